@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ZaguanLabs/chatty/internal"
+	"github.com/ZaguanLabs/chatty/internal/serve"
+)
+
+// handleAPICommand answers one JSON request read from stdin and writes the
+// answer to stdout as JSON lines, for editor plugins that shell out to chatty.
+// The request and events are those of ./chatty serve.
+func handleAPICommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("api", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Read a JSON request from stdin and write JSON-lines events to stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty api --json < request.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 || !*jsonFlag {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	fail := func(err error) {
+		out.Encode(serve.Event{Type: "error", Error: err.Error()})
+		os.Exit(1)
+	}
+
+	var req serve.Request
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fail(fmt.Errorf("invalid request: %w", err))
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fail(fmt.Errorf("failed to load configuration: %w", err))
+	}
+	client, err := internal.NewClientFromConfig(cfg)
+	if err != nil {
+		fail(fmt.Errorf("failed to create secure client: %w", err))
+	}
+	server, err := serve.New(client, cfg, serve.Options{})
+	if err != nil {
+		fail(err)
+	}
+
+	// The plugin stops a request by signalling the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = server.Stream(ctx, req, func(event serve.Event) error {
+		return out.Encode(event)
+	})
+	if err != nil {
+		stop()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ZaguanLabs/chatty/internal/audit"
+)
+
+// handleAuditCommand checks the hash chain of the audit log.
+func handleAuditCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty audit verify [path]\n")
+		fmt.Fprintf(os.Stderr, "The path defaults to logging.audit_file.\n")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 || fs.Arg(0) != "verify" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	path := fs.Arg(1)
+	if path == "" {
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+			os.Exit(1)
+		}
+		if cfg.Logging.AuditFile == "" {
+			fmt.Fprintf(os.Stderr, "Error: no audit log configured; set logging.audit_file or pass a path\n")
+			os.Exit(1)
+		}
+		path = cfg.Logging.AuditFile
+	}
+
+	entries, err := audit.Verify(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %d entries, chain intact\n", path, entries)
+}
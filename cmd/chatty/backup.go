@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal/storage"
+	"golang.org/x/term"
+)
+
+// handleBackupCommand copies the conversation database to a file, or into a
+// directory under a timestamped name.
+func handleBackupCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty backup <file|directory>\n")
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	dest := fs.Arg(0)
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		dest = filepath.Join(dest, fmt.Sprintf("chatty-%s.db", time.Now().Format("20060102-150405")))
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Storage.Path == "disable" {
+		fmt.Fprintf(os.Stderr, "Error: storage is disabled, there is nothing to back up\n")
+		os.Exit(1)
+	}
+	if storage.IsMemoryPath(cfg.Storage.Path) {
+		fmt.Fprintf(os.Stderr, "Error: the history is kept in memory only, there is nothing to back up\n")
+		os.Exit(1)
+	}
+	store, err := storage.OpenConfig(cfg.Storage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to open storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	if err := store.Backup(context.Background(), dest); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: backup failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Backed up conversation history to %s.\n", dest)
+}
+
+// handleSnapshotCommand copies the conversation database over a file, such
+// as one in a Dropbox or Syncthing folder, each time it is run.
+func handleSnapshotCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty snapshot <file.db>\n")
+		fmt.Fprintf(os.Stderr, "Writes a consistent copy of the database, replacing the file if it exists.\n")
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Storage.Path == "disable" {
+		fmt.Fprintf(os.Stderr, "Error: storage is disabled, there is nothing to snapshot\n")
+		os.Exit(1)
+	}
+	if storage.IsMemoryPath(cfg.Storage.Path) {
+		fmt.Fprintf(os.Stderr, "Error: the history is kept in memory only, there is nothing to snapshot\n")
+		os.Exit(1)
+	}
+	store, err := storage.OpenConfig(cfg.Storage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to open storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	if err := store.Snapshot(context.Background(), fs.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: snapshot failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote a snapshot of the conversation history to %s.\n", fs.Arg(0))
+}
+
+// handleRestoreCommand replaces the conversation database with a backup,
+// keeping the current one next to it.
+func handleRestoreCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	yesFlag := fs.Bool("yes", false, "Replace the current history without asking")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty restore [--yes] <file>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	src := fs.Arg(0)
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Storage.Path == "disable" {
+		fmt.Fprintf(os.Stderr, "Error: storage is disabled, nowhere to restore to\n")
+		os.Exit(1)
+	}
+	if storage.IsMemoryPath(cfg.Storage.Path) {
+		fmt.Fprintf(os.Stderr, "Error: the history is kept in memory only, nowhere to restore to\n")
+		os.Exit(1)
+	}
+	if cfg.Storage.Driver == storage.DriverPostgres {
+		fmt.Fprintf(os.Stderr, "Error: the history is on a Postgres server; restore it with pg_restore\n")
+		os.Exit(1)
+	}
+
+	if !*yesFlag && !assumeYes {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Fprintf(os.Stderr, "Error: restoring replaces the current history; pass --yes to confirm\n")
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Replace the current conversation history with %s? Quit any running chatty first. [y/N] ", src)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Fprintln(os.Stderr, "Not restored.")
+			os.Exit(1)
+		}
+	}
+
+	saved, err := storage.Restore(context.Background(), src, cfg.Storage.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: restore failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Restored conversation history from %s.\n", src)
+	if saved != "" {
+		fmt.Printf("The previous history was saved to %s.\n", saved)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ZaguanLabs/chatty/internal"
+	"github.com/ZaguanLabs/chatty/internal/config"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+// handleBatchCommand submits prompts to the provider's batch API and
+// downloads finished batches into a saved session.
+func handleBatchCommand(configPath string, args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty batch submit [--model name] prompts.jsonl\n")
+		fmt.Fprintf(os.Stderr, "       ./chatty batch fetch <batch-id>\n")
+		fmt.Fprintf(os.Stderr, "Each line of prompts.jsonl is {\"prompt\": \"...\"} or {\"messages\": [...]}, with an optional \"id\".\n")
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "submit":
+		handleBatchSubmit(configPath, args[1:], usage)
+	case "fetch":
+		handleBatchFetch(configPath, args[1:], usage)
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
+
+func handleBatchSubmit(configPath string, args []string, usage func()) {
+	fs := flag.NewFlagSet("batch submit", flag.ExitOnError)
+	modelFlag := fs.String("model", "", "Model to run the prompts against (default: model.name)")
+	fs.Usage = usage
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+		os.Exit(1)
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	prompts, err := internal.ParseBatchPrompts(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", fs.Arg(0), err)
+		os.Exit(1)
+	}
+
+	cfg, client := batchClient(configPath)
+	model := cfg.Model.Name
+	if *modelFlag != "" {
+		model = *modelFlag
+	}
+
+	batch, err := client.SubmitBatch(context.Background(), prompts, model, cfg.Model.Temperature, internal.RequestOptionsForModel(cfg, model))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to submit batch: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Submitted %d prompts to %s as batch %s (%s).\n", len(prompts), model, batch.ID, batch.Status)
+	fmt.Printf("Results are usually ready within 24 hours. Fetch them with:\n\n  ./chatty batch fetch %s\n", batch.ID)
+}
+
+func handleBatchFetch(configPath string, args []string, usage func()) {
+	if len(args) != 1 {
+		usage()
+		os.Exit(1)
+	}
+
+	cfg, client := batchClient(configPath)
+	ctx := context.Background()
+
+	batch, err := client.GetBatch(ctx, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to get batch: %v\n", err)
+		os.Exit(1)
+	}
+	if batch.Status != "completed" {
+		fmt.Printf("Batch %s is %s: %d of %d requests done, %d failed.\n", batch.ID, batch.Status,
+			batch.RequestCounts.Completed+batch.RequestCounts.Failed, batch.RequestCounts.Total, batch.RequestCounts.Failed)
+		switch batch.Status {
+		case "failed", "expired", "cancelled":
+			os.Exit(1)
+		}
+		return
+	}
+
+	results, err := client.BatchResults(ctx, batch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cfg.Storage.Path == "disable" {
+		fmt.Fprintf(os.Stderr, "Error: storage is disabled, nowhere to save the results\n")
+		os.Exit(1)
+	}
+	store, err := storage.OpenConfig(cfg.Storage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to open storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	var messages []storage.Message
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", result.ID, result.Err)
+			failed++
+			continue
+		}
+		for _, msg := range result.Messages {
+			messages = append(messages, storage.Message{Role: msg.Role, Content: msg.Content})
+		}
+		messages = append(messages, storage.Message{Role: "assistant", Content: result.Response})
+	}
+	if len(messages) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no request in batch %s succeeded\n", batch.ID)
+		os.Exit(1)
+	}
+
+	sessionID, err := store.CreateSession(ctx, "Batch "+batch.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create session: %v\n", err)
+		os.Exit(1)
+	}
+	if err := store.AppendMessagesBatch(ctx, sessionID, messages); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to save results: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Saved %d results from batch %s to session #%d", len(results)-failed, batch.ID, sessionID)
+	if failed > 0 {
+		fmt.Printf(" (%d failed)", failed)
+	}
+	fmt.Println(".")
+}
+
+func batchClient(configPath string) (*config.Config, *internal.Client) {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	client, err := internal.NewClientFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create secure client: %v\n", err)
+		os.Exit(1)
+	}
+	return cfg, client
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal"
+)
+
+// handleCompareCommand sends the same prompt to several models concurrently and
+// prints each response under a labelled header.
+func handleCompareCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	modelsFlag := fs.String("models", "", "Comma-separated list of models to compare")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty compare --models model1,model2 \"prompt\"\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	prompt := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if prompt == "" || strings.TrimSpace(*modelsFlag) == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	models, err := internal.ParseModelList(*modelsFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := internal.NewClientFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create secure client: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Request)
+	defer cancel()
+
+	messages := []internal.Message{{Role: "user", Content: prompt}}
+	results := client.ChatModels(ctx, messages, models, cfg.Model.Temperature, func(model string) internal.RequestOptions {
+		return internal.RequestOptionsForModel(cfg, model)
+	})
+
+	failed := 0
+	for i, result := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("=== %s (%.1fs) ===\n", result.Model, result.Duration.Seconds())
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr, "Error from %s: %v\n", result.Model, result.Err)
+			failed++
+			continue
+		}
+		fmt.Println(strings.TrimSpace(result.Response))
+	}
+
+	if failed == len(results) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ZaguanLabs/chatty/internal/storage"
+	"github.com/ZaguanLabs/chatty/internal/ui"
+)
+
+// handleContextCommand manages the named context snippets that /use adds to
+// a conversation, so a spec or style guide is saved once instead of pasted
+// into every session.
+func handleContextCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("context", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty context save <name> <file|->\n")
+		fmt.Fprintf(os.Stderr, "       ./chatty context list\n")
+		fmt.Fprintf(os.Stderr, "       ./chatty context show <name>\n")
+		fmt.Fprintf(os.Stderr, "       ./chatty context delete <name>\n")
+		fmt.Fprintf(os.Stderr, "Saved snippets are added to a conversation with /use <name>.\n")
+	}
+	fs.Parse(args)
+
+	want := map[string]int{"save": 3, "list": 1, "show": 2, "delete": 2}
+	if n, ok := want[fs.Arg(0)]; !ok || fs.NArg() != n {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// Read the file before opening the store so a typo fails fast
+	var content string
+	if fs.Arg(0) == "save" {
+		if err := storage.ValidateSnippetName(fs.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		var data []byte
+		var err error
+		if fs.Arg(2) == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(fs.Arg(2))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		content = string(data)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Storage.Path == "disable" {
+		fmt.Fprintf(os.Stderr, "Error: storage is disabled, nowhere to keep snippets\n")
+		os.Exit(1)
+	}
+	if storage.IsMemoryPath(cfg.Storage.Path) {
+		fmt.Fprintf(os.Stderr, "Error: the history is kept in memory only, snippets would not outlive this command\n")
+		os.Exit(1)
+	}
+	store, err := storage.OpenConfig(cfg.Storage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to open storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	switch fs.Arg(0) {
+	case "save":
+		err = store.SaveSnippet(ctx, fs.Arg(1), content)
+		if err == nil {
+			fmt.Printf("Saved snippet %q (%d bytes). Add it to a conversation with /use %s\n", fs.Arg(1), len(content), fs.Arg(1))
+		}
+	case "list":
+		var snippets []storage.Snippet
+		snippets, err = store.ListSnippets(ctx)
+		if err == nil && len(snippets) == 0 {
+			fmt.Println("No snippets saved.")
+		}
+		for _, snippet := range snippets {
+			fmt.Printf("%-24s %8d bytes  %s\n", snippet.Name, len(snippet.Content), ui.FormatDateTime(snippet.UpdatedAt))
+		}
+	case "show":
+		var snippet *storage.Snippet
+		snippet, err = store.GetSnippet(ctx, fs.Arg(1))
+		if err == nil {
+			fmt.Print(snippet.Content)
+		}
+	case "delete":
+		err = store.DeleteSnippet(ctx, fs.Arg(1))
+		if err == nil {
+			fmt.Printf("Deleted snippet %q.\n", fs.Arg(1))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal/config"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+// handleDBCommand maintains the conversation database: it checks it for
+// damage, rebuilds it to reclaim space and refreshes its statistics, or
+// salvages the sessions of a damaged one.
+func handleDBCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("db", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty db maintain\n")
+		fmt.Fprintf(os.Stderr, "       ./chatty db recover [--out file]\n")
+		fmt.Fprintf(os.Stderr, "maintain runs an integrity check, VACUUM and ANALYZE, and reports sizes and counts.\n")
+		fmt.Fprintf(os.Stderr, "recover copies the sessions that can still be read from a damaged database into a new one.\n")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || (fs.Arg(0) != "maintain" && fs.Arg(0) != "recover") || (fs.Arg(0) == "maintain" && fs.NArg() != 1) {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Storage.Path == "disable" {
+		fmt.Fprintf(os.Stderr, "Error: storage is disabled, there is no database to maintain\n")
+		os.Exit(1)
+	}
+	if storage.IsMemoryPath(cfg.Storage.Path) {
+		fmt.Fprintf(os.Stderr, "Error: the history is kept in memory only, there is no database to maintain\n")
+		os.Exit(1)
+	}
+	if fs.Arg(0) == "recover" {
+		handleDBRecover(cfg.Storage, fs.Args()[1:], fs.Usage)
+		return
+	}
+	store, err := storage.OpenConfig(cfg.Storage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to open storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	report, err := store.Maintain(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Sessions: %d, messages: %d, attachments: %d, embeddings: %d, snippets: %d\n",
+		report.Sessions, report.Messages, report.Attachments, report.Embeddings, report.Snippets)
+	if len(report.Problems) > 0 {
+		fmt.Println("Integrity check: FAILED")
+		for _, problem := range report.Problems {
+			fmt.Printf("  %s\n", problem)
+		}
+		fmt.Printf("Size: %s. The database was left as it is; restore a backup with ./chatty restore or salvage it with ./chatty db recover.\n", formatBytes(report.SizeBefore))
+		os.Exit(1)
+	}
+
+	// ANALYZE's statistics can outweigh the space a tidy database reclaims
+	reclaimed := max(report.SizeBefore-report.SizeAfter, 0)
+	fmt.Println("Integrity check: ok")
+	fmt.Printf("Size: %s -> %s (%s reclaimed)\n", formatBytes(report.SizeBefore), formatBytes(report.SizeAfter), formatBytes(reclaimed))
+	if len(report.Indexes) > 0 {
+		fmt.Println("Indexes:")
+	}
+	for _, index := range report.Indexes {
+		fmt.Printf("  %-32s on %-20s %8d entries, %d rows per key\n", index.Name, index.Table, index.Entries, index.RowsPerKey)
+	}
+}
+
+// handleDBRecover salvages the readable sessions of a damaged SQLite
+// database, into the file given with --out or in place of the damaged one.
+func handleDBRecover(storageCfg config.StorageConfig, args []string, usage func()) {
+	fs := flag.NewFlagSet("db recover", flag.ExitOnError)
+	out := fs.String("out", "", "Write the salvaged sessions to this new file and leave the database as it is")
+	fs.Usage = usage
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		usage()
+		os.Exit(1)
+	}
+	if storageCfg.Driver == storage.DriverPostgres {
+		fmt.Fprintf(os.Stderr, "Error: the history is on a Postgres server; recover it with the server's own tools\n")
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	var (
+		report  *storage.SalvageReport
+		damaged string
+		err     error
+	)
+	if *out != "" {
+		report, err = storage.Salvage(ctx, storageCfg.Path, *out)
+	} else {
+		damaged, report, err = storage.Recover(ctx, storageCfg.Path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Salvaged %d sessions with %d messages.\n", report.Sessions, report.Messages)
+	if len(report.Lost) > 0 {
+		ids := make([]string, len(report.Lost))
+		for i, id := range report.Lost {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+		fmt.Printf("Lost %d sessions that could not be read: %s\n", len(report.Lost), strings.Join(ids, ", "))
+	}
+	if *out != "" {
+		fmt.Printf("Wrote %s; the damaged database was left as it is.\n", *out)
+		return
+	}
+	fmt.Printf("The damaged database was kept as %s.\n", damaged)
+}
+
+// formatBytes formats a size in bytes with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
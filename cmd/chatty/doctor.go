@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ZaguanLabs/chatty/internal"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+// handleDoctorCommand checks the configuration, the API endpoint and the
+// database, printing one line per check. It exits non-zero if any fails.
+func handleDoctorCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty doctor\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	failed := false
+	report := func(ok bool, format string, args ...interface{}) {
+		status := "ok  "
+		if !ok {
+			status = "FAIL"
+			failed = true
+		}
+		fmt.Printf("[%s] %s\n", status, fmt.Sprintf(format, args...))
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		report(false, "configuration: %v", err)
+		os.Exit(1)
+	}
+	report(true, "configuration loaded (API %s, model %s)", cfg.API.URL, cfg.Model.Name)
+
+	client, err := internal.NewClientFromConfig(cfg)
+	if err != nil {
+		report(false, "client: %v", err)
+		os.Exit(1)
+	}
+
+	result, err := client.Ping(context.Background())
+	if err != nil {
+		report(false, "API endpoint: %v", err)
+	} else {
+		report(true, "API endpoint reachable in %dms, key accepted, %d models listed",
+			result.Latency.Milliseconds(), len(result.Models))
+
+		models := []string{cfg.Model.Name}
+		for _, fallback := range cfg.Model.Fallbacks {
+			if fallback.URL == "" || fallback.URL == cfg.API.URL {
+				models = append(models, fallback.Name)
+			}
+		}
+		for _, model := range models {
+			switch {
+			case len(result.Models) == 0:
+				// Some gateways return an empty list; nothing to check against
+			case result.HasModel(model):
+				report(true, "model %s is available", model)
+			default:
+				report(false, "model %s is not listed by the API", model)
+			}
+		}
+
+		// Probe again so the cache reflects what the endpoint supports now
+		if features, err := client.ProbeFeatures(context.Background(), cfg.Model.Name); err != nil {
+			report(false, "feature probe: %v", err)
+		} else {
+			report(true, "features of %s: %s", cfg.Model.Name, features)
+			if path, err := internal.DefaultFeatureCachePath(); err == nil {
+				_ = internal.SaveFeatures(path, features)
+			}
+		}
+	}
+
+	if cfg.Storage.Path == "disable" {
+		report(true, "storage disabled")
+	} else if store, err := storage.OpenConfig(cfg.Storage); err != nil {
+		report(false, "storage: %v", err)
+	} else {
+		store.Close()
+		report(true, "storage opened")
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+// handleExportCommand writes a saved conversation as a Markdown, JSON or HTML
+// transcript to stdout or a file.
+func handleExportCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	formatFlag := fs.String("format", "", "Transcript format: md, json or html (default: from the output file extension, else md)")
+	outputFlag := fs.String("o", "", "File to write instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty export <session-id> [--format md|json|html] [-o file]\n")
+		fs.PrintDefaults()
+	}
+	// Flags may come before or after the session ID
+	fs.Parse(args)
+	var positional []string
+	for fs.NArg() > 0 {
+		positional = append(positional, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	sessionID, err := strconv.ParseInt(positional[0], 10, 64)
+	if err != nil || sessionID <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid session ID: %s\n", positional[0])
+		os.Exit(1)
+	}
+
+	format := *formatFlag
+	if format == "" {
+		format = storage.ExportFormatFor(*outputFlag)
+	}
+	if format == "" {
+		format = storage.FormatMarkdown
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	store, err := storage.OpenConfig(cfg.Storage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to open storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	if err := unlockSession(context.Background(), store, sessionID); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var out io.Writer = os.Stdout
+	var file *os.File
+	if *outputFlag != "" {
+		file, err = os.OpenFile(*outputFlag, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		out = file
+	}
+
+	err = store.ExportTranscript(context.Background(), sessionID, format, out)
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(*outputFlag)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: export failed: %v\n", err)
+		os.Exit(1)
+	}
+	if file != nil {
+		fmt.Fprintf(os.Stderr, "Exported session #%d to %s.\n", sessionID, *outputFlag)
+	}
+}
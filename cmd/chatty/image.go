@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal"
+	"github.com/ZaguanLabs/chatty/internal/ui"
+	"golang.org/x/term"
+)
+
+// handleImageCommand generates an image from a prompt, saves it to disk and
+// previews it inline when the terminal supports it.
+func handleImageCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("image", flag.ExitOnError)
+	modelFlag := fs.String("model", "", "Image model (default images.model)")
+	sizeFlag := fs.String("size", "", "Image size such as 1024x1024 (default images.size)")
+	outFlag := fs.String("out", "", "Directory to save the image in (default images.output_dir or the current directory)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty image [--size 1024x1024] [--out dir] \"prompt\"\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	prompt := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if prompt == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	model, size, dir := cfg.Images.Model, cfg.Images.Size, cfg.Images.OutputDir
+	if *modelFlag != "" {
+		model = *modelFlag
+	}
+	if *sizeFlag != "" {
+		size = *sizeFlag
+	}
+	if *outFlag != "" {
+		dir = *outFlag
+	}
+
+	client, err := internal.NewClientFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create secure client: %v\n", err)
+		os.Exit(1)
+	}
+
+	data, err := client.GenerateImage(context.Background(), model, prompt, size)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	path, err := internal.SaveImage(data, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Print(ui.InlineImage(data))
+	}
+	fmt.Println(path)
+}
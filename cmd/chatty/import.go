@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+// handleImportCommand stores the conversations of a ChatGPT or chatty export
+// as local sessions, skipping any that were imported before.
+func handleImportCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty import <file>\n")
+		fmt.Fprintf(os.Stderr, "  <file> is ChatGPT's conversations.json, or a chatty .chatty or JSON export\n")
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	path := fs.Arg(0)
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	sessions, err := storage.ReadExport(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	store, err := storage.OpenConfig(cfg.Storage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to open storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	result, err := store.ImportSessions(context.Background(), sessions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: import failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, failure := range result.Failed {
+		fmt.Fprintf(os.Stderr, "Skipped %v\n", failure)
+	}
+	ids := make([]string, len(result.Imported))
+	for i, id := range result.Imported {
+		ids[i] = fmt.Sprintf("#%d", id)
+	}
+	fmt.Printf("Imported %d of %d conversations from %s", len(result.Imported), len(sessions), path)
+	if len(ids) > 0 {
+		fmt.Printf(" as %s", strings.Join(ids, ", "))
+	}
+	fmt.Println(".")
+	if result.Duplicates > 0 {
+		fmt.Printf("%d already imported, skipped.\n", result.Duplicates)
+	}
+	if len(result.Failed) > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -14,7 +17,9 @@ import (
 	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
 	"github.com/ZaguanLabs/chatty/internal/storage"
 	"github.com/ZaguanLabs/chatty/internal/tui"
+	"github.com/ZaguanLabs/chatty/internal/ui"
 	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/term"
 )
 
 var (
@@ -23,7 +28,107 @@ var (
 	date    = "unknown"
 )
 
-// handleDirectQuestion processes a direct question from command line arguments
+// cliOverrides holds command-line flags that override configuration values.
+type cliOverrides struct {
+	seed        *int
+	logprobs    bool
+	topLogprobs int
+	debug       bool
+	plain       bool
+	ephemeral   bool
+	db          string
+	quiet       bool
+	user        string
+	metadata    map[string]string
+}
+
+var overrides cliOverrides
+
+// dryRun prints the assembled request instead of sending it in direct mode.
+var dryRun bool
+
+// continueLast reopens the last active session in the TUI.
+var continueLast bool
+
+// teePath streams the direct-mode answer to this file as well as the terminal.
+var teePath string
+
+// assumeYes sends direct questions above model.confirm_cost_above without asking.
+var assumeYes bool
+
+// loadConfig loads the configuration and applies command-line overrides.
+func loadConfig(configPath string) (*config.Config, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if overrides.seed != nil {
+		cfg.Model.Seed = overrides.seed
+	}
+	if overrides.topLogprobs < 0 || overrides.topLogprobs > 20 {
+		return nil, fmt.Errorf("--top-logprobs must be between 0 and 20, got %d", overrides.topLogprobs)
+	}
+	if overrides.logprobs || overrides.topLogprobs > 0 {
+		cfg.Model.Logprobs = true
+	}
+	if overrides.topLogprobs > 0 {
+		cfg.Model.TopLogprobs = overrides.topLogprobs
+	}
+	if overrides.user != "" {
+		cfg.API.User = overrides.user
+	}
+	if len(overrides.metadata) > 0 {
+		metadata := make(map[string]string, len(cfg.API.Metadata)+len(overrides.metadata))
+		for key, value := range cfg.API.Metadata {
+			metadata[key] = value
+		}
+		for key, value := range overrides.metadata {
+			metadata[key] = value
+		}
+		cfg.API.Metadata = metadata
+	}
+	if overrides.user != "" || len(overrides.metadata) > 0 {
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if overrides.plain {
+		cfg.UI.RenderMath = false
+	}
+	if overrides.quiet {
+		cfg.UI.ShowWelcome = false
+	}
+	if overrides.db != "" && overrides.ephemeral {
+		return nil, fmt.Errorf("--db and --ephemeral cannot be used together")
+	}
+	if overrides.db != "" {
+		cfg.Storage.Path = overrides.db
+		cfg.Storage.Driver = storage.DriverSQLite
+	}
+	if overrides.ephemeral {
+		cfg.Storage.Path = storage.MemoryPath
+		cfg.Storage.Driver = storage.DriverSQLite
+	}
+	if overrides.debug && cfg.Logging.DebugFile == "" {
+		path, err := internal.DefaultDebugLogPath()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Logging.DebugFile = path
+	}
+
+	ui.SetDisplayNames(cfg.UI.UserName, cfg.UI.UserAvatar, cfg.UI.AssistantName, cfg.UI.AssistantAvatar)
+	if err := ui.SetTimeFormat(cfg.UI.TimestampFormat, cfg.UI.Timezone); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// handleDirectQuestion processes a direct question from command line arguments.
+// Several questions separated by --and are answered one after another, each
+// under its own header. It never opens the history database or builds a
+// markdown renderer, so a one-shot question starts as quickly as possible.
 func handleDirectQuestion(configPath string, args []string) {
 	// Check if this is a command (starts with /)
 	if len(args) > 0 && strings.HasPrefix(args[0], "/") {
@@ -31,41 +136,207 @@ func handleDirectQuestion(configPath string, args []string) {
 		return
 	}
 
-	// Join all arguments into a single question
-	question := strings.Join(args, " ")
+	questions, err := directQuestions(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Load configuration securely
-	cfg, err := config.Load(configPath)
+	cfg, err := loadConfig(configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Build every request first, so nothing is sent before all of them are checked
+	conversations := make([][]internal.Message, len(questions))
+	for i, question := range questions {
+		conversations[i] = []internal.Message{
+			{Role: "user", Content: question},
+		}
+		if templateName != "" {
+			if conversations[i], err = templateMessages(cfg, question); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if dryRun {
+		// The payload goes to stdout so it can be piped into jq or curl
+		for _, messages := range conversations {
+			payload, err := internal.RequestPayload(messages, cfg.Model.Name, cfg.Model.Temperature, false, internal.RequestOptionsFromConfig(cfg))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "POST %s/chat/completions (not sent, ~%d prompt tokens)\n",
+				strings.TrimSuffix(cfg.API.URL, "/"), internal.EstimateMessageTokens(messages))
+			fmt.Println(string(payload))
+		}
+		return
+	}
+
+	for _, messages := range conversations {
+		if cost, over := internal.CostNeedsConfirmation(cfg, messages, internal.RequestOptionsFromConfig(cfg)); over && !assumeYes {
+			if err := confirmCost(cost, cfg.Model.ConfirmCostAbove); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
 	// Create API client securely
-	client, err := internal.NewSecureClient(cfg.API.Key, cfg.API.URL)
+	client, err := internal.NewClientFromConfig(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to create secure client: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
-	// Create message with the question
-	messages := []internal.Message{
-		{Role: "user", Content: question},
+	var tee *os.File
+	if teePath != "" {
+		// Stream the answer to the terminal and the file as it arrives
+		tee, err = os.OpenFile(teePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to open tee file: %v\n", err)
+			os.Exit(1)
+		}
+		defer tee.Close()
 	}
 
-	// Get response from API
-	response, err := client.Chat(ctx, messages, cfg.Model.Name, cfg.Model.Temperature)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	failed := false
+	for i, messages := range conversations {
+		if len(conversations) > 1 {
+			header := fmt.Sprintf("=== Question %d of %d: %s ===\n\n", i+1, len(conversations), questions[i])
+			if i > 0 {
+				header = "\n\n" + header
+			}
+			fmt.Print(header)
+			if tee != nil {
+				fmt.Fprint(tee, header)
+			}
+		}
+		if err := answerDirectQuestion(cfg, client, messages, tee); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed = true
+		}
+	}
+	if failed {
 		os.Exit(1)
 	}
+}
 
-	// Output the response directly
-	fmt.Print(response)
+// directQuestions splits the arguments of a direct question at each --and.
+// A single "-" reads the questions from stdin instead, separated by lines
+// that only contain --and.
+func directQuestions(args []string) ([]string, error) {
+	if len(args) == 1 && args[0] == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("read questions: %w", err)
+		}
+		args = nil
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(line) == "--and" {
+				args = append(args, "--and")
+			} else {
+				args = append(args, line)
+			}
+		}
+		return splitQuestions(args, "\n")
+	}
+	return splitQuestions(args, " ")
+}
+
+func splitQuestions(args []string, sep string) ([]string, error) {
+	var questions []string
+	var current []string
+	finish := func() error {
+		question := strings.TrimSpace(strings.Join(current, sep))
+		// A template is a complete question on its own
+		if question == "" && (templateName == "" || len(args) > 0) {
+			return errors.New("empty question: put a question on each side of --and")
+		}
+		questions = append(questions, question)
+		current = nil
+		return nil
+	}
+	for _, arg := range args {
+		if arg != "--and" {
+			current = append(current, arg)
+			continue
+		}
+		if err := finish(); err != nil {
+			return nil, err
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
+
+// answerDirectQuestion prints the answer to one direct question, streaming it
+// to tee as well when set.
+func answerDirectQuestion(cfg *config.Config, client *internal.Client, messages []internal.Message, tee io.Writer) error {
+	var response string
+	var err error
+	start := time.Now()
+	if tee != nil {
+		// The client ends the stream if the provider goes quiet for timeouts.stream
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var collected strings.Builder
+		sink := internal.Tee(internal.WriterSink(os.Stdout), internal.WriterSink(tee), internal.WriterSink(&collected))
+		err = client.ChatStreamEvents(ctx, messages, cfg.Model.Name, cfg.Model.Temperature, internal.RequestOptionsFromConfig(cfg), sink.Events())
+		if err != nil {
+			// End the partial answer before the error
+			fmt.Println()
+			return err
+		}
+		response = collected.String()
+	} else {
+		// Create context with timeout
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Request)
+		defer cancel()
+
+		// Get response from API
+		response, err = client.ChatWithOptions(ctx, messages, cfg.Model.Name, cfg.Model.Temperature, internal.RequestOptionsFromConfig(cfg))
+		if err != nil {
+			return err
+		}
+
+		// Output the response directly
+		if cfg.UI.RenderMath {
+			fmt.Print(ui.RenderMath(response))
+		} else {
+			fmt.Print(response)
+		}
+	}
+
+	answeredBy := client.LastModel()
+	if answeredBy != cfg.Model.Name {
+		fmt.Fprintf(os.Stderr, "\n(answered by fallback model %s)\n", answeredBy)
+	}
+
+	// Metadata goes to stderr so the answer itself stays pipeable
+	if cfg.UI.ShowResponseMeta {
+		pricing := cfg.Model.Pricing
+		if answeredBy != cfg.Model.Name {
+			pricing = nil
+		}
+		meta := internal.NewResponseMeta(answeredBy, client.LastUsage(), messages, response, time.Since(start), pricing)
+		fmt.Fprintf(os.Stderr, "\n%s\n", meta)
+	}
+
+	// Logprobs go to stderr so the answer itself stays pipeable
+	if cfg.Model.Logprobs {
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprint(os.Stderr, internal.FormatLogprobs(client.LastLogprobs(), 0))
+	}
+	return nil
 }
 
 // handleCLICommand processes slash commands in CLI mode
@@ -74,7 +345,7 @@ func handleCLICommand(configPath string, args []string) {
 	commandArgs := args[1:]
 
 	// Load configuration for commands that need it
-	cfg, err := config.Load(configPath)
+	cfg, err := loadConfig(configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
 		os.Exit(1)
@@ -84,7 +355,7 @@ func handleCLICommand(configPath string, args []string) {
 	case "/help":
 		showCLIHelp()
 	case "/list", "/sessions":
-		handleListCommand(cfg)
+		handleListCommand(cfg, commandArgs)
 	case "/load":
 		if len(commandArgs) == 0 {
 			fmt.Fprintf(os.Stderr, "Usage: ./chatty /load <session-id>\n")
@@ -118,35 +389,103 @@ func showCLIHelp() {
 	fmt.Println("Direct Questions:")
 	fmt.Println("  ./chatty \"What is an LLM?\"           Ask a question directly")
 	fmt.Println("  ./chatty \"Explain Go in detail\"       Multi-word questions")
+	fmt.Println("  ./chatty \"q1\" --and \"q2\"              Ask several questions in one run")
+	fmt.Println("  ./chatty - < questions.txt             Read questions separated by --and lines")
+	fmt.Println("  ./chatty sweep --temps 0,0.5,1 \"q\"    Compare answers across temperatures")
+	fmt.Println("  ./chatty compare --models a,b \"q\"     Ask several models at once")
+	fmt.Println("  ./chatty image \"a red fox in snow\"    Generate an image and save it to disk")
+	fmt.Println("  ./chatty batch submit prompts.jsonl    Run many prompts through the batch API")
+	fmt.Println("  ./chatty batch fetch <batch-id>        Save a finished batch as a session")
 	fmt.Println()
 	fmt.Println("Session Management:")
 	fmt.Println("  ./chatty /list                         List saved conversations")
+	fmt.Println("  ./chatty /list --all                   Include archived conversations")
+	fmt.Println("  ./chatty /list --name text --sort created|messages --updated-after YYYY-MM-DD")
+	fmt.Println("                                         Filter and sort; ./chatty /list --help lists all options")
 	fmt.Println("  ./chatty /sessions                     Alias for /list")
 	fmt.Println("  ./chatty /load <id>                    Load a saved conversation")
+	fmt.Println("  ./chatty new --template <name>         Start a conversation from a session template")
+	fmt.Println("  ./chatty --continue                    Reopen the conversation you last worked in")
+	fmt.Println("  ./chatty share <id>                    Share a conversation read-only on the LAN")
+	fmt.Println("  ./chatty export <id> --format md       Print a transcript as md, json or html")
+	fmt.Println("  ./chatty import <file>                 Import ChatGPT's conversations.json or a chatty export")
+	fmt.Println("  ./chatty backup <file|dir>             Copy the conversation database")
+	fmt.Println("  ./chatty snapshot <file.db>            Copy the database over a file, e.g. in a synced folder")
+	fmt.Println("  ./chatty restore <file>                Replace the conversation database with a backup")
+	fmt.Println("  ./chatty db maintain                   Check, compact and analyze the database")
+	fmt.Println("  ./chatty db recover [--out file]       Salvage the readable sessions of a damaged database")
+	fmt.Println("  ./chatty stats                         Show sessions, messages and tokens by model and month")
+	fmt.Println("  ./chatty context save <name> <file>    Save a context snippet for /use <name>")
+	fmt.Println("  ./chatty context list|show|delete      Manage saved context snippets")
 	fmt.Println()
 	fmt.Println("Other Commands:")
 	fmt.Println("  ./chatty /help                         Show this help")
+	fmt.Println("  ./chatty doctor                        Check the configuration, API and storage")
+	fmt.Println("  ./chatty audit verify [path]           Check the audit log for tampering")
 	fmt.Println("  ./chatty /exit                         Exit (no-op in CLI mode)")
 	fmt.Println()
 	fmt.Println("Interactive Mode:")
 	fmt.Println("  ./chatty                               Start interactive TUI session")
 	fmt.Println("  ./chatty --config <path>               Use custom config file")
+	fmt.Println("  ./chatty ssh [--addr :2323]            Serve the TUI over SSH to authorized keys")
+	fmt.Println("  ./chatty serve [--token secret]        Stream answers over SSE and WebSocket")
+	fmt.Println("  ./chatty api --json < request.json     Answer one JSON request as JSON lines")
+	fmt.Println("  ./chatty --dry-run \"q\"                 Print the JSON payload without sending it")
+	fmt.Println("  ./chatty --tee out.md \"q\"              Stream the answer to a file as well")
+	fmt.Println("  ./chatty --yes \"q\"                     Skip the confirmation for expensive requests")
+	fmt.Println("  ./chatty --template name --var k=v     Ask using a prompt template")
+	fmt.Println("  ./chatty --debug                       Log API traffic to a debug file")
+	fmt.Println("  ./chatty --plain                       Leave LaTeX math in answers raw")
+	fmt.Println("  ./chatty --ephemeral                   Keep history in memory, never on disk")
+	fmt.Println("  ./chatty --db <file>                   Use another database file for this run")
+	fmt.Println("  ./chatty --quiet                       Start without the welcome banner")
+	fmt.Println()
+	fmt.Println("Sampling Flags:")
+	fmt.Println("  --seed <n>                             Sampling seed for reproducible outputs")
+	fmt.Println("  --logprobs                             Report token log probabilities")
+	fmt.Println("  --top-logprobs <n>                     Alternatives per token (0-20)")
+	fmt.Println()
+	fmt.Println("Attribution Flags:")
+	fmt.Println("  --user <id>                            User identifier sent with each request")
+	fmt.Println("  --metadata key=value                   Request metadata (repeatable)")
 	fmt.Println()
 	fmt.Println("For more commands, use interactive mode with './chatty'")
 }
 
-// handleListCommand lists saved sessions
-func handleListCommand(cfg *config.Config) {
+// handleListCommand lists saved sessions, including archived ones when all
+// is set
+func handleListCommand(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	all := fs.Bool("all", false, "Include archived conversations")
+	name := fs.String("name", "", "Only conversations whose name contains this text")
+	sortBy := fs.String("sort", storage.SortUpdated, "Sort by updated, created or messages, largest first")
+	limit := fs.Int("limit", 0, "List at most this many conversations (0 = all)")
+	var filter storage.SessionFilter
+	fs.Func("created-after", "Only conversations started on or after this date (YYYY-MM-DD or RFC 3339)", listDateFlag(&filter.CreatedAfter))
+	fs.Func("created-before", "Only conversations started before this date", listDateFlag(&filter.CreatedBefore))
+	fs.Func("updated-after", "Only conversations updated on or after this date", listDateFlag(&filter.UpdatedAfter))
+	fs.Func("updated-before", "Only conversations updated before this date", listDateFlag(&filter.UpdatedBefore))
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty /list [--all] [--name text] [--created-after date] [--created-before date]\n")
+		fmt.Fprintf(os.Stderr, "                      [--updated-after date] [--updated-before date] [--sort updated|created|messages] [--limit n]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || !storage.ValidSessionSort(*sortBy) || *limit < 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	filter.IncludeArchived, filter.Name, filter.Sort, filter.Limit = *all, *name, *sortBy, *limit
+
 	// Initialize storage
-	store, err := storage.Open("")
+	store, err := storage.OpenConfig(cfg.Storage)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to open storage: %v\n", err)
 		os.Exit(1)
 	}
 	defer store.Close()
 
-	ctx := context.Background()
-	sessions, err := store.ListSessions(ctx, 0)
+	sessions, err := store.FilterSessions(context.Background(), filter)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to list sessions: %v\n", err)
 		os.Exit(1)
@@ -164,12 +503,38 @@ func handleListCommand(cfg *config.Config) {
 		if strings.TrimSpace(title) == "" {
 			title = "Untitled session"
 		}
+		if session.Pinned {
+			title = "📌 " + title
+		}
+		if session.Archived {
+			title += " (archived)"
+		}
 		fmt.Printf("#%d: %s\n", session.ID, title)
+		if session.Summary != "" {
+			fmt.Printf("     %s\n", session.Summary)
+		}
 		fmt.Printf("     %d messages • Last updated %s\n", session.MessageCount, formatRelative(session.UpdatedAt))
 		fmt.Println()
 	}
 }
 
+// listDateFlag parses a /list date bound into t. A bare date is midnight
+// local time, so --created-before 2024-06-01 ends with May.
+func listDateFlag(t *time.Time) func(string) error {
+	return func(value string) error {
+		if parsed, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+			*t = parsed
+			return nil
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("expected YYYY-MM-DD or an RFC 3339 time, got %q", value)
+		}
+		*t = parsed
+		return nil
+	}
+}
+
 // handleLoadCommand loads and displays a saved session
 func handleLoadCommand(cfg *config.Config, sessionIDStr string) {
 	// Parse session ID
@@ -180,7 +545,7 @@ func handleLoadCommand(cfg *config.Config, sessionIDStr string) {
 	}
 
 	// Initialize storage
-	store, err := storage.Open("")
+	store, err := storage.OpenConfig(cfg.Storage)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to open storage: %v\n", err)
 		os.Exit(1)
@@ -188,6 +553,10 @@ func handleLoadCommand(cfg *config.Config, sessionIDStr string) {
 	defer store.Close()
 
 	ctx := context.Background()
+	if err := unlockSession(ctx, store, sessionID); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	transcript, err := store.LoadSession(ctx, sessionID)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to load session: %v\n", err)
@@ -200,16 +569,19 @@ func handleLoadCommand(cfg *config.Config, sessionIDStr string) {
 	}
 
 	fmt.Printf("Session #%d: %s\n", transcript.Summary.ID, title)
-	fmt.Printf("%d messages • Created %s\n", len(transcript.Messages), transcript.Summary.CreatedAt.Format("2006-01-02 15:04"))
+	fmt.Printf("%d messages • Created %s\n", len(transcript.Messages), ui.FormatDateTime(transcript.Summary.CreatedAt))
 	fmt.Println(strings.Repeat("=", 50))
 
 	for _, msg := range transcript.Messages {
-		timestamp := msg.CreatedAt.Format("15:04")
+		timestamp := ui.FormatTimestamp(msg.CreatedAt)
 		if msg.Role == "user" {
 			fmt.Printf("\n[%s] User:\n", timestamp)
 		} else {
 			fmt.Printf("\n[%s] Assistant:\n", timestamp)
 		}
+		if !msg.Meta.IsZero() {
+			fmt.Printf("(%s)\n", msg.Meta)
+		}
 		fmt.Println(strings.Repeat("-", 30))
 		fmt.Println(msg.Content)
 	}
@@ -218,6 +590,25 @@ func handleLoadCommand(cfg *config.Config, sessionIDStr string) {
 	fmt.Printf("End of session #%d\n", transcript.Summary.ID)
 }
 
+// unlockSession asks on the terminal for the passphrase of an encrypted
+// session; other sessions need nothing.
+func unlockSession(ctx context.Context, store storage.Backend, id int64) error {
+	sensitive, err := store.IsSessionSensitive(ctx, id)
+	if err != nil || !sensitive {
+		return err
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("session %d is encrypted; its passphrase can only be entered at a terminal", id)
+	}
+	fmt.Fprintf(os.Stderr, "Passphrase for session #%d: ", id)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	return store.UnlockSession(ctx, id, string(passphrase))
+}
+
 // formatRelative formats a time relative to now
 func formatRelative(t time.Time) string {
 	if t.IsZero() {
@@ -237,7 +628,7 @@ func formatRelative(t time.Time) string {
 	if delta < 30*24*time.Hour {
 		return fmt.Sprintf("%d d ago", int(delta.Hours()/24))
 	}
-	return t.Format("2006-01-02")
+	return ui.FormatDate(t)
 }
 
 func main() {
@@ -246,25 +637,144 @@ func main() {
 
 	var configPath string
 	flag.StringVar(&configPath, "config", "", "Path to configuration file")
+	flag.Func("seed", "Sampling seed for reproducible outputs", func(value string) error {
+		seed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid seed %q", value)
+		}
+		overrides.seed = &seed
+		return nil
+	})
+	flag.BoolVar(&overrides.logprobs, "logprobs", false, "Request token log probabilities (printed to stderr in direct mode, /logprobs in the TUI)")
+	flag.IntVar(&overrides.topLogprobs, "top-logprobs", 0, "Number of alternative tokens to report per position (implies --logprobs)")
+	flag.BoolVar(&overrides.debug, "debug", false, "Log full API requests and responses (API key redacted) to logging.debug_file or ~/.local/share/chatty/debug.log")
+	flag.StringVar(&overrides.user, "user", "", "User identifier sent with each request for usage attribution (overrides api.user)")
+	flag.Func("metadata", "Request metadata as key=value, repeatable (merged over api.metadata)", func(value string) error {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("expected key=value, got %q", value)
+		}
+		if overrides.metadata == nil {
+			overrides.metadata = make(map[string]string)
+		}
+		overrides.metadata[strings.TrimSpace(key)] = val
+		return nil
+	})
+	flag.BoolVar(&overrides.plain, "plain", false, "Leave LaTeX math in answers raw instead of rendering it as Unicode")
+	flag.BoolVar(&overrides.quiet, "quiet", false, "Start straight at the prompt, without the welcome and goodbye banners (same as ui.show_welcome: false)")
+	flag.BoolVar(&overrides.ephemeral, "ephemeral", false, "Keep sessions in memory only, for the life of the process (same as storage.path: \":memory:\")")
+	flag.StringVar(&overrides.db, "db", "", "Keep history in this SQLite database file for this run (overrides storage.path)")
+	flag.BoolVar(&continueLast, "continue", false, "Reopen the conversation you last worked in (same as /last)")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the exact JSON payload for a direct question without sending it")
+	flag.StringVar(&templateName, "template", "", "Ask using a prompt template from the config; extra arguments are appended to it")
+	flag.Func("var", "Template variable as name=value, repeatable", func(value string) error {
+		vars, err := internal.ParseTemplateVars([]string{value})
+		if err != nil {
+			return err
+		}
+		for name, val := range vars {
+			templateVars[name] = val
+		}
+		return nil
+	})
+	flag.BoolVar(&assumeYes, "yes", false, "Send a direct question even when its estimated cost is above model.confirm_cost_above")
+	flag.StringVar(&teePath, "tee", "", "Stream the answer to a direct question into this file as well as the terminal")
 	flag.Parse()
 
 	// Check if a direct question was provided
 	args := flag.Args()
 	if len(args) > 0 {
+		// Subcommands
+		switch args[0] {
+		case "sweep":
+			handleSweepCommand(configPath, args[1:])
+			return
+		case "compare":
+			handleCompareCommand(configPath, args[1:])
+			return
+		case "image":
+			handleImageCommand(configPath, args[1:])
+			return
+		case "share":
+			handleShareCommand(configPath, args[1:])
+			return
+		case "export":
+			handleExportCommand(configPath, args[1:])
+			return
+		case "import":
+			handleImportCommand(configPath, args[1:])
+			return
+		case "backup":
+			handleBackupCommand(configPath, args[1:])
+			return
+		case "snapshot":
+			handleSnapshotCommand(configPath, args[1:])
+			return
+		case "restore":
+			handleRestoreCommand(configPath, args[1:])
+			return
+		case "ssh":
+			handleSSHCommand(configPath, args[1:])
+			return
+		case "serve":
+			handleServeCommand(configPath, args[1:])
+			return
+		case "api":
+			handleAPICommand(configPath, args[1:])
+			return
+		case "doctor":
+			handleDoctorCommand(configPath, args[1:])
+			return
+		case "db":
+			handleDBCommand(configPath, args[1:])
+			return
+		case "stats":
+			handleStatsCommand(configPath, args[1:])
+			return
+		case "context":
+			handleContextCommand(configPath, args[1:])
+			return
+		case "audit":
+			handleAuditCommand(configPath, args[1:])
+			return
+		case "batch":
+			handleBatchCommand(configPath, args[1:])
+			return
+		case "new":
+			handleNewCommand(configPath, args[1:])
+			return
+		}
+
+		if continueLast {
+			fmt.Fprintf(os.Stderr, "Error: --continue only applies to the interactive interface\n")
+			os.Exit(1)
+		}
+
 		// Direct question mode
 		handleDirectQuestion(configPath, args)
 		return
 	}
 
+	if templateName != "" {
+		// A template is a complete direct question on its own
+		handleDirectQuestion(configPath, nil)
+		return
+	}
+
+	if teePath != "" {
+		fmt.Fprintf(os.Stderr, "Error: --tee only applies to direct questions, e.g. ./chatty --tee out.md \"question\"\n")
+		os.Exit(1)
+	}
+
 	// Load configuration securely
-	cfg, err := config.Load(configPath)
+	cfg, err := loadConfig(configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Create API client securely - the client will handle the API key securely
-	client, err := internal.NewSecureClient(cfg.API.Key, cfg.API.URL)
+	client, err := internal.NewClientFromConfig(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to create secure client: %v\n", err)
 		os.Exit(1)
@@ -278,10 +788,27 @@ func main() {
 
 	// Start TUI
 	model := tui.NewModel(client, cfg, nil)
+	if continueLast {
+		model = model.ContinueLastSession()
+	}
 	p := tea.NewProgram(model, tea.WithAltScreen())
 
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running program: %v\n", err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
+// confirmCost asks on the terminal whether to send a request estimated to
+// cost more than limit. Without a terminal the request is refused.
+func confirmCost(cost, limit float64) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("estimated cost $%.2f is above model.confirm_cost_above ($%.2f); pass --yes to send it", cost, limit)
+	}
+	fmt.Fprintf(os.Stderr, "Estimated cost $%.2f is above $%.2f. Send anyway? [y/N] ", cost, limit)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("not sent")
+}
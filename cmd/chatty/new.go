@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ZaguanLabs/chatty/internal"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+	"github.com/ZaguanLabs/chatty/internal/tui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// handleNewCommand opens the TUI on a new conversation, started from a
+// session template saved with /save-template when --template is given.
+func handleNewCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("new", flag.ExitOnError)
+	template := fs.String("template", "", "Session template to start from (see /new-from in the TUI)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty new [--template <name>]\n")
+		fmt.Fprintf(os.Stderr, "Session templates are saved from a conversation with /save-template <name>.\n")
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *template != "" {
+		if err := storage.ValidateSessionTemplateName(*template); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if *template != "" && cfg.Storage.Path == "disable" {
+		fmt.Fprintf(os.Stderr, "Error: storage is disabled, so there are no session templates\n")
+		os.Exit(1)
+	}
+
+	client, err := internal.NewClientFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create secure client: %v\n", err)
+		os.Exit(1)
+	}
+
+	model := tui.NewModel(client, cfg, nil)
+	if *template != "" {
+		model = model.WithSessionTemplate(*template)
+	}
+	p := tea.NewProgram(model, tea.WithAltScreen())
+	if _, err := p.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error running program: %v\n", err)
+		os.Exit(1)
+	}
+}
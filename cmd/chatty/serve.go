@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal"
+	"github.com/ZaguanLabs/chatty/internal/serve"
+)
+
+// handleServeCommand streams chat answers over HTTP, as Server-Sent Events or
+// over a WebSocket, for web frontends and editor plugins.
+func handleServeCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addrFlag := fs.String("addr", "127.0.0.1:8766", "Address to listen on")
+	tokenFlag := fs.String("token", "", "Bearer token clients must send (default: none, or $CHATTY_SERVE_TOKEN)")
+	originsFlag := fs.String("allow-origin", "", "Comma-separated browser origins allowed to call the server, or * for any")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty serve [--addr 127.0.0.1:8766] [--token secret] [--allow-origin https://app.example]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := internal.NewClientFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create secure client: %v\n", err)
+		os.Exit(1)
+	}
+
+	token := *tokenFlag
+	if token == "" {
+		token = os.Getenv("CHATTY_SERVE_TOKEN")
+	}
+	var origins []string
+	for _, origin := range strings.Split(*originsFlag, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	server, err := serve.New(client, cfg, serve.Options{Token: token, AllowOrigins: origins})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	listener, err := net.Listen("tcp", *addrFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to listen on %s: %v\n", *addrFlag, err)
+		os.Exit(1)
+	}
+
+	addr := listener.Addr().String()
+	fmt.Printf("Streaming %s answers at:\n\n  http://%s/v1/chat/stream  (Server-Sent Events)\n  ws://%s/v1/chat/ws        (WebSocket)\n\n", cfg.Model.Name, addr, addr)
+	if token == "" {
+		fmt.Print("Anyone who can reach the address can use your API key; set --token to require one.")
+	} else {
+		fmt.Print("Clients must send the token.")
+	}
+	fmt.Println(" Press Ctrl+C to stop.")
+
+	httpServer := &http.Server{
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Server stopped.")
+}
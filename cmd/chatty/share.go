@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal/share"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+	"github.com/ZaguanLabs/chatty/internal/ui"
+)
+
+// handleShareCommand serves a saved conversation read-only on the local
+// network until the link expires or the command is interrupted.
+func handleShareCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("share", flag.ExitOnError)
+	addrFlag := fs.String("addr", ":8765", "Address to listen on")
+	expiresFlag := fs.Duration("expires", time.Hour, "How long the link works, e.g. 30m or 24h (0 = until stopped)")
+	passwordFlag := fs.String("password", "", "Password viewers must enter (default: none, or $CHATTY_SHARE_PASSWORD)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty share [--addr :8765] [--expires 1h] [--password secret] <session-id>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	sessionID, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid session ID: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	store, err := storage.OpenConfig(cfg.Storage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to open storage: %v\n", err)
+		os.Exit(1)
+	}
+	if err := unlockSession(context.Background(), store, sessionID); err != nil {
+		store.Close()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	transcript, err := store.LoadSession(context.Background(), sessionID)
+	store.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load session: %v\n", err)
+		os.Exit(1)
+	}
+
+	password := *passwordFlag
+	if password == "" {
+		password = os.Getenv("CHATTY_SHARE_PASSWORD")
+	}
+	shared, err := share.New(transcript, share.Options{Expires: *expiresFlag, Password: password})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	listener, err := net.Listen("tcp", *addrFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to listen on %s: %v\n", *addrFlag, err)
+		os.Exit(1)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	fmt.Printf("Sharing session #%d read-only at:\n\n  http://%s:%d%s\n\n", sessionID, share.LANAddress(), port, shared.Path())
+	if expiresAt := shared.ExpiresAt(); !expiresAt.IsZero() {
+		fmt.Printf("The link expires at %s.", ui.FormatTimestamp(expiresAt))
+	} else {
+		fmt.Print("The link works until you stop sharing.")
+	}
+	if password != "" {
+		fmt.Print(" Viewers need the password.")
+	}
+	fmt.Println(" Press Ctrl+C to stop.")
+
+	server := &http.Server{
+		Handler:           shared,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+		case <-shared.Expired():
+			fmt.Println("Link expired.")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Stopped sharing.")
+}
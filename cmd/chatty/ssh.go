@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal"
+	"github.com/ZaguanLabs/chatty/internal/access"
+	"github.com/ZaguanLabs/chatty/internal/config"
+	"github.com/ZaguanLabs/chatty/internal/metrics"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+	"github.com/ZaguanLabs/chatty/internal/tui"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/activeterm"
+	bm "github.com/charmbracelet/wish/bubbletea"
+	"github.com/charmbracelet/wish/logging"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// handleSSHCommand serves the TUI over SSH. Only keys listed in the
+// authorized keys file may connect, each key gets its own database, and
+// access roles from the config limit what each key may do.
+func handleSSHCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("ssh", flag.ExitOnError)
+	addrFlag := fs.String("addr", ":2323", "Address to listen on")
+	keysFlag := fs.String("authorized-keys", "~/.ssh/authorized_keys", "Public keys allowed to connect")
+	hostKeyFlag := fs.String("host-key", "", "Server host key, generated if missing (default: next to the database)")
+	metricsFlag := fs.String("metrics-addr", "", "Serve Prometheus metrics at /metrics on this address, e.g. :9090 (default: off)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty ssh [--addr :2323] [--authorized-keys file] [--host-key file] [--metrics-addr :9090]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	authorized, err := loadAuthorizedKeys(expandHome(*keysFlag))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	hostKey := expandHome(*hostKeyFlag)
+	if hostKey == "" {
+		hostKey, err = defaultHostKeyPath(cfg.Storage.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	client, err := internal.NewClientFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create secure client: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *metricsFlag != "" {
+		usage := metrics.New()
+		client.SetMetrics(usage)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", usage)
+		metricsServer := &http.Server{Addr: *metricsFlag, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Fprintf(os.Stderr, "Error: metrics server: %v\n", err)
+			}
+		}()
+		fmt.Printf("Serving Prometheus metrics on %s at /metrics\n", *metricsFlag)
+	}
+
+	policy := access.NewPolicy(cfg)
+	server, err := wish.NewServer(
+		wish.WithAddress(*addrFlag),
+		wish.WithHostKeyPath(hostKey),
+		wish.WithPublicKeyAuth(func(_ ssh.Context, key ssh.PublicKey) bool {
+			_, ok := findAuthorizedKey(authorized, key)
+			return ok
+		}),
+		wish.WithMiddleware(
+			bm.Middleware(sshTeaHandler(client, cfg, authorized, policy)),
+			activeterm.Middleware(),
+			logging.Middleware(),
+		),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create SSH server: %v\n", err)
+		os.Exit(1)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	fmt.Printf("Serving chatty over SSH on %s for %d authorized keys. Press Ctrl+C to stop.\n", *addrFlag, len(authorized))
+	if policy.Enabled() {
+		for _, key := range authorized {
+			id := keyUserID(key.key)
+			role, err := policy.RoleFor(key.comment, id)
+			if err != nil {
+				role = "(no access)"
+			}
+			fmt.Printf("  %s %s: %s\n", id, key.comment, role)
+		}
+	}
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("SSH server stopped.")
+}
+
+// sshTeaHandler starts a TUI for each session, backed by a database that
+// belongs to the session's public key and restricted to the key's role.
+func sshTeaHandler(client *internal.Client, cfg *config.Config, authorized []authorizedKey, policy *access.Policy) bm.Handler {
+	return func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+		userID := keyUserID(s.PublicKey())
+
+		userCfg := *cfg
+		var provider internal.ChatProvider = client
+		if policy.Enabled() {
+			key, _ := findAuthorizedKey(authorized, s.PublicKey())
+			role, err := policy.RoleFor(key.comment, userID)
+			if err != nil {
+				wish.Fatalln(s, "Access denied:", err)
+				return nil, nil
+			}
+			guard := policy.Guard(client, userID, role)
+			// The sandbox runs on this host, so it is a tool like any other
+			userCfg.Sandbox.Enabled = cfg.Sandbox.Enabled && guard.AllowsTool("run")
+			provider = guard
+		}
+
+		if storage.IsMemoryPath(cfg.Storage.Path) {
+			// Every connection opens its own in-memory history, which ends
+			// with the connection
+			userCfg.Storage.Driver = storage.DriverSQLite
+		} else if cfg.Storage.Path != "disable" {
+			path, err := storage.UserPath(cfg.Storage.Path, userID)
+			if err != nil {
+				wish.Fatalln(s, "Error: failed to prepare storage:", err)
+				return nil, nil
+			}
+			userCfg.Storage.Path = path
+			// Each key keeps its own SQLite database even when the server's
+			// history is on Postgres, so users never see each other's sessions
+			userCfg.Storage.Driver = storage.DriverSQLite
+		}
+		return tui.NewModel(provider, &userCfg, nil), []tea.ProgramOption{tea.WithAltScreen()}
+	}
+}
+
+// keyUserID names the storage directory of a public key: the first 16 bytes
+// of its SHA-256 fingerprint in hex.
+func keyUserID(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return hex.EncodeToString(sum[:16])
+}
+
+// authorizedKey is a public key allowed to connect and its comment, which
+// usually names the owner (e.g. alice@laptop).
+type authorizedKey struct {
+	key     ssh.PublicKey
+	comment string
+}
+
+func findAuthorizedKey(authorized []authorizedKey, key ssh.PublicKey) (authorizedKey, bool) {
+	for _, allowed := range authorized {
+		if ssh.KeysEqual(key, allowed.key) {
+			return allowed, true
+		}
+	}
+	return authorizedKey{}, false
+}
+
+// loadAuthorizedKeys reads public keys in OpenSSH authorized_keys format.
+func loadAuthorizedKeys(path string) ([]authorizedKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read authorized keys: %w", err)
+	}
+
+	var keys []authorizedKey
+	for len(data) > 0 {
+		key, comment, _, rest, err := gossh.ParseAuthorizedKey(data)
+		if err != nil {
+			break // No more keys; the remainder is blank or comments
+		}
+		keys = append(keys, authorizedKey{key: key, comment: comment})
+		data = rest
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys in %s", path)
+	}
+	return keys, nil
+}
+
+// defaultHostKeyPath keeps the host key in the storage directory.
+func defaultHostKeyPath(storagePath string) (string, error) {
+	if storagePath == "disable" || storage.IsMemoryPath(storagePath) {
+		storagePath = ""
+	}
+	dir, err := storage.Dir(storagePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ssh_host_ed25519"), nil
+}
+
+func expandHome(path string) string {
+	if path == "~" || len(path) > 1 && path[:2] == "~/" {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
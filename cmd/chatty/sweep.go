@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal"
+)
+
+const defaultSweepTemps = "0,0.5,1.0"
+
+// handleSweepCommand runs the same prompt at several temperatures and prints
+// each response under a labelled header.
+func handleSweepCommand(configPath string, args []string) {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	tempsFlag := fs.String("temps", defaultSweepTemps, "Comma-separated list of temperatures to try")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./chatty sweep [--temps 0,0.5,1.0] \"prompt\"\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	prompt := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if prompt == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	temps, err := parseTemperatures(*tempsFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := internal.NewClientFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create secure client: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !internal.CapabilitiesFor(cfg.Model.Name).Temperature {
+		fmt.Fprintf(os.Stderr, "Warning: %s does not accept a temperature; all responses will use the provider default.\n", cfg.Model.Name)
+	}
+
+	messages := []internal.Message{{Role: "user", Content: prompt}}
+	opts := internal.RequestOptionsFromConfig(cfg)
+
+	failed := 0
+	for i, temp := range temps {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("=== temperature %.2f ===\n", temp)
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Request)
+		response, err := client.ChatWithOptions(ctx, messages, cfg.Model.Name, temp, opts)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error at temperature %.2f: %v\n", temp, err)
+			failed++
+			continue
+		}
+		fmt.Println(strings.TrimSpace(response))
+	}
+
+	if failed == len(temps) {
+		os.Exit(1)
+	}
+}
+
+// parseTemperatures parses a comma-separated list of temperatures in [0, 2].
+func parseTemperatures(value string) ([]float64, error) {
+	var temps []float64
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		temp, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid temperature %q", field)
+		}
+		if temp < 0 || temp > 2 {
+			return nil, fmt.Errorf("temperature %.2f out of range (must be between 0.0 and 2.0)", temp)
+		}
+		temps = append(temps, temp)
+	}
+
+	if len(temps) == 0 {
+		return nil, fmt.Errorf("no temperatures given")
+	}
+
+	return temps, nil
+}
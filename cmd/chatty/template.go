@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal"
+	"github.com/ZaguanLabs/chatty/internal/config"
+	"golang.org/x/term"
+)
+
+// templateName and templateVars select a prompt template for a direct
+// question and fill in its variables.
+var (
+	templateName string
+	templateVars = make(map[string]string)
+)
+
+// templateMessages renders the --template prompt. Required variables missing
+// from --var are asked for when stdin is a terminal; otherwise it fails and
+// names them. Any question text is appended to the prompt.
+func templateMessages(cfg *config.Config, question string) ([]internal.Message, error) {
+	tmpl, err := internal.LookupTemplate(cfg, templateName)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string, len(templateVars))
+	for name, value := range templateVars {
+		vars[name] = value
+	}
+	if missing := tmpl.Missing(vars); len(missing) > 0 && term.IsTerminal(int(os.Stdin.Fd())) {
+		reader := bufio.NewReader(os.Stdin)
+		for _, name := range missing {
+			fmt.Fprintf(os.Stderr, "%s: ", name)
+			value, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+			vars[name] = strings.TrimSpace(value)
+		}
+	}
+
+	messages, err := tmpl.Render(vars)
+	var missingErr *internal.MissingVariablesError
+	if errors.As(err, &missingErr) {
+		flags := make([]string, len(missingErr.Names))
+		for i, name := range missingErr.Names {
+			flags[i] = fmt.Sprintf("--var %s=...", name)
+		}
+		return nil, fmt.Errorf("%w; pass %s", err, strings.Join(flags, " "))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if question = strings.TrimSpace(question); question != "" {
+		last := &messages[len(messages)-1]
+		last.Content += "\n\n" + question
+	}
+	return messages, nil
+}
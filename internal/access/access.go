@@ -0,0 +1,258 @@
+// Package access enforces the roles of a shared chatty server: which models
+// and tools each user may use, and how much they may spend per day.
+package access
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal"
+	"github.com/ZaguanLabs/chatty/internal/config"
+)
+
+// Error reports a request the user's role does not allow.
+type Error struct {
+	Role   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("not allowed for role %s: %s", e.Role, e.Reason)
+}
+
+// Policy maps users to roles and tracks their daily spending. It is shared by
+// every session of a server so spending is counted across sessions.
+type Policy struct {
+	cfg     config.AccessConfig
+	pricing *config.PricingConfig
+
+	mu    sync.Mutex
+	day   string
+	spent map[string]float64
+}
+
+// NewPolicy creates the policy for cfg.
+func NewPolicy(cfg *config.Config) *Policy {
+	return &Policy{
+		cfg:     cfg.Access,
+		pricing: cfg.Model.Pricing,
+		spent:   make(map[string]float64),
+	}
+}
+
+// Enabled reports whether any roles are configured.
+func (p *Policy) Enabled() bool {
+	return len(p.cfg.Roles) > 0
+}
+
+// RoleFor returns the role of the first name listed in access.users, or the
+// default role. It fails when the user has no role.
+func (p *Policy) RoleFor(names ...string) (string, error) {
+	for _, name := range names {
+		if role, ok := p.cfg.Users[name]; ok && name != "" {
+			return role, nil
+		}
+	}
+	if p.cfg.DefaultRole != "" {
+		return p.cfg.DefaultRole, nil
+	}
+	return "", fmt.Errorf("no role assigned to %s", names[0])
+}
+
+// Spent returns what user has spent today, in USD.
+func (p *Policy) Spent(user string) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rollover()
+	return p.spent[user]
+}
+
+func (p *Policy) charge(user string, cost float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rollover()
+	p.spent[user] += cost
+}
+
+// rollover starts a new day of spending at midnight UTC.
+func (p *Policy) rollover() {
+	if today := time.Now().UTC().Format("2006-01-02"); today != p.day {
+		p.day = today
+		p.spent = make(map[string]float64)
+	}
+}
+
+// Guard is a client restricted to what one user's role allows. Methods that
+// are not restricted are those of the embedded client.
+type Guard struct {
+	*internal.Client
+	policy *Policy
+	user   string
+	role   string
+	rules  config.RoleConfig
+}
+
+// Guard returns client restricted to role for user.
+func (p *Policy) Guard(client *internal.Client, user, role string) *Guard {
+	return &Guard{Client: client, policy: p, user: user, role: role, rules: p.cfg.Roles[role]}
+}
+
+// AllowsModel reports whether the role may chat with model.
+func (g *Guard) AllowsModel(model string) bool {
+	return allows(g.rules.Models, model)
+}
+
+// AllowsTool reports whether the role may use tool.
+func (g *Guard) AllowsTool(tool string) bool {
+	return allows(g.rules.Tools, tool)
+}
+
+func allows(list []string, name string) bool {
+	if list == nil {
+		return true
+	}
+	for _, allowed := range list {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkChat fails when model is not allowed or today's budget is used up.
+func (g *Guard) checkChat(model string) error {
+	if !g.AllowsModel(model) {
+		return &Error{Role: g.role, Reason: fmt.Sprintf("model %s", model)}
+	}
+	if limit := g.rules.MaxCostPerDay; limit > 0 {
+		if spent := g.policy.Spent(g.user); spent >= limit {
+			return &Error{Role: g.role, Reason: fmt.Sprintf("daily budget of $%.2f used up ($%.2f spent)", limit, spent)}
+		}
+	}
+	return nil
+}
+
+func (g *Guard) checkTool(tool string) error {
+	if !g.AllowsTool(tool) {
+		return &Error{Role: g.role, Reason: "/" + tool}
+	}
+	return nil
+}
+
+// record charges the cost of a response. Reported usage is preferred; the
+// shared client's last usage may belong to another user, so it is only a
+// fallback to estimating from the text.
+func (g *Guard) record(usage *internal.Usage, messages []internal.Message, response string) {
+	if g.policy.pricing == nil {
+		return
+	}
+	prompt, completion := internal.EstimateMessageTokens(messages), internal.EstimateTokens(response)
+	if usage != nil {
+		prompt, completion = usage.PromptTokens, usage.CompletionTokens
+	}
+	g.policy.charge(g.user, internal.EstimateCost(g.policy.pricing, prompt, completion))
+}
+
+// ChatWithOptions sends a chat request if the role allows the model.
+func (g *Guard) ChatWithOptions(ctx context.Context, messages []internal.Message, model string, temperature float64, opts internal.RequestOptions) (string, error) {
+	if err := g.checkChat(model); err != nil {
+		return "", err
+	}
+	response, err := g.Client.ChatWithOptions(ctx, messages, model, temperature, opts)
+	if err == nil {
+		g.record(nil, messages, response)
+	}
+	return response, err
+}
+
+// ChatStreamEvents streams a chat response if the role allows the model.
+func (g *Guard) ChatStreamEvents(ctx context.Context, messages []internal.Message, model string, temperature float64, opts internal.RequestOptions, onEvent func(internal.StreamEvent) error) error {
+	if err := g.checkChat(model); err != nil {
+		return err
+	}
+
+	var usage *internal.Usage
+	var response []byte
+	err := g.Client.ChatStreamEvents(ctx, messages, model, temperature, opts, func(event internal.StreamEvent) error {
+		if event.Usage != nil {
+			usage = event.Usage
+		}
+		response = append(response, event.Content...)
+		return onEvent(event)
+	})
+	g.record(usage, messages, string(response))
+	return err
+}
+
+// ChatModels compares models if the role allows /compare; models the role
+// may not use get an error result.
+func (g *Guard) ChatModels(ctx context.Context, messages []internal.Message, models []string, temperature float64, optsFor func(string) internal.RequestOptions) []internal.ModelResult {
+	results := make([]internal.ModelResult, len(models))
+	var allowed []string
+	var index []int
+	for i, model := range models {
+		results[i].Model = model
+		if err := g.checkTool("compare"); err != nil {
+			results[i].Err = err
+		} else if err := g.checkChat(model); err != nil {
+			results[i].Err = err
+		} else {
+			allowed = append(allowed, model)
+			index = append(index, i)
+		}
+	}
+	if len(allowed) == 0 {
+		return results
+	}
+
+	for i, result := range g.Client.ChatModels(ctx, messages, allowed, temperature, optsFor) {
+		results[index[i]] = result
+		if result.Err == nil {
+			g.record(nil, messages, result.Response)
+		}
+	}
+	return results
+}
+
+// Embed creates embeddings for /recall if the role allows it.
+func (g *Guard) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	if err := g.checkTool("recall"); err != nil {
+		return nil, err
+	}
+	return g.Client.Embed(ctx, model, inputs)
+}
+
+// Transcribe converts speech to text if the role allows /transcribe.
+func (g *Guard) Transcribe(ctx context.Context, model, path, language string) (string, error) {
+	if err := g.checkTool("transcribe"); err != nil {
+		return "", err
+	}
+	return g.Client.Transcribe(ctx, model, path, language)
+}
+
+// Speech converts text to audio if the role allows /speak.
+func (g *Guard) Speech(ctx context.Context, model, voice, text string) ([]byte, error) {
+	if err := g.checkTool("speak"); err != nil {
+		return nil, err
+	}
+	return g.Client.Speech(ctx, model, voice, text)
+}
+
+// GenerateImage creates an image if the role allows /image.
+func (g *Guard) GenerateImage(ctx context.Context, model, prompt, size string) ([]byte, error) {
+	if err := g.checkTool("image"); err != nil {
+		return nil, err
+	}
+	return g.Client.GenerateImage(ctx, model, prompt, size)
+}
+
+var (
+	_ internal.ChatProvider   = (*Guard)(nil)
+	_ internal.Embedder       = (*Guard)(nil)
+	_ internal.ModelComparer  = (*Guard)(nil)
+	_ internal.Transcriber    = (*Guard)(nil)
+	_ internal.Speaker        = (*Guard)(nil)
+	_ internal.ImageGenerator = (*Guard)(nil)
+)
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+// LoadAttachment reads the file at path for attaching to a message. With
+// reference set only its path, name and type are kept, and the content is
+// read again whenever the message is sent.
+func LoadAttachment(path string, reference bool) (storage.Attachment, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	if info.IsDir() {
+		return storage.Attachment{}, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > storage.MaxAttachmentSize {
+		return storage.Attachment{}, fmt.Errorf("%s is larger than %d MiB", filepath.Base(path), storage.MaxAttachmentSize>>20)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return storage.Attachment{}, err
+	}
+	attachment := storage.Attachment{
+		Name:     filepath.Base(path),
+		MIMEType: attachmentType(path, data),
+		Size:     int64(len(data)),
+		Path:     path,
+	}
+	if !reference {
+		attachment.Data = data
+	}
+	return attachment, nil
+}
+
+// attachmentType guesses the MIME type of a file from its extension, or
+// else from its content.
+func attachmentType(path string, data []byte) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(path)); mimeType != "" {
+		mimeType, _, _ = strings.Cut(mimeType, ";")
+		return mimeType
+	}
+	mimeType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return mimeType
+}
+
+// FormatAttachment describes an attachment in one line, such as
+// "photo.png (image/png, 120.4 KiB)".
+func FormatAttachment(attachment storage.Attachment) string {
+	return fmt.Sprintf("%s (%s, %s)", attachment.Name, attachment.MIMEType, formatSize(attachment.Size))
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// MarshalJSON sends a message with attachments as a list of content parts:
+// the text, then each image as an image_url part, each text file as a text
+// part and any other file as a file part, all inlined as data URLs. A file
+// kept by reference that can no longer be read is replaced by a note, so the
+// conversation can continue without it.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type plain Message
+	if len(m.Attachments) == 0 {
+		return json.Marshal(plain(m))
+	}
+
+	parts := make([]map[string]interface{}, 0, len(m.Attachments)+1)
+	if m.Content != "" {
+		parts = append(parts, map[string]interface{}{"type": "text", "text": m.Content})
+	}
+	for _, attachment := range m.Attachments {
+		parts = append(parts, attachmentPart(attachment))
+	}
+	return json.Marshal(struct {
+		plain
+		Content []map[string]interface{} `json:"content"`
+	}{plain(m), parts})
+}
+
+func attachmentPart(attachment storage.Attachment) map[string]interface{} {
+	data := attachment.Data
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(attachment.Path); err != nil {
+			return map[string]interface{}{"type": "text", "text": fmt.Sprintf("[attachment %s is no longer available]", attachment.Name)}
+		}
+	}
+
+	url := "data:" + attachment.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	switch {
+	case strings.HasPrefix(attachment.MIMEType, "image/"):
+		return map[string]interface{}{"type": "image_url", "image_url": map[string]string{"url": url}}
+	case strings.HasPrefix(attachment.MIMEType, "text/"):
+		return map[string]interface{}{"type": "text", "text": fmt.Sprintf("%s:\n\n%s", attachment.Name, data)}
+	default:
+		return map[string]interface{}{"type": "file", "file": map[string]string{"filename": attachment.Name, "file_data": url}}
+	}
+}
@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+)
+
+// MaxAudioFileSize is the largest audio file accepted for transcription,
+// matching the OpenAI upload limit.
+const MaxAudioFileSize = 25 << 20
+
+// supportedAudioExtensions lists the formats accepted by the transcription endpoint.
+var supportedAudioExtensions = map[string]bool{
+	".flac": true,
+	".m4a":  true,
+	".mp3":  true,
+	".mp4":  true,
+	".mpeg": true,
+	".mpga": true,
+	".ogg":  true,
+	".wav":  true,
+	".webm": true,
+}
+
+// Transcribe uploads the audio file at path to the /audio/transcriptions
+// endpoint and returns the transcript. language is an optional ISO-639-1 hint.
+func (c *Client) Transcribe(ctx context.Context, model, path, language string) (string, error) {
+	if c == nil {
+		return "", chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if !supportedAudioExtensions[ext] {
+		return "", fmt.Errorf("unsupported audio format %q", ext)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open audio file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("stat audio file: %w", err)
+	}
+	if info.Size() > MaxAudioFileSize {
+		return "", fmt.Errorf("audio file is %d bytes, the limit is %d", info.Size(), MaxAudioFileSize)
+	}
+
+	if err := c.checkRateLimits(); err != nil {
+		return "", err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	fields := map[string]string{"model": model, "response_format": "json"}
+	if language != "" {
+		fields["language"] = language
+	}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return "", fmt.Errorf("encode request: %w", err)
+		}
+	}
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return "", fmt.Errorf("encode request: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return "", fmt.Errorf("read audio file: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("encode request: %w", err)
+	}
+
+	// Uploads and transcription of long recordings take longer than a chat request
+	ctx, cancel := context.WithTimeout(ctx, c.streamTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/audio/transcriptions", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", c.decodeError(bytes.NewReader(bodyBytes), resp.StatusCode)
+	}
+
+	var response struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+
+	text := strings.TrimSpace(response.Text)
+	if text == "" {
+		return "", fmt.Errorf("transcription returned no text")
+	}
+	return text, nil
+}
+
+// maxSpeechInput is the longest text the speech endpoint accepts per request.
+const maxSpeechInput = 4096
+
+// audioPlayers are tried in order when no player is configured. Each accepts
+// an MP3 file path as its last argument.
+var audioPlayers = [][]string{
+	{"afplay"},
+	{"mpv", "--no-video", "--really-quiet"},
+	{"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet"},
+	{"mpg123", "-q"},
+}
+
+// Speech converts text to MP3 audio using the /audio/speech endpoint.
+func (c *Client) Speech(ctx context.Context, model, voice, text string) ([]byte, error) {
+	if c == nil {
+		return nil, chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
+	}
+
+	if err := c.checkRateLimits(); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"model":           model,
+		"voice":           voice,
+		"input":           text,
+		"response_format": "mp3",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.streamTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/audio/speech", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, c.decodeError(bytes.NewReader(bodyBytes), resp.StatusCode)
+	}
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read audio: %w", err)
+	}
+	return audio, nil
+}
+
+// SpeechChunks splits text into pieces the speech endpoint accepts, breaking
+// at paragraph, sentence or word boundaries where possible.
+func SpeechChunks(text string) []string {
+	var chunks []string
+	text = strings.TrimSpace(text)
+	for len(text) > maxSpeechInput {
+		cut := maxSpeechInput
+		for _, sep := range []string{"\n\n", ". ", " "} {
+			if i := strings.LastIndex(text[:maxSpeechInput], sep); i > maxSpeechInput/2 {
+				cut = i + len(sep)
+				break
+			}
+		}
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut-- // Never split a multi-byte character
+		}
+		chunks = append(chunks, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// PlayAudio plays MP3 data with player, a command line such as "mpv --no-video",
+// or with the first known player found on PATH when player is empty.
+func PlayAudio(ctx context.Context, audio []byte, player string) error {
+	command := strings.Fields(player)
+	if len(command) == 0 {
+		for _, candidate := range audioPlayers {
+			if _, err := exec.LookPath(candidate[0]); err == nil {
+				command = candidate
+				break
+			}
+		}
+	}
+	if len(command) == 0 {
+		return errors.New("no audio player found; install mpv, ffplay or mpg123, or set audio.player")
+	}
+
+	file, err := os.CreateTemp("", "chatty-speech-*.mp3")
+	if err != nil {
+		return fmt.Errorf("create audio file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(audio); err != nil {
+		file.Close()
+		return fmt.Errorf("write audio file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("write audio file: %w", err)
+	}
+
+	args := append(append([]string{}, command[1:]...), file.Name())
+	if err := exec.CommandContext(ctx, command[0], args...).Run(); err != nil {
+		return fmt.Errorf("play audio with %s: %w", command[0], err)
+	}
+	return nil
+}
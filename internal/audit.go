@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os/user"
+
+	"github.com/ZaguanLabs/chatty/internal/audit"
+)
+
+// auditor writes every model request to an audit log.
+type auditor struct {
+	log     *audit.Log
+	user    string
+	content bool // Record prompts and responses, not just their metadata
+}
+
+// SetAuditLog records every chat request, including failed attempts and
+// fallbacks, in log. name identifies the person sending them, defaulting to
+// the operating system user; with content set, the last prompt and the
+// response are recorded too.
+func (c *Client) SetAuditLog(log *audit.Log, name string, content bool) {
+	if log == nil {
+		c.audit = nil
+		return
+	}
+	if name == "" {
+		if current, err := user.Current(); err == nil {
+			name = current.Username
+		}
+	}
+	c.audit = &auditor{log: log, user: name, content: content}
+}
+
+// auditRequest records one attempt made by client. Failing to write the log
+// is reported through the debug log rather than failing the request.
+func (c *Client) auditRequest(client *Client, model string, messages []Message, response string, err error) {
+	if c.audit == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		User:     c.audit.user,
+		Provider: client.baseURL,
+		Model:    model,
+		Messages: len(messages),
+	}
+	if parsed, parseErr := url.Parse(client.baseURL); parseErr == nil && parsed.Host != "" {
+		entry.Provider = parsed.Host
+	}
+	if data, marshalErr := json.Marshal(messages); marshalErr == nil {
+		sum := sha256.Sum256(data)
+		entry.PromptSHA256 = hex.EncodeToString(sum[:])
+	}
+	if c.audit.content {
+		entry.Prompt = lastUserMessage(messages)
+		entry.Response = response
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else if usage := client.LastUsage(); usage != nil {
+		entry.PromptTokens, entry.CompletionTokens = usage.PromptTokens, usage.CompletionTokens
+	}
+
+	if writeErr := c.audit.log.Append(entry); writeErr != nil {
+		c.debugf("audit log: %v\n", writeErr)
+	}
+}
+
+func lastUserMessage(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
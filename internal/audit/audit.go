@@ -0,0 +1,175 @@
+// Package audit keeps an append-only log of model interactions. Each entry
+// carries the hash of the previous one, so editing, removing or reordering
+// entries breaks the chain and is detected by Verify.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// genesisHash is the previous hash of the first entry in a log.
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// maxEntrySize bounds one line of the log when reading it back.
+const maxEntrySize = 16 * 1024 * 1024
+
+// Entry records one request to a model. Prompt and Response are only filled
+// in when content logging is enabled; PromptSHA256 is always set so a
+// disclosed prompt can be matched to its entry later.
+type Entry struct {
+	Seq              int64     `json:"seq"`
+	Time             time.Time `json:"time"`
+	User             string    `json:"user"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	Messages         int       `json:"messages"`
+	PromptSHA256     string    `json:"prompt_sha256"`
+	Prompt           string    `json:"prompt,omitempty"`
+	Response         string    `json:"response,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	Prev             string    `json:"prev"`
+	Hash             string    `json:"hash"`
+}
+
+// computeHash returns the chain hash of e, covering every field but Hash.
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends hash-chained entries to a file.
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	seq  int64
+	prev string
+}
+
+// Open opens the log at path for appending, creating it with owner-only
+// permissions. An existing log is verified first so new entries are never
+// chained onto a log that has been tampered with.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create audit log directory: %w", err)
+	}
+
+	log := &Log{prev: genesisHash}
+	if last, err := verifyFile(path); err == nil {
+		if last != nil {
+			log.seq, log.prev = last.Seq, last.Hash
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	log.file = file
+	return log, nil
+}
+
+// Append chains entry onto the log and writes it. Seq, Prev and Hash are
+// filled in; Time defaults to now.
+func (l *Log) Append(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.Seq = l.seq + 1
+	entry.Prev = l.prev
+	hash, err := entry.computeHash()
+	if err != nil {
+		return fmt.Errorf("hash audit entry: %w", err)
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode audit entry: %w", err)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	l.seq, l.prev = entry.Seq, entry.Hash
+	return nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// Verify checks the chain of the log at path and returns the number of
+// entries. The error names the first entry that does not match.
+func Verify(path string) (int64, error) {
+	last, err := verifyFile(path)
+	if err != nil || last == nil {
+		return 0, err
+	}
+	return last.Seq, nil
+}
+
+func verifyFile(path string) (*Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return verifyChain(file)
+}
+
+// verifyChain reads entries from r and returns the last one, or nil for an
+// empty log.
+func verifyChain(r io.Reader) (*Entry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEntrySize)
+
+	var last *Entry
+	prev := genesisHash
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		if entry.Seq != int64(line) {
+			return nil, fmt.Errorf("audit log line %d: sequence %d out of order", line, entry.Seq)
+		}
+		if entry.Prev != prev {
+			return nil, fmt.Errorf("audit log line %d: chain broken, previous entry missing or altered", line)
+		}
+		hash, err := entry.computeHash()
+		if err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		if hash != entry.Hash {
+			return nil, fmt.Errorf("audit log line %d: entry altered", line)
+		}
+		prev = entry.Hash
+		last = &entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	return last, nil
+}
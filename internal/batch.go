@@ -0,0 +1,370 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+)
+
+const (
+	// batchEndpoint is the endpoint batch requests are run against; the
+	// batch API wants the versioned path regardless of the base URL.
+	batchEndpoint = "/v1/chat/completions"
+	// batchWindow is the only completion window providers currently offer.
+	batchWindow = "24h"
+	// MaxBatchRequests is the most prompts one batch may hold.
+	MaxBatchRequests = 50000
+	// maxBatchFileSize bounds downloaded batch input and output files.
+	maxBatchFileSize = 200 * 1024 * 1024
+)
+
+// BatchPrompt is one line of a prompts file: either a single prompt or a
+// whole conversation. ID is optional and defaults to the line number.
+type BatchPrompt struct {
+	ID       string    `json:"id,omitempty"`
+	Prompt   string    `json:"prompt,omitempty"`
+	Messages []Message `json:"messages,omitempty"`
+}
+
+// Batch is a batch job as reported by the provider.
+type Batch struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"` // validating, in_progress, completed, failed, expired, cancelled...
+	InputFileID   string `json:"input_file_id"`
+	OutputFileID  string `json:"output_file_id"`
+	ErrorFileID   string `json:"error_file_id"`
+	CreatedAt     int64  `json:"created_at"`
+	RequestCounts struct {
+		Total     int `json:"total"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	} `json:"request_counts"`
+}
+
+// Created returns when the batch was submitted.
+func (b *Batch) Created() time.Time {
+	return time.Unix(b.CreatedAt, 0)
+}
+
+// BatchResult pairs a prompt with the response the batch produced for it.
+type BatchResult struct {
+	ID       string
+	Messages []Message // The conversation that was sent
+	Response string
+	Err      error
+}
+
+// ParseBatchPrompts reads a prompts file with one JSON object per line. Blank
+// lines are skipped.
+func ParseBatchPrompts(r io.Reader) ([]BatchPrompt, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), DefaultMaxStreamLine)
+
+	var prompts []BatchPrompt
+	seen := make(map[string]bool)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var prompt BatchPrompt
+		if err := json.Unmarshal([]byte(text), &prompt); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if prompt.ID == "" {
+			prompt.ID = fmt.Sprintf("line-%d", line)
+		}
+		if seen[prompt.ID] {
+			return nil, fmt.Errorf("line %d: duplicate id %q", line, prompt.ID)
+		}
+		seen[prompt.ID] = true
+		if strings.TrimSpace(prompt.Prompt) != "" {
+			prompt.Messages = append(prompt.Messages, Message{Role: "user", Content: prompt.Prompt})
+		}
+		if len(prompt.Messages) == 0 {
+			return nil, fmt.Errorf("line %d: needs a prompt or messages", line)
+		}
+		prompts = append(prompts, prompt)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read prompts: %w", err)
+	}
+	if len(prompts) == 0 {
+		return nil, errors.New("no prompts found")
+	}
+	if len(prompts) > MaxBatchRequests {
+		return nil, fmt.Errorf("%d prompts exceed the batch limit of %d", len(prompts), MaxBatchRequests)
+	}
+	return prompts, nil
+}
+
+// SubmitBatch uploads prompts as a batch input file and starts a batch job
+// that runs them against model with the given options.
+func (c *Client) SubmitBatch(ctx context.Context, prompts []BatchPrompt, model string, temperature float64, opts RequestOptions) (*Batch, error) {
+	if c == nil {
+		return nil, chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
+	}
+	if len(prompts) == 0 {
+		return nil, errors.New("no prompts to submit")
+	}
+
+	var input bytes.Buffer
+	encoder := json.NewEncoder(&input)
+	for _, prompt := range prompts {
+		line := map[string]interface{}{
+			"custom_id": prompt.ID,
+			"method":    http.MethodPost,
+			"url":       batchEndpoint,
+			"body":      buildRequestBody(prompt.Messages, model, temperature, false, opts),
+		}
+		if err := encoder.Encode(line); err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+	}
+
+	fileID, err := c.uploadBatchFile(ctx, input.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"input_file_id":     fileID,
+		"endpoint":          batchEndpoint,
+		"completion_window": batchWindow,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	var batch Batch
+	if err := c.batchRequest(ctx, http.MethodPost, "/batches", "application/json", bytes.NewReader(payload), &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetBatch returns the current state of a batch job.
+func (c *Client) GetBatch(ctx context.Context, id string) (*Batch, error) {
+	if c == nil {
+		return nil, chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
+	}
+	if strings.TrimSpace(id) == "" {
+		return nil, errors.New("batch id cannot be empty")
+	}
+
+	var batch Batch
+	if err := c.batchRequest(ctx, http.MethodGet, "/batches/"+url.PathEscape(id), "", nil, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// BatchResults downloads the input and output of a completed batch and
+// returns one result per prompt, in submission order.
+func (c *Client) BatchResults(ctx context.Context, batch *Batch) ([]BatchResult, error) {
+	if c == nil {
+		return nil, chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
+	}
+	if batch.Status != "completed" {
+		return nil, fmt.Errorf("batch %s is %s, not completed", batch.ID, batch.Status)
+	}
+
+	input, err := c.downloadFile(ctx, batch.InputFileID)
+	if err != nil {
+		return nil, fmt.Errorf("download batch input: %w", err)
+	}
+	var results []BatchResult
+	index := make(map[string]int)
+	err = forEachJSONLine(input, func(data []byte) error {
+		var line struct {
+			CustomID string `json:"custom_id"`
+			Body     struct {
+				Messages []Message `json:"messages"`
+			} `json:"body"`
+		}
+		if err := json.Unmarshal(data, &line); err != nil {
+			return err
+		}
+		index[line.CustomID] = len(results)
+		results = append(results, BatchResult{
+			ID:       line.CustomID,
+			Messages: line.Body.Messages,
+			Err:      errors.New("no result returned"),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read batch input: %w", err)
+	}
+
+	for _, fileID := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		output, err := c.downloadFile(ctx, fileID)
+		if err != nil {
+			return nil, fmt.Errorf("download batch output: %w", err)
+		}
+		err = forEachJSONLine(output, func(data []byte) error {
+			var line struct {
+				CustomID string `json:"custom_id"`
+				Response *struct {
+					StatusCode int             `json:"status_code"`
+					Body       json.RawMessage `json:"body"`
+				} `json:"response"`
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(data, &line); err != nil {
+				return err
+			}
+			i, ok := index[line.CustomID]
+			if !ok {
+				return nil
+			}
+			result := &results[i]
+			switch {
+			case line.Error != nil:
+				result.Err = errors.New(line.Error.Message)
+			case line.Response == nil:
+				result.Err = errors.New("no response")
+			case line.Response.StatusCode < 200 || line.Response.StatusCode >= 300:
+				result.Err = c.decodeError(bytes.NewReader(line.Response.Body), line.Response.StatusCode)
+			default:
+				result.Response, result.Err = c.decodeResponse(line.Response.Body)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read batch output: %w", err)
+		}
+	}
+	return results, nil
+}
+
+// uploadBatchFile uploads a batch input file and returns its ID.
+func (c *Client) uploadBatchFile(ctx context.Context, data []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("purpose", "batch"); err != nil {
+		return "", fmt.Errorf("encode request: %w", err)
+	}
+	part, err := form.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", fmt.Errorf("encode request: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", fmt.Errorf("encode request: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("encode request: %w", err)
+	}
+
+	var file struct {
+		ID string `json:"id"`
+	}
+	if err := c.batchRequest(ctx, http.MethodPost, "/files", form.FormDataContentType(), &body, &file); err != nil {
+		return "", fmt.Errorf("upload batch input: %w", err)
+	}
+	if file.ID == "" {
+		return "", errors.New("upload batch input: no file id returned")
+	}
+	return file.ID, nil
+}
+
+// downloadFile returns the contents of an uploaded or generated file.
+func (c *Client) downloadFile(ctx context.Context, id string) ([]byte, error) {
+	if err := c.checkRateLimits(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.streamTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/files/"+url.PathEscape(id)+"/content", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBatchFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.decodeError(bytes.NewReader(data), resp.StatusCode)
+	}
+	if len(data) > maxBatchFileSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxBatchFileSize)
+	}
+	return data, nil
+}
+
+// batchRequest sends a request to the batch or files API and decodes the JSON
+// response into out.
+func (c *Client) batchRequest(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	if err := c.checkRateLimits(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return c.decodeError(bytes.NewReader(bodyBytes), resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+func forEachJSONLine(data []byte, fn func([]byte) error) error {
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal/security"
+)
+
+// CircuitOpenError is returned without contacting the API while the circuit
+// breaker is open after repeated failures.
+type CircuitOpenError struct {
+	Failures int           // Consecutive failures that opened the circuit
+	RetryIn  time.Duration // Time until the next trial request is allowed
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("API unavailable after %d consecutive failures, not retrying for %s",
+		e.Failures, e.RetryIn.Round(time.Second))
+}
+
+// SetCircuitBreaker configures the breaker that stops requests to a failing
+// endpoint. A threshold of 0 disables it.
+func (c *Client) SetCircuitBreaker(threshold int, coolDown time.Duration) {
+	if threshold <= 0 {
+		c.breaker = nil
+		return
+	}
+	c.breaker = security.NewCircuitBreaker(security.CircuitBreakerConfig{
+		FailureThreshold: threshold,
+		CoolDown:         coolDown,
+	})
+}
+
+// checkCircuit fails fast while the circuit breaker is open.
+func (c *Client) checkCircuit() error {
+	if c.breaker == nil || c.breaker.Allow() {
+		return nil
+	}
+	return &CircuitOpenError{Failures: c.breaker.Failures(), RetryIn: c.breaker.RemainingCoolDown()}
+}
+
+// do sends an API request and reports the outcome to the metrics and the
+// circuit breaker.
+// Transport errors and 5xx responses count as failures; cancellation by the
+// caller counts as neither.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	if c.metrics != nil {
+		status := 0
+		if err == nil {
+			status = resp.StatusCode
+		}
+		c.metrics.ObserveRequest(strings.TrimPrefix(req.URL.String(), c.baseURL), status, time.Since(start))
+	}
+	if c.breaker == nil {
+		return resp, err
+	}
+
+	switch {
+	case err == nil && resp.StatusCode < 500:
+		c.breaker.RecordSuccess()
+	case err == nil || !errors.Is(req.Context().Err(), context.Canceled):
+		c.breaker.RecordFailure()
+		if c.breaker.State() == security.CircuitOpen {
+			c.debugf("circuit breaker open after %d consecutive failures\n", c.breaker.Failures())
+		}
+	}
+	return resp, err
+}
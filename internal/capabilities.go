@@ -0,0 +1,52 @@
+package internal
+
+import "strings"
+
+// ModelCapabilities describes which request parameters a model family accepts.
+type ModelCapabilities struct {
+	Temperature         bool `json:"temperature"`           // Accepts a sampling temperature
+	ReasoningEffort     bool `json:"reasoning_effort"`      // Accepts reasoning_effort
+	MaxCompletionTokens bool `json:"max_completion_tokens"` // Uses max_completion_tokens instead of max_tokens
+}
+
+// defaultCapabilities applies to any model without a more specific entry.
+var defaultCapabilities = ModelCapabilities{Temperature: true}
+
+// reasoningCapabilities applies to OpenAI o-series style reasoning models.
+var reasoningCapabilities = ModelCapabilities{ReasoningEffort: true, MaxCompletionTokens: true}
+
+// modelFamilies maps model name prefixes to their capabilities. The first
+// matching prefix wins, so more specific prefixes must come first.
+var modelFamilies = []struct {
+	prefix       string
+	capabilities ModelCapabilities
+}{
+	{"o1-mini", ModelCapabilities{MaxCompletionTokens: true}},
+	{"o1", reasoningCapabilities},
+	{"o3", reasoningCapabilities},
+	{"o4", reasoningCapabilities},
+	{"gpt-5", reasoningCapabilities},
+}
+
+// CapabilitiesFor returns the capabilities of the given model. Provider
+// prefixes such as "openai/" are ignored when matching model families.
+func CapabilitiesFor(model string) ModelCapabilities {
+	name := baseModelName(model)
+
+	for _, family := range modelFamilies {
+		if strings.HasPrefix(name, family.prefix) {
+			return family.capabilities
+		}
+	}
+
+	return defaultCapabilities
+}
+
+// baseModelName lowercases model and strips any provider prefix.
+func baseModelName(model string) string {
+	name := strings.ToLower(model)
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name
+}
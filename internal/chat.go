@@ -2,11 +2,14 @@ package internal
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
@@ -142,13 +145,25 @@ type CommandRegistry struct {
 
 // Command definitions for easy extensibility.
 var commandRegistry = map[string]CommandRegistry{
-	"exit":     {handler: &ExitCommandHandler{session: nil}},
-	"reset":    {handler: &ResetCommandHandler{session: nil}},
-	"help":     {handler: &HelpCommandHandler{session: nil}},
-	"history":  {handler: &HistoryCommandHandler{session: nil}},
-	"markdown": {handler: &MarkdownCommandHandler{session: nil}},
-	"list":     {handler: &ListCommandHandler{session: nil}},
-	"load":     {handler: &LoadCommandHandler{session: nil}},
+	"exit":        {handler: &ExitCommandHandler{session: nil}},
+	"reset":       {handler: &ResetCommandHandler{session: nil}},
+	"help":        {handler: &HelpCommandHandler{session: nil}},
+	"history":     {handler: &HistoryCommandHandler{session: nil}},
+	"markdown":    {handler: &MarkdownCommandHandler{session: nil}},
+	"list":        {handler: &ListCommandHandler{session: nil}},
+	"load":        {handler: &LoadCommandHandler{session: nil}},
+	"last":        {handler: &LastCommandHandler{session: nil}},
+	"reuse":       {handler: &ReuseCommandHandler{session: nil}},
+	"fork":        {handler: &ForkCommandHandler{session: nil}},
+	"clone":       {handler: &CloneCommandHandler{session: nil}},
+	"forget-last": {handler: &ForgetLastCommandHandler{session: nil}},
+	"pin":         {handler: &PinSessionCommandHandler{session: nil}},
+	"archive":     {handler: &ArchiveCommandHandler{session: nil}},
+	"delete":      {handler: &DeleteCommandHandler{session: nil}},
+	"trash":       {handler: &TrashCommandHandler{session: nil}},
+	"sensitive":   {handler: &SensitiveCommandHandler{session: nil}},
+	"stats":       {handler: &StatsCommandHandler{session: nil}},
+	"system":      {handler: &SystemCommandHandler{session: nil}},
 }
 
 // initializeCommandHandlers sets up the command handlers.
@@ -186,6 +201,10 @@ type ExitCommandHandler struct {
 func (h *ExitCommandHandler) setSession(s *Session) { h.session = s }
 
 func (h *ExitCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	if !h.session.config.UI.ShowWelcome {
+		return true, nil
+	}
+
 	// Create a nice goodbye header
 	goodbyeText := "👋 Goodbye! Thanks for using Chatty!"
 	width := len(goodbyeText) + 4
@@ -223,7 +242,7 @@ func (h *ResetCommandHandler) setSession(s *Session) { h.session = s }
 
 func (h *ResetCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
 	h.session.history = h.session.history[:0]
-	h.session.sessionID = 0
+	h.session.leaveSession()
 
 	// Create a nice reset header
 	resetText := "🗑️ History cleared. Starting fresh!"
@@ -331,6 +350,92 @@ func (h *MarkdownCommandHandler) HelpText() string { return "Toggle markdown ren
 func (h *MarkdownCommandHandler) Usage() string { return "" }
 func (h *MarkdownCommandHandler) MinArgs() int { return 0 }
 
+// SystemCommandHandler shows, sets or removes the system prompt of the session
+type SystemCommandHandler struct {
+	session *Session
+}
+
+func (h *SystemCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *SystemCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	prompt := strings.Join(parts[1:], " ")
+	switch prompt {
+	case "":
+		if s.systemPrompt == "" {
+			s.println(s.colorize(colorGray, "No system prompt. Use /system <text> to set one for this session."))
+		} else {
+			s.println(s.colorize(colorGray, "System prompt: "+s.systemPrompt))
+		}
+		return false, nil
+	case "off":
+		prompt = ""
+	}
+
+	if s.store != nil && s.sessionID != 0 {
+		if err := s.store.SetSessionSystemPrompt(ctx, s.sessionID, prompt); err != nil {
+			return false, err
+		}
+	}
+	s.systemPrompt = prompt
+	if prompt == "" {
+		s.println(s.colorize(colorGray, "System prompt removed."))
+	} else {
+		s.println(s.colorize(colorGray, "System prompt set; it is sent first with every request of this session."))
+	}
+	return false, nil
+}
+
+func (h *SystemCommandHandler) Name() string      { return "system" }
+func (h *SystemCommandHandler) Aliases() []string { return []string{"/system"} }
+func (h *SystemCommandHandler) HelpText() string {
+	return "Show, set or remove (off) this session's system prompt, saved with it"
+}
+func (h *SystemCommandHandler) Usage() string { return "/system [text|off]" }
+func (h *SystemCommandHandler) MinArgs() int { return 0 }
+
+// ReuseCommandHandler answers a repeated question with the earlier answer
+type ReuseCommandHandler struct {
+	session *Session
+}
+
+func (h *ReuseCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *ReuseCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	// The conversation may have been reset or replaced since
+	if s.duplicatePrompt == "" || s.duplicateAnswer >= len(s.history) || s.history[s.duplicateAnswer].Role != "assistant" {
+		s.duplicatePrompt = ""
+		return false, errors.New("no repeated question to answer")
+	}
+	prompt, answer := s.duplicatePrompt, s.history[s.duplicateAnswer].Content
+	s.duplicatePrompt = ""
+
+	if s.store != nil && s.sessionID == 0 && !s.privacy.Excludes(prompt) {
+		if err := s.ensureSession(ctx, prompt); err != nil {
+			s.printError(fmt.Sprintf("Failed to initialise persistence: %v", err))
+			s.store = nil
+		}
+	}
+
+	userMsg := Message{Role: "user", Content: prompt}
+	assistantMsg := Message{Role: "assistant", Content: answer}
+	s.history = append(s.history, userMsg, assistantMsg)
+	s.printUserMessage(prompt)
+	s.printAssistant(answer)
+
+	s.persistExchange(userMsg, assistantMsg)
+	return false, nil
+}
+
+func (h *ReuseCommandHandler) Name() string      { return "reuse" }
+func (h *ReuseCommandHandler) Aliases() []string { return []string{"/reuse"} }
+func (h *ReuseCommandHandler) HelpText() string {
+	return "Answer a repeated question with the earlier answer instead of a new request"
+}
+func (h *ReuseCommandHandler) Usage() string { return "" }
+func (h *ReuseCommandHandler) MinArgs() int  { return 0 }
+
 // ListCommandHandler handles the list command
 type ListCommandHandler struct {
 	session *Session
@@ -339,13 +444,14 @@ type ListCommandHandler struct {
 func (h *ListCommandHandler) setSession(s *Session) { h.session = s }
 
 func (h *ListCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
-	return false, h.session.handleListSessions(ctx)
+	all := len(parts) > 1 && parts[1] == "--all"
+	return false, h.session.handleListSessions(ctx, all)
 }
 
 func (h *ListCommandHandler) Name() string { return "list" }
 func (h *ListCommandHandler) Aliases() []string { return []string{"/list", "/sessions"} }
-func (h *ListCommandHandler) HelpText() string { return "Show saved conversations" }
-func (h *ListCommandHandler) Usage() string { return "" }
+func (h *ListCommandHandler) HelpText() string { return "Show saved conversations; --all includes archived ones" }
+func (h *ListCommandHandler) Usage() string { return "/list [--all]" }
 func (h *ListCommandHandler) MinArgs() int { return 0 }
 
 // LoadCommandHandler handles the load command
@@ -377,6 +483,455 @@ func (h *LoadCommandHandler) HelpText() string { return "Load a saved conversati
 func (h *LoadCommandHandler) Usage() string { return "/load <session-id>" }
 func (h *LoadCommandHandler) MinArgs() int { return 1 }
 
+// LastCommandHandler reopens the conversation last worked in
+type LastCommandHandler struct {
+	session *Session
+}
+
+func (h *LastCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *LastCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	if s.store == nil {
+		return false, errors.New("persistence is disabled")
+	}
+	id, err := s.store.LastSession(ctx)
+	if err != nil {
+		return false, err
+	}
+	if id == 0 {
+		s.println(s.colorize(colorGray, "No earlier conversation to continue."))
+		return false, nil
+	}
+	return false, s.handleLoadSession(ctx, id)
+}
+
+func (h *LastCommandHandler) Name() string { return "last" }
+func (h *LastCommandHandler) Aliases() []string { return []string{"/last"} }
+func (h *LastCommandHandler) HelpText() string { return "Reopen the conversation you last worked in" }
+func (h *LastCommandHandler) Usage() string { return "/last" }
+func (h *LastCommandHandler) MinArgs() int { return 0 }
+
+// PinSessionCommandHandler keeps a saved conversation at the top of /list
+type PinSessionCommandHandler struct {
+	session *Session
+}
+
+func (h *PinSessionCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *PinSessionCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	if s.store == nil {
+		return false, errors.New("persistence is disabled")
+	}
+	// Without an id, the current conversation is pinned
+	id := s.sessionID
+	if len(parts) > 1 {
+		var convErr error
+		if id, convErr = strconv.ParseInt(parts[1], 10, 64); convErr != nil {
+			return false, fmt.Errorf("invalid session id %q", parts[1])
+		}
+	}
+	if id == 0 {
+		return false, fmt.Errorf("usage: %s <session-id>", parts[0])
+	}
+
+	pin := parts[0] == "/pin" || parts[0] == "/pin-session"
+	if err := s.store.SetSessionPinned(ctx, id, pin); err != nil {
+		return false, err
+	}
+	if pin {
+		s.println(s.colorize(colorGray, fmt.Sprintf("Session #%d is pinned to the top of /list.", id)))
+	} else {
+		s.println(s.colorize(colorGray, fmt.Sprintf("Session #%d is no longer pinned.", id)))
+	}
+	return false, nil
+}
+
+func (h *PinSessionCommandHandler) Name() string { return "pin" }
+func (h *PinSessionCommandHandler) Aliases() []string {
+	return []string{"/pin", "/unpin", "/pin-session", "/unpin-session"}
+}
+func (h *PinSessionCommandHandler) HelpText() string {
+	return "Pin a saved conversation (default: this one) to the top of /list, or unpin it"
+}
+func (h *PinSessionCommandHandler) Usage() string { return "/pin-session [session-id] or /unpin-session [session-id]" }
+func (h *PinSessionCommandHandler) MinArgs() int { return 0 }
+
+// ArchiveCommandHandler hides a saved conversation from /list without deleting it
+type ArchiveCommandHandler struct {
+	session *Session
+}
+
+func (h *ArchiveCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *ArchiveCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	if s.store == nil {
+		return false, errors.New("persistence is disabled")
+	}
+	id := s.sessionID
+	if len(parts) > 1 {
+		var convErr error
+		if id, convErr = strconv.ParseInt(parts[1], 10, 64); convErr != nil {
+			return false, fmt.Errorf("invalid session id %q", parts[1])
+		}
+	}
+	if id == 0 {
+		return false, fmt.Errorf("usage: %s <session-id>", parts[0])
+	}
+
+	archive := parts[0] == "/archive"
+	if err := s.store.SetSessionArchived(ctx, id, archive); err != nil {
+		return false, err
+	}
+	if archive {
+		s.println(s.colorize(colorGray, fmt.Sprintf("Session #%d is archived; /list --all still shows it.", id)))
+	} else {
+		s.println(s.colorize(colorGray, fmt.Sprintf("Session #%d is back in /list.", id)))
+	}
+	return false, nil
+}
+
+func (h *ArchiveCommandHandler) Name() string { return "archive" }
+func (h *ArchiveCommandHandler) Aliases() []string { return []string{"/archive", "/unarchive"} }
+func (h *ArchiveCommandHandler) HelpText() string {
+	return "Hide a saved conversation (default: this one) from /list, or bring it back"
+}
+func (h *ArchiveCommandHandler) Usage() string { return "/archive [session-id] or /unarchive [session-id]" }
+func (h *ArchiveCommandHandler) MinArgs() int { return 0 }
+
+// DeleteCommandHandler moves a saved conversation to the trash, or restores it
+type DeleteCommandHandler struct {
+	session *Session
+}
+
+func (h *DeleteCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *DeleteCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	if s.store == nil {
+		return false, errors.New("persistence is disabled")
+	}
+	id := s.sessionID
+	if len(parts) > 1 {
+		var convErr error
+		if id, convErr = strconv.ParseInt(parts[1], 10, 64); convErr != nil {
+			return false, fmt.Errorf("invalid session id %q", parts[1])
+		}
+	}
+	if id == 0 {
+		return false, fmt.Errorf("usage: %s <session-id>", parts[0])
+	}
+
+	if parts[0] == "/undelete" {
+		if err := s.store.UndeleteSession(ctx, id); err != nil {
+			return false, err
+		}
+		s.println(s.colorize(colorGray, fmt.Sprintf("Session #%d restored.", id)))
+		return false, nil
+	}
+	if err := s.store.DeleteSession(ctx, id); err != nil {
+		return false, err
+	}
+	if id == s.sessionID {
+		// Otherwise the next answer would be saved to the deleted session
+		s.history = s.history[:0]
+		s.leaveSession()
+	}
+	s.println(s.colorize(colorGray, fmt.Sprintf("Session #%d moved to the trash; /undelete %d restores it.", id, id)))
+	return false, nil
+}
+
+func (h *DeleteCommandHandler) Name() string { return "delete" }
+func (h *DeleteCommandHandler) Aliases() []string { return []string{"/delete", "/undelete"} }
+func (h *DeleteCommandHandler) HelpText() string {
+	return "Move a saved conversation (default: this one) to the trash, or restore it"
+}
+func (h *DeleteCommandHandler) Usage() string { return "/delete [session-id] or /undelete <session-id>" }
+func (h *DeleteCommandHandler) MinArgs() int { return 0 }
+
+// TrashCommandHandler lists deleted conversations or purges them
+type TrashCommandHandler struct {
+	session *Session
+}
+
+func (h *TrashCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *TrashCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	if s.store == nil {
+		return false, errors.New("persistence is disabled")
+	}
+	if len(parts) > 1 {
+		if parts[1] != "empty" {
+			return false, errors.New("usage: /trash [empty]")
+		}
+		purged, err := s.store.PurgeDeletedSessions(ctx, 0)
+		if err != nil {
+			return false, err
+		}
+		s.println(s.colorize(colorGray, fmt.Sprintf("Permanently deleted %d session(s).", purged)))
+		return false, nil
+	}
+
+	sessions, err := s.store.ListDeletedSessions(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(sessions) == 0 {
+		s.println(s.colorize(colorGray, "The trash is empty."))
+		return false, nil
+	}
+	for _, session := range sessions {
+		title := session.Name
+		if strings.TrimSpace(title) == "" {
+			title = "Untitled session"
+		}
+		line := fmt.Sprintf("#%d %s — %d messages, deleted %s", session.ID, title, session.MessageCount, formatRelative(session.DeletedAt))
+		if retention := s.config.Storage.TrashRetention; retention > 0 {
+			line += ", purged " + session.DeletedAt.Add(retention).Local().Format("2006-01-02")
+		}
+		s.println(line)
+	}
+	s.println(s.colorize(colorGray, "/undelete <id> restores a session; /trash empty deletes them all for good."))
+	return false, nil
+}
+
+func (h *TrashCommandHandler) Name() string { return "trash" }
+func (h *TrashCommandHandler) Aliases() []string { return []string{"/trash"} }
+func (h *TrashCommandHandler) HelpText() string {
+	return "List deleted conversations, or purge them now"
+}
+func (h *TrashCommandHandler) Usage() string { return "/trash [empty]" }
+func (h *TrashCommandHandler) MinArgs() int { return 0 }
+
+// ForkCommandHandler continues a copy of the conversation up to a message
+type ForkCommandHandler struct {
+	session *Session
+}
+
+func (h *ForkCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *ForkCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	if s.store == nil {
+		return false, errors.New("persistence is disabled")
+	}
+	if s.sessionID == 0 || len(s.history) == 0 {
+		return false, errors.New("this conversation is not saved yet")
+	}
+
+	upTo := len(s.history)
+	if len(parts) > 1 {
+		n, convErr := strconv.Atoi(parts[1])
+		if convErr != nil || n < 1 || n > len(s.history) {
+			return false, fmt.Errorf("message number must be between 1 and %d (see /history)", len(s.history))
+		}
+		upTo = n
+	}
+
+	parent := s.sessionID
+	id, err := s.store.ForkSession(ctx, parent, s.messageOffset+upTo)
+	if err != nil {
+		return false, fmt.Errorf("fork session: %w", err)
+	}
+	s.history = s.history[:upTo]
+	s.sessionID = id
+	s.rememberSession(ctx)
+	s.duplicatePrompt = ""
+	s.println(s.colorize(colorGray, fmt.Sprintf("Forked session #%d at message %d into session #%d; continue here, or /load %d to return.", parent, upTo, id, parent)))
+	return false, nil
+}
+
+func (h *ForkCommandHandler) Name() string { return "fork" }
+func (h *ForkCommandHandler) Aliases() []string { return []string{"/fork"} }
+func (h *ForkCommandHandler) HelpText() string {
+	return "Continue a copy of this conversation from message n (default: the last)"
+}
+func (h *ForkCommandHandler) Usage() string { return "/fork [message-number]" }
+func (h *ForkCommandHandler) MinArgs() int { return 0 }
+
+// CloneCommandHandler copies a saved conversation into a new session and
+// continues there
+type CloneCommandHandler struct {
+	session *Session
+}
+
+func (h *CloneCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *CloneCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	if s.store == nil {
+		return false, errors.New("persistence is disabled")
+	}
+
+	source := s.sessionID
+	if len(parts) > 1 {
+		id, convErr := strconv.ParseInt(parts[1], 10, 64)
+		if convErr != nil {
+			return false, fmt.Errorf("invalid session id %q", parts[1])
+		}
+		source = id
+	}
+	if source == 0 {
+		return false, errors.New("usage: /clone <session-id>")
+	}
+
+	id, err := s.store.CloneSession(ctx, source)
+	if errors.Is(err, storage.ErrSessionLocked) {
+		return false, fmt.Errorf("session #%d is encrypted; /load it first, then /clone without an id", source)
+	}
+	if err != nil {
+		return false, fmt.Errorf("clone session: %w", err)
+	}
+	if err := s.handleLoadSession(ctx, id); err != nil {
+		return false, err
+	}
+	s.println(s.colorize(colorGray, fmt.Sprintf("Cloned session #%d into session #%d; continue here, or /load %d to return.", source, id, source)))
+	return false, nil
+}
+
+func (h *CloneCommandHandler) Name() string { return "clone" }
+func (h *CloneCommandHandler) Aliases() []string { return []string{"/clone"} }
+func (h *CloneCommandHandler) HelpText() string {
+	return "Continue in a copy of a saved conversation (default: this one)"
+}
+func (h *CloneCommandHandler) Usage() string { return "/clone [session-id]" }
+func (h *CloneCommandHandler) MinArgs() int { return 0 }
+
+// StatsCommandHandler summarises the saved history
+type StatsCommandHandler struct {
+	session *Session
+}
+
+func (h *StatsCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *StatsCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	if s.store == nil {
+		return false, errors.New("persistence is disabled")
+	}
+	stats, err := s.store.Stats(ctx)
+	if err != nil {
+		return false, fmt.Errorf("read stats: %w", err)
+	}
+	s.println(FormatStats(stats))
+	return false, nil
+}
+
+func (h *StatsCommandHandler) Name() string { return "stats" }
+func (h *StatsCommandHandler) Aliases() []string { return []string{"/stats"} }
+func (h *StatsCommandHandler) HelpText() string {
+	return "Show sessions, messages and tokens by model and month"
+}
+func (h *StatsCommandHandler) Usage() string { return "/stats" }
+func (h *StatsCommandHandler) MinArgs() int { return 0 }
+
+// ForgetLastCommandHandler removes the last question and its answer from the
+// conversation and from disk
+type ForgetLastCommandHandler struct {
+	session *Session
+}
+
+func (h *ForgetLastCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *ForgetLastCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	start := -1
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if s.history[i].Role == "user" {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return false, errors.New("there is no question to forget")
+	}
+
+	// Excluded exchanges were never saved
+	if s.store != nil && s.sessionID != 0 && !s.privacy.Excludes(s.history[start].Content) {
+		remaining, err := s.store.ForgetLastExchange(ctx, s.sessionID)
+		if err != nil {
+			return false, err
+		}
+		if remaining == 0 {
+			s.sessionID, s.messageOffset = 0, 0
+		}
+	}
+	s.history = s.history[:start]
+	s.duplicatePrompt = ""
+	s.println(s.colorize(colorGray, "Forgot the last question and its answer."))
+	return false, nil
+}
+
+func (h *ForgetLastCommandHandler) Name() string { return "forget-last" }
+func (h *ForgetLastCommandHandler) Aliases() []string { return []string{"/forget-last"} }
+func (h *ForgetLastCommandHandler) HelpText() string {
+	return "Remove the last question and answer from the conversation and from disk"
+}
+func (h *ForgetLastCommandHandler) Usage() string { return "" }
+func (h *ForgetLastCommandHandler) MinArgs() int { return 0 }
+
+// SensitiveCommandHandler encrypts the current conversation with a passphrase
+type SensitiveCommandHandler struct {
+	session *Session
+}
+
+func (h *SensitiveCommandHandler) setSession(s *Session) { h.session = s }
+
+func (h *SensitiveCommandHandler) Process(ctx context.Context, parts []string) (exit bool, err error) {
+	s := h.session
+	if s.store == nil {
+		return false, errors.New("persistence is disabled")
+	}
+
+	if len(parts) > 1 {
+		if parts[1] != "off" {
+			return false, errors.New("usage: /sensitive [off]")
+		}
+		if s.sessionID == 0 {
+			return false, errors.New("this conversation is not saved yet")
+		}
+		if err := s.store.DecryptSession(ctx, s.sessionID); err != nil {
+			return false, err
+		}
+		s.println(s.colorize(colorGray, "This conversation is no longer encrypted."))
+		return false, nil
+	}
+
+	passphrase, err := s.readPassphrase("New passphrase: ")
+	if err != nil {
+		return false, err
+	}
+	if len(passphrase) < storage.MinPassphraseLength {
+		return false, fmt.Errorf("the passphrase must be at least %d characters", storage.MinPassphraseLength)
+	}
+	confirm, err := s.readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return false, err
+	}
+	if confirm != passphrase {
+		return false, errors.New("the passphrases do not match")
+	}
+
+	// A neutral name, since the first question would otherwise become it
+	if err := s.ensureSession(ctx, "Sensitive conversation"); err != nil {
+		return false, err
+	}
+	if err := s.store.EncryptSession(ctx, s.sessionID, passphrase); err != nil {
+		return false, err
+	}
+	s.println(s.colorize(colorGray, fmt.Sprintf("Session #%d is now encrypted. Its name stays readable; /load asks for the passphrase.", s.sessionID)))
+	return false, nil
+}
+
+func (h *SensitiveCommandHandler) Name() string { return "sensitive" }
+func (h *SensitiveCommandHandler) Aliases() []string { return []string{"/sensitive"} }
+func (h *SensitiveCommandHandler) HelpText() string { return "Encrypt this conversation with a passphrase" }
+func (h *SensitiveCommandHandler) Usage() string { return "/sensitive [off]" }
+func (h *SensitiveCommandHandler) MinArgs() int { return 0 }
+
 // ANSI color codes and styles for terminal output
 const (
 	colorReset   = "\033[0m"
@@ -412,9 +967,10 @@ const (
 
 // Session manages a chat conversation with history.
 type Session struct {
-	client         *Client
+	client         ChatProvider
 	config         *config.Config
-	store          *storage.Store
+	store          storage.Backend
+	writer         *storage.Writer // Saves exchanges in the background; nil without a store
 	sessionID      int64
 	history        []Message
 	input          io.Reader
@@ -424,10 +980,26 @@ type Session struct {
 	renderMarkdown bool
 	lineReader     *liner.State
 	terminalWidth  int
+
+	// Messages of a long saved session that were not loaded into history
+	messageOffset int
+
+	// System prompt of the session, set with /system and saved with it
+	systemPrompt string
+
+	// Prompts kept off disk (privacy.exclude_patterns), and the last entry
+	// added to the input history
+	privacy   *PrivacyFilter
+	lastInput string
+
+	// A question that repeats an earlier one, and the index of the earlier
+	// answer. Sending it again asks anyway; /reuse shows the earlier answer.
+	duplicatePrompt string
+	duplicateAnswer int
 }
 
 // NewSession creates a new chat session.
-func NewSession(client *Client, cfg *config.Config, store *storage.Store, version string) (*Session, error) {
+func NewSession(client ChatProvider, cfg *config.Config, store storage.Backend, version string) (*Session, error) {
 	if client == nil {
 		return nil, errors.New("client cannot be nil")
 	}
@@ -445,16 +1017,24 @@ func NewSession(client *Client, cfg *config.Config, store *storage.Store, versio
 		useColors:      true,
 		version:        version,
 		renderMarkdown: true,
+		privacy:        NewPrivacyFilter(cfg),
+	}
+	if store != nil {
+		s.writer = storage.NewWriter(store, cfg.Timeouts.Persist)
 	}
 
 	// Detect terminal width for responsive design
-	s.detectTerminalWidth()
+	if margin := s.detectTerminalWidth(); margin > 0 && cfg.UI.Center {
+		s.output = &indentWriter{w: s.output, indent: strings.Repeat(" ", margin), lineStart: true}
+	}
 
 	return s, nil
 }
 
-// detectTerminalWidth determines the actual terminal width for responsive UI
-func (s *Session) detectTerminalWidth() {
+// detectTerminalWidth determines the actual terminal width for responsive UI.
+// It returns the left margin that centers the column when it is narrower
+// than the terminal.
+func (s *Session) detectTerminalWidth() int {
 	width := 80 // Default fallback width
 
 	// Try to get terminal size from the system
@@ -463,15 +1043,46 @@ func (s *Session) detectTerminalWidth() {
 			width = w
 		}
 	}
+	available := width
 
 	// Apply reasonable limits for terminal UI
-	if width > 120 {
-		width = 120 // Cap maximum width for better readability
+	if maxWidth := s.config.UI.MaxWidth; maxWidth > 0 && width > maxWidth {
+		width = maxWidth // Cap maximum width for better readability
 	} else if width < 40 {
 		width = 40 // Minimum width for UI elements
 	}
 
 	s.terminalWidth = width
+	if available > width {
+		return (available - width) / 2
+	}
+	return 0
+}
+
+// indentWriter prefixes every output line with indent, shifting the whole
+// session to the right when ui.center is set.
+type indentWriter struct {
+	w         io.Writer
+	indent    string
+	lineStart bool
+}
+
+func (iw *indentWriter) Write(p []byte) (int, error) {
+	var b bytes.Buffer
+	for _, c := range p {
+		if iw.lineStart && c != '\n' && c != '\r' {
+			b.WriteString(iw.indent)
+			iw.lineStart = false
+		}
+		b.WriteByte(c)
+		if c == '\n' || c == '\r' {
+			iw.lineStart = true
+		}
+	}
+	if _, err := iw.w.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
 // getContentWidth returns the usable width for content (excluding margins/padding)
@@ -491,7 +1102,10 @@ func (s *Session) Run(ctx context.Context) error {
 		return errors.New("context is nil")
 	}
 
-	s.printWelcome()
+	if s.config.UI.ShowWelcome {
+		s.printWelcome()
+	}
+	defer s.closeWriter()
 
 	var scanner *bufio.Scanner
 	if s.shouldUseLineEditor() {
@@ -508,6 +1122,7 @@ func (s *Session) Run(ctx context.Context) error {
 		var raw string
 		var err error
 
+		s.reportSaveErrors()
 		if s.lineReader != nil {
 			raw, err = s.lineReader.Prompt(s.plainPromptString())
 			if err != nil {
@@ -536,8 +1151,9 @@ func (s *Session) Run(ctx context.Context) error {
 		if input == "" {
 			continue
 		}
-		if s.lineReader != nil {
+		if s.lineReader != nil && input != s.lastInput && !s.privacy.Excludes(input) {
 			s.lineReader.AppendHistory(input)
+			s.lastInput = input
 		}
 
 		// Handle commands
@@ -579,31 +1195,154 @@ func (s *Session) ensureSession(ctx context.Context, firstMessage string) error
 	}
 
 	s.sessionID = id
+	s.rememberSession(ctx)
+	if s.systemPrompt != "" {
+		if err := s.store.SetSessionSystemPrompt(ctx, id, s.systemPrompt); err != nil {
+			return fmt.Errorf("save system prompt: %w", err)
+		}
+	}
 	return nil
 }
 
-func (s *Session) persistExchange(ctx context.Context, userMsg, assistantMsg Message) {
-	if s.store == nil || s.sessionID == 0 {
+// rememberSession records the current session for /last.
+func (s *Session) rememberSession(ctx context.Context) {
+	// Failing only leaves /last on an earlier session
+	_ = s.store.SetLastSession(ctx, s.sessionID)
+}
+
+// persistExchange queues a question and its answer to be saved.
+func (s *Session) persistExchange(userMsg, assistantMsg Message) {
+	if s.store == nil || s.sessionID == 0 || s.privacy.Excludes(userMsg.Content) {
 		return
 	}
+	err := s.writer.Save(s.sessionID,
+		storage.Message{Role: userMsg.Role, Content: userMsg.Content, Attachments: userMsg.Attachments},
+		storage.Message{Role: assistantMsg.Role, Content: assistantMsg.Content, Meta: metaOf(assistantMsg)},
+	)
+	if err != nil {
+		s.printError(fmt.Sprintf("Failed to save messages batch: %v", err))
+	}
+}
 
-	// Use batch operations for better performance
-	messages := []storage.Message{
-		{Role: userMsg.Role, Content: userMsg.Content},
-		{Role: assistantMsg.Role, Content: assistantMsg.Content},
+// persistPartialExchange queues a question and the partial answer to it to
+// be saved.
+func (s *Session) persistPartialExchange(userMsg, assistantMsg Message) {
+	if s.store == nil || s.sessionID == 0 || s.privacy.Excludes(userMsg.Content) {
+		return
+	}
+	err := s.writer.Save(s.sessionID,
+		storage.Message{Role: userMsg.Role, Content: userMsg.Content, Attachments: userMsg.Attachments},
+		storage.Message{Role: assistantMsg.Role, Content: assistantMsg.Content, Interrupted: true, Meta: metaOf(assistantMsg)},
+	)
+	if err != nil {
+		s.printError(fmt.Sprintf("Failed to save messages batch: %v", err))
 	}
+}
 
-	if err := s.store.AppendMessagesBatch(ctx, s.sessionID, messages); err != nil {
+// flushWriter waits for the exchanges being saved, up to timeouts.persist.
+func (s *Session) flushWriter(ctx context.Context) {
+	if s.writer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeouts.Persist)
+	defer cancel()
+	if err := s.writer.Flush(ctx); err != nil {
 		s.printError(fmt.Sprintf("Failed to save messages batch: %v", err))
 	}
+	s.reportSaveErrors()
 }
 
-func (s *Session) handleListSessions(ctx context.Context) error {
+// reportSaveErrors prints the saves that failed in the background.
+func (s *Session) reportSaveErrors() {
+	if s.writer == nil {
+		return
+	}
+	for {
+		select {
+		case err, ok := <-s.writer.Errors():
+			if !ok {
+				return
+			}
+			s.printError(fmt.Sprintf("Failed to save messages batch: %v", err))
+		default:
+			return
+		}
+	}
+}
+
+// closeWriter saves the queued exchanges before the session ends.
+func (s *Session) closeWriter() {
+	if s.writer == nil {
+		return
+	}
+	s.writer.Close()
+	s.reportSaveErrors()
+}
+
+// replyMeta describes the request that produced the latest reply. The token
+// counts are only known when the request completed.
+func (s *Session) replyMeta(complete bool) *storage.MessageMeta {
+	temperature := s.config.Model.Temperature
+	meta := &storage.MessageMeta{Model: s.config.Model.Name, Temperature: &temperature}
+	if !complete {
+		return meta
+	}
+	if model := s.client.LastModel(); model != "" {
+		meta.Model = model
+	}
+	if usage := s.client.LastUsage(); usage != nil {
+		meta.PromptTokens, meta.CompletionTokens = usage.PromptTokens, usage.CompletionTokens
+	}
+	return meta
+}
+
+// metaOf returns the request metadata of msg, if any.
+func metaOf(msg Message) storage.MessageMeta {
+	if msg.Meta == nil {
+		return storage.MessageMeta{}
+	}
+	return *msg.Meta
+}
+
+// requestHistory returns the history sent with a request: the system prompt,
+// then the conversation trimmed to the configured window.
+func (s *Session) requestHistory() []Message {
+	return WithSystemPrompt(TrimHistory(s.history, s.config.Model.MaxHistory, nil), s.systemPrompt)
+}
+
+// leaveSession forgets the current session, locking it again if it is
+// encrypted.
+func (s *Session) leaveSession() {
+	if s.store != nil && s.sessionID != 0 {
+		s.store.LockSession(s.sessionID)
+	}
+	s.sessionID = 0
+	s.messageOffset = 0
+	s.systemPrompt = ""
+}
+
+// readPassphrase asks for a passphrase without echoing it.
+func (s *Session) readPassphrase(prompt string) (string, error) {
+	if s.lineReader == nil {
+		return "", errors.New("a passphrase can only be entered at an interactive terminal")
+	}
+	passphrase, err := s.lineReader.PasswordPrompt(prompt)
+	if errors.Is(err, liner.ErrPromptAborted) {
+		return "", errors.New("cancelled")
+	}
+	return passphrase, err
+}
+
+func (s *Session) handleListSessions(ctx context.Context, all bool) error {
 	if s.store == nil {
 		return errors.New("persistence is disabled")
 	}
 
-	sessions, err := s.store.ListSessions(ctx, 0)
+	list := s.store.ListSessions
+	if all {
+		list = s.store.ListAllSessions
+	}
+	sessions, err := list(ctx, 0)
 	if err != nil {
 		return fmt.Errorf("list sessions: %w", err)
 	}
@@ -651,14 +1390,31 @@ func (s *Session) handleListSessions(ctx context.Context) error {
 
 		// Session header
 		sessionHeader := fmt.Sprintf("#%d %s", summary.ID, title)
+		if summary.Pinned {
+			sessionHeader = "📌 " + sessionHeader
+		}
+		if summary.Sensitive {
+			sessionHeader += " 🔒"
+		}
+		if summary.Archived {
+			sessionHeader += " (archived)"
+		}
 		fmt.Fprint(s.output, ui.BGSystem+ui.BrightWhite+" │ "+sessionHeader)
 		if len(sessionHeader) < width-3 {
 			fmt.Fprint(s.output, strings.Repeat(" ", width-3-len(sessionHeader)))
 		}
 		fmt.Fprint(s.output, " │"+ui.Reset+"\n")
 
+		// Summary, saved with /summarize --save or storage.summary_every
+		if summary.Summary != "" {
+			fmt.Fprint(s.output, ui.BGSystem+ui.BrightWhite+" │   "+summary.Summary+ui.Reset+"\n")
+		}
+
 		// Session details
 		details := fmt.Sprintf("  📝 %d messages │ 🕐 %s", summary.MessageCount, updated)
+		if summary.ParentID != 0 {
+			details += fmt.Sprintf(" │ forked from #%d", summary.ParentID)
+		}
 		fmt.Fprint(s.output, ui.BGSystem+ui.BrightWhite+" │ "+details)
 		if len(details) < width-3 {
 			fmt.Fprint(s.output, strings.Repeat(" ", width-3-len(details)))
@@ -681,15 +1437,36 @@ func (s *Session) handleLoadSession(ctx context.Context, id int64) error {
 	}
 
 	transcript, err := s.store.LoadSession(ctx, id)
+	if errors.Is(err, storage.ErrSessionLocked) {
+		passphrase, promptErr := s.readPassphrase(fmt.Sprintf("Passphrase for session #%d: ", id))
+		if promptErr != nil {
+			return promptErr
+		}
+		if err := s.store.UnlockSession(ctx, id, passphrase); err != nil {
+			return err
+		}
+		transcript, err = s.store.LoadSession(ctx, id)
+	}
 	if err != nil {
 		return fmt.Errorf("load session: %w", err)
 	}
 
+	if s.sessionID != transcript.Summary.ID {
+		s.leaveSession()
+	}
 	s.sessionID = transcript.Summary.ID
+	s.rememberSession(ctx)
+	s.messageOffset = max(transcript.Summary.MessageCount-len(transcript.Messages), 0)
+	s.systemPrompt = transcript.Summary.SystemPrompt
 	s.history = s.history[:0]
 
 	for _, msg := range transcript.Messages {
-		s.history = append(s.history, Message{Role: msg.Role, Content: msg.Content})
+		loaded := Message{Role: msg.Role, Content: msg.Content, Attachments: msg.Attachments}
+		if !msg.Meta.IsZero() {
+			meta := msg.Meta
+			loaded.Meta = &meta
+		}
+		s.history = append(s.history, loaded)
 	}
 
 	title := transcript.Summary.Name
@@ -746,7 +1523,7 @@ func formatRelative(t time.Time) string {
 	if delta < 30*24*time.Hour {
 		return fmt.Sprintf("%d d ago", int(delta.Hours()/24))
 	}
-	return t.Format("2006-01-02")
+	return ui.FormatDate(t)
 }
 
 func (s *Session) sendMessage(ctx context.Context, input string) error {
@@ -758,12 +1535,40 @@ func (s *Session) sendMessage(ctx context.Context, input string) error {
 	// Sanitize the input
 	sanitizedInput := validation.SanitizeInput(input, validation.MaxUserMessageLength)
 
-	// Create a child context with timeout for the entire operation
-	// Create a child context with timeout for the entire operation
-	messageCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	// Repeated questions are sent on the second try
+	if s.config.UI.DetectDuplicates && s.duplicatePrompt != sanitizedInput {
+		if answer := FindDuplicateQuestion(s.history, sanitizedInput); answer >= 0 {
+			s.duplicatePrompt, s.duplicateAnswer = sanitizedInput, answer
+			s.println(s.colorize(colorGray, fmt.Sprintf(
+				"You asked this before (message #%d). Type /reuse to see that answer again, or send the question again for a new one.", answer)))
+			return nil
+		}
+	}
+	s.duplicatePrompt = ""
+
+	// Create a child context for the entire operation. A streaming answer
+	// has no deadline of its own: the client ends it when the provider sends
+	// nothing for timeouts.stream
+	var messageCtx context.Context
+	var cancel context.CancelFunc
+	if s.config.Model.Stream {
+		messageCtx, cancel = context.WithCancel(ctx)
+	} else {
+		messageCtx, cancel = context.WithTimeout(ctx, s.config.Timeouts.Request)
+	}
 	defer func() { cancel() }()
+	if s.config.Model.Stream {
+		// Ctrl+C stops the answer instead of quitting
+		var stop context.CancelFunc
+		messageCtx, stop = signal.NotifyContext(messageCtx, os.Interrupt)
+		defer stop()
+	}
 
-	if s.store != nil && s.sessionID == 0 {
+	excluded := s.privacy.Excludes(sanitizedInput)
+	if excluded && s.store != nil {
+		s.println(s.colorize(colorGray, "(not saved: the message matches privacy.exclude_patterns)"))
+	}
+	if s.store != nil && s.sessionID == 0 && !excluded {
 		if err := s.ensureSession(messageCtx, sanitizedInput); err != nil {
 			s.printError(fmt.Sprintf("Failed to initialise persistence: %v", err))
 			s.store = nil
@@ -795,12 +1600,24 @@ func (s *Session) sendMessage(ctx context.Context, input string) error {
 		reply, err = s.streamResponse(messageCtx)
 	} else {
 		// Non-streaming mode
-		reply, err = s.client.Chat(messageCtx, s.history, s.config.Model.Name, s.config.Model.Temperature)
+		reply, err = s.client.ChatWithOptions(messageCtx, s.requestHistory(), s.config.Model.Name, s.config.Model.Temperature, RequestOptionsFromConfig(s.config))
 		if err == nil {
 			s.printAssistant(reply)
 		}
 	}
 
+	if err != nil && strings.TrimSpace(reply) != "" {
+		// Keep a partial answer, marked as interrupted, rather than lose it
+		assistantMsg := Message{Role: "assistant", Content: reply, Meta: s.replyMeta(false)}
+		s.history = append(s.history, assistantMsg)
+		s.persistPartialExchange(userMsg, assistantMsg)
+		if messageCtx.Err() != nil {
+			s.println(s.colorize(colorGray, "(interrupted, the partial answer was kept)"))
+			return nil
+		}
+		return fmt.Errorf("chat request failed, the partial answer was kept: %w", err)
+	}
+
 	if err != nil {
 		// Remove the user message if the request failed
 		s.history = s.history[:len(s.history)-1]
@@ -813,13 +1630,11 @@ func (s *Session) sendMessage(ctx context.Context, input string) error {
 	}
 
 	// Add assistant response to history
-	assistantMsg := Message{Role: "assistant", Content: reply}
+	assistantMsg := Message{Role: "assistant", Content: reply, Meta: s.replyMeta(true)}
 	s.history = append(s.history, assistantMsg)
 
-	// Persist with a separate timeout for storage operations
-	persistCtx, persistCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer persistCancel()
-	s.persistExchange(persistCtx, userMsg, assistantMsg)
+	// Saved in the background, with its own timeout
+	s.persistExchange(userMsg, assistantMsg)
 
 	return nil
 }
@@ -856,7 +1671,18 @@ func (s *Session) streamResponse(ctx context.Context) (string, error) {
 	thinkTagPattern := regexp.MustCompile(`(<thinking>)|(<think>)`)
 	thinkClosePattern := regexp.MustCompile(`(</thinking>)|(</think>)`)
 
-	err := s.client.ChatStream(ctx, s.history, s.config.Model.Name, s.config.Model.Temperature, func(chunk string) error {
+	opts := RequestOptionsFromConfig(s.config)
+	// Token usage is saved with the answer
+	opts.IncludeUsage = s.store != nil
+	err := s.client.ChatStreamEvents(ctx, s.requestHistory(), s.config.Model.Name, s.config.Model.Temperature, opts, func(event StreamEvent) error {
+		if event.RetryAfter > 0 {
+			fmt.Fprintf(s.output, "\r\x1b[K%s", s.colorize(colorYellow, fmt.Sprintf("Rate limited, retrying in %ds...", int(math.Ceil(event.RetryAfter.Seconds())))))
+			return nil
+		}
+		chunk := event.Content
+		if chunk == "" {
+			return nil
+		}
 		fullResponse.WriteString(chunk)
 
 		// Update loading animation frame periodically
@@ -1008,7 +1834,12 @@ func (s *Session) streamResponse(ctx context.Context) (string, error) {
 	})
 
 	if err != nil {
-		return "", err
+		// Return what arrived so a partial answer can be kept
+		if s.useColors {
+			fmt.Fprint(s.output, ui.Reset)
+		}
+		fmt.Fprintln(s.output)
+		return fullResponse.String(), err
 	}
 
 	// Reset colors and add newline after streaming
@@ -1061,6 +1892,10 @@ func (s *Session) handleCommand(ctx context.Context, cmd string) (exit bool, err
 		return false, nil
 	}
 
+	// Commands read and change saved sessions, so they must see every
+	// exchange saved before them
+	s.flushWriter(ctx)
+
 	handlers := s.initializeCommandHandlers()
 	commandName, reg := findCommand(parts[0])
 
@@ -1284,6 +2119,16 @@ func (s *Session) printHistory() {
 		}
 		fmt.Fprint(s.output, " │"+ui.Reset+"\n")
 
+		// How the answer was produced, when known
+		if msg.Meta != nil && !msg.Meta.IsZero() {
+			meta := "    (" + msg.Meta.String() + ")"
+			fmt.Fprint(s.output, ui.BGSystem+ui.Gray+" │ "+meta)
+			if len(meta) < width-3 {
+				fmt.Fprint(s.output, strings.Repeat(" ", width-3-len(meta)))
+			}
+			fmt.Fprint(s.output, " │"+ui.Reset+"\n")
+		}
+
 		// Empty line between messages
 		fmt.Fprint(s.output, ui.BGSystem+" │"+strings.Repeat(" ", width-2)+"│"+ui.Reset+"\n")
 	}
@@ -1298,6 +2143,7 @@ func (s *Session) printPrompt() {
 
 func (s *Session) printAssistant(text string) {
 	if s.renderMarkdown {
+		text = ui.TagCodeFences(text)
 		renderer, err := getMarkdownRenderer()
 		if err != nil {
 			// Failed to get renderer, fallback to plain text
@@ -1566,7 +2412,7 @@ func (s *Session) promptString() string {
 
 	// Add timestamp if enabled
 	if s.config.UI.ShowTimestamps {
-		timestamp := time.Now().Format("15:04")
+		timestamp := ui.FormatTimestamp(time.Now())
 		prompt.WriteString(s.colorize(styleDim+colorGray, fmt.Sprintf("%s ", timestamp)))
 	}
 
@@ -1586,7 +2432,7 @@ func (s *Session) plainPromptString() string {
 
 	// Add timestamp if enabled
 	if s.config.UI.ShowTimestamps {
-		timestamp := time.Now().Format("15:04")
+		timestamp := ui.FormatTimestamp(time.Now())
 		prompt.WriteString(fmt.Sprintf("%s ", timestamp))
 	}
 
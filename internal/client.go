@@ -7,19 +7,20 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"runtime"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ZaguanLabs/chatty/internal/metrics"
 	"github.com/ZaguanLabs/chatty/internal/security"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+	"github.com/ZaguanLabs/chatty/internal/validation"
 	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
 	"github.com/hashicorp/golang-lru/v2"
 )
@@ -28,12 +29,104 @@ const (
 	defaultTimeout   = 30 * time.Second
 	streamingTimeout = 120 * time.Second
 	cacheSize        = 128
+
+	// DefaultMaxStreamLine is the largest single SSE line accepted by default.
+	// Lines grow the read buffer on demand up to this size.
+	DefaultMaxStreamLine = 1024 * 1024
 )
 
 // Message represents a single chat message.
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ToolCalls are the tools an assistant message asked to run, and
+	// ToolCallID links a tool message to the call it answers.
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Meta describes the request that produced an assistant message. It is
+	// kept locally and never sent to the provider.
+	Meta *storage.MessageMeta `json:"-"`
+	// Attachments are sent as content parts after the text; see MarshalJSON.
+	Attachments []storage.Attachment `json:"-"`
+	// ToolTrace records the tools called while an assistant message was
+	// produced. It is kept locally; see ExpandToolTrace.
+	ToolTrace []storage.ToolCallRecord `json:"-"`
+}
+
+// RequestOptions holds optional request parameters. Zero values are omitted
+// from the request payload so the provider defaults apply.
+type RequestOptions struct {
+	MaxTokens   int  // Upper bound on generated tokens
+	Seed        *int // Sampling seed for reproducible outputs
+	Logprobs    bool // Request token log probabilities
+	TopLogprobs int  // Number of alternative tokens to return per position
+
+	// ReasoningEffort is sent to models that support it (low, medium, high).
+	ReasoningEffort string
+	// Capabilities overrides the built-in capability map for the model.
+	Capabilities *ModelCapabilities
+	// IncludeUsage asks streaming responses to report token usage in a final chunk.
+	IncludeUsage bool
+	// Metadata is sent as the request's metadata object so gateways can
+	// attribute cost (OpenAI metadata, LiteLLM tags and similar).
+	Metadata map[string]string
+	// User identifies the end user to the provider for usage attribution.
+	User string
+	// Stop lists sequences that end generation when produced.
+	Stop []string
+	// Tools the model may call, and ToolChoice ("none", "auto") whether it may.
+	Tools      []Tool
+	ToolChoice string
+}
+
+// StreamEvent is a parsed piece of a streaming response. Only the fields
+// carried by the underlying chunk are set.
+type StreamEvent struct {
+	Role         string          // Role announced in the first delta
+	Content      string          // Text delta, possibly several chunks buffered together
+	ToolCalls    []ToolCallDelta // Incremental tool call data
+	FinishReason string          // Why generation stopped: stop, length, tool_calls, content_filter
+	Usage        *Usage          // Token usage, sent in a final chunk when requested
+	RetryAfter   time.Duration   // Set while waiting out a rate limit before retrying
+	// ToolRun is a tool call the Toolbox ran, with its result, sent once
+	// the result is known
+	ToolRun *storage.ToolCallRecord
+}
+
+// FinishReasonNote explains a finish reason that means the answer is incomplete,
+// or returns an empty string for a normal completion.
+func FinishReasonNote(reason string) string {
+	switch reason {
+	case "length":
+		return "(response truncated: token limit reached)"
+	case "content_filter":
+		return "(response stopped by the provider's content filter)"
+	default:
+		return ""
+	}
+}
+
+// ToolCallDelta is an incremental update to a tool call in a streaming response.
+// Arguments arrive in fragments that must be concatenated per Index.
+type ToolCallDelta struct {
+	Index    int          `json:"index"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// Usage holds the token counts reported by the API for a response.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// TokenLogprob holds the log probability of a generated token and, when
+// requested, the most likely alternatives at that position.
+type TokenLogprob struct {
+	Token       string         `json:"token"`
+	Logprob     float64        `json:"logprob"`
+	TopLogprobs []TokenLogprob `json:"top_logprobs,omitempty"`
 }
 
 // Client handles HTTP communication with OpenAI-compatible APIs.
@@ -43,10 +136,27 @@ type Client struct {
 	http            *http.Client
 	streamBuf       *bufio.Writer
 	bufMutex        sync.Mutex
-	flushThreshold  int // Threshold in bytes before flushing buffer
+	flushThreshold  int           // Threshold in bytes before flushing buffer
+	flushInterval   time.Duration // Longest content stays buffered, 0 = no limit
 	cache           *lru.Cache[string, string]
 	rateLimiter     *security.RateLimiter
 	apiTokenBucket  *security.APITokenBucket
+	breaker         *security.CircuitBreaker // Stops requests to a failing endpoint
+	metrics         *metrics.Metrics         // Usage counters for /metrics, nil when not served
+	audit           *auditor                 // Records every request when the audit log is enabled
+	logprobs        []TokenLogprob
+	logprobsMutex   sync.Mutex
+	requestTimeout  time.Duration // Deadline for non-streaming requests
+	streamTimeout   time.Duration // Longest silence in a streaming response; deadline of long requests
+	maxStreamLine   int           // Largest SSE line accepted, in bytes
+	organization    string        // Sent as OpenAI-Organization when set
+	project         string        // Sent as OpenAI-Project when set
+	usage           *Usage
+	usageMutex      sync.Mutex
+	fallbacks       []Fallback
+	debug           *debugTransport // Set when the debug log is enabled
+	lastModel       string
+	lastModelMutex  sync.Mutex
 }
 
 // NewClient creates a new API client.
@@ -67,89 +177,83 @@ func NewClient(apiKey, baseURL string) (*Client, error) {
 	return &Client{
 		apiKey:         apiKey,
 		baseURL:        strings.TrimSuffix(baseURL, "/"),
-		http: &http.Client{
-			Timeout: defaultTimeout,
-		},
+		// Deadlines are applied per request so streams are not cut off by
+		// the shorter non-streaming timeout.
+		http:           &http.Client{},
 		flushThreshold: 256, // Set a reasonable default buffer size
 		cache:          cache,
+		requestTimeout: defaultTimeout,
+		streamTimeout:  streamingTimeout,
+		maxStreamLine:  DefaultMaxStreamLine,
 	}, nil
 }
 
 // Chat sends a chat completion request and returns the assistant's response.
 func (c *Client) Chat(ctx context.Context, messages []Message, model string, temperature float64) (string, error) {
+	return c.ChatWithOptions(ctx, messages, model, temperature, RequestOptions{})
+}
+
+// ChatWithOptions sends a chat completion request including the optional parameters in opts.
+// Rate limited requests are retried after the delay the server asks for, and if
+// the request still fails with a status that warrants it, the configured
+// fallbacks are tried in order.
+func (c *Client) ChatWithOptions(ctx context.Context, messages []Message, model string, temperature float64, opts RequestOptions) (string, error) {
 	if c == nil {
 		return "", chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
 	}
 
-	// Check rate limiting
-	if c.rateLimiter != nil {
-		if !c.rateLimiter.Allow(c.apiKey) {
-			remainingTime := c.rateLimiter.GetRemainingTime(c.apiKey)
-			return "", chattyErrors.NewSecureNetworkError(
-				"Rate limit exceeded",
-				fmt.Sprintf("Rate limit exceeded, please try again in %v", remainingTime),
-				c.baseURL,
-				429,
-				nil,
-			)
-		}
-	}
+	var response string
+	err := c.withFallbacks(model, opts, func(client *Client, model string, opts RequestOptions) error {
+		err := client.retryRateLimited(ctx, nil, func() error {
+			var err error
+			response, err = client.chat(ctx, messages, model, temperature, opts)
+			return err
+		})
+		c.auditRequest(client, model, messages, response, err)
+		return err
+	})
+	return response, err
+}
 
-	// Check token bucket
-	if c.apiTokenBucket != nil {
-		if !c.apiTokenBucket.Allow() {
-			return "", chattyErrors.NewSecureNetworkError(
-				"API temporarily unavailable",
-				"API token bucket exhausted",
-				c.baseURL,
-				503,
-				nil,
-			)
-		}
+func (c *Client) chat(ctx context.Context, messages []Message, model string, temperature float64, opts RequestOptions) (string, error) {
+	if err := c.checkRateLimits(); err != nil {
+		return "", err
 	}
 
 	// Generate a cache key for the request
-	cacheKey, err := c.generateCacheKey(messages, model, temperature)
+	cacheKey, err := c.generateCacheKey(messages, model, temperature, opts)
 	if err != nil {
 		// Log the error but proceed without caching
 		fmt.Printf("Error generating cache key: %v\n", err)
 	}
 
-	// Check cache first
-	if c.cache != nil && cacheKey != "" {
+	// Check cache first. Cached responses carry no logprobs, so skip the
+	// cache when they were requested.
+	c.setLogprobs(nil)
+	c.setUsage(nil)
+	if c.cache != nil && cacheKey != "" && !opts.Logprobs {
 		if cached, ok := c.cache.Get(cacheKey); ok {
+			c.metrics.CacheHit()
 			return cached, nil
 		}
+		c.metrics.CacheMiss()
 	}
 
-	reqBody := map[string]interface{}{
-		"model":    model,
-		"messages": messages,
-		"stream":   false,
-	}
-
-	// Include temperature only if not an o3 model
-	if !strings.HasPrefix(model, "o3") {
-		reqBody["temperature"] = temperature
-	}
-
-	payload, err := json.Marshal(reqBody)
+	payload, err := json.Marshal(buildRequestBody(messages, model, temperature, false, opts))
 	if err != nil {
 		return "", fmt.Errorf("encode request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(payload))
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/chat/completions", bytes.NewReader(payload))
 	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+		return "", err
 	}
-
-	// Set security headers
-	setSecurityHeaders(req)
-
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return "", fmt.Errorf("execute request: %w", err)
 	}
@@ -157,7 +261,7 @@ func (c *Client) Chat(ctx context.Context, messages []Message, model string, tem
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", c.decodeError(bytes.NewReader(bodyBytes), resp.StatusCode)
+		return "", c.responseError(resp, bodyBytes)
 	}
 
 	response, err := c.decodeSuccess(resp.Body)
@@ -173,40 +277,64 @@ func (c *Client) Chat(ctx context.Context, messages []Message, model string, tem
 	return response, nil
 }
 
-// generateCacheKey creates a unique hash for a given set of messages and parameters.
-func (c *Client) generateCacheKey(messages []Message, model string, temperature float64) (string, error) {
-	// Create a struct to hold all cacheable data
-	cacheable := struct {
-		Messages    []Message `json:"messages"`
-		Model       string    `json:"model"`
-		Temperature float64   `json:"temperature"`
-	}{
-		Messages:    messages,
-		Model:       model,
-		Temperature: temperature,
+// SetMetrics records API usage in m. Call it after SetFallbacks so fallback
+// providers are counted too.
+func (c *Client) SetMetrics(m *metrics.Metrics) {
+	c.metrics = m
+	for _, fallback := range c.fallbacks {
+		if fallback.Client != nil {
+			fallback.Client.metrics = m
+		}
 	}
+}
 
-	// Marshal the data to JSON
-	data, err := json.Marshal(cacheable)
-	if err != nil {
-		return "", fmt.Errorf("marshal cache key: %w", err)
+// SetTimeouts sets the deadline of regular requests and how long a streaming
+// response may go without sending anything. Zero values leave the current
+// setting unchanged.
+func (c *Client) SetTimeouts(request, stream time.Duration) {
+	if request > 0 {
+		c.requestTimeout = request
+	}
+	if stream > 0 {
+		c.streamTimeout = stream
 	}
-
-	// Hash the JSON data
-	hash := sha256.Sum256(data)
-	return fmt.Sprintf("%x", hash), nil
 }
 
+// SetStreamBuffering sets how much streamed content is collected before it is
+// delivered: up to threshold bytes, and for at most interval when it is
+// positive. A threshold of 1 delivers every chunk as it arrives;
+// non-positive thresholds leave the current setting unchanged.
+func (c *Client) SetStreamBuffering(threshold int, interval time.Duration) {
+	if threshold > 0 {
+		c.flushThreshold = threshold
+	}
+	if interval >= 0 {
+		c.flushInterval = interval
+	}
+}
 
-// ChatStream sends a streaming chat completion request and calls onChunk for each content delta.
-func (c *Client) ChatStream(ctx context.Context, messages []Message, model string, temperature float64, onChunk func(string) error) error {
-	if c == nil {
-		return chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
+// SetMaxStreamLine sets the largest single streaming line, in bytes, the client
+// accepts before failing the stream. Non-positive values are ignored.
+func (c *Client) SetMaxStreamLine(n int) {
+	if n > 0 {
+		c.maxStreamLine = n
 	}
+}
+
+// SetOrganization sets the OpenAI organization and project sent with every
+// request, so usage is billed to the right bucket. Empty values are omitted.
+func (c *Client) SetOrganization(organization, project string) {
+	c.organization = strings.TrimSpace(organization)
+	c.project = strings.TrimSpace(project)
+}
 
+// checkRateLimits consults the client-side rate limiter, token bucket and
+// circuit breaker before a request is sent.
+func (c *Client) checkRateLimits() error {
 	// Check rate limiting
 	if c.rateLimiter != nil {
 		if !c.rateLimiter.Allow(c.apiKey) {
+			c.metrics.RateLimited()
 			remainingTime := c.rateLimiter.GetRemainingTime(c.apiKey)
 			return chattyErrors.NewSecureNetworkError(
 				"Rate limit exceeded",
@@ -221,133 +349,569 @@ func (c *Client) ChatStream(ctx context.Context, messages []Message, model strin
 	// Check token bucket
 	if c.apiTokenBucket != nil {
 		if !c.apiTokenBucket.Allow() {
-			return errors.New("API token bucket exhausted, please try again later")
+			c.metrics.RateLimited()
+			return chattyErrors.NewSecureNetworkError(
+				"API temporarily unavailable",
+				"API token bucket exhausted",
+				c.baseURL,
+				503,
+				nil,
+			)
 		}
 	}
 
+	return c.checkCircuit()
+}
+
+// newRequest creates an authenticated API request for the given endpoint path.
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	// Set security headers
+	setSecurityHeaders(req)
+
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if c.organization != "" {
+		req.Header.Set("OpenAI-Organization", c.organization)
+	}
+	if c.project != "" {
+		req.Header.Set("OpenAI-Project", c.project)
+	}
+	return req, nil
+}
+
+// buildRequestBody assembles the chat completion payload shared by streaming and non-streaming requests.
+func buildRequestBody(messages []Message, model string, temperature float64, stream bool, opts RequestOptions) map[string]interface{} {
 	reqBody := map[string]interface{}{
 		"model":    model,
 		"messages": messages,
-		"stream":   true,
+		"stream":   stream,
 	}
 
-	// Include temperature only if not an o3 model
-	if !strings.HasPrefix(model, "o3") {
+	caps := CapabilitiesFor(model)
+	if opts.Capabilities != nil {
+		caps = *opts.Capabilities
+	}
+
+	// Reasoning models reject temperature and take an effort level instead
+	if caps.Temperature {
 		reqBody["temperature"] = temperature
 	}
+	if caps.ReasoningEffort && opts.ReasoningEffort != "" {
+		reqBody["reasoning_effort"] = opts.ReasoningEffort
+	}
+
+	if opts.MaxTokens > 0 {
+		if caps.MaxCompletionTokens {
+			reqBody["max_completion_tokens"] = opts.MaxTokens
+		} else {
+			reqBody["max_tokens"] = opts.MaxTokens
+		}
+	}
+	if opts.Seed != nil {
+		reqBody["seed"] = *opts.Seed
+	}
+	if opts.Logprobs {
+		reqBody["logprobs"] = true
+		if opts.TopLogprobs > 0 {
+			reqBody["top_logprobs"] = opts.TopLogprobs
+		}
+	}
+	if len(opts.Stop) > 0 {
+		reqBody["stop"] = opts.Stop
+	}
+	if len(opts.Metadata) > 0 {
+		reqBody["metadata"] = opts.Metadata
+	}
+	if opts.User != "" {
+		reqBody["user"] = opts.User
+	}
+	if len(opts.Tools) > 0 {
+		reqBody["tools"] = opts.Tools
+		if opts.ToolChoice != "" {
+			reqBody["tool_choice"] = opts.ToolChoice
+		}
+	}
+	if stream && opts.IncludeUsage {
+		reqBody["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
 
-	payload, err := json.Marshal(reqBody)
+	return reqBody
+}
+
+// generateCacheKey creates a unique hash for a given set of messages and parameters.
+func (c *Client) generateCacheKey(messages []Message, model string, temperature float64, opts RequestOptions) (string, error) {
+	// Create a struct to hold all cacheable data
+	cacheable := struct {
+		Messages    []Message      `json:"messages"`
+		Model       string         `json:"model"`
+		Temperature float64        `json:"temperature"`
+		Options     RequestOptions `json:"options"`
+	}{
+		Messages:    messages,
+		Model:       model,
+		Temperature: temperature,
+		Options:     opts,
+	}
+
+	// Marshal the data to JSON
+	data, err := json.Marshal(cacheable)
 	if err != nil {
-		return fmt.Errorf("encode request: %w", err)
+		return "", fmt.Errorf("marshal cache key: %w", err)
 	}
 
-	// Use a client with longer timeout for streaming
-	ctx, cancel := context.WithTimeout(ctx, streamingTimeout)
-	defer cancel()
+	// Hash the JSON data
+	hash := sha256.Sum256(data)
+	return fmt.Sprintf("%x", hash), nil
+}
+
+
+// ChatStream sends a streaming chat completion request and calls onChunk for each content delta.
+func (c *Client) ChatStream(ctx context.Context, messages []Message, model string, temperature float64, onChunk func(string) error) error {
+	return c.ChatStreamWithOptions(ctx, messages, model, temperature, RequestOptions{}, onChunk)
+}
+
+// ChatStreamWithOptions sends a streaming chat completion request including the optional parameters in opts.
+// Fallbacks are only tried when the request fails before any content has been streamed.
+func (c *Client) ChatStreamWithOptions(ctx context.Context, messages []Message, model string, temperature float64, opts RequestOptions, onChunk func(string) error) error {
+	return c.ChatStreamEvents(ctx, messages, model, temperature, opts, func(event StreamEvent) error {
+		if event.Content == "" {
+			return nil
+		}
+		return onChunk(event.Content)
+	})
+}
+
+// ChatStreamEvents sends a streaming chat completion request and calls onEvent
+// for every content delta, tool call delta, finish reason and usage report, so
+// callers can tell a completed answer from a truncated one. A connection that
+// drops mid-response is resumed from the content received so far.
+func (c *Client) ChatStreamEvents(ctx context.Context, messages []Message, model string, temperature float64, opts RequestOptions, onEvent func(StreamEvent) error) error {
+	if c == nil {
+		return chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
+	}
+
+	return c.withFallbacks(model, opts, func(client *Client, model string, opts RequestOptions) error {
+		var response strings.Builder
+		record := onEvent
+		if c.audit != nil && c.audit.content {
+			record = func(event StreamEvent) error {
+				response.WriteString(event.Content)
+				return onEvent(event)
+			}
+		}
+		err := client.retryRateLimited(ctx, record, func() error {
+			return client.chatStreamResumable(ctx, messages, model, temperature, opts, record)
+		})
+		c.auditRequest(client, model, messages, response.String(), err)
+		return err
+	})
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(payload))
+func (c *Client) chatStream(ctx context.Context, messages []Message, model string, temperature float64, opts RequestOptions, onEvent func(StreamEvent) error) error {
+	if err := c.checkRateLimits(); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(buildRequestBody(messages, model, temperature, true, opts))
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return fmt.Errorf("encode request: %w", err)
 	}
 
-	// Set security headers
-	setSecurityHeaders(req)
+	c.setLogprobs(nil)
+	c.setUsage(nil)
+
+	// A streaming response may take as long as it needs, reasoning models
+	// included, as long as the provider keeps sending something, if only
+	// keep-alive comments, at least every streamTimeout
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	idle := time.AfterFunc(c.streamTimeout, func() { cancel(errStreamIdle) })
+	defer idle.Stop()
 
+	req, err := c.newRequest(ctx, http.MethodPost, "/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	req.Header.Set("Accept", "text/event-stream")
 
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return fmt.Errorf("execute request: %w", err)
+		return c.streamError(ctx, fmt.Errorf("execute request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return c.decodeError(bytes.NewReader(bodyBytes), resp.StatusCode)
+		return c.responseError(resp, bodyBytes)
+	}
+
+	body := &activityReader{r: resp.Body, active: func() { idle.Reset(c.streamTimeout) }}
+	return c.streamError(ctx, c.processStream(body, onEvent))
+}
+
+// errStreamIdle cancels a streaming request whose provider went quiet.
+var errStreamIdle = errors.New("stream idle")
+
+// streamError reports a stream abandoned for sending nothing as a timeout,
+// which is neither resumed nor retried, rather than as the read error it
+// causes.
+func (c *Client) streamError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(context.Cause(ctx), errStreamIdle) {
+		return fmt.Errorf("the provider sent nothing for %s (timeouts.stream): %w", c.streamTimeout, context.DeadlineExceeded)
 	}
+	return err
+}
 
-	return c.processStream(resp.Body, onChunk)
+// activityReader calls active whenever data arrives.
+type activityReader struct {
+	r      io.Reader
+	active func()
 }
 
-func (c *Client) processStream(r io.Reader, onChunk func(string) error) error {
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.active()
+	}
+	return n, err
+}
+
+// processStream parses server-sent events into StreamEvents. Content deltas
+// are buffered up to flushThreshold bytes, or for at most flushInterval when
+// set; buffered content is always delivered before any other event so
+// ordering is preserved.
+func (c *Client) processStream(r io.Reader, onEvent func(StreamEvent) error) error {
 	var outputBuffer strings.Builder
+	var role string // Some providers repeat the role in every delta; report it once
+
+	// The flush timer runs while content is buffered
+	var flushTimer *time.Timer
+	var flushDue <-chan time.Time
+	defer func() {
+		if flushTimer != nil {
+			flushTimer.Stop()
+		}
+	}()
 
+	flush := func() error {
+		if flushTimer != nil {
+			flushTimer.Stop()
+			flushDue = nil
+		}
+		if outputBuffer.Len() == 0 {
+			return nil
+		}
+		content := outputBuffer.String()
+		outputBuffer.Reset()
+		return onEvent(StreamEvent{Content: content})
+	}
+
+	// The scanner's limit is the larger of its initial capacity and max, so the
+	// initial buffer must not exceed maxStreamLine.
+	initial := 4096
+	if c.maxStreamLine < initial {
+		initial = c.maxStreamLine
+	}
 	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 0, 1024), 64*1024) // Set max token size to 64KB
+	scanner.Buffer(make([]byte, 0, initial), c.maxStreamLine)
+
+	// Lines are read in the background so buffered content can be flushed on
+	// time while the provider is slow to send the next chunk.
+	lines := make(chan string)
+	scanErr := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-stop:
+				return
+			}
+		}
+		scanErr <- scanner.Err()
+	}()
+
+	for {
+		var line string
+		select {
+		case <-flushDue:
+			if err := flush(); err != nil {
+				return err
+			}
+			continue
+		case next, ok := <-lines:
+			if !ok {
+				return c.finishStream(<-scanErr, flush)
+			}
+			line = next
+		}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if !strings.HasPrefix(line, "data: ") {
+		// Some local servers prefix the stream with a byte order mark
+		line = strings.TrimPrefix(line, "\uFEFF")
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+		case "":
+			// A blank line ends an event; a line starting with a colon is a
+			// comment, which gateways send as a keep-alive while a model is
+			// thinking. Both already count as activity for the stream timeout.
+			if line != "" {
+				c.debugf("stream keep-alive: %s\n", bodySnippet([]byte(line)))
+			}
+			continue
+		default:
+			// event, id and retry fields, and anything else, carry nothing
+			// a chat completion needs
 			continue
 		}
 
-		data := strings.TrimPrefix(line, "data: ")
+		data := value
 		if data == "[DONE]" {
 			// Flush any remaining buffered content
-			if outputBuffer.Len() > 0 {
-				if err := onChunk(outputBuffer.String()); err != nil {
-					return err
-				}
-			}
-			return nil
+			return flush()
 		}
 
 		var chunk struct {
 			Choices []struct {
 				Delta struct {
-					Content string `json:"content"`
+					Role      string          `json:"role"`
+					Content   string          `json:"content"`
+					ToolCalls []ToolCallDelta `json:"tool_calls"`
 				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+				Logprobs     *struct {
+					Content []TokenLogprob `json:"content"`
+				} `json:"logprobs"`
 			} `json:"choices"`
+			Usage *Usage `json:"usage"`
+			// Some gateways report a failure mid-stream as an event
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
 		}
 
 		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			c.debugf("skipping malformed stream chunk: %s\n", bodySnippet([]byte(data)))
 			continue // Skip malformed chunks
 		}
+		if chunk.Error != nil {
+			if err := flush(); err != nil {
+				return err
+			}
+			return fmt.Errorf("provider error during stream: %s", validation.SanitizeOutput(chunk.Error.Message))
+		}
 
-		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
-			content := chunk.Choices[0].Delta.Content
-			outputBuffer.WriteString(content)
+		var event StreamEvent
+		if len(chunk.Choices) > 0 {
+			choice := chunk.Choices[0]
+			if choice.Logprobs != nil {
+				c.appendLogprobs(choice.Logprobs.Content)
+			}
+
+			if content := validation.SanitizeOutput(choice.Delta.Content); content != "" {
+				if outputBuffer.Len() == 0 && c.flushInterval > 0 {
+					if flushTimer == nil {
+						flushTimer = time.NewTimer(c.flushInterval)
+					} else {
+						flushTimer.Reset(c.flushInterval)
+					}
+					flushDue = flushTimer.C
+				}
+				outputBuffer.WriteString(content)
 
-			// Flush when buffer reaches threshold
-			if outputBuffer.Len() >= c.flushThreshold {
-				if err := onChunk(outputBuffer.String()); err != nil {
-					return err
+				// Flush when buffer reaches threshold
+				if outputBuffer.Len() >= c.flushThreshold {
+					if err := flush(); err != nil {
+						return err
+					}
 				}
-				outputBuffer.Reset()
 			}
+
+			if choice.Delta.Role != "" && choice.Delta.Role != role {
+				role = choice.Delta.Role
+				event.Role = role
+			}
+			event.ToolCalls = choice.Delta.ToolCalls
+			if choice.FinishReason != nil {
+				event.FinishReason = *choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			c.setUsage(chunk.Usage)
+			event.Usage = chunk.Usage
+		}
+
+		if event.Role == "" && len(event.ToolCalls) == 0 && event.FinishReason == "" && event.Usage == nil {
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if err := onEvent(event); err != nil {
+			return err
 		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("stream read error: %w", err)
+// finishStream delivers the content still buffered when the body ends and
+// reports why reading stopped.
+func (c *Client) finishStream(err error, flush func() error) error {
+	// Deliver what was received before reporting a failure
+	if flushErr := flush(); flushErr != nil {
+		return flushErr
 	}
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("stream frame exceeds %d bytes (raise api.max_stream_line): %w", c.maxStreamLine, err)
+	}
+	return &streamInterruptedError{err: err}
+}
 
-	// Flush any remaining content
-	if outputBuffer.Len() > 0 {
-		return onChunk(outputBuffer.String())
+func (c *Client) decodeSuccess(r io.Reader) (string, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+	body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")) // UTF-8 byte order mark
+
+	response, err := c.decodeResponse(body)
+	if err != nil {
+		c.debugf("unexpected response body: %s\n\n", bodySnippet(body))
+		return "", err
 	}
 
-	return nil
+	return response, nil
 }
 
-func (c *Client) decodeSuccess(r io.Reader) (string, error) {
+// decodeResponse validates a non-streaming chat completion body and returns
+// the assistant content, with a descriptive error for any unexpected shape.
+func (c *Client) decodeResponse(body []byte) (string, error) {
 	var response struct {
 		Choices []struct {
-			Message Message `json:"message"`
+			Message *struct {
+				Content json.RawMessage `json:"content"`
+				Refusal string          `json:"refusal"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+			Logprobs     *struct {
+				Content []TokenLogprob `json:"content"`
+			} `json:"logprobs"`
 		} `json:"choices"`
+		Usage *Usage          `json:"usage"`
+		Error json.RawMessage `json:"error"`
 	}
 
-	if err := json.NewDecoder(r).Decode(&response); err != nil {
+	if err := json.Unmarshal(body, &response); err != nil {
 		return "", fmt.Errorf("decode response: %w", err)
 	}
 
+	// Some gateways report failures with a 200 status and an error object
+	if len(response.Error) > 0 && string(response.Error) != "null" {
+		return "", c.decodeError(bytes.NewReader(body), http.StatusOK)
+	}
+
+	c.setUsage(response.Usage)
+
 	if len(response.Choices) == 0 {
-		return "", errors.New("no choices in response")
+		return "", errors.New("invalid response: no choices in response")
+	}
+
+	choice := response.Choices[0]
+	if choice.Logprobs != nil {
+		c.setLogprobs(choice.Logprobs.Content)
+	}
+
+	if choice.Message == nil {
+		return "", errors.New("invalid response: choice has no message")
+	}
+	if choice.Message.Refusal != "" {
+		return "", fmt.Errorf("model refused the request: %s", choice.Message.Refusal)
+	}
+
+	content, err := decodeContent(choice.Message.Content)
+	if err != nil {
+		return "", err
+	}
+	content = validation.SanitizeOutput(content)
+	if content == "" {
+		if choice.FinishReason != "" {
+			return "", fmt.Errorf("invalid response: empty content (finish_reason: %s)", choice.FinishReason)
+		}
+		return "", errors.New("invalid response: empty content")
+	}
+
+	return content, nil
+}
+
+// decodeContent accepts message content as a plain string or as an array of
+// text parts, which some providers return.
+func decodeContent(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
 	}
 
-	return response.Choices[0].Message.Content, nil
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("invalid response: unexpected content type %s", jsonKind(raw))
+	}
+
+	var b strings.Builder
+	for _, part := range parts {
+		if part.Type == "text" || part.Type == "output_text" {
+			b.WriteString(part.Text)
+		}
+	}
+	return b.String(), nil
+}
+
+// jsonKind names the JSON type of raw for error messages.
+func jsonKind(raw json.RawMessage) string {
+	switch trimmed := bytes.TrimSpace(raw); {
+	case len(trimmed) == 0:
+		return "empty"
+	case trimmed[0] == '{':
+		return "object"
+	case trimmed[0] == '[':
+		return "array"
+	case trimmed[0] == '"':
+		return "string"
+	case trimmed[0] == 't' || trimmed[0] == 'f':
+		return "boolean"
+	default:
+		return "number"
+	}
+}
+
+// HTTPError is returned when the API responds with a non-2xx status.
+type HTTPError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // Delay requested by a 429 response, zero if none
+}
+
+func (e *HTTPError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("api error (status %d): %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("api error (status %d)", e.StatusCode)
 }
 
 func (c *Client) decodeError(r io.Reader, status int) error {
@@ -356,7 +920,7 @@ func (c *Client) decodeError(r io.Reader, status int) error {
 	}
 
 	if err := json.NewDecoder(r).Decode(&apiErr); err != nil {
-		return fmt.Errorf("api error (status %d): failed to decode body: %w", status, err)
+		return fmt.Errorf("%w: failed to decode body: %w", &HTTPError{StatusCode: status}, err)
 	}
 
 	var message string
@@ -369,11 +933,7 @@ func (c *Client) decodeError(r io.Reader, status int) error {
 		}
 	}
 
-	if message != "" {
-		return fmt.Errorf("api error (status %d): %s", status, message)
-	}
-
-	return fmt.Errorf("api error (status %d)", status)
+	return &HTTPError{StatusCode: status, Message: message}
 }
 
 // NewSecureClient creates a new secure API client with enhanced security features
@@ -424,10 +984,12 @@ func NewSecureClient(apiKey, baseURL string) (*Client, error) {
 	// Create API token bucket - 100 tokens max, refill 1 token per second
 	tokenBucket := security.NewAPITokenBucket(100, 1)
 
+	// Stop calling an endpoint after 5 consecutive failures, for 30 seconds
+	breaker := security.NewCircuitBreaker(security.DefaultCircuitBreakerConfig())
+
 	// Create secure HTTP client
 	transport := createSecureHTTPTransport()
 	httpClient := &http.Client{
-		Timeout:   defaultTimeout,
 		Transport: transport,
 	}
 
@@ -439,6 +1001,10 @@ func NewSecureClient(apiKey, baseURL string) (*Client, error) {
 		cache:          cache,
 		rateLimiter:    rateLimiter,
 		apiTokenBucket: tokenBucket,
+		breaker:        breaker,
+		requestTimeout: defaultTimeout,
+		streamTimeout:  streamingTimeout,
+		maxStreamLine:  DefaultMaxStreamLine,
 	}
 
 	// Securely clear the API key from the parameter
@@ -449,13 +1015,12 @@ func NewSecureClient(apiKey, baseURL string) (*Client, error) {
 
 // secureClear securely clears sensitive string data from memory
 func secureClear(s string) {
-	// Convert string to byte slice and overwrite
+	// Convert string to byte slice and overwrite. No runtime.GC() here: it
+	// cannot reach the string itself and stalled every client construction.
 	b := []byte(s)
 	for i := range b {
 		b[i] = 0
 	}
-	// Force garbage collection to help clear memory
-	runtime.GC()
 }
 
 // secureClearBytes securely clears sensitive byte data from memory
@@ -483,6 +1048,44 @@ func generateSecureNonce() (string, error) {
 	return nonce, nil
 }
 
+// LastLogprobs returns the token log probabilities reported for the most recent
+// response, or nil if they were not requested or not provided.
+func (c *Client) LastLogprobs() []TokenLogprob {
+	c.logprobsMutex.Lock()
+	defer c.logprobsMutex.Unlock()
+	return append([]TokenLogprob(nil), c.logprobs...)
+}
+
+func (c *Client) setLogprobs(logprobs []TokenLogprob) {
+	c.logprobsMutex.Lock()
+	c.logprobs = logprobs
+	c.logprobsMutex.Unlock()
+}
+
+func (c *Client) appendLogprobs(logprobs []TokenLogprob) {
+	c.logprobsMutex.Lock()
+	c.logprobs = append(c.logprobs, logprobs...)
+	c.logprobsMutex.Unlock()
+}
+
+// LastUsage returns the token usage reported for the most recent response, or
+// nil if the provider did not report it.
+func (c *Client) LastUsage() *Usage {
+	c.usageMutex.Lock()
+	defer c.usageMutex.Unlock()
+	if c.usage == nil {
+		return nil
+	}
+	usage := *c.usage
+	return &usage
+}
+
+func (c *Client) setUsage(usage *Usage) {
+	c.usageMutex.Lock()
+	c.usage = usage
+	c.usageMutex.Unlock()
+}
+
 // GetRateLimitStats returns rate limiting statistics for the client
 func (c *Client) GetRateLimitStats() (requests int, remainingTime time.Duration, allowed bool) {
 	if c.rateLimiter == nil {
@@ -499,11 +1102,14 @@ func (c *Client) GetTokenBucketTokens() int {
 	return c.apiTokenBucket.GetTokens()
 }
 
-// ResetRateLimiter resets the rate limiter for this client
+// ResetRateLimiter resets the rate limiter and circuit breaker for this client
 func (c *Client) ResetRateLimiter() {
 	if c.rateLimiter != nil {
 		c.rateLimiter.Reset(c.apiKey)
 	}
+	if c.breaker != nil {
+		c.breaker.Reset()
+	}
 }
 
 // setSecurityHeaders adds security headers to HTTP requests
@@ -529,18 +1135,13 @@ func setSecurityHeaders(req *http.Request) {
 	req.Header.Set("User-Agent", "Chatty/1.0")
 }
 func createSecureHTTPTransport() *http.Transport {
-	// Create a certificate pool with system roots
-	rootCAs, err := x509.SystemCertPool()
-	if err != nil {
-		// Fallback to empty pool if system cert pool is not available
-		rootCAs = x509.NewCertPool()
-	}
-
 	// Create secure TLS configuration
 	tlsConfig := &tls.Config{
 		MinVersion: tls.VersionTLS12, // Require TLS 1.2 or higher
 		MaxVersion: tls.VersionTLS13, // Support up to TLS 1.3
-		RootCAs:    rootCAs,
+		// A nil pool verifies against the system roots, loaded on the first
+		// handshake and shared by every client instead of copied into each
+		RootCAs: nil,
 		// Security features
 		PreferServerCipherSuites: true,
 		CipherSuites: []uint16{
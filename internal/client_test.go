@@ -1,11 +1,26 @@
 package internal
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal/audit"
+	"github.com/ZaguanLabs/chatty/internal/config"
+	"github.com/ZaguanLabs/chatty/internal/metrics"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+	"github.com/ZaguanLabs/chatty/internal/ui"
 )
 
 func TestNewClient(t *testing.T) {
@@ -88,6 +103,91 @@ func TestClient_Chat(t *testing.T) {
 	}
 }
 
+func TestClient_Metrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": "Hi"}}},
+			"usage":   map[string]int{"prompt_tokens": 7, "completion_tokens": 3},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	usage := metrics.New()
+	client.SetMetrics(usage)
+
+	messages := []Message{{Role: "user", Content: "Hello"}}
+	for i := 0; i < 2; i++ { // The second request is answered from the cache
+		if _, err := client.Chat(context.Background(), messages, "gpt-4o-mini", 0.7); err != nil {
+			t.Fatalf("chat failed: %v", err)
+		}
+	}
+
+	var out strings.Builder
+	usage.WriteTo(&out)
+	for _, want := range []string{
+		`chatty_api_requests_total{endpoint="/chat/completions",code="200"} 1`,
+		`chatty_api_request_duration_seconds_count{endpoint="/chat/completions"} 1`,
+		`chatty_tokens_total{type="prompt"} 7`,
+		`chatty_tokens_total{type="completion"} 3`,
+		`chatty_cache_requests_total{result="hit"} 1`,
+		`chatty_cache_requests_total{result="miss"} 1`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestClient_AuditLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": "Hi"}}},
+		})
+	}))
+	defer server.Close()
+
+	path := t.TempDir() + "/audit.log"
+	log, err := audit.Open(path)
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer log.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.SetAuditLog(log, "alice", false)
+
+	for _, prompt := range []string{"first secret", "second secret"} {
+		if _, err := client.Chat(context.Background(), []Message{{Role: "user", Content: prompt}}, "gpt-4o-mini", 0.7); err != nil {
+			t.Fatalf("chat failed: %v", err)
+		}
+	}
+
+	if n, err := audit.Verify(path); err != nil || n != 2 {
+		t.Fatalf("Verify() = %d, %v, want 2 entries", n, err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"user":"alice"`) || strings.Contains(string(data), "secret") {
+		t.Errorf("unexpected audit log contents:\n%s", data)
+	}
+
+	tampered := strings.Replace(string(data), `"model":"gpt-4o-mini"`, `"model":"gpt-4o"`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := audit.Verify(path); err == nil {
+		t.Error("expected Verify to detect the edited entry")
+	}
+}
+
 func TestClient_Chat_Error(t *testing.T) {
 	// Create a test server that returns an error
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -116,3 +216,1268 @@ func TestClient_Chat_Error(t *testing.T) {
 		t.Error("expected error, got nil")
 	}
 }
+
+func TestClient_ChatWithOptions_MaxTokens(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": "ok"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	messages := []Message{{Role: "user", Content: "Hello"}}
+	if _, err := client.ChatWithOptions(context.Background(), messages, "gpt-4o-mini", 0.7, RequestOptions{MaxTokens: 512}); err != nil {
+		t.Fatalf("chat failed: %v", err)
+	}
+	if body["max_tokens"] != float64(512) {
+		t.Errorf("expected max_tokens 512, got %v", body["max_tokens"])
+	}
+
+	if _, err := client.Chat(context.Background(), []Message{{Role: "user", Content: "Again"}}, "gpt-4o-mini", 0.7); err != nil {
+		t.Fatalf("chat failed: %v", err)
+	}
+	if _, ok := body["max_tokens"]; ok {
+		t.Errorf("expected max_tokens to be omitted, got %v", body["max_tokens"])
+	}
+}
+
+func TestBuildRequestBody_Capabilities(t *testing.T) {
+	tests := []struct {
+		name            string
+		model           string
+		opts            RequestOptions
+		wantTemperature bool
+		wantEffort      bool
+		wantTokenField  string
+	}{
+		{"chat model", "gpt-4o-mini", RequestOptions{ReasoningEffort: "high", MaxTokens: 10}, true, false, "max_tokens"},
+		{"reasoning model", "o3-mini", RequestOptions{ReasoningEffort: "high", MaxTokens: 10}, false, true, "max_completion_tokens"},
+		{"provider prefixed", "openai/o4-mini", RequestOptions{ReasoningEffort: "low"}, false, true, ""},
+		{"override", "custom-reasoner", RequestOptions{ReasoningEffort: "low", Capabilities: &ModelCapabilities{ReasoningEffort: true}}, false, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := buildRequestBody(nil, tt.model, 0.7, false, tt.opts)
+			if _, ok := body["temperature"]; ok != tt.wantTemperature {
+				t.Errorf("temperature present = %t, want %t", ok, tt.wantTemperature)
+			}
+			if _, ok := body["reasoning_effort"]; ok != tt.wantEffort {
+				t.Errorf("reasoning_effort present = %t, want %t", ok, tt.wantEffort)
+			}
+			if tt.wantTokenField != "" {
+				if _, ok := body[tt.wantTokenField]; !ok {
+					t.Errorf("expected %s in request body", tt.wantTokenField)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestPayload(t *testing.T) {
+	messages := []Message{{Role: "user", Content: "Hello"}}
+	payload, err := RequestPayload(messages, "gpt-4o-mini", 0.5, false, RequestOptions{MaxTokens: 42})
+	if err != nil {
+		t.Fatalf("RequestPayload() error = %v", err)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(payload, &body); err != nil {
+		t.Fatalf("payload is not valid JSON: %v", err)
+	}
+	if body["model"] != "gpt-4o-mini" || body["max_tokens"] != float64(42) {
+		t.Errorf("unexpected payload: %s", payload)
+	}
+	if got := body["messages"].([]any); len(got) != 1 {
+		t.Errorf("expected 1 message, got %d", len(got))
+	}
+}
+
+func TestMessage_MarshalJSON_Attachments(t *testing.T) {
+	plain, err := json.Marshal(Message{Role: "user", Content: "Hello"})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if string(plain) != `{"role":"user","content":"Hello"}` {
+		t.Errorf("message without attachments = %s", plain)
+	}
+
+	msg := Message{Role: "user", Content: "What is this?", Attachments: []storage.Attachment{
+		{Name: "cat.png", MIMEType: "image/png", Data: []byte("png")},
+		{Name: "notes.txt", MIMEType: "text/plain", Data: []byte("some notes")},
+		{Name: "spec.pdf", MIMEType: "application/pdf", Data: []byte("pdf")},
+		{Name: "gone.png", MIMEType: "image/png", Path: "/nonexistent/gone.png"},
+	}}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var body struct {
+		Role    string           `json:"role"`
+		Content []map[string]any `json:"content"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		t.Fatalf("payload is not valid JSON: %v (%s)", err, payload)
+	}
+	if body.Role != "user" || len(body.Content) != 5 {
+		t.Fatalf("unexpected message: %s", payload)
+	}
+	wantTypes := []string{"text", "image_url", "text", "file", "text"}
+	for i, part := range body.Content {
+		if part["type"] != wantTypes[i] {
+			t.Errorf("part %d type = %v, want %s", i, part["type"], wantTypes[i])
+		}
+	}
+	if url := body.Content[1]["image_url"].(map[string]any)["url"]; url != "data:image/png;base64,"+base64.StdEncoding.EncodeToString([]byte("png")) {
+		t.Errorf("image url = %v", url)
+	}
+	if text := body.Content[4]["text"].(string); !strings.Contains(text, "no longer available") {
+		t.Errorf("missing file part = %q", text)
+	}
+}
+
+func TestClient_Embed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			t.Errorf("expected /embeddings, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// Return the items out of order to exercise index handling
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"index": 1, "embedding": []float32{0, 1}},
+				{"index": 0, "embedding": []float32{1, 0}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	vectors, err := client.Embed(context.Background(), "text-embedding-3-small", []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("embed failed: %v", err)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("unexpected vectors: %v", vectors)
+	}
+	if got := cosineSimilarity(vectors[0], vectors[0]); got < 0.999 {
+		t.Errorf("expected identical vectors to score 1, got %f", got)
+	}
+	if got := cosineSimilarity(vectors[0], vectors[1]); got != 0 {
+		t.Errorf("expected orthogonal vectors to score 0, got %f", got)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/models" {
+			t.Errorf("expected GET /models, got %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "invalid api key"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]string{{"id": "gpt-4o-mini"}, {"id": "gpt-4o"}},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	result, err := client.Ping(context.Background())
+	if err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	if !result.HasModel("gpt-4o") || result.HasModel("o3") {
+		t.Errorf("unexpected models: %v", result.Models)
+	}
+
+	status = http.StatusUnauthorized
+	if _, err := client.Ping(context.Background()); err == nil {
+		t.Error("expected an error for a rejected key")
+	}
+}
+
+func TestClient_ProbeFeatures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": []map[string]string{{"id": "text-only"}}})
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		raw, _ := json.Marshal(body["messages"])
+		switch {
+		case body["response_format"] != nil, bytes.Contains(raw, []byte("image_url")):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "unsupported"}})
+		case body["stream"] == true:
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"OK\"}}]}\n\ndata: [DONE]\n\n")
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": "OK"}}}})
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	features, err := client.ProbeFeatures(context.Background(), "text-only")
+	if err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if !features.Models || !features.Streaming || !features.Tools || features.JSONMode || features.Vision {
+		t.Errorf("unexpected features: %s", features)
+	}
+
+	path := t.TempDir() + "/providers.json"
+	if err := SaveFeatures(path, features); err != nil {
+		t.Fatalf("save features: %v", err)
+	}
+	if cached, ok := CachedFeatures(path, server.URL+"/", "text-only"); !ok || cached.Tools != features.Tools {
+		t.Errorf("expected cached features, got %v %v", cached, ok)
+	}
+	if _, ok := CachedFeatures(path, server.URL, "other"); ok {
+		t.Error("expected no cached features for another model")
+	}
+}
+
+func TestClient_Batch(t *testing.T) {
+	prompts, err := ParseBatchPrompts(strings.NewReader(`{"id": "a", "prompt": "One"}
+
+{"prompt": "Two"}
+`))
+	if err != nil {
+		t.Fatalf("ParseBatchPrompts() error = %v", err)
+	}
+	if len(prompts) != 2 || prompts[1].ID != "line-3" || prompts[1].Messages[0].Content != "Two" {
+		t.Fatalf("unexpected prompts: %+v", prompts)
+	}
+
+	var input []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/files":
+			file, _, err := r.FormFile("file")
+			if err != nil || r.FormValue("purpose") != "batch" {
+				t.Errorf("bad upload: %v", err)
+				return
+			}
+			input, _ = io.ReadAll(file)
+			json.NewEncoder(w).Encode(map[string]string{"id": "file-in"})
+		case "/batches":
+			json.NewEncoder(w).Encode(map[string]string{"id": "batch-1", "status": "validating"})
+		case "/batches/batch-1":
+			json.NewEncoder(w).Encode(map[string]string{"id": "batch-1", "status": "completed", "input_file_id": "file-in", "output_file_id": "file-out"})
+		case "/files/file-in/content":
+			w.Write(input)
+		case "/files/file-out/content":
+			fmt.Fprintln(w, `{"custom_id": "line-3", "response": {"status_code": 200, "body": {"choices": [{"message": {"role": "assistant", "content": "Deux"}}]}}}`)
+			fmt.Fprintln(w, `{"custom_id": "a", "response": {"status_code": 400, "body": {"error": {"message": "bad request"}}}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	batch, err := client.SubmitBatch(context.Background(), prompts, "gpt-4o-mini", 0.7, RequestOptions{})
+	if err != nil || batch.ID != "batch-1" {
+		t.Fatalf("SubmitBatch() = %+v, %v", batch, err)
+	}
+	if !strings.Contains(string(input), `"url":"/v1/chat/completions"`) {
+		t.Errorf("unexpected batch input: %s", input)
+	}
+
+	batch, err = client.GetBatch(context.Background(), "batch-1")
+	if err != nil {
+		t.Fatalf("GetBatch() error = %v", err)
+	}
+	results, err := client.BatchResults(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("BatchResults() error = %v", err)
+	}
+	if len(results) != 2 || results[0].Err == nil || results[1].Response != "Deux" || results[1].Messages[0].Content != "Two" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+func TestClient_ChatModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		if body["model"] == "broken" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "model not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": "answer from " + body["model"].(string)}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	models := []string{"model-a", "broken", "model-b"}
+	results := client.ChatModels(context.Background(), []Message{{Role: "user", Content: "Hi"}}, models, 0.7, nil)
+	if len(results) != len(models) {
+		t.Fatalf("expected %d results, got %d", len(models), len(results))
+	}
+	for i, result := range results {
+		if result.Model != models[i] {
+			t.Errorf("result %d: expected model %s, got %s", i, models[i], result.Model)
+		}
+	}
+	if results[0].Err != nil || results[0].Response != "answer from model-a" {
+		t.Errorf("unexpected result for model-a: %+v", results[0])
+	}
+	if results[1].Err == nil {
+		t.Error("expected an error for the broken model")
+	}
+	if results[2].Err != nil || results[2].Response != "answer from model-b" {
+		t.Errorf("unexpected result for model-b: %+v", results[2])
+	}
+}
+
+func TestClient_ChatWithOptions_Fallback(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		model := body["model"].(string)
+		requested = append(requested, model)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch model {
+		case "missing":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "model not found"})
+		case "overloaded":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "overloaded"})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"choices": []map[string]interface{}{
+					{"message": map[string]string{"role": "assistant", "content": "from " + model}},
+				},
+			})
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.SetFallbacks([]Fallback{{Model: "overloaded"}, {Model: "backup"}})
+
+	response, err := client.Chat(context.Background(), []Message{{Role: "user", Content: "Hi"}}, "missing", 0.7)
+	if err != nil {
+		t.Fatalf("chat failed: %v", err)
+	}
+	if response != "from backup" {
+		t.Errorf("expected response from backup, got %q", response)
+	}
+	if client.LastModel() != "backup" {
+		t.Errorf("expected LastModel backup, got %q", client.LastModel())
+	}
+	if len(requested) != 3 {
+		t.Errorf("expected 3 requests, got %v", requested)
+	}
+}
+
+func TestClient_ChatStreamEvents_RetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After-Ms", "10")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "slow down"})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	var waited time.Duration
+	var content strings.Builder
+	err = client.ChatStreamEvents(context.Background(), []Message{{Role: "user", Content: "Hi"}}, "test-model", 0.7, RequestOptions{}, func(event StreamEvent) error {
+		if event.RetryAfter > 0 {
+			waited = event.RetryAfter
+		}
+		content.WriteString(event.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if waited != 10*time.Millisecond {
+		t.Errorf("expected a 10ms rate limit event, got %v", waited)
+	}
+	if content.String() != "ok" || requests != 2 {
+		t.Errorf("expected %q after 2 requests, got %q after %d", "ok", content.String(), requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{"Retry-After": {"3"}}, 3 * time.Second},
+		{http.Header{"Retry-After": {now.Add(5 * time.Second).Format(http.TimeFormat)}}, 5 * time.Second},
+		{http.Header{"Retry-After": {"soon"}}, 0},
+		{http.Header{}, 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%v) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": "upstream down"})
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.SetCircuitBreaker(2, time.Minute)
+
+	messages := []Message{{Role: "user", Content: "Hi"}}
+	for i := 0; i < 2; i++ {
+		if _, err := client.Chat(context.Background(), messages, "test-model", 0.7); err == nil {
+			t.Fatal("expected an API error")
+		}
+	}
+
+	_, err = client.Chat(context.Background(), messages, "test-model", 0.7)
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) {
+		t.Fatalf("expected CircuitOpenError, got %v", err)
+	}
+	if circuitErr.Failures != 2 || requests != 2 {
+		t.Errorf("expected 2 failures and 2 requests, got %d and %d", circuitErr.Failures, requests)
+	}
+}
+
+func TestTeeSink(t *testing.T) {
+	var first, second strings.Builder
+	failing := Sink(func(string) error { return errors.New("disk full") })
+	onEvent := Tee(WriterSink(&first), failing, WriterSink(&second)).Events()
+
+	for _, event := range []StreamEvent{{Content: "Hel"}, {Usage: &Usage{}}, {Content: "lo"}} {
+		err := onEvent(event)
+		if event.Content != "" && err == nil {
+			t.Error("expected the failing sink's error")
+		}
+	}
+	if first.String() != "Hello" || second.String() != "Hello" {
+		t.Errorf("sinks got %q and %q, want both %q", first.String(), second.String(), "Hello")
+	}
+}
+
+func TestClient_EnableDebugLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": "logged answer"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient("secret-test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	var log bytes.Buffer
+	client.EnableDebugLog(&log)
+
+	if _, err := client.Chat(context.Background(), []Message{{Role: "user", Content: "logged question"}}, "gpt-4o-mini", 0.7); err != nil {
+		t.Fatalf("chat failed: %v", err)
+	}
+
+	output := log.String()
+	if strings.Contains(output, "secret-test-key") {
+		t.Error("debug log contains the API key")
+	}
+	for _, want := range []string{"Authorization: [REDACTED]", "logged question", "logged answer"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("debug log missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "string content",
+			body: `{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`,
+			want: "hi",
+		},
+		{
+			name: "content parts",
+			body: `{"choices":[{"message":{"role":"assistant","content":[{"type":"text","text":"hello "},{"type":"text","text":"world"}]}}]}`,
+			want: "hello world",
+		},
+		{
+			name:    "missing choices",
+			body:    `{"id":"x"}`,
+			wantErr: "no choices",
+		},
+		{
+			name:    "missing message",
+			body:    `{"choices":[{"text":"legacy"}]}`,
+			wantErr: "no message",
+		},
+		{
+			name:    "empty content with finish reason",
+			body:    `{"choices":[{"message":{"content":""},"finish_reason":"length"}]}`,
+			wantErr: "finish_reason: length",
+		},
+		{
+			name:    "unexpected content type",
+			body:    `{"choices":[{"message":{"content":42}}]}`,
+			wantErr: "unexpected content type number",
+		},
+		{
+			name:    "error object with 200 status",
+			body:    `{"error":{"message":"upstream unavailable"}}`,
+			wantErr: "upstream unavailable",
+		},
+	}
+
+	client, err := NewClient("test-key", "http://localhost")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.decodeResponse([]byte(tt.body))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProcessStream_Events(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"choices":[{"delta":{"role":"assistant"}}]}`,
+		`data: {"choices":[{"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`data: {"choices":[{"delta":{"content":"lo"}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"lookup","arguments":"{\"q\":"}}]}}]}`,
+		`data: {"choices":[{"delta":{},"finish_reason":"length"}]}`,
+		`data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2}}`,
+		`data: [DONE]`,
+	}, "\n")
+
+	client, err := NewClient("test-key", "http://localhost")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	var events []StreamEvent
+	if err := client.processStream(strings.NewReader(stream), func(event StreamEvent) error {
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatalf("processStream failed: %v", err)
+	}
+
+	if len(events) != 5 {
+		t.Fatalf("expected 5 events, got %d: %+v", len(events), events)
+	}
+	if events[0].Role != "assistant" {
+		t.Errorf("expected role event first, got %+v", events[0])
+	}
+	if events[1].Content != "Hello" {
+		t.Errorf("expected buffered content before the tool call, got %+v", events[1])
+	}
+	if len(events[2].ToolCalls) != 1 || events[2].ToolCalls[0].Function.Name != "lookup" {
+		t.Errorf("expected tool call delta, got %+v", events[2])
+	}
+	if events[3].FinishReason != "length" {
+		t.Errorf("expected finish reason length, got %+v", events[3])
+	}
+	if events[4].Usage == nil || events[4].Usage.CompletionTokens != 2 {
+		t.Errorf("expected usage event, got %+v", events[4])
+	}
+}
+
+func TestProcessStream_FlushInterval(t *testing.T) {
+	client, err := NewClient("test-key", "http://localhost")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.SetStreamBuffering(1024, 10*time.Millisecond)
+
+	r, w := io.Pipe()
+	delivered := make(chan string, 4)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.processStream(r, func(event StreamEvent) error {
+			delivered <- event.Content
+			return nil
+		})
+	}()
+
+	// The first chunk is far below the threshold but must not wait for the next
+	fmt.Fprintln(w, `data: {"choices":[{"delta":{"content":"Hel"}}]}`)
+	select {
+	case content := <-delivered:
+		if content != "Hel" {
+			t.Errorf("expected %q, got %q", "Hel", content)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("buffered content was not flushed after the interval")
+	}
+
+	fmt.Fprintln(w, `data: {"choices":[{"delta":{"content":"lo"}}]}`)
+	fmt.Fprintln(w, `data: [DONE]`)
+	w.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("processStream failed: %v", err)
+	}
+	if content := <-delivered; content != "lo" {
+		t.Errorf("expected %q, got %q", "lo", content)
+	}
+}
+
+func TestProcessStream_SanitizesOutput(t *testing.T) {
+	stream := "\xef\xbb\xbfdata: {\"choices\":[{\"delta\":{\"content\":\"\\ufeffHi\\u001b[31m there\"}}]}\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"\xff!\"}}]}\n" +
+		"data: [DONE]\n"
+
+	client, err := NewClient("test-key", "http://localhost")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	var output strings.Builder
+	if err := client.processStream(strings.NewReader(stream), func(event StreamEvent) error {
+		output.WriteString(event.Content)
+		return nil
+	}); err != nil {
+		t.Fatalf("processStream failed: %v", err)
+	}
+
+	if got, want := output.String(), "Hi[31m there�!"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestProcessStream_LineTooLong(t *testing.T) {
+	client, err := NewClient("test-key", "http://localhost")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.SetMaxStreamLine(64)
+
+	stream := `data: {"choices":[{"delta":{"content":"ok"}}]}` + "\n" +
+		`data: {"choices":[{"delta":{"content":"` + strings.Repeat("x", 100) + `"}}]}` + "\n"
+
+	var output strings.Builder
+	err = client.processStream(strings.NewReader(stream), func(event StreamEvent) error {
+		output.WriteString(event.Content)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "max_stream_line") {
+		t.Fatalf("expected an explicit line length error, got %v", err)
+	}
+	if output.String() != "ok" {
+		t.Errorf("expected content before the oversized frame to be delivered, got %q", output.String())
+	}
+}
+
+func TestProcessStream_CommentsAndEvents(t *testing.T) {
+	stream := ": keep-alive\n\n" +
+		"event: message\nid: 1\nretry: 1000\n" +
+		`data:{"choices":[{"delta":{"content":"Hi"}}]}` + "\n\n" +
+		": OPENROUTER PROCESSING\n\n" +
+		`data: {"choices":[{"delta":{"content":"!"}}]}` + "\n\n" +
+		"data: [DONE]\n"
+
+	client, err := NewClient("test-key", "http://localhost")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	var output strings.Builder
+	if err := client.processStream(strings.NewReader(stream), func(event StreamEvent) error {
+		output.WriteString(event.Content)
+		return nil
+	}); err != nil {
+		t.Fatalf("processStream failed: %v", err)
+	}
+	if output.String() != "Hi!" {
+		t.Errorf("expected %q, got %q", "Hi!", output.String())
+	}
+
+	err = client.processStream(strings.NewReader(`data: {"error":{"message":"overloaded"}}`+"\n"), func(StreamEvent) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Errorf("expected the provider's error, got %v", err)
+	}
+}
+
+func TestClient_ChatStreamEvents_KeepAlive(t *testing.T) {
+	silent := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if !silent {
+			// Think for longer than the stream timeout, sending keep-alives
+			for i := 0; i < 6; i++ {
+				fmt.Fprint(w, ": keep-alive\n\n")
+				w.(http.Flusher).Flush()
+				time.Sleep(25 * time.Millisecond)
+			}
+			fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"done"},"finish_reason":"stop"}]}`+"\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.SetTimeouts(0, 60*time.Millisecond)
+
+	var output strings.Builder
+	err = client.ChatStreamEvents(context.Background(), []Message{{Role: "user", Content: "hi"}}, "test-model", 0.7, RequestOptions{}, func(event StreamEvent) error {
+		output.WriteString(event.Content)
+		return nil
+	})
+	if err != nil || output.String() != "done" {
+		t.Fatalf("expected keep-alives to hold the stream open, got %q, %v", output.String(), err)
+	}
+
+	silent = true
+	err = client.ChatStreamEvents(context.Background(), []Message{{Role: "user", Content: "hi"}}, "test-model", 0.7, RequestOptions{}, func(StreamEvent) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a silent stream to time out, got %v", err)
+	}
+}
+
+func TestClient_ChatStreamEvents_Resume(t *testing.T) {
+	var requests [][]Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []Message `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body.Messages)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		if len(requests) == 1 {
+			fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"Hello, "}}]}`+"\n\n")
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler) // Drop the connection mid-response
+		}
+		fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"world"},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	var output strings.Builder
+	err = client.ChatStreamEvents(context.Background(), []Message{{Role: "user", Content: "Hi"}}, "test-model", 0.7, RequestOptions{}, func(event StreamEvent) error {
+		output.WriteString(event.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if output.String() != "Hello, world" {
+		t.Errorf("expected resumed output %q, got %q", "Hello, world", output.String())
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	resumed := requests[1]
+	if len(resumed) != 3 || resumed[1].Role != "assistant" || resumed[1].Content != "Hello, " {
+		t.Errorf("expected the partial answer as assistant context, got %+v", resumed)
+	}
+}
+
+func TestToolbox_Stream(t *testing.T) {
+	var requests [][]Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []Message `json:"messages"`
+			Tools    []Tool    `json:"tools"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body.Messages)
+		if len(body.Tools) != 1 || body.Tools[0].Function.Name != "run_code" {
+			t.Errorf("expected the run_code tool, got %+v", body.Tools)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		if len(requests) == 1 {
+			fmt.Fprint(w, `data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"run_code","arguments":"{\"language\":"}}]}}]}`+"\n\n")
+			fmt.Fprint(w, `data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"python\",\"code\":\"print(1)\"}"}}]},"finish_reason":"tool_calls"}]}`+"\n\n")
+		} else {
+			fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"It prints 1."},"finish_reason":"stop"}]}`+"\n\n")
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// The runtime is missing, which the model is told like any failed run
+	tools := NewToolbox(&config.Config{Sandbox: config.SandboxConfig{
+		Enabled:   true,
+		Runtime:   "chatty-missing-runtime",
+		Timeout:   time.Second,
+		MaxRounds: 2,
+		Images:    map[string]string{"python": "python:3.12-alpine"},
+	}})
+
+	var output strings.Builder
+	err = tools.Stream(context.Background(), client, []Message{{Role: "user", Content: "What does print(1) print?"}}, "test-model", 0.7, RequestOptions{}, func(event StreamEvent) error {
+		output.WriteString(event.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	followUp := requests[1]
+	if len(followUp) != 3 || len(followUp[1].ToolCalls) != 1 || followUp[1].ToolCalls[0].Function.Arguments != `{"language":"python","code":"print(1)"}` {
+		t.Fatalf("expected the assembled tool call, got %+v", followUp)
+	}
+	if followUp[2].Role != "tool" || followUp[2].ToolCallID != "call_1" || !strings.Contains(followUp[2].Content, "not found") {
+		t.Errorf("expected the run result as a tool message, got %+v", followUp[2])
+	}
+	if !strings.Contains(output.String(), "print(1)") || !strings.HasSuffix(output.String(), "It prints 1.") {
+		t.Errorf("expected the snippet and the answer in the output, got %q", output.String())
+	}
+}
+
+func TestClient_SetOrganization(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("OpenAI-Organization"); got != "org-test" {
+			t.Errorf("unexpected organization header: %q", got)
+		}
+		if got := r.Header.Get("OpenAI-Project"); got != "" {
+			t.Errorf("expected no project header, got %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": "ok"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.SetOrganization("org-test", "")
+
+	if _, err := client.Chat(context.Background(), []Message{{Role: "user", Content: "Hi"}}, "test-model", 0.7); err != nil {
+		t.Fatalf("chat failed: %v", err)
+	}
+}
+
+func TestClient_Transcribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/audio/transcriptions" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("parse multipart form: %v", err)
+		}
+		if r.FormValue("model") != "whisper-1" {
+			t.Errorf("unexpected model: %q", r.FormValue("model"))
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("missing file: %v", err)
+		}
+		defer file.Close()
+		if header.Filename != "note.wav" {
+			t.Errorf("unexpected filename: %q", header.Filename)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"text": " Hello there. "})
+	}))
+	defer server.Close()
+
+	path := t.TempDir() + "/note.wav"
+	if err := os.WriteFile(path, []byte("RIFF"), 0o600); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	text, err := client.Transcribe(context.Background(), "whisper-1", path, "")
+	if err != nil {
+		t.Fatalf("transcribe failed: %v", err)
+	}
+	if text != "Hello there." {
+		t.Errorf("unexpected transcript: %q", text)
+	}
+
+	if _, err := client.Transcribe(context.Background(), "whisper-1", t.TempDir()+"/notes.txt", ""); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestIsOfflineError(t *testing.T) {
+	client, err := NewClient("test-key", "http://127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	_, err = client.Chat(context.Background(), []Message{{Role: "user", Content: "Hi"}}, "test-model", 0.7)
+	if !IsOfflineError(err) {
+		t.Errorf("expected a refused connection to be an offline error, got %v", err)
+	}
+	if IsOfflineError(&HTTPError{StatusCode: http.StatusBadGateway, Message: "bad gateway"}) {
+		t.Error("expected an HTTP error response not to be an offline error")
+	}
+	if IsOfflineError(context.Canceled) {
+		t.Error("expected cancellation not to be an offline error")
+	}
+}
+
+func TestSpeechChunks(t *testing.T) {
+	if chunks := SpeechChunks("  Short answer.  "); len(chunks) != 1 || chunks[0] != "Short answer." {
+		t.Errorf("unexpected chunks for short text: %q", chunks)
+	}
+
+	long := strings.Repeat("This is one sentence. ", 400)
+	chunks := SpeechChunks(long)
+	if len(chunks) < 2 {
+		t.Fatalf("expected long text to be split, got %d chunk(s)", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > maxSpeechInput {
+			t.Errorf("chunk %d has %d bytes, limit is %d", i, len(chunk), maxSpeechInput)
+		}
+		if !strings.HasSuffix(chunk, ".") {
+			t.Errorf("chunk %d does not end at a sentence boundary: %q", i, chunk[len(chunk)-20:])
+		}
+	}
+}
+
+func TestClient_GenerateImage(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/generations" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["prompt"] != "a red fox in snow" || body["response_format"] != "b64_json" {
+			t.Errorf("unexpected request body: %v", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]string{{"b64_json": base64.StdEncoding.EncodeToString(png)}},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key", server.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	data, err := client.GenerateImage(context.Background(), "dall-e-3", "a red fox in snow", "1024x1024")
+	if err != nil {
+		t.Fatalf("generate image failed: %v", err)
+	}
+
+	path, err := SaveImage(data, t.TempDir())
+	if err != nil {
+		t.Fatalf("save image failed: %v", err)
+	}
+	if !strings.HasSuffix(path, ".png") {
+		t.Errorf("expected a .png file, got %s", path)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(saved, png) {
+		t.Errorf("saved image does not match: %v", err)
+	}
+}
+
+func TestParseFollowUps(t *testing.T) {
+	reply := "1. How does it scale?\n\n- \"What are the trade-offs?\"\n3) Can you show an example?\n4. One too many?"
+	got := parseFollowUps(reply)
+	want := []string{"How does it scale?", "What are the trade-offs?", "Can you show an example?"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d suggestions, got %q", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("suggestion %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestParseTitle(t *testing.T) {
+	tests := map[string]string{
+		"Setting Up Postgres Replication":               "Setting Up Postgres Replication",
+		"\"Debugging a Flaky Test.\"\nHope this helps!": "Debugging a Flaky Test",
+		"Title: **Go Generics Basics**":                 "Go Generics Basics",
+	}
+	for reply, want := range tests {
+		if got := parseTitle(reply); got != want {
+			t.Errorf("parseTitle(%q) = %q, want %q", reply, got, want)
+		}
+	}
+}
+
+func TestParseGist(t *testing.T) {
+	got := parseGist("Summary: Planning a Postgres upgrade; settled on logical replication.\n\nLet me know!", "summary", 160)
+	if want := "Planning a Postgres upgrade; settled on logical replication"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := parseGist("An overly long line", "summary", 10); got != "An overly" {
+		t.Errorf("expected the gist cut to 10 runes, got %q", got)
+	}
+}
+
+func TestParseOutline(t *testing.T) {
+	reply := "1. Setting up the database\nnoise\n3. Fixing the failing test\n7. Out of range"
+	got := parseOutline(reply, 3)
+	want := []string{"Setting up the database", "", "Fixing the failing test"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("summary %d: expected %q, got %q", i+1, want[i], got[i])
+		}
+	}
+}
+
+func TestParseStopSequences(t *testing.T) {
+	got, err := ParseStopSequences(`\nUser:, ###, a\,b`)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	want := []string{"\nUser:", "###", "a,b"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("sequence %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+
+	if _, err := ParseStopSequences("a,b,c,d,e"); err == nil {
+		t.Error("expected an error for more than four sequences")
+	}
+}
+
+func TestTemplateRender(t *testing.T) {
+	tmpl := &Template{
+		Name:     "triage",
+		System:   "Support for {{product}}.",
+		Prompt:   "Ticket {{ ticket_id }} ({{product}})",
+		Defaults: map[string]string{"product": "chatty"},
+	}
+
+	if got := tmpl.Variables(); len(got) != 2 || got[0] != "product" || got[1] != "ticket_id" {
+		t.Errorf("Variables() = %v", got)
+	}
+
+	_, err := tmpl.Render(nil)
+	var missing *MissingVariablesError
+	if !errors.As(err, &missing) || len(missing.Names) != 1 || missing.Names[0] != "ticket_id" {
+		t.Fatalf("expected ticket_id to be reported missing, got %v", err)
+	}
+
+	messages, err := tmpl.Render(map[string]string{"ticket_id": "OPS-42"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if len(messages) != 2 || messages[0].Content != "Support for chatty." || messages[1].Content != "Ticket OPS-42 (chatty)" {
+		t.Errorf("unexpected messages: %+v", messages)
+	}
+}
+
+func TestCostNeedsConfirmation(t *testing.T) {
+	cfg := &config.Config{Model: config.ModelConfig{
+		Pricing:          &config.PricingConfig{InputPerMillion: 10, OutputPerMillion: 30},
+		ConfirmCostAbove: 0.50,
+	}}
+	small := []Message{{Role: "user", Content: "Hello"}}
+	huge := []Message{{Role: "user", Content: strings.Repeat("lorem ipsum ", 100000)}}
+
+	if _, over := CostNeedsConfirmation(cfg, small, RequestOptions{}); over {
+		t.Error("expected a short prompt to be sent without confirmation")
+	}
+	if _, over := CostNeedsConfirmation(cfg, small, RequestOptions{MaxTokens: 20000}); !over {
+		t.Error("expected the output limit to count towards the estimate")
+	}
+	cost, over := CostNeedsConfirmation(cfg, huge, RequestOptions{})
+	if !over || cost <= 0.50 {
+		t.Errorf("expected a huge prompt to need confirmation, got $%.2f", cost)
+	}
+
+	cfg.Model.Pricing = nil
+	if _, over := CostNeedsConfirmation(cfg, huge, RequestOptions{}); over {
+		t.Error("expected no confirmation without pricing")
+	}
+}
+
+func TestFormatPaste(t *testing.T) {
+	code := "package main\r\n\r\nfunc main() {\r\n\tfmt.Println(\"hi\")\r\n}\r\n"
+	if got, want := FormatPaste(code), "```go\npackage main\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n```\n"; got != want {
+		t.Errorf("FormatPaste(code) = %q, want %q", got, want)
+	}
+
+	prose := "Thanks for the update.\nI will review the document tomorrow."
+	if got := FormatPaste(prose); got != prose {
+		t.Errorf("expected prose to be left alone, got %q", got)
+	}
+
+	fenced := "```\nx := 1\ny := 2\n```"
+	if got := FormatPaste(fenced); got != fenced {
+		t.Errorf("expected fenced code to be left alone, got %q", got)
+	}
+}
+
+func TestTagCodeFences(t *testing.T) {
+	in := "Try this:\n\n```\ndef greet(name):\n    print(name)\n```\n\n```sh\nls\n```\n\n```\nsomething\n```\n\n```\nunclosed"
+	want := "Try this:\n\n```python\ndef greet(name):\n    print(name)\n```\n\n```sh\nls\n```\n\n```\nsomething\n```\n\n```\nunclosed"
+	if got := ui.TagCodeFences(in); got != want {
+		t.Errorf("TagCodeFences() = %q, want %q", got, want)
+	}
+}
+
+func TestGrepMessages(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "How do I open a file?"},
+		{Role: "assistant", Content: "Use os.Open:\n\nf, err := os.Open(name)\nif err != nil {"},
+		{Role: "user", Content: "And close it?"},
+	}
+	matches := GrepMessages(messages, regexp.MustCompile(`(?i)os\.open|close`))
+	if len(matches) != 3 {
+		t.Fatalf("expected 3 matching lines, got %+v", matches)
+	}
+	if matches[0].Message != 1 || matches[0].Line != "Use os.Open:" || matches[2].Message != 2 || matches[2].Role != "user" {
+		t.Errorf("unexpected matches: %+v", matches)
+	}
+}
+
+func TestFindDuplicateQuestion(t *testing.T) {
+	history := []Message{
+		{Role: "user", Content: "How do I reverse a slice in Go?"},
+		{Role: "assistant", Content: "Use slices.Reverse."},
+		{Role: "user", Content: "continue"},
+		{Role: "assistant", Content: "That is all."},
+	}
+
+	tests := []struct {
+		prompt string
+		want   int
+	}{
+		{"how do I reverse a slice in Go", 1},
+		{"How do I reverse a slice in Go??", 1},
+		{"How do I reverse a string in Go?", -1},
+		{"continue", -1}, // Too short to count
+	}
+	for _, tt := range tests {
+		if got := FindDuplicateQuestion(history, tt.prompt); got != tt.want {
+			t.Errorf("FindDuplicateQuestion(%q) = %d, want %d", tt.prompt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxCompareModels caps how many models a single comparison may fan out to.
+const MaxCompareModels = 4
+
+// ModelResult holds one model's answer from a fan-out request.
+type ModelResult struct {
+	Model    string
+	Response string
+	Err      error
+	Duration time.Duration
+}
+
+// ChatModels sends the same messages to every model concurrently and returns
+// the results in the order of models. optsFor supplies the request options for
+// each model; a nil optsFor sends no optional parameters. A failure for one
+// model is recorded in its result and does not affect the others, and
+// fallbacks are not used so every answer comes from the model it is labelled with.
+func (c *Client) ChatModels(ctx context.Context, messages []Message, models []string, temperature float64, optsFor func(model string) RequestOptions) []ModelResult {
+	results := make([]ModelResult, len(models))
+
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func(i int, model string) {
+			defer wg.Done()
+
+			var opts RequestOptions
+			if optsFor != nil {
+				opts = optsFor(model)
+			}
+
+			start := time.Now()
+			response, err := c.chat(ctx, messages, model, temperature, opts)
+			results[i] = ModelResult{
+				Model:    model,
+				Response: response,
+				Err:      err,
+				Duration: time.Since(start),
+			}
+		}(i, model)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// ParseModelList parses a comma-separated list of model names, dropping
+// duplicates and empty entries.
+func ParseModelList(value string) ([]string, error) {
+	seen := make(map[string]bool)
+	var models []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || seen[field] {
+			continue
+		}
+		seen[field] = true
+		models = append(models, field)
+	}
+
+	if len(models) == 0 {
+		return nil, errors.New("no models given")
+	}
+	if len(models) > MaxCompareModels {
+		return nil, fmt.Errorf("too many models (maximum %d)", MaxCompareModels)
+	}
+
+	return models, nil
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
+	"time"
+	"unicode"
 
 	"gopkg.in/yaml.v3"
 	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
@@ -16,21 +19,106 @@ const (
 	envAPIURL = "CHATTY_API_URL"
 	minAPIKeyLength = 16  // Increased minimum length for better security
 	maxAPIKeyLength = 500 // Maximum length to prevent DoS
+
+	maxMetadataPairs       = 16
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 512
+	maxUserLength          = 256
+
+	maxStopSequences = 4
+
+	minContentWidth = 40 // Narrowest ui.max_width the layout supports
+
+	maxDisplayNameLength = 32
 )
 
+// imageSizePattern matches image dimensions such as 1024x1792.
+var imageSizePattern = regexp.MustCompile(`^(\d{2,5}x\d{2,5}|auto)$`)
+
+// sandboxMemoryPattern matches container memory limits such as 256m or 1g.
+var sandboxMemoryPattern = regexp.MustCompile(`^[1-9][0-9]*[kmg]$`)
+
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidTools are the features beyond chat that access roles can allow.
+var ValidTools = map[string]bool{
+	"recall":     true,
+	"transcribe": true,
+	"speak":      true,
+	"image":      true,
+	"compare":    true,
+	"run":        true,
+}
+
 // Config captures runtime configuration for the Chatty application.
 type Config struct {
-	API     APIConfig     `yaml:"api"`
-	Model   ModelConfig   `yaml:"model"`
-	Logging LoggingConfig `yaml:"logging"`
-	UI      UIConfig      `yaml:"ui"`
-	Storage StorageConfig `yaml:"storage"`
+	API        APIConfig        `yaml:"api"`
+	Model      ModelConfig      `yaml:"model"`
+	Embeddings EmbeddingsConfig `yaml:"embeddings"`
+	Audio      AudioConfig      `yaml:"audio"`
+	Images     ImagesConfig     `yaml:"images"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	UI         UIConfig         `yaml:"ui"`
+	Storage    StorageConfig    `yaml:"storage"`
+	Privacy    PrivacyConfig    `yaml:"privacy"`
+	Timeouts   TimeoutsConfig   `yaml:"timeouts"`
+	Access     AccessConfig     `yaml:"access"`
+	Sandbox    SandboxConfig    `yaml:"sandbox"`
+	// Templates are reusable prompts, keyed by name.
+	Templates map[string]TemplateConfig `yaml:"templates"`
+}
+
+// TemplateConfig is a reusable prompt. Placeholders like {{ticket_id}} in
+// System and Prompt are variables; those without a default are required.
+type TemplateConfig struct {
+	Description string            `yaml:"description"`
+	System      string            `yaml:"system"`
+	Prompt      string            `yaml:"prompt"`
+	Defaults    map[string]string `yaml:"defaults"`
 }
 
 // APIConfig holds settings for connecting to the OpenAI-compatible API.
 type APIConfig struct {
 	URL string `yaml:"url"`
 	Key string `yaml:"key"`
+	// MaxStreamLine is the largest single streamed event in bytes, 0 = built-in default (1 MiB).
+	MaxStreamLine int `yaml:"max_stream_line"`
+	// Organization and Project are sent as the OpenAI-Organization and
+	// OpenAI-Project headers for organization-scoped keys.
+	Organization string `yaml:"organization"`
+	Project      string `yaml:"project"`
+	// Metadata is attached to every chat request (e.g. team, purpose) for
+	// cost attribution by providers and gateways that support it.
+	Metadata map[string]string `yaml:"metadata"`
+	// User identifies the person behind the requests (OpenAI "user"), so
+	// gateways can attribute usage when a team shares one key.
+	User string `yaml:"user"`
+	// CircuitBreaker stops requests to an endpoint that keeps failing.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	// StreamBuffer controls how streamed text is batched before display.
+	StreamBuffer StreamBufferConfig `yaml:"stream_buffer"`
+	// PingOnStartup checks the endpoint when the TUI starts so a bad URL or
+	// key is reported before the first message.
+	PingOnStartup bool `yaml:"ping_on_startup"`
+	// ProbeFeatures detects once per endpoint and model whether streaming,
+	// tools, JSON mode and images are supported, so unsupported features are
+	// turned off or warned about instead of failing mid-chat.
+	ProbeFeatures bool `yaml:"probe_features"`
+}
+
+// StreamBufferConfig trades smoothness against latency for streamed answers:
+// text is shown once Bytes have arrived or Interval has passed, whichever
+// comes first.
+type StreamBufferConfig struct {
+	Bytes    int           `yaml:"bytes"`    // 1 = show every chunk immediately
+	Interval time.Duration `yaml:"interval"` // 0 = wait for Bytes regardless of delay
+}
+
+// CircuitBreakerConfig controls when requests to a failing endpoint are
+// short-circuited.
+type CircuitBreakerConfig struct {
+	Failures int           `yaml:"failures"`  // Consecutive failures that open the circuit, 0 = disabled
+	CoolDown time.Duration `yaml:"cool_down"` // How long requests are refused before a retry
 }
 
 // ModelConfig controls default model behaviour.
@@ -38,21 +126,185 @@ type ModelConfig struct {
 	Name        string  `yaml:"name"`
 	Temperature float64 `yaml:"temperature"`
 	Stream      bool    `yaml:"stream"`
+	MaxHistory  int     `yaml:"max_history"` // Most recent messages sent per request, 0 = unlimited
+	Seed        *int    `yaml:"seed"`         // Sampling seed for reproducible outputs, unset = random
+	Logprobs    bool    `yaml:"logprobs"`     // Request token log probabilities
+	TopLogprobs int     `yaml:"top_logprobs"` // Alternatives per token when logprobs is enabled (0-20)
+
+	// ReasoningEffort is sent to reasoning models (low, medium, high), empty = provider default.
+	ReasoningEffort string `yaml:"reasoning_effort"`
+	// Stop lists up to four sequences that end generation when produced.
+	Stop []string `yaml:"stop"`
+	// Capabilities overrides the built-in capability detection for the model family.
+	Capabilities *CapabilitiesConfig `yaml:"capabilities"`
+	// Fallbacks are tried in order when a request fails with 404, 429 or a 5xx status.
+	Fallbacks []FallbackConfig `yaml:"fallbacks"`
+	// Pricing is used to estimate the cost of each response.
+	Pricing *PricingConfig `yaml:"pricing"`
+	// ConfirmCostAbove asks before sending a request estimated to cost more
+	// than this many USD. Only applies with Pricing, 0 = never ask.
+	ConfirmCostAbove float64 `yaml:"confirm_cost_above"`
+	// SessionTokenBudget is the number of prompt and completion tokens a
+	// session may use before the TUI header warns, 0 = no budget.
+	SessionTokenBudget int `yaml:"session_token_budget"`
+}
+
+// PricingConfig holds model prices in USD per million tokens.
+type PricingConfig struct {
+	InputPerMillion  float64 `yaml:"input_per_million"`
+	OutputPerMillion float64 `yaml:"output_per_million"`
+}
+
+// FallbackConfig describes an alternative model. URL and Key default to the
+// primary API settings when empty.
+type FallbackConfig struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	Key  string `yaml:"key"`
+}
+
+// CapabilitiesConfig overrides which request parameters the configured model accepts.
+// Unset fields fall back to the built-in model family defaults.
+type CapabilitiesConfig struct {
+	Temperature         *bool `yaml:"temperature"`
+	ReasoningEffort     *bool `yaml:"reasoning_effort"`
+	MaxCompletionTokens *bool `yaml:"max_completion_tokens"`
+}
+
+// EmbeddingsConfig controls semantic search over saved conversations.
+type EmbeddingsConfig struct {
+	Model       string `yaml:"model"`        // Embedding model used to index messages
+	RecallLimit int    `yaml:"recall_limit"` // Maximum results returned by /recall
+}
+
+// AudioConfig controls speech input.
+type AudioConfig struct {
+	TranscriptionModel string `yaml:"transcription_model"` // Model used by /transcribe
+	Language           string `yaml:"language"`            // Optional ISO-639-1 hint, e.g. "en"
+	SpeechModel        string `yaml:"speech_model"`        // Model used by /speak and ui.tts
+	Voice              string `yaml:"voice"`               // Voice used for speech
+	Player             string `yaml:"player"`              // Command that plays an MP3 file, detected when empty
+}
+
+// ImagesConfig controls image generation with /image.
+type ImagesConfig struct {
+	Model     string `yaml:"model"`      // Image generation model
+	Size      string `yaml:"size"`       // e.g. "1024x1024", empty = provider default
+	OutputDir string `yaml:"output_dir"` // Where images are saved, empty = current directory
+}
+
+// TimeoutsConfig holds per-operation deadlines, written as durations such as "30s" or "2m".
+type TimeoutsConfig struct {
+	Request time.Duration `yaml:"request"` // Non-streaming API requests
+	Stream  time.Duration `yaml:"stream"`  // Silence allowed in a streaming response, keep-alives reset it
+	Persist time.Duration `yaml:"persist"` // Saving messages to storage
 }
 
 // LoggingConfig encapsulates logging preferences.
 type LoggingConfig struct {
 	Level string `yaml:"level"`
+	// DebugFile receives full API requests and responses with credentials redacted, empty = off.
+	DebugFile string `yaml:"debug_file"`
+	// AuditFile receives a hash-chained record of every model request, empty = off.
+	AuditFile string `yaml:"audit_file"`
+	// AuditContent adds prompts and responses to the audit log, not just metadata.
+	AuditContent bool `yaml:"audit_content"`
 }
 
 // UIConfig defines terminal rendering preferences.
 type UIConfig struct {
-	ShowTimestamps bool `yaml:"show_timestamps"`
+	ShowTimestamps   bool `yaml:"show_timestamps"`
+	ShowResponseMeta bool `yaml:"show_response_meta"` // Footer with model, tokens, latency and cost
+	OfflineQueue     bool `yaml:"offline_queue"`      // Queue prompts while the API is unreachable
+	TTS              bool `yaml:"tts"`                // Read each answer aloud
+	FollowUps        bool `yaml:"follow_ups"`         // Suggest follow-up questions after each answer
+	RenderMath       bool `yaml:"render_math"`        // Show LaTeX math as Unicode, --plain keeps it raw
+	MaxWidth         int  `yaml:"max_width"`          // Widest reading column in characters, 0 = full terminal width
+	Center           bool `yaml:"center"`             // Center the reading column when the terminal is wider
+	// FollowUpModel generates the suggestions, empty = the chat model. A small,
+	// cheap model is usually enough.
+	FollowUpModel string `yaml:"follow_up_model"`
+	// Labels of the two sides of the conversation, empty = "You" and
+	// "Assistant" ("AI" in the TUI). Avatars are usually an emoji.
+	UserName        string `yaml:"user_name"`
+	UserAvatar      string `yaml:"user_avatar"`
+	AssistantName   string `yaml:"assistant_name"`
+	AssistantAvatar string `yaml:"assistant_avatar"`
+	// TimestampFormat is "24h", "12h" or a Go time layout such as
+	// "15:04:05" or "2006-01-02 15:04 MST".
+	TimestampFormat string `yaml:"timestamp_format"`
+	// Timezone is an IANA name such as "Europe/Berlin" or "UTC", empty = local.
+	Timezone string `yaml:"timezone"`
+	// DetectDuplicates offers the earlier answer when a question repeats one
+	// of the recent questions of the conversation.
+	DetectDuplicates bool `yaml:"detect_duplicates"`
+	// ShowWelcome greets with the welcome banner on start and the goodbye
+	// banner on exit; --quiet turns both off.
+	ShowWelcome bool `yaml:"show_welcome"`
 }
 
 // StorageConfig defines persistence options.
 type StorageConfig struct {
 	Path string `yaml:"path"`
+	// Driver is "sqlite" (the default), which keeps a database file under
+	// Path, or "postgres", which keeps the history on the server at DSN.
+	Driver string `yaml:"driver"`
+	DSN    string `yaml:"dsn"`
+	// Attachments is "copy" (the default), which saves attached files in the
+	// database, or "reference", which only saves their paths.
+	Attachments string `yaml:"attachments"`
+	// TrashRetention is how long deleted sessions stay in the trash before
+	// they are purged; 0 keeps them until the trash is emptied.
+	TrashRetention time.Duration `yaml:"trash_retention"`
+	// AutoTitle names each new session after its first exchange by asking
+	// TitleModel (empty = the chat model) for a short title, instead of
+	// keeping the start of the first prompt.
+	AutoTitle  bool   `yaml:"auto_title"`
+	TitleModel string `yaml:"title_model"`
+	// SummaryEvery refreshes the one-line summary /list shows for a session
+	// after every that many answers, also written by TitleModel; 0 = only
+	// with /summarize --save.
+	SummaryEvery int `yaml:"summary_every"`
+	// DedupeMessages stores a user message identical to the previous one in
+	// its session once, counting the repeats on it, rather than again.
+	DedupeMessages bool `yaml:"dedupe_messages"`
+}
+
+// PrivacyConfig keeps chosen prompts off disk.
+type PrivacyConfig struct {
+	// ExcludePatterns are regular expressions matched case-insensitively
+	// against prompts. A matching prompt is not added to the input history,
+	// and neither it nor its answer is saved.
+	ExcludePatterns []string `yaml:"exclude_patterns"`
+}
+
+// SandboxConfig lets the model run Python and Go snippets it writes in
+// throwaway containers and see their output.
+type SandboxConfig struct {
+	Enabled   bool              `yaml:"enabled"`    // Offer the run_code tool to the model
+	Runtime   string            `yaml:"runtime"`    // Container runtime: docker or podman
+	Timeout   time.Duration     `yaml:"timeout"`    // Longest a snippet may run
+	Memory    string            `yaml:"memory"`     // Container memory limit, e.g. "256m"
+	MaxRounds int               `yaml:"max_rounds"` // Snippets run per answer before the model must reply
+	Images    map[string]string `yaml:"images"`     // Container image per language (python, go)
+}
+
+// AccessConfig restricts what each user of a shared server (chatty ssh) may
+// do. With no roles defined every user has full access.
+type AccessConfig struct {
+	Roles map[string]RoleConfig `yaml:"roles"`
+	// Users maps an SSH key, by its authorized_keys comment or key ID, to a role.
+	Users map[string]string `yaml:"users"`
+	// DefaultRole applies to users not listed, empty = they are refused.
+	DefaultRole string `yaml:"default_role"`
+}
+
+// RoleConfig lists what users with a role may access. A nil list allows
+// everything; an empty list allows nothing.
+type RoleConfig struct {
+	Models        []string `yaml:"models"`           // Chat models the role may use
+	Tools         []string `yaml:"tools"`            // recall, transcribe, speak, image, compare, run
+	MaxCostPerDay float64  `yaml:"max_cost_per_day"` // USD per user and UTC day, needs model.pricing, 0 = unlimited
 }
 
 // Load reads configuration from the provided path, falling back to defaults and
@@ -100,7 +352,21 @@ func loadFile(path string, cfg *Config) error {
 	// Expand environment variables in config values
 	cfg.API.Key = os.ExpandEnv(cfg.API.Key)
 	cfg.API.URL = os.ExpandEnv(cfg.API.URL)
+	cfg.API.Organization = os.ExpandEnv(cfg.API.Organization)
+	cfg.API.Project = os.ExpandEnv(cfg.API.Project)
+	for key, value := range cfg.API.Metadata {
+		cfg.API.Metadata[key] = os.ExpandEnv(value)
+	}
+	cfg.API.User = os.ExpandEnv(cfg.API.User)
 	cfg.Storage.Path = os.ExpandEnv(cfg.Storage.Path)
+	cfg.Storage.DSN = os.ExpandEnv(cfg.Storage.DSN)
+	cfg.Logging.DebugFile = os.ExpandEnv(cfg.Logging.DebugFile)
+	cfg.Logging.AuditFile = os.ExpandEnv(cfg.Logging.AuditFile)
+	cfg.Images.OutputDir = os.ExpandEnv(cfg.Images.OutputDir)
+	for i := range cfg.Model.Fallbacks {
+		cfg.Model.Fallbacks[i].URL = os.ExpandEnv(cfg.Model.Fallbacks[i].URL)
+		cfg.Model.Fallbacks[i].Key = os.ExpandEnv(cfg.Model.Fallbacks[i].Key)
+	}
 
 	return nil
 }
@@ -114,6 +380,12 @@ func applyEnvOverrides(cfg *Config) {
 	}
 }
 
+// Validate checks the configuration again, e.g. after command-line flags
+// have changed it.
+func (c *Config) Validate() error {
+	return c.validate()
+}
+
 func (c *Config) validate() error {
 	var validationErrors []error
 
@@ -130,6 +402,69 @@ func (c *Config) validate() error {
 		}
 	}
 
+	if c.API.CircuitBreaker.Failures < 0 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.circuit_breaker.failures", "cannot be negative", c.API.CircuitBreaker.Failures, nil))
+	}
+	if c.API.CircuitBreaker.Failures > 0 && c.API.CircuitBreaker.CoolDown <= 0 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.circuit_breaker.cool_down", "must be positive", c.API.CircuitBreaker.CoolDown, nil))
+	}
+	if c.UI.MaxWidth != 0 && c.UI.MaxWidth < minContentWidth {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("ui.max_width", fmt.Sprintf("must be 0 or at least %d", minContentWidth), c.UI.MaxWidth, nil))
+	}
+	switch c.UI.TimestampFormat {
+	case "", "24h", "12h":
+	default:
+		// A layout without any time elements formats as itself
+		if reference := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC); reference.Format(c.UI.TimestampFormat) == c.UI.TimestampFormat {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("ui.timestamp_format", "must be 24h, 12h or a Go time layout", c.UI.TimestampFormat, nil))
+		}
+	}
+	if c.UI.Timezone != "" {
+		if _, err := time.LoadLocation(c.UI.Timezone); err != nil {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("ui.timezone", "is not a known time zone", c.UI.Timezone, err))
+		}
+	}
+	for _, label := range []struct{ field, value string }{
+		{"ui.user_name", c.UI.UserName},
+		{"ui.user_avatar", c.UI.UserAvatar},
+		{"ui.assistant_name", c.UI.AssistantName},
+		{"ui.assistant_avatar", c.UI.AssistantAvatar},
+	} {
+		if len(label.value) > maxDisplayNameLength || strings.ContainsFunc(label.value, unicode.IsControl) {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError(label.field, fmt.Sprintf("must be at most %d bytes without control characters", maxDisplayNameLength), label.value, nil))
+		}
+	}
+	if c.API.StreamBuffer.Bytes < 1 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.stream_buffer.bytes", "must be at least 1", c.API.StreamBuffer.Bytes, nil))
+	}
+	if c.API.StreamBuffer.Interval < 0 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.stream_buffer.interval", "cannot be negative", c.API.StreamBuffer.Interval, nil))
+	}
+	if c.API.MaxStreamLine < 0 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.max_stream_line", "cannot be negative", c.API.MaxStreamLine, nil))
+	}
+	if strings.ContainsFunc(c.API.Organization, unicode.IsSpace) {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.organization", "cannot contain whitespace", c.API.Organization, nil))
+	}
+	if strings.ContainsFunc(c.API.Project, unicode.IsSpace) {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.project", "cannot contain whitespace", c.API.Project, nil))
+	}
+	// Limits follow the OpenAI metadata object
+	if len(c.API.User) > maxUserLength || strings.ContainsFunc(c.API.User, unicode.IsControl) {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.user", fmt.Sprintf("must be at most %d printable characters", maxUserLength), len(c.API.User), nil))
+	}
+	if len(c.API.Metadata) > maxMetadataPairs {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.metadata", fmt.Sprintf("cannot have more than %d entries", maxMetadataPairs), len(c.API.Metadata), nil))
+	}
+	for key, value := range c.API.Metadata {
+		if strings.TrimSpace(key) == "" || len(key) > maxMetadataKeyLength {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.metadata", fmt.Sprintf("keys must be 1-%d characters", maxMetadataKeyLength), key, nil))
+		}
+		if len(value) > maxMetadataValueLength {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("api.metadata."+key, fmt.Sprintf("cannot exceed %d characters", maxMetadataValueLength), len(value), nil))
+		}
+	}
+
 	// API Key validation with enhanced security checks
 	if err := validateAPIKeySecure(c.API.Key); err != nil {
 		validationErrors = append(validationErrors, chattyErrors.NewConfigError("api.key", err.Error(), nil))
@@ -147,6 +482,88 @@ func (c *Config) validate() error {
 		validationErrors = append(validationErrors, chattyErrors.NewValidationError("model.temperature", fmt.Sprintf("must be between 0.0 and 2.0, got %.2f", c.Model.Temperature), c.Model.Temperature, nil))
 	}
 
+	// History window validation
+	if c.Model.MaxHistory < 0 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("model.max_history", "cannot be negative", c.Model.MaxHistory, nil))
+	}
+
+	// Logprobs validation
+	if c.Model.TopLogprobs < 0 || c.Model.TopLogprobs > 20 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("model.top_logprobs", "must be between 0 and 20", c.Model.TopLogprobs, nil))
+	} else if c.Model.TopLogprobs > 0 && !c.Model.Logprobs {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("model.top_logprobs", "requires model.logprobs to be enabled", c.Model.TopLogprobs, nil))
+	}
+
+	// Reasoning effort validation
+	if len(c.Model.Stop) > maxStopSequences {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("model.stop", fmt.Sprintf("cannot have more than %d sequences", maxStopSequences), len(c.Model.Stop), nil))
+	}
+	for _, stop := range c.Model.Stop {
+		if stop == "" {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("model.stop", "sequences cannot be empty", stop, nil))
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.Model.ReasoningEffort)) {
+	case "", "minimal", "low", "medium", "high":
+	default:
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("model.reasoning_effort", "must be one of: minimal, low, medium, high", c.Model.ReasoningEffort, nil))
+	}
+
+	// Fallback validation
+	for i, fallback := range c.Model.Fallbacks {
+		field := fmt.Sprintf("model.fallbacks[%d]", i)
+		if strings.TrimSpace(fallback.Name) == "" {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError(field+".name", "cannot be empty", fallback.Name, nil))
+		}
+		if fallback.URL != "" && !strings.HasPrefix(fallback.URL, "http://") && !strings.HasPrefix(fallback.URL, "https://") {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError(field+".url", "must start with http:// or https://", fallback.URL, nil))
+		}
+		if fallback.Key != "" {
+			if err := validateAPIKeySecure(fallback.Key); err != nil {
+				validationErrors = append(validationErrors, chattyErrors.NewConfigError(field+".key", err.Error(), nil))
+			}
+		}
+	}
+
+	// Pricing validation
+	if p := c.Model.Pricing; p != nil && (p.InputPerMillion < 0 || p.OutputPerMillion < 0) {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("model.pricing", "prices cannot be negative", *p, nil))
+	}
+	if c.Model.ConfirmCostAbove < 0 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("model.confirm_cost_above", "cannot be negative", c.Model.ConfirmCostAbove, nil))
+	}
+	if c.Model.SessionTokenBudget < 0 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("model.session_token_budget", "cannot be negative", c.Model.SessionTokenBudget, nil))
+	}
+
+	// Embeddings validation
+	if strings.TrimSpace(c.Embeddings.Model) == "" {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("embeddings.model", "cannot be empty", c.Embeddings.Model, nil))
+	}
+	if c.Embeddings.RecallLimit < 1 || c.Embeddings.RecallLimit > 50 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("embeddings.recall_limit", "must be between 1 and 50", c.Embeddings.RecallLimit, nil))
+	}
+
+	// Audio validation
+	if strings.TrimSpace(c.Audio.TranscriptionModel) == "" {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("audio.transcription_model", "cannot be empty", c.Audio.TranscriptionModel, nil))
+	}
+	if strings.TrimSpace(c.Audio.SpeechModel) == "" {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("audio.speech_model", "cannot be empty", c.Audio.SpeechModel, nil))
+	}
+	if strings.TrimSpace(c.Audio.Voice) == "" {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("audio.voice", "cannot be empty", c.Audio.Voice, nil))
+	}
+
+	// Images validation
+	if strings.TrimSpace(c.Images.Model) == "" {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("images.model", "cannot be empty", c.Images.Model, nil))
+	}
+	if c.Images.Size != "" && !imageSizePattern.MatchString(c.Images.Size) {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("images.size", "must be WIDTHxHEIGHT or auto", c.Images.Size, nil))
+	}
+
 	// Logging level validation
 	validLevels := []string{"debug", "info", "warn", "error", "fatal"}
 	if strings.TrimSpace(c.Logging.Level) == "" {
@@ -164,6 +581,17 @@ func (c *Config) validate() error {
 		}
 	}
 
+	// Timeout validation
+	for field, timeout := range map[string]time.Duration{
+		"timeouts.request": c.Timeouts.Request,
+		"timeouts.stream":  c.Timeouts.Stream,
+		"timeouts.persist": c.Timeouts.Persist,
+	} {
+		if timeout <= 0 {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError(field, "must be a positive duration", timeout.String(), nil))
+		}
+	}
+
 	// Storage path validation
 	if strings.TrimSpace(c.Storage.Path) != "" {
 		if info, statErr := os.Stat(c.Storage.Path); statErr == nil {
@@ -172,6 +600,95 @@ func (c *Config) validate() error {
 			}
 		}
 	}
+	switch c.Storage.Driver {
+	case "", "sqlite":
+	case "postgres":
+		if strings.TrimSpace(c.Storage.DSN) == "" {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("storage.dsn", "is required for the postgres driver", "", nil))
+		}
+	default:
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("storage.driver", "must be sqlite or postgres", c.Storage.Driver, nil))
+	}
+	switch c.Storage.Attachments {
+	case "", "copy", "reference":
+	default:
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("storage.attachments", "must be copy or reference", c.Storage.Attachments, nil))
+	}
+	if c.Storage.TrashRetention < 0 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("storage.trash_retention", "must not be negative", c.Storage.TrashRetention.String(), nil))
+	}
+	if c.Storage.SummaryEvery < 0 {
+		validationErrors = append(validationErrors, chattyErrors.NewValidationError("storage.summary_every", "must not be negative", c.Storage.SummaryEvery, nil))
+	}
+
+	// Privacy validation
+	for i, pattern := range c.Privacy.ExcludePatterns {
+		field := fmt.Sprintf("privacy.exclude_patterns[%d]", i)
+		if strings.TrimSpace(pattern) == "" {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError(field, "cannot be empty", pattern, nil))
+		} else if _, err := regexp.Compile(pattern); err != nil {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError(field, "must be a valid regular expression", pattern, err))
+		}
+	}
+
+	// Template validation
+	for name, tmpl := range c.Templates {
+		if !templateNamePattern.MatchString(name) {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("templates."+name, "name must be letters, digits, '-' or '_'", name, nil))
+		}
+		if strings.TrimSpace(tmpl.Prompt) == "" {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("templates."+name+".prompt", "cannot be empty", tmpl.Prompt, nil))
+		}
+	}
+
+	// Sandbox validation
+	if c.Sandbox.Enabled {
+		if c.Sandbox.Runtime != "docker" && c.Sandbox.Runtime != "podman" {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("sandbox.runtime", "must be docker or podman", c.Sandbox.Runtime, nil))
+		}
+		if c.Sandbox.Timeout <= 0 {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("sandbox.timeout", "must be a positive duration", c.Sandbox.Timeout.String(), nil))
+		}
+		if !sandboxMemoryPattern.MatchString(c.Sandbox.Memory) {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("sandbox.memory", "must be a size such as 256m or 1g", c.Sandbox.Memory, nil))
+		}
+		if c.Sandbox.MaxRounds < 1 || c.Sandbox.MaxRounds > 20 {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("sandbox.max_rounds", "must be between 1 and 20", c.Sandbox.MaxRounds, nil))
+		}
+		for lang, image := range c.Sandbox.Images {
+			if lang != "python" && lang != "go" {
+				validationErrors = append(validationErrors, chattyErrors.NewValidationError("sandbox.images", "languages must be python or go", lang, nil))
+			}
+			if strings.TrimSpace(image) == "" {
+				validationErrors = append(validationErrors, chattyErrors.NewValidationError("sandbox.images."+lang, "cannot be empty", image, nil))
+			}
+		}
+	}
+
+	// Access validation
+	for name, role := range c.Access.Roles {
+		if role.MaxCostPerDay < 0 {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("access.roles."+name+".max_cost_per_day", "cannot be negative", role.MaxCostPerDay, nil))
+		}
+		if role.MaxCostPerDay > 0 && c.Model.Pricing == nil {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("access.roles."+name+".max_cost_per_day", "requires model.pricing", role.MaxCostPerDay, nil))
+		}
+		for _, tool := range role.Tools {
+			if !ValidTools[tool] {
+				validationErrors = append(validationErrors, chattyErrors.NewValidationError("access.roles."+name+".tools", "unknown tool", tool, nil))
+			}
+		}
+	}
+	for user, role := range c.Access.Users {
+		if _, ok := c.Access.Roles[role]; !ok {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("access.users."+user, "undefined role", role, nil))
+		}
+	}
+	if c.Access.DefaultRole != "" {
+		if _, ok := c.Access.Roles[c.Access.DefaultRole]; !ok {
+			validationErrors = append(validationErrors, chattyErrors.NewValidationError("access.default_role", "undefined role", c.Access.DefaultRole, nil))
+		}
+	}
 
 	if len(validationErrors) > 0 {
 		return chattyErrors.NewConfigError("configuration", fmt.Sprintf("validation failed:\n\t• %s", strings.Join(getErrorMessages(validationErrors), "\n\t• ")), nil)
@@ -192,20 +709,65 @@ func defaultConfig() Config {
 	return Config{
 		API: APIConfig{
 			URL: "",
+			CircuitBreaker: CircuitBreakerConfig{
+				Failures: 5,
+				CoolDown: 30 * time.Second,
+			},
+			StreamBuffer: StreamBufferConfig{
+				Bytes:    256,
+				Interval: 100 * time.Millisecond,
+			},
+			PingOnStartup: true,
+			ProbeFeatures: true,
 		},
 		Model: ModelConfig{
 			Name:        "groq/moonshotai/kimi-k2-instruct-0905",
-			Temperature: 0.7,
-			Stream:      true,
+			Temperature:      0.7,
+			Stream:           true,
+			ConfirmCostAbove: 0.50,
+		},
+		Embeddings: EmbeddingsConfig{
+			Model:       "text-embedding-3-small",
+			RecallLimit: 5,
+		},
+		Audio: AudioConfig{
+			TranscriptionModel: "whisper-1",
+			SpeechModel:        "tts-1",
+			Voice:              "alloy",
+		},
+		Images: ImagesConfig{
+			Model: "dall-e-3",
+			Size:  "1024x1024",
 		},
 		Logging: LoggingConfig{
 			Level: "info",
 		},
 		UI: UIConfig{
-			ShowTimestamps: true,
+			ShowTimestamps:   true,
+			RenderMath:       true,
+			MaxWidth:         120,
+			TimestampFormat:  "24h",
+			DetectDuplicates: true,
+			ShowWelcome:      true,
 		},
 		Storage: StorageConfig{
-			Path: "",
+			Path:           "",
+			TrashRetention: 30 * 24 * time.Hour,
+		},
+		Timeouts: TimeoutsConfig{
+			Request: 30 * time.Second,
+			Stream:  120 * time.Second,
+			Persist: 5 * time.Second,
+		},
+		Sandbox: SandboxConfig{
+			Runtime:   "docker",
+			Timeout:   20 * time.Second,
+			Memory:    "256m",
+			MaxRounds: 5,
+			Images: map[string]string{
+				"python": "python:3.12-alpine",
+				"go":     "golang:1.23-alpine",
+			},
 		},
 	}
 }
@@ -77,6 +77,34 @@ func TestLoad_InvalidTemperature(t *testing.T) {
 	}
 }
 
+func TestLoad_TimestampSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		ui      string
+		wantErr bool
+	}{
+		{"12h", "  timestamp_format: 12h\n", false},
+		{"layout and zone", "  timestamp_format: \"2006-01-02 15:04 MST\"\n  timezone: Europe/Berlin\n", false},
+		{"layout without time elements", "  timestamp_format: soon\n", true},
+		{"unknown zone", "  timezone: Mars/Olympus_Mons\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			content := []byte("api:\n  url: https://api.test/v1\n  key: sk-abc123def456ghi789jkl012mno345pqr\nmodel:\n  name: gpt-test\nui:\n" + tt.ui)
+			if err := os.WriteFile(configPath, content, 0o600); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestLoad_MissingAPIKey(t *testing.T) {
 	// Ensure no environment fallback is present.
 	t.Setenv(envAPIKey, "")
@@ -95,3 +123,69 @@ func TestLoad_MissingAPIKey(t *testing.T) {
 		t.Fatal("expected error for missing API key, got none")
 	}
 }
+
+func TestLoad_AttributionExpandsEnv(t *testing.T) {
+	t.Setenv(envAPIKey, "")
+	t.Setenv(envAPIURL, "")
+	t.Setenv("CHATTY_TEST_TEAM", "platform")
+	t.Setenv("CHATTY_TEST_USER", "alice")
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := []byte("api:\n  url: https://api.test/v1\n  key: sk-abc123def456ghi789jkl012mno345pqr\n  metadata:\n    team: ${CHATTY_TEST_TEAM}\n    purpose: support\n  user: ${CHATTY_TEST_USER}\n")
+
+	if err := os.WriteFile(configPath, content, 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.API.Metadata["team"] != "platform" || cfg.API.Metadata["purpose"] != "support" {
+		t.Errorf("unexpected metadata: %v", cfg.API.Metadata)
+	}
+	if cfg.API.User != "alice" {
+		t.Errorf("expected user alice, got %q", cfg.API.User)
+	}
+}
+
+func TestLoad_AccessRoles(t *testing.T) {
+	t.Setenv(envAPIKey, "")
+	t.Setenv(envAPIURL, "")
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	base := "api:\n  url: https://api.test/v1\n  key: sk-abc123def456ghi789jkl012mno345pqr\n"
+	content := []byte(base + "access:\n  default_role: guest\n  roles:\n    guest:\n      tools: []\n    staff:\n      tools: [image]\n  users:\n    alice@laptop: staff\n")
+
+	if err := os.WriteFile(configPath, content, 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if tools := cfg.Access.Roles["guest"].Tools; tools == nil || len(tools) != 0 {
+		t.Errorf("expected an empty, non-nil tool list for guest, got %#v", tools)
+	}
+	if cfg.Access.Roles["staff"].Models != nil {
+		t.Errorf("expected staff to allow every model")
+	}
+
+	invalid := []string{
+		"access:\n  roles:\n    guest:\n      tools: [shell]\n",
+		"access:\n  default_role: admin\n  roles:\n    guest: {}\n",
+		"access:\n  roles:\n    guest:\n      max_cost_per_day: 1\n",
+	}
+	for _, extra := range invalid {
+		if err := os.WriteFile(configPath, []byte(base+extra), 0o600); err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+		if _, err := Load(configPath); err == nil {
+			t.Errorf("expected an error for:\n%s", extra)
+		}
+	}
+}
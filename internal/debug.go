@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDebugLogName = "debug.log"
+	maxDebugSnippet     = 512 // Bytes of an unexpected body included in the debug log
+)
+
+// redactedHeaders are replaced before requests and responses are logged.
+var redactedHeaders = map[string]bool{
+	"Authorization": true,
+	"Api-Key":       true,
+	"X-Api-Key":     true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+}
+
+// debugTransport logs every request and response passing through it. Response
+// bodies are logged as they are read so streaming is not delayed.
+type debugTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+// EnableDebugLog wraps the client's transport so requests and responses are
+// written to w with credentials redacted.
+func (c *Client) EnableDebugLog(w io.Writer) {
+	next := c.http.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	transport := &debugTransport{next: next, w: w}
+	c.http.Transport = transport
+	c.debug = transport
+}
+
+// debugf writes a diagnostic line to the debug log when one is enabled.
+func (c *Client) debugf(format string, args ...interface{}) {
+	if c.debug != nil {
+		c.debug.logf(format, args...)
+	}
+}
+
+// bodySnippet truncates a response body for diagnostics.
+func bodySnippet(body []byte) string {
+	if len(body) <= maxDebugSnippet {
+		return string(body)
+	}
+	return strings.ToValidUTF8(string(body[:maxDebugSnippet]), "") + "... (truncated)"
+}
+
+// DefaultDebugLogPath returns the debug log location used when --debug is set
+// without an explicit path.
+func DefaultDebugLogPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".local/share/chatty", defaultDebugLogName), nil
+}
+
+// OpenDebugLog opens the debug log for appending, creating it with owner-only
+// permissions.
+func OpenDebugLog(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create debug log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open debug log: %w", err)
+	}
+	return file, nil
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	t.logf("--> %s %s %s\n%s\n%s\n", time.Now().Format(time.RFC3339), req.Method, req.URL.Redacted(), formatHeaders(req.Header), body)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.logf("<-- %s error after %v: %v\n\n", req.URL.Redacted(), time.Since(start), err)
+		return nil, err
+	}
+
+	t.logf("<-- %s %s (%v)\n%s\n", req.URL.Redacted(), resp.Status, time.Since(start), formatHeaders(resp.Header))
+	resp.Body = &debugBody{ReadCloser: resp.Body, t: t}
+	return resp, nil
+}
+
+func (t *debugTransport) logf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, format, args...)
+}
+
+func (t *debugTransport) write(p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.w.Write(p)
+}
+
+// debugBody copies the response body to the debug log as it is consumed.
+type debugBody struct {
+	io.ReadCloser
+	t *debugTransport
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.t.write(p[:n])
+	}
+	return n, err
+}
+
+func (b *debugBody) Close() error {
+	b.t.logf("\n<-- end of body\n\n")
+	return b.ReadCloser.Close()
+}
+
+// formatHeaders renders headers one per line in a stable order, redacting
+// credentials.
+func formatHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			value = "[REDACTED]"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", name, value)
+	}
+	return b.String()
+}
@@ -0,0 +1,116 @@
+package internal
+
+import "regexp"
+
+// maxDiffCells bounds the word-by-word comparison table of WordDiff. Texts
+// that differ over more words are shown as one deletion and one insertion.
+const maxDiffCells = 4_000_000
+
+// DiffOp says whether a piece of text is in both texts of a diff or only in
+// one of them.
+type DiffOp int
+
+const (
+	DiffEqual DiffOp = iota
+	DiffDelete
+	DiffInsert
+)
+
+// DiffSegment is a run of text with the same DiffOp.
+type DiffSegment struct {
+	Op   DiffOp
+	Text string
+}
+
+var diffTokenPattern = regexp.MustCompile(`\s+|\S+`)
+
+// WordDiff compares two texts word by word and returns the segments that turn
+// before into after. Whitespace is compared like words, so a changed line
+// break shows up as well.
+func WordDiff(before, after string) []DiffSegment {
+	a := diffTokenPattern.FindAllString(before, -1)
+	b := diffTokenPattern.FindAllString(after, -1)
+
+	// Answers to the same question usually share their start and end
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var segments []DiffSegment
+	add := func(op DiffOp, token string) {
+		if n := len(segments); n > 0 && segments[n-1].Op == op {
+			segments[n-1].Text += token
+			return
+		}
+		segments = append(segments, DiffSegment{Op: op, Text: token})
+	}
+
+	for _, token := range a[:prefix] {
+		add(DiffEqual, token)
+	}
+	for _, segment := range diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		add(segment.Op, segment.Text)
+	}
+	for _, token := range a[len(a)-suffix:] {
+		add(DiffEqual, token)
+	}
+	return segments
+}
+
+// diffMiddle diffs the tokens between the common prefix and suffix using
+// their longest common subsequence.
+func diffMiddle(a, b []string) []DiffSegment {
+	var segments []DiffSegment
+	if len(a)*len(b) > maxDiffCells {
+		for _, token := range a {
+			segments = append(segments, DiffSegment{Op: DiffDelete, Text: token})
+		}
+		for _, token := range b {
+			segments = append(segments, DiffSegment{Op: DiffInsert, Text: token})
+		}
+		return segments
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			segments = append(segments, DiffSegment{Op: DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			segments = append(segments, DiffSegment{Op: DiffDelete, Text: a[i]})
+			i++
+		default:
+			segments = append(segments, DiffSegment{Op: DiffInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		segments = append(segments, DiffSegment{Op: DiffDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		segments = append(segments, DiffSegment{Op: DiffInsert, Text: b[j]})
+	}
+	return segments
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	duplicateLookback   = 20   // Recent questions compared with a new one
+	duplicateMinWords   = 4    // Shorter prompts like "continue" are often repeated on purpose
+	duplicateSimilarity = 0.9  // Minimum similarity of the normalised texts
+	duplicateMaxCompare = 2000 // Longer texts must match exactly
+)
+
+// FindDuplicateQuestion looks for a recent question in history that is nearly
+// identical to prompt, ignoring case, punctuation and spacing, and was
+// answered. It returns the index of the latest such answer, or -1.
+func FindDuplicateQuestion(history []Message, prompt string) int {
+	want := normalizeQuestion(prompt)
+	if len(strings.Fields(want)) < duplicateMinWords {
+		return -1
+	}
+
+	checked := 0
+	for i := len(history) - 2; i >= 0 && checked < duplicateLookback; i-- {
+		if history[i].Role != "user" {
+			continue
+		}
+		checked++
+		if history[i+1].Role != "assistant" || strings.TrimSpace(history[i+1].Content) == "" {
+			continue
+		}
+		if similarity(want, normalizeQuestion(history[i].Content)) >= duplicateSimilarity {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// normalizeQuestion lowercases text and keeps only its words, separated by
+// single spaces.
+func normalizeQuestion(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// similarity is 1 minus the edit distance between a and b relative to the
+// longer of the two.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) > duplicateMaxCompare || len(rb) > duplicateMaxCompare {
+		return 0
+	}
+	longest := max(len(ra), len(rb))
+	// Texts whose lengths differ too much cannot be similar enough
+	if float64(abs(len(ra)-len(rb))) > (1-duplicateSimilarity)*float64(longest) {
+		return 0
+	}
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
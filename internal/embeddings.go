@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+const (
+	embeddingBatchSize    = 64
+	maxEmbeddingInputLen  = 8000 // Characters of a message sent for embedding
+	maxIndexedPerRecall   = 512  // Messages indexed before each search, bounds /recall latency
+	maxrecallSnippetRunes = 600
+)
+
+// RecallResult is a stored message ranked by similarity to a recall query.
+type RecallResult struct {
+	SessionID int64
+	Role      string
+	Content   string
+	Score     float64
+}
+
+// Embed returns one embedding vector per input using the /embeddings endpoint.
+func (c *Client) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	if c == nil {
+		return nil, chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
+	}
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+
+	if err := c.checkRateLimits(); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"model": model,
+		"input": inputs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/embeddings", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, c.decodeError(bytes.NewReader(bodyBytes), resp.StatusCode)
+	}
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	vectors := make([][]float32, len(inputs))
+	for _, item := range response.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+	}
+
+	return vectors, nil
+}
+
+// IndexMessages embeds up to limit stored messages that have no embedding for
+// model yet and returns how many were indexed.
+func IndexMessages(ctx context.Context, client Embedder, store storage.Backend, model string, limit int) (int, error) {
+	pending, err := store.ListUnembeddedMessages(ctx, model, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	indexed := 0
+	for start := 0; start < len(pending); start += embeddingBatchSize {
+		end := start + embeddingBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+
+		inputs := make([]string, len(batch))
+		for i, msg := range batch {
+			inputs[i] = embeddingInput(msg.Content)
+		}
+
+		vectors, err := client.Embed(ctx, model, inputs)
+		if err != nil {
+			return indexed, fmt.Errorf("embed messages: %w", err)
+		}
+
+		for i, msg := range batch {
+			if err := store.SaveEmbedding(ctx, msg.ID, model, vectors[i]); err != nil {
+				return indexed, err
+			}
+			indexed++
+		}
+	}
+
+	return indexed, nil
+}
+
+// Recall indexes any new messages and returns the limit stored messages most
+// similar to query across all sessions.
+func Recall(ctx context.Context, client Embedder, store storage.Backend, model, query string, limit int) ([]RecallResult, error) {
+	if client == nil || store == nil {
+		return nil, errors.New("recall requires an API client and storage")
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New("recall query cannot be empty")
+	}
+
+	if _, err := IndexMessages(ctx, client, store, model, maxIndexedPerRecall); err != nil {
+		return nil, err
+	}
+
+	vectors, err := client.Embed(ctx, model, []string{embeddingInput(query)})
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+
+	stored, err := store.ListEmbeddings(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RecallResult, 0, len(stored))
+	for _, item := range stored {
+		results = append(results, RecallResult{
+			SessionID: item.SessionID,
+			Role:      item.Role,
+			Content:   item.Content,
+			Score:     cosineSimilarity(vectors[0], item.Vector),
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// RecallContext formats recall results as a system message that can be sent
+// alongside the conversation.
+func RecallContext(results []RecallResult) Message {
+	var b strings.Builder
+	b.WriteString("Relevant excerpts from earlier conversations:\n")
+	for _, r := range results {
+		fmt.Fprintf(&b, "\n[session %d, %s]\n%s\n", r.SessionID, r.Role, recallSnippet(r.Content))
+	}
+	return Message{Role: "system", Content: b.String()}
+}
+
+// recallSnippet shortens message content for display and context injection.
+func recallSnippet(content string) string {
+	content = strings.TrimSpace(content)
+	runes := []rune(content)
+	if len(runes) <= maxrecallSnippetRunes {
+		return content
+	}
+	return string(runes[:maxrecallSnippetRunes]) + "…"
+}
+
+func embeddingInput(content string) string {
+	if len(content) <= maxEmbeddingInputLen {
+		return content
+	}
+	return strings.ToValidUTF8(content[:maxEmbeddingInputLen], "")
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
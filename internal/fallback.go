@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Fallback is an alternative model tried when a request fails. Client is nil
+// when the fallback is served by the same provider as the primary model.
+type Fallback struct {
+	Model  string
+	Client *Client
+}
+
+// SetFallbacks sets the ordered list of models tried after the primary model fails.
+func (c *Client) SetFallbacks(fallbacks []Fallback) {
+	c.fallbacks = fallbacks
+}
+
+// LastModel returns the model that answered the most recent successful request,
+// which differs from the requested model when a fallback was used.
+func (c *Client) LastModel() string {
+	c.lastModelMutex.Lock()
+	defer c.lastModelMutex.Unlock()
+	return c.lastModel
+}
+
+func (c *Client) setLastModel(model string) {
+	c.lastModelMutex.Lock()
+	c.lastModel = model
+	c.lastModelMutex.Unlock()
+}
+
+// withFallbacks runs call against the primary model and then against each
+// fallback in turn for as long as the failure is one a different model or
+// provider might not have.
+func (c *Client) withFallbacks(model string, opts RequestOptions, call func(client *Client, model string, opts RequestOptions) error) error {
+	err := call(c, model, opts)
+	if err == nil {
+		c.setLastModel(model)
+		c.recordUsage()
+		return nil
+	}
+
+	// Capability overrides describe the primary model only.
+	opts.Capabilities = nil
+
+	for _, fallback := range c.fallbacks {
+		if !shouldFallback(err) {
+			break
+		}
+
+		client := fallback.Client
+		if client == nil {
+			client = c
+		}
+
+		err = call(client, fallback.Model, opts)
+		if err == nil {
+			if client != c {
+				c.setLogprobs(client.LastLogprobs())
+				c.setUsage(client.LastUsage())
+			}
+			c.setLastModel(fallback.Model)
+			c.recordUsage()
+			return nil
+		}
+	}
+
+	return err
+}
+
+// recordUsage adds the tokens of the last response to the metrics.
+func (c *Client) recordUsage() {
+	if usage := c.LastUsage(); usage != nil {
+		c.metrics.AddTokens(usage.PromptTokens, usage.CompletionTokens)
+	}
+}
+
+// shouldFallback reports whether err is an API response status that another
+// model may not return: unknown model, rate limiting, or a server error. An
+// open circuit breaker also falls back, since the fallback may use another
+// provider.
+func shouldFallback(err error) bool {
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		return true
+	}
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+
+	return httpErr.StatusCode == http.StatusNotFound ||
+		httpErr.StatusCode == http.StatusTooManyRequests ||
+		httpErr.StatusCode >= 500
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	// MaxFollowUps is the number of suggested follow-up questions requested.
+	MaxFollowUps = 3
+
+	maxFollowUpContext = 4000 // Characters of the last answer sent with the request
+	maxFollowUpLength  = 200  // Longest suggestion kept
+
+	followUpPrompt = "Suggest up to 3 short follow-up questions the user might ask next about the conversation above. " +
+		"Reply with one question per line and nothing else."
+)
+
+// SuggestFollowUps asks model for follow-up questions to the last exchange in
+// history. Only the final question and answer are sent, to keep it cheap.
+func SuggestFollowUps(ctx context.Context, client ChatProvider, model string, history []Message) ([]string, error) {
+	var exchange []Message
+	for i := len(history) - 1; i >= 0 && len(exchange) < 2; i-- {
+		msg := history[i]
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		if len(msg.Content) > maxFollowUpContext {
+			msg.Content = strings.ToValidUTF8(msg.Content[:maxFollowUpContext], "")
+		}
+		exchange = append([]Message{msg}, exchange...)
+	}
+	if len(exchange) == 0 {
+		return nil, nil
+	}
+
+	messages := append(exchange, Message{Role: "user", Content: followUpPrompt})
+	reply, err := client.ChatWithOptions(ctx, messages, model, 0.7, RequestOptions{MaxTokens: 150})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFollowUps(reply), nil
+}
+
+// parseFollowUps extracts questions from a reply, dropping list markers.
+func parseFollowUps(reply string) []string {
+	var suggestions []string
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimLeft(line, "-*•0123456789.) ")
+		line = strings.Trim(line, "\"")
+		if line == "" || len(line) > maxFollowUpLength {
+			continue
+		}
+		suggestions = append(suggestions, line)
+		if len(suggestions) == MaxFollowUps {
+			break
+		}
+	}
+	return suggestions
+}
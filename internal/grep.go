@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// LineMatch is a line of a message that matched a /grep pattern or /find
+// text.
+type LineMatch struct {
+	Message int // Index of the message in the transcript
+	Role    string
+	Line    string
+}
+
+// GrepMessages returns every line of messages that matches pattern, in
+// transcript order.
+func GrepMessages(messages []Message, pattern *regexp.Regexp) []LineMatch {
+	var matches []LineMatch
+	for i, msg := range messages {
+		for _, line := range strings.Split(msg.Content, "\n") {
+			if pattern.MatchString(line) {
+				matches = append(matches, LineMatch{Message: i, Role: msg.Role, Line: line})
+			}
+		}
+	}
+	return matches
+}
+
+// FindMessages returns, for every message that contains text, ignoring case,
+// its first line that does, in transcript order.
+func FindMessages(messages []Message, text string) []LineMatch {
+	text = strings.ToLower(text)
+	var matches []LineMatch
+	for i, msg := range messages {
+		for _, line := range strings.Split(msg.Content, "\n") {
+			if strings.Contains(strings.ToLower(line), text) {
+				matches = append(matches, LineMatch{Message: i, Role: msg.Role, Line: line})
+				break
+			}
+		}
+	}
+	return matches
+}
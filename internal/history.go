@@ -0,0 +1,21 @@
+package internal
+
+// TrimHistory returns the subset of history that should be sent with the next
+// request. When maxMessages is positive only the most recent maxMessages entries
+// are kept, but system messages and any position present in pinned are always
+// retained. The original ordering of the conversation is preserved.
+func TrimHistory(history []Message, maxMessages int, pinned map[int]bool) []Message {
+	if maxMessages <= 0 || len(history) <= maxMessages {
+		return history
+	}
+
+	cutoff := len(history) - maxMessages
+	trimmed := make([]Message, 0, maxMessages+len(pinned))
+	for i, msg := range history {
+		if i >= cutoff || msg.Role == "system" || pinned[i] {
+			trimmed = append(trimmed, msg)
+		}
+	}
+
+	return trimmed
+}
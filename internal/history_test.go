@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+func TestTrimHistory(t *testing.T) {
+	history := []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "one"},
+		{Role: "assistant", Content: "two"},
+		{Role: "user", Content: "three"},
+		{Role: "assistant", Content: "four"},
+	}
+
+	tests := []struct {
+		name   string
+		max    int
+		pinned map[int]bool
+		want   []string
+	}{
+		{"unlimited", 0, nil, []string{"be brief", "one", "two", "three", "four"}},
+		{"window larger than history", 10, nil, []string{"be brief", "one", "two", "three", "four"}},
+		{"keeps system message", 2, nil, []string{"be brief", "three", "four"}},
+		{"keeps pinned message", 2, map[int]bool{1: true}, []string{"be brief", "one", "three", "four"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TrimHistory(history, tt.max, tt.pinned)
+			contents := make([]string, len(got))
+			for i, msg := range got {
+				contents[i] = msg.Content
+			}
+			if !reflect.DeepEqual(contents, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, contents)
+			}
+		})
+	}
+}
+
+func TestWithSystemPrompt(t *testing.T) {
+	history := []Message{{Role: "user", Content: "one"}}
+
+	if got := WithSystemPrompt(history, ""); !reflect.DeepEqual(got, history) {
+		t.Errorf("expected the history unchanged, got %v", got)
+	}
+	got := WithSystemPrompt(history, "be brief")
+	want := []Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "one"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if len(history) != 1 {
+		t.Errorf("history was modified: %v", history)
+	}
+}
+
+func TestFindMessages(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "How do I read a file?"},
+		{Role: "assistant", Content: "Use os.ReadFile:\n\ndata, err := os.ReadFile(path)"},
+		{Role: "user", Content: "Thanks"},
+	}
+
+	got := FindMessages(messages, "OS.READFILE(")
+	want := []LineMatch{{Message: 1, Role: "assistant", Line: "data, err := os.ReadFile(path)"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := FindMessages(messages, "missing"); len(got) != 0 {
+		t.Errorf("expected no matches, got %v", got)
+	}
+}
+
+func TestExpandToolTrace(t *testing.T) {
+	history := []Message{
+		{Role: "user", Content: "Does it compile?"},
+		{Role: "assistant", Content: "Yes.", ToolTrace: []storage.ToolCallRecord{
+			{Round: 0, CallID: "a", Name: "run_code", Arguments: `{"code":"1"}`, Result: "exit code 0"},
+			{Round: 1, Name: "run_code", Arguments: `{"code":"2"}`, Result: "exit code 1"},
+		}},
+	}
+
+	got := ExpandToolTrace(history)
+	want := []Message{
+		{Role: "user", Content: "Does it compile?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "a", Type: "function", Function: FunctionCall{Name: "run_code", Arguments: `{"code":"1"}`}}}},
+		{Role: "tool", ToolCallID: "a", Content: "exit code 0"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1_0", Type: "function", Function: FunctionCall{Name: "run_code", Arguments: `{"code":"2"}`}}}},
+		{Role: "tool", ToolCallID: "call_1_0", Content: "exit code 1"},
+		{Role: "assistant", Content: "Yes."},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if len(history[1].ToolTrace) != 2 {
+		t.Errorf("history was modified: %+v", history)
+	}
+}
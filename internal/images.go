@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+)
+
+// maxImageDownload bounds an image fetched from a provider-hosted URL.
+const maxImageDownload = 32 << 20
+
+// imageExtensions maps detected image content types to file extensions.
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+// GenerateImage creates an image from prompt using the /images/generations
+// endpoint and returns the encoded image bytes. size is optional (e.g. "1024x1024").
+func (c *Client) GenerateImage(ctx context.Context, model, prompt, size string) ([]byte, error) {
+	if c == nil {
+		return nil, chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
+	}
+
+	if err := c.checkRateLimits(); err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"model":  model,
+		"prompt": prompt,
+		"n":      1,
+	}
+	if size != "" {
+		body["size"] = size
+	}
+	// gpt-image models always return base64 and reject response_format
+	if !strings.HasPrefix(baseModelName(model), "gpt-image") {
+		body["response_format"] = "b64_json"
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	// Image generation routinely takes longer than a chat request
+	ctx, cancel := context.WithTimeout(ctx, c.streamTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/images/generations", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, c.decodeError(bytes.NewReader(bodyBytes), resp.StatusCode)
+	}
+
+	var response struct {
+		Data []struct {
+			B64JSON string `json:"b64_json"`
+			URL     string `json:"url"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("response contained no images")
+	}
+
+	image := response.Data[0]
+	switch {
+	case image.B64JSON != "":
+		data, err := base64.StdEncoding.DecodeString(image.B64JSON)
+		if err != nil {
+			return nil, fmt.Errorf("decode image: %w", err)
+		}
+		return data, nil
+	case image.URL != "":
+		return c.downloadImage(ctx, image.URL)
+	default:
+		return nil, fmt.Errorf("response contained neither image data nor a URL")
+	}
+}
+
+// downloadImage fetches an image the provider returned by URL. The request is
+// not authenticated: these are pre-signed links, often on another host.
+func (c *Client) downloadImage(ctx context.Context, url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return nil, fmt.Errorf("unexpected image URL scheme")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download image: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownload+1))
+	if err != nil {
+		return nil, fmt.Errorf("download image: %w", err)
+	}
+	if len(data) > maxImageDownload {
+		return nil, fmt.Errorf("image exceeds %d bytes", maxImageDownload)
+	}
+	return data, nil
+}
+
+// SaveImage writes image data to a new timestamped file in dir (the current
+// directory when empty) and returns its path.
+func SaveImage(data []byte, dir string) (string, error) {
+	ext, ok := imageExtensions[http.DetectContentType(data)]
+	if !ok {
+		return "", fmt.Errorf("response is not a supported image type")
+	}
+
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create image directory: %w", err)
+	}
+
+	base := "chatty-image-" + time.Now().Format("20060102-150405")
+	path := filepath.Join(dir, base+ext)
+	for i := 2; ; i++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if os.IsExist(err) {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, i, ext))
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("create image file: %w", err)
+		}
+		if _, err := file.Write(data); err != nil {
+			file.Close()
+			return "", fmt.Errorf("write image file: %w", err)
+		}
+		if err := file.Close(); err != nil {
+			return "", fmt.Errorf("write image file: %w", err)
+		}
+		return path, nil
+	}
+}
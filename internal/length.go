@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LengthPreset maps a response length choice to a system prompt hint and a
+// max_tokens limit.
+type LengthPreset struct {
+	Name      string
+	Hint      string // System prompt hint, empty for none
+	MaxTokens int    // 0 leaves the provider default in place
+}
+
+// DefaultLengthPreset is the preset used when no length has been chosen.
+const DefaultLengthPreset = "normal"
+
+var lengthPresets = map[string]LengthPreset{
+	"short": {
+		Name:      "short",
+		Hint:      "Answer concisely. Keep responses to a few sentences unless code is required.",
+		MaxTokens: 512,
+	},
+	"normal": {
+		Name: "normal",
+	},
+	"detailed": {
+		Name:      "detailed",
+		Hint:      "Give thorough, detailed answers. Explain your reasoning and include examples where helpful.",
+		MaxTokens: 4096,
+	},
+}
+
+// LookupLengthPreset returns the preset with the given name.
+func LookupLengthPreset(name string) (LengthPreset, error) {
+	preset, ok := lengthPresets[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return LengthPreset{}, fmt.Errorf("unknown length %q (must be one of: short, normal, detailed)", name)
+	}
+	return preset, nil
+}
+
+// Apply prepends the preset hint as a system message and sets the token limit
+// on opts. The history slice is not modified.
+func (p LengthPreset) Apply(history []Message, opts RequestOptions) ([]Message, RequestOptions) {
+	if p.MaxTokens > 0 {
+		opts.MaxTokens = p.MaxTokens
+	}
+	if p.Hint == "" {
+		return history, opts
+	}
+
+	withHint := make([]Message, 0, len(history)+1)
+	withHint = append(withHint, Message{Role: "system", Content: p.Hint})
+	withHint = append(withHint, history...)
+	return withHint, opts
+}
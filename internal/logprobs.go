@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// FormatLogprobs renders token log probabilities as a plain-text table, one
+// token per line with its probability and any top alternatives. At most
+// maxTokens rows are included when maxTokens is positive.
+func FormatLogprobs(logprobs []TokenLogprob, maxTokens int) string {
+	if len(logprobs) == 0 {
+		return "No logprobs recorded for the last response. Enable model.logprobs (or --logprobs) and send a message."
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-4s %-20s %9s %7s  %s\n", "#", "token", "logprob", "prob", "alternatives")
+	for i, lp := range logprobs {
+		if maxTokens > 0 && i >= maxTokens {
+			fmt.Fprintf(&b, "... %d more tokens\n", len(logprobs)-maxTokens)
+			break
+		}
+
+		alternatives := make([]string, 0, len(lp.TopLogprobs))
+		for _, alt := range lp.TopLogprobs {
+			if alt.Token == lp.Token {
+				continue
+			}
+			alternatives = append(alternatives, fmt.Sprintf("%q %.1f%%", alt.Token, math.Exp(alt.Logprob)*100))
+		}
+
+		fmt.Fprintf(&b, "%-4d %-20q %9.4f %6.1f%%  %s\n", i+1, lp.Token, lp.Logprob, math.Exp(lp.Logprob)*100, strings.Join(alternatives, ", "))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal/config"
+)
+
+// ResponseMeta summarises a completed response for the metadata footer.
+type ResponseMeta struct {
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool // Token counts are estimates because the provider reported no usage
+	Latency          time.Duration
+	Cost             float64
+	HasCost          bool
+}
+
+// NewResponseMeta builds the metadata for a response. Reported usage is
+// preferred; without it the token counts are estimated from prompt and
+// response. Cost is only computed when pricing is configured.
+func NewResponseMeta(model string, usage *Usage, prompt []Message, response string, latency time.Duration, pricing *config.PricingConfig) ResponseMeta {
+	meta := ResponseMeta{Model: model, Latency: latency}
+	if usage != nil {
+		meta.PromptTokens = usage.PromptTokens
+		meta.CompletionTokens = usage.CompletionTokens
+	} else {
+		meta.PromptTokens = EstimateMessageTokens(prompt)
+		meta.CompletionTokens = EstimateTokens(response)
+		meta.Estimated = true
+	}
+
+	if pricing != nil {
+		meta.Cost = EstimateCost(pricing, meta.PromptTokens, meta.CompletionTokens)
+		meta.HasCost = true
+	}
+
+	return meta
+}
+
+// EstimateCost returns the cost in USD of the given token counts.
+func EstimateCost(pricing *config.PricingConfig, promptTokens, completionTokens int) float64 {
+	if pricing == nil {
+		return 0
+	}
+	return (float64(promptTokens)*pricing.InputPerMillion + float64(completionTokens)*pricing.OutputPerMillion) / 1e6
+}
+
+// EstimateRequestCost returns the estimated cost in USD of sending messages:
+// the prompt, plus opts.MaxTokens of output when a limit is set.
+func EstimateRequestCost(pricing *config.PricingConfig, messages []Message, opts RequestOptions) float64 {
+	return EstimateCost(pricing, EstimateMessageTokens(messages), opts.MaxTokens)
+}
+
+// CostNeedsConfirmation reports whether the estimated cost of sending
+// messages is above model.confirm_cost_above, and returns the estimate.
+func CostNeedsConfirmation(cfg *config.Config, messages []Message, opts RequestOptions) (float64, bool) {
+	if cfg.Model.Pricing == nil || cfg.Model.ConfirmCostAbove <= 0 {
+		return 0, false
+	}
+	cost := EstimateRequestCost(cfg.Model.Pricing, messages, opts)
+	return cost, cost > cfg.Model.ConfirmCostAbove
+}
+
+// String formats the metadata as a single footer line.
+func (m ResponseMeta) String() string {
+	approx := ""
+	if m.Estimated {
+		approx = "~"
+	}
+
+	parts := []string{
+		m.Model,
+		fmt.Sprintf("%s%d in / %s%d out", approx, m.PromptTokens, approx, m.CompletionTokens),
+		fmt.Sprintf("%.1fs", m.Latency.Seconds()),
+	}
+	if m.HasCost {
+		parts = append(parts, fmt.Sprintf("%s$%.4f", approx, m.Cost))
+	}
+
+	return strings.Join(parts, " • ")
+}
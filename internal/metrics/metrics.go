@@ -0,0 +1,209 @@
+// Package metrics counts API usage and serves it in the Prometheus text
+// exposition format, for monitoring long-running chatty servers.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency
+// histogram. Streaming requests are timed until the response headers arrive.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type requestKey struct {
+	endpoint string
+	code     string
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Metrics collects API usage counters. All methods are safe for concurrent
+// use, and do nothing on a nil *Metrics so callers need not check.
+type Metrics struct {
+	mu               sync.Mutex
+	requests         map[requestKey]uint64
+	latency          map[string]*histogram
+	promptTokens     uint64
+	completionTokens uint64
+	cacheHits        uint64
+	cacheMisses      uint64
+	rateLimited      uint64
+}
+
+// New creates an empty set of metrics.
+func New() *Metrics {
+	return &Metrics{
+		requests: make(map[requestKey]uint64),
+		latency:  make(map[string]*histogram),
+	}
+}
+
+// ObserveRequest records an API request to endpoint (e.g. "/chat/completions").
+// A status of 0 means the request failed before a response arrived.
+func (m *Metrics) ObserveRequest(endpoint string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	code := "error"
+	if status > 0 {
+		code = strconv.Itoa(status)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{endpoint, code}]++
+	h := m.latency[endpoint]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[endpoint] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// AddTokens records the token usage of a completed response.
+func (m *Metrics) AddTokens(prompt, completion int) {
+	if m == nil || prompt < 0 || completion < 0 {
+		return
+	}
+	m.mu.Lock()
+	m.promptTokens += uint64(prompt)
+	m.completionTokens += uint64(completion)
+	m.mu.Unlock()
+}
+
+// CacheHit records a response served from the response cache.
+func (m *Metrics) CacheHit() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.cacheHits++
+	m.mu.Unlock()
+}
+
+// CacheMiss records a cacheable request that had to be sent to the API.
+func (m *Metrics) CacheMiss() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.cacheMisses++
+	m.mu.Unlock()
+}
+
+// RateLimited records a request refused by the client-side rate limiter.
+func (m *Metrics) RateLimited() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.rateLimited++
+	m.mu.Unlock()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+
+	fmt.Fprintln(cw, "# HELP chatty_api_requests_total API requests by endpoint and HTTP status.")
+	fmt.Fprintln(cw, "# TYPE chatty_api_requests_total counter")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, key := range keys {
+		fmt.Fprintf(cw, "chatty_api_requests_total{endpoint=%q,code=%q} %d\n", key.endpoint, key.code, m.requests[key])
+	}
+
+	fmt.Fprintln(cw, "# HELP chatty_api_request_duration_seconds Time until the API responded.")
+	fmt.Fprintln(cw, "# TYPE chatty_api_request_duration_seconds histogram")
+	endpoints := make([]string, 0, len(m.latency))
+	for endpoint := range m.latency {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		h := m.latency[endpoint]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(cw, "chatty_api_request_duration_seconds_bucket{endpoint=%q,le=%q} %d\n",
+				endpoint, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(cw, "chatty_api_request_duration_seconds_bucket{endpoint=%q,le=\"+Inf\"} %d\n", endpoint, h.count)
+		fmt.Fprintf(cw, "chatty_api_request_duration_seconds_sum{endpoint=%q} %g\n", endpoint, h.sum)
+		fmt.Fprintf(cw, "chatty_api_request_duration_seconds_count{endpoint=%q} %d\n", endpoint, h.count)
+	}
+
+	fmt.Fprintln(cw, "# HELP chatty_tokens_total Tokens reported by the API.")
+	fmt.Fprintln(cw, "# TYPE chatty_tokens_total counter")
+	fmt.Fprintf(cw, "chatty_tokens_total{type=\"prompt\"} %d\n", m.promptTokens)
+	fmt.Fprintf(cw, "chatty_tokens_total{type=\"completion\"} %d\n", m.completionTokens)
+
+	fmt.Fprintln(cw, "# HELP chatty_cache_requests_total Cacheable requests by whether the response cache answered them.")
+	fmt.Fprintln(cw, "# TYPE chatty_cache_requests_total counter")
+	fmt.Fprintf(cw, "chatty_cache_requests_total{result=\"hit\"} %d\n", m.cacheHits)
+	fmt.Fprintf(cw, "chatty_cache_requests_total{result=\"miss\"} %d\n", m.cacheMisses)
+
+	fmt.Fprintln(cw, "# HELP chatty_rate_limit_rejections_total Requests refused by the client-side rate limiter.")
+	fmt.Fprintln(cw, "# TYPE chatty_rate_limit_rejections_total counter")
+	fmt.Fprintf(cw, "chatty_rate_limit_rejections_total %d\n", m.rateLimited)
+
+	return cw.n, cw.err
+}
+
+// countingWriter tracks the bytes written and the first error for WriteTo.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -7,9 +7,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ZaguanLabs/chatty/internal"
 	"github.com/ZaguanLabs/chatty/internal/storage"
 )
 
+// MockAPI can stand in for *internal.Client in the TUI and REPL session
+var _ internal.ChatProvider = (*MockAPI)(nil)
+
 // MockAPI simulates an OpenAI-compatible API for testing
 type MockAPI struct {
 	baseURL       string
@@ -19,6 +23,7 @@ type MockAPI struct {
 	mu            sync.Mutex
 	callCount     int
 	delay         time.Duration
+	lastModel     string
 }
 
 // NewMockAPI creates a new mock API client
@@ -161,6 +166,64 @@ func (m *MockAPI) ChatStream(ctx context.Context, history []storage.Message, mod
 	return nil
 }
 
+// ChatWithOptions implements internal.ChatProvider
+func (m *MockAPI) ChatWithOptions(ctx context.Context, messages []internal.Message, model string, temperature float64, opts internal.RequestOptions) (string, error) {
+	response, err := m.Chat(ctx, toStorageMessages(messages), model, temperature)
+	if err == nil {
+		m.setLastModel(model)
+	}
+	return response, err
+}
+
+// ChatStreamEvents implements internal.ChatProvider, delivering the response
+// word by word followed by a "stop" finish reason
+func (m *MockAPI) ChatStreamEvents(ctx context.Context, messages []internal.Message, model string, temperature float64, opts internal.RequestOptions, onEvent func(internal.StreamEvent) error) error {
+	if onEvent == nil {
+		return fmt.Errorf("bad request: missing callback")
+	}
+	
+	err := m.ChatStream(ctx, toStorageMessages(messages), model, temperature, func(chunk string) error {
+		return onEvent(internal.StreamEvent{Content: chunk})
+	})
+	if err != nil {
+		return err
+	}
+	
+	m.setLastModel(model)
+	return onEvent(internal.StreamEvent{FinishReason: "stop"})
+}
+
+// LastModel implements internal.ChatProvider
+func (m *MockAPI) LastModel() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastModel
+}
+
+// LastUsage implements internal.ChatProvider; the mock does not report usage
+func (m *MockAPI) LastUsage() *internal.Usage {
+	return nil
+}
+
+// LastLogprobs implements internal.ChatProvider; the mock does not report logprobs
+func (m *MockAPI) LastLogprobs() []internal.TokenLogprob {
+	return nil
+}
+
+func (m *MockAPI) setLastModel(model string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastModel = model
+}
+
+func toStorageMessages(messages []internal.Message) []storage.Message {
+	history := make([]storage.Message, len(messages))
+	for i, msg := range messages {
+		history[i] = storage.Message{Role: msg.Role, Content: msg.Content}
+	}
+	return history
+}
+
 // GetCallCount returns the number of API calls made
 func (m *MockAPI) GetCallCount() int {
 	m.mu.Lock()
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// IsOfflineError reports whether err means the API could not be reached at
+// all (DNS failure, refused or unreachable connection, connect timeout), as
+// opposed to an error response from a reachable provider.
+func IsOfflineError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
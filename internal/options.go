@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal/audit"
+	"github.com/ZaguanLabs/chatty/internal/config"
+)
+
+// RequestOptionsFromConfig builds the default request options for the configured model.
+func RequestOptionsFromConfig(cfg *config.Config) RequestOptions {
+	if cfg == nil {
+		return RequestOptions{}
+	}
+	return RequestOptionsForModel(cfg, cfg.Model.Name)
+}
+
+// RequestOptionsForModel builds request options for model from the config. The
+// capability override only applies when model is the configured model.
+func RequestOptionsForModel(cfg *config.Config, model string) RequestOptions {
+	if cfg == nil {
+		return RequestOptions{}
+	}
+
+	opts := RequestOptions{
+		Seed:            cfg.Model.Seed,
+		Logprobs:        cfg.Model.Logprobs,
+		TopLogprobs:     cfg.Model.TopLogprobs,
+		ReasoningEffort: strings.ToLower(strings.TrimSpace(cfg.Model.ReasoningEffort)),
+		Metadata:        cfg.API.Metadata,
+		User:            strings.TrimSpace(cfg.API.User),
+		Stop:            cfg.Model.Stop,
+	}
+
+	if override := cfg.Model.Capabilities; override != nil && model == cfg.Model.Name {
+		caps := CapabilitiesFor(model)
+		if override.Temperature != nil {
+			caps.Temperature = *override.Temperature
+		}
+		if override.ReasoningEffort != nil {
+			caps.ReasoningEffort = *override.ReasoningEffort
+		}
+		if override.MaxCompletionTokens != nil {
+			caps.MaxCompletionTokens = *override.MaxCompletionTokens
+		}
+		opts.Capabilities = &caps
+	}
+
+	return opts
+}
+
+// NewClientFromConfig creates a secure client for the configured API, including
+// any fallback models.
+func NewClientFromConfig(cfg *config.Config) (*Client, error) {
+	client, err := NewSecureClient(cfg.API.Key, cfg.API.URL)
+	if err != nil {
+		return nil, err
+	}
+	client.SetTimeouts(cfg.Timeouts.Request, cfg.Timeouts.Stream)
+	client.SetMaxStreamLine(cfg.API.MaxStreamLine)
+	client.SetStreamBuffering(cfg.API.StreamBuffer.Bytes, cfg.API.StreamBuffer.Interval)
+	client.SetCircuitBreaker(cfg.API.CircuitBreaker.Failures, cfg.API.CircuitBreaker.CoolDown)
+	client.SetOrganization(cfg.API.Organization, cfg.API.Project)
+
+	var debugLog io.Writer
+	if cfg.Logging.DebugFile != "" {
+		// The log stays open for the lifetime of the process.
+		file, err := OpenDebugLog(cfg.Logging.DebugFile)
+		if err != nil {
+			return nil, err
+		}
+		debugLog = file
+		client.EnableDebugLog(debugLog)
+	}
+
+	fallbacks := make([]Fallback, 0, len(cfg.Model.Fallbacks))
+	for _, fb := range cfg.Model.Fallbacks {
+		fallback := Fallback{Model: fb.Name}
+		if fb.URL != "" || fb.Key != "" {
+			url, key := fb.URL, fb.Key
+			if url == "" {
+				url = cfg.API.URL
+			}
+			if key == "" {
+				key = cfg.API.Key
+			}
+			if fallback.Client, err = NewSecureClient(key, url); err != nil {
+				return nil, fmt.Errorf("fallback %s: %w", fb.Name, err)
+			}
+			fallback.Client.SetTimeouts(cfg.Timeouts.Request, cfg.Timeouts.Stream)
+			fallback.Client.SetMaxStreamLine(cfg.API.MaxStreamLine)
+			fallback.Client.SetStreamBuffering(cfg.API.StreamBuffer.Bytes, cfg.API.StreamBuffer.Interval)
+			fallback.Client.SetCircuitBreaker(cfg.API.CircuitBreaker.Failures, cfg.API.CircuitBreaker.CoolDown)
+			if fb.URL == "" {
+				// Organization and project only apply to the primary provider
+				fallback.Client.SetOrganization(cfg.API.Organization, cfg.API.Project)
+			}
+			if debugLog != nil {
+				fallback.Client.EnableDebugLog(debugLog)
+			}
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	client.SetFallbacks(fallbacks)
+
+	if cfg.Logging.AuditFile != "" {
+		// The log stays open for the lifetime of the process.
+		log, err := audit.Open(cfg.Logging.AuditFile)
+		if err != nil {
+			return nil, err
+		}
+		client.SetAuditLog(log, cfg.API.User, cfg.Logging.AuditContent)
+	}
+
+	return client, nil
+}
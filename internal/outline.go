@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	outlineBatchSize    = 20  // Exchanges summarised per request
+	maxOutlineExcerpt   = 500 // Characters of each message sent for summarising
+	maxOutlineSummary   = 120 // Longest summary kept
+	outlineSystemPrompt = "You write a table of contents for a chat transcript. For each numbered exchange, " +
+		"reply with a line \"N. summary\" where the summary is at most 10 words. Reply with nothing else."
+)
+
+// Exchange is a user question and the answer it received.
+type Exchange struct {
+	Question string
+	Answer   string
+}
+
+// Key identifies the exchange's content so its summary can be cached.
+func (e Exchange) Key() string {
+	sum := sha256.Sum256([]byte(e.Question + "\x00" + e.Answer))
+	return fmt.Sprintf("%x", sum[:16])
+}
+
+// SummarizeExchanges returns a one-line summary for each exchange, asking
+// model in batches. Exchanges the model skips get their question as summary.
+func SummarizeExchanges(ctx context.Context, client ChatProvider, model string, exchanges []Exchange) ([]string, error) {
+	summaries := make([]string, len(exchanges))
+
+	for start := 0; start < len(exchanges); start += outlineBatchSize {
+		end := start + outlineBatchSize
+		if end > len(exchanges) {
+			end = len(exchanges)
+		}
+
+		var transcript strings.Builder
+		for i, e := range exchanges[start:end] {
+			fmt.Fprintf(&transcript, "%d. User: %s\nAssistant: %s\n\n", i+1, outlineExcerpt(e.Question), outlineExcerpt(e.Answer))
+		}
+
+		messages := []Message{
+			{Role: "system", Content: outlineSystemPrompt},
+			{Role: "user", Content: transcript.String()},
+		}
+		reply, err := client.ChatWithOptions(ctx, messages, model, 0.2, RequestOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("summarise exchanges: %w", err)
+		}
+
+		batch := parseOutline(reply, end-start)
+		for i, summary := range batch {
+			if summary == "" {
+				summary = outlineExcerpt(exchanges[start+i].Question)
+				if len(summary) > maxOutlineSummary {
+					summary = strings.ToValidUTF8(summary[:maxOutlineSummary], "") + "…"
+				}
+			}
+			summaries[start+i] = summary
+		}
+	}
+
+	return summaries, nil
+}
+
+// parseOutline reads "N. summary" lines into a slice of n summaries.
+func parseOutline(reply string, n int) []string {
+	summaries := make([]string, n)
+	for _, line := range strings.Split(reply, "\n") {
+		number, summary, ok := strings.Cut(strings.TrimSpace(line), ".")
+		if !ok {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSpace(number))
+		if err != nil || index < 1 || index > n {
+			continue
+		}
+		summary = strings.TrimSpace(summary)
+		if len(summary) > maxOutlineSummary {
+			summary = strings.ToValidUTF8(summary[:maxOutlineSummary], "") + "…"
+		}
+		summaries[index-1] = summary
+	}
+	return summaries
+}
+
+// outlineExcerpt flattens and shortens a message for the summary request.
+func outlineExcerpt(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if len(content) > maxOutlineExcerpt {
+		content = strings.ToValidUTF8(content[:maxOutlineExcerpt], "") + "…"
+	}
+	return content
+}
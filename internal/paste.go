@@ -0,0 +1,19 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal/ui"
+)
+
+// FormatPaste prepares pasted text for sending. Text that looks like code is
+// wrapped in a fenced block tagged with its guessed language, so the model
+// sees where the code starts and ends; anything else is returned unchanged.
+func FormatPaste(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	if strings.Contains(text, "```") || !ui.LooksLikeCode(text) {
+		return text
+	}
+	return fence(strings.Trim(text, "\n"), ui.DetectLanguage(text))
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+)
+
+// pingTimeout bounds a health check so a dead endpoint is reported quickly.
+const pingTimeout = 5 * time.Second
+
+// PingResult describes a reachable API endpoint.
+type PingResult struct {
+	Latency time.Duration
+	Models  []string // Model IDs listed by the endpoint
+}
+
+// HasModel reports whether the endpoint lists model.
+func (r *PingResult) HasModel(model string) bool {
+	for _, id := range r.Models {
+		if id == model {
+			return true
+		}
+	}
+	return false
+}
+
+// Ping checks that the API is reachable and accepts the key by listing its
+// models. It does not count against the request rate limits.
+func (c *Client) Ping(ctx context.Context) (*PingResult, error) {
+	if c == nil {
+		return nil, chattyErrors.NewSecureValidationError("Invalid client", "Client is nil", "client", nil)
+	}
+	if err := c.checkCircuit(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+	latency := time.Since(start)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, c.decodeError(bytes.NewReader(bodyBytes), resp.StatusCode)
+	}
+
+	var response struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	result := &PingResult{Latency: latency, Models: make([]string, 0, len(response.Data))}
+	for _, model := range response.Data {
+		result.Models = append(result.Models, model.ID)
+	}
+	return result, nil
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FormatRequestPreview renders the request that would be sent for messages,
+// including the parameters the model actually receives and an estimate of the
+// prompt size. Nothing is sent to the API.
+func FormatRequestPreview(messages []Message, model string, temperature float64, stream bool, opts RequestOptions) string {
+	body := buildRequestBody(messages, model, temperature, stream, opts)
+
+	var b strings.Builder
+	b.WriteString("Request preview (not sent)\n")
+	b.WriteString(strings.Repeat("=", 50) + "\n")
+
+	keys := make([]string, 0, len(body))
+	for key := range body {
+		if key != "messages" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%-22s %v\n", key+":", body[key])
+	}
+
+	fmt.Fprintf(&b, "\nMessages (%d):\n", len(messages))
+	for i, msg := range messages {
+		fmt.Fprintf(&b, "[%d] %s (~%d tokens):\n", i+1, msg.Role, EstimateTokens(msg.Content))
+		b.WriteString(strings.Repeat("-", 30) + "\n")
+		b.WriteString(msg.Content + "\n\n")
+	}
+
+	fmt.Fprintf(&b, "Estimated prompt tokens: ~%d\n", EstimateMessageTokens(messages))
+	return b.String()
+}
+
+// RequestPayload returns the exact, indented JSON body that would be posted to
+// /chat/completions for messages.
+func RequestPayload(messages []Message, model string, temperature float64, stream bool, opts RequestOptions) ([]byte, error) {
+	payload, err := json.MarshalIndent(buildRequestBody(messages, model, temperature, stream, opts), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	return payload, nil
+}
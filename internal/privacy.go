@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"regexp"
+
+	"github.com/ZaguanLabs/chatty/internal/config"
+)
+
+// PrivacyFilter recognises prompts that privacy.exclude_patterns keeps off
+// disk. A nil filter excludes nothing.
+type PrivacyFilter struct {
+	patterns []*regexp.Regexp
+}
+
+// NewPrivacyFilter compiles the configured patterns. They were validated
+// when the configuration was loaded, so patterns that do not compile are
+// skipped.
+func NewPrivacyFilter(cfg *config.Config) *PrivacyFilter {
+	if cfg == nil || len(cfg.Privacy.ExcludePatterns) == 0 {
+		return nil
+	}
+	filter := &PrivacyFilter{}
+	for _, pattern := range cfg.Privacy.ExcludePatterns {
+		if re, err := regexp.Compile("(?i)" + pattern); err == nil {
+			filter.patterns = append(filter.patterns, re)
+		}
+	}
+	return filter
+}
+
+// Excludes reports whether prompt must not be saved or kept in the input
+// history.
+func (f *PrivacyFilter) Excludes(prompt string) bool {
+	if f == nil {
+		return false
+	}
+	for _, re := range f.patterns {
+		if re.MatchString(prompt) {
+			return true
+		}
+	}
+	return false
+}
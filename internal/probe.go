@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+const (
+	// probeTimeout bounds all the requests of one probe together.
+	probeTimeout = 30 * time.Second
+	// featureCacheTTL is how long probed features are trusted before the
+	// endpoint is probed again.
+	featureCacheTTL = 30 * 24 * time.Hour
+
+	defaultFeatureCacheName = "providers.json"
+)
+
+// probeImage is a 1x1 PNG sent to find out whether the model accepts images.
+var probeImage, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg==")
+
+// ProviderFeatures are the optional features an endpoint was found to
+// support for a model.
+type ProviderFeatures struct {
+	URL      string    `json:"url"`
+	Model    string    `json:"model"`
+	ProbedAt time.Time `json:"probed_at"`
+
+	Models    bool `json:"models"`    // Lists its models at /models
+	Streaming bool `json:"streaming"` // Streams answers as server-sent events
+	Tools     bool `json:"tools"`     // Accepts tool definitions
+	JSONMode  bool `json:"json_mode"` // Accepts response_format json_object
+	Vision    bool `json:"vision"`    // Accepts images in messages
+}
+
+// String lists the features, such as "streaming yes, tools no, ...".
+func (f *ProviderFeatures) String() string {
+	yesNo := func(ok bool) string {
+		if ok {
+			return "yes"
+		}
+		return "no"
+	}
+	return fmt.Sprintf("model list %s, streaming %s, tools %s, JSON mode %s, vision %s",
+		yesNo(f.Models), yesNo(f.Streaming), yesNo(f.Tools), yesNo(f.JSONMode), yesNo(f.Vision))
+}
+
+// ProbeFeatures finds out which optional features the endpoint supports for
+// model: it lists the models, then sends one tiny completion for each
+// feature. A feature is unsupported when its request is rejected as invalid;
+// any other failure, such as a wrong key or an unreachable endpoint, fails
+// the probe, so nothing is concluded from it.
+func (c *Client) ProbeFeatures(ctx context.Context, model string) (*ProviderFeatures, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	features := &ProviderFeatures{URL: c.baseURL, Model: model, ProbedAt: time.Now().UTC()}
+
+	_, err := c.Ping(ctx)
+	var httpErr *HTTPError
+	switch {
+	case err == nil:
+		features.Models = true
+	case errors.As(err, &httpErr) && probeRejected(httpErr.StatusCode):
+	default:
+		return nil, err
+	}
+
+	question := []Message{{Role: "user", Content: "Reply with OK."}}
+	opts := RequestOptions{MaxTokens: 16}
+
+	probes := []struct {
+		supported *bool
+		body      map[string]interface{}
+	}{
+		{&features.Streaming, buildRequestBody(question, model, 0, true, opts)},
+		{&features.Tools, buildRequestBody(question, model, 0, false, RequestOptions{MaxTokens: opts.MaxTokens, Tools: []Tool{{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        "probe",
+				Description: "Not used; checks that tools are accepted",
+				Parameters:  json.RawMessage(`{"type":"object","properties":{}}`),
+			},
+		}}})},
+		{&features.JSONMode, withResponseFormat(buildRequestBody([]Message{{Role: "user", Content: `Reply with the JSON object {"ok": true}.`}}, model, 0, false, opts))},
+		{&features.Vision, buildRequestBody([]Message{{Role: "user", Content: "What colour is this pixel?", Attachments: []storage.Attachment{
+			{Name: "pixel.png", MIMEType: "image/png", Size: int64(len(probeImage)), Data: probeImage},
+		}}}, model, 0, false, opts)},
+	}
+	for _, probe := range probes {
+		if *probe.supported, err = c.probeRequest(ctx, probe.body); err != nil {
+			return nil, err
+		}
+	}
+	return features, nil
+}
+
+func withResponseFormat(body map[string]interface{}) map[string]interface{} {
+	body["response_format"] = map[string]string{"type": "json_object"}
+	return body
+}
+
+// probeRequest sends one probe completion and reports whether it was
+// accepted. Streamed answers must also arrive as server-sent events.
+func (c *Client) probeRequest(ctx context.Context, body map[string]interface{}) (bool, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return false, fmt.Errorf("encode request: %w", err)
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, "/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return false, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		if body["stream"] == true {
+			return strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("data:")), nil
+		}
+		return true, nil
+	case probeRejected(resp.StatusCode):
+		return false, nil
+	default:
+		return false, c.responseError(resp, data)
+	}
+}
+
+// probeRejected reports whether a status means the request itself was not
+// accepted, rather than that the endpoint or the key has a problem.
+func probeRejected(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// DefaultFeatureCachePath returns where probed provider features are kept.
+func DefaultFeatureCachePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".local/share/chatty", defaultFeatureCacheName), nil
+}
+
+// CachedFeatures returns the features probed for url and model, unless they
+// are missing or older than a month.
+func CachedFeatures(path, url, model string) (*ProviderFeatures, bool) {
+	cache, err := readFeatureCache(path)
+	if err != nil {
+		return nil, false
+	}
+	features, ok := cache[featureCacheKey(url, model)]
+	if !ok || time.Since(features.ProbedAt) > featureCacheTTL {
+		return nil, false
+	}
+	return features, true
+}
+
+// SaveFeatures adds features to the cache at path, replacing any earlier
+// result for the same endpoint and model.
+func SaveFeatures(path string, features *ProviderFeatures) error {
+	cache, err := readFeatureCache(path)
+	if err != nil {
+		cache = make(map[string]*ProviderFeatures)
+	}
+	cache[featureCacheKey(features.URL, features.Model)] = features
+
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create cache directory: %w", err)
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func readFeatureCache(path string) (map[string]*ProviderFeatures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cache map[string]*ProviderFeatures
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+func featureCacheKey(url, model string) string {
+	return strings.TrimSuffix(url, "/") + " " + model
+}
@@ -0,0 +1,65 @@
+package internal
+
+import "context"
+
+// ChatProvider is the chat API used by the TUI and the REPL session. *Client
+// implements it; tests can substitute mocks.MockAPI.
+type ChatProvider interface {
+	ChatWithOptions(ctx context.Context, messages []Message, model string, temperature float64, opts RequestOptions) (string, error)
+	ChatStreamEvents(ctx context.Context, messages []Message, model string, temperature float64, opts RequestOptions, onEvent func(StreamEvent) error) error
+
+	// LastModel, LastUsage and LastLogprobs describe the most recent successful request.
+	LastModel() string
+	LastUsage() *Usage
+	LastLogprobs() []TokenLogprob
+}
+
+// Pinger checks that the API endpoint is reachable and accepts the key;
+// providers that support the startup health check implement it.
+type Pinger interface {
+	Ping(ctx context.Context) (*PingResult, error)
+}
+
+// FeatureProber finds out which optional features an endpoint supports for
+// a model; providers that support feature probing implement it.
+type FeatureProber interface {
+	ProbeFeatures(ctx context.Context, model string) (*ProviderFeatures, error)
+}
+
+// Embedder creates embedding vectors; providers that support /recall implement it.
+type Embedder interface {
+	Embed(ctx context.Context, model string, inputs []string) ([][]float32, error)
+}
+
+// ModelComparer sends one conversation to several models; providers that
+// support /compare implement it.
+type ModelComparer interface {
+	ChatModels(ctx context.Context, messages []Message, models []string, temperature float64, optsFor func(string) RequestOptions) []ModelResult
+}
+
+// Transcriber converts recorded speech to text; providers that support
+// /transcribe implement it.
+type Transcriber interface {
+	Transcribe(ctx context.Context, model, path, language string) (string, error)
+}
+
+// Speaker converts text to audio; providers that support /speak implement it.
+type Speaker interface {
+	Speech(ctx context.Context, model, voice, text string) ([]byte, error)
+}
+
+// ImageGenerator creates images from text prompts; providers that support
+// /image implement it.
+type ImageGenerator interface {
+	GenerateImage(ctx context.Context, model, prompt, size string) ([]byte, error)
+}
+
+var (
+	_ ChatProvider   = (*Client)(nil)
+	_ FeatureProber  = (*Client)(nil)
+	_ Embedder       = (*Client)(nil)
+	_ ModelComparer  = (*Client)(nil)
+	_ Transcriber    = (*Client)(nil)
+	_ Speaker        = (*Client)(nil)
+	_ ImageGenerator = (*Client)(nil)
+)
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+const (
+	maxStreamResumes = 2 // Reconnects attempted for one streaming response
+
+	resumePrompt = "Your previous response was cut off. Continue it exactly where it stopped, without repeating any text."
+)
+
+// streamInterruptedError reports a streaming response whose connection failed
+// while the body was being read.
+type streamInterruptedError struct {
+	err error
+}
+
+func (e *streamInterruptedError) Error() string {
+	return "stream read error: " + e.err.Error()
+}
+
+func (e *streamInterruptedError) Unwrap() error {
+	return e.err
+}
+
+// chatStreamResumable streams a response and, when the connection drops after
+// some content has arrived, re-sends the request with the partial answer as
+// assistant context so the model continues it instead of starting over.
+func (c *Client) chatStreamResumable(ctx context.Context, messages []Message, model string, temperature float64, opts RequestOptions, onEvent func(StreamEvent) error) error {
+	var received strings.Builder
+	finished := false
+
+	track := func(event StreamEvent) error {
+		received.WriteString(event.Content)
+		if event.FinishReason != "" {
+			finished = true
+		}
+		return onEvent(event)
+	}
+
+	request := messages
+	var interrupted error
+	for attempt := 0; ; attempt++ {
+		err := c.chatStream(ctx, request, model, temperature, opts, track)
+		if err != nil && interrupted != nil && !shouldResume(ctx, err) {
+			// Report the original interruption: content has already been
+			// delivered, so a fallback model must not start the answer again.
+			return interrupted
+		}
+		if err == nil || !shouldResume(ctx, err) || finished || received.Len() == 0 || attempt == maxStreamResumes {
+			return err
+		}
+		interrupted = err
+
+		c.debugf("stream interrupted after %d bytes, resuming (attempt %d): %v\n", received.Len(), attempt+1, err)
+
+		request = make([]Message, 0, len(messages)+2)
+		request = append(request, messages...)
+		request = append(request,
+			Message{Role: "assistant", Content: received.String()},
+			Message{Role: "user", Content: resumePrompt},
+		)
+	}
+}
+
+// shouldResume reports whether err is a dropped connection rather than a
+// cancellation, a timeout or an error raised by the caller.
+func shouldResume(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var interrupted *streamInterruptedError
+	return errors.As(err, &interrupted)
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxRateLimitRetries = 3                // Retries of one request after 429 responses
+	maxRetryAfter       = 60 * time.Second // Longer waits fail instead, so fallbacks can take over
+)
+
+// parseRetryAfter reads how long the server asked us to wait from the
+// Retry-After header (seconds or an HTTP date) or the retry-after-ms header
+// some providers send. It returns zero when neither is present or valid.
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if ms := strings.TrimSpace(header.Get("Retry-After-Ms")); ms != "" {
+		if n, err := strconv.ParseFloat(ms, 64); err == nil && n > 0 {
+			return time.Duration(n * float64(time.Millisecond))
+		}
+	}
+
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// responseError decodes a non-2xx response and records the Retry-After delay
+// on rate limit errors.
+func (c *Client) responseError(resp *http.Response, body []byte) error {
+	err := c.decodeError(bytes.NewReader(body), resp.StatusCode)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			httpErr.RetryAfter = parseRetryAfter(resp.Header, time.Now())
+		}
+	}
+	return err
+}
+
+// retryRateLimited runs call and, while it fails with a 429 carrying a
+// Retry-After delay of at most maxRetryAfter, waits that long and tries again.
+// onEvent, when set, is told about each wait so streaming callers can show it.
+func (c *Client) retryRateLimited(ctx context.Context, onEvent func(StreamEvent) error, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+
+		var httpErr *HTTPError
+		if err == nil || attempt == maxRateLimitRetries || !errors.As(err, &httpErr) ||
+			httpErr.StatusCode != http.StatusTooManyRequests || httpErr.RetryAfter <= 0 || httpErr.RetryAfter > maxRetryAfter {
+			return err
+		}
+
+		wait := httpErr.RetryAfter
+		c.debugf("rate limited, retrying in %v (attempt %d)\n", wait, attempt+1)
+		if onEvent != nil {
+			if err := onEvent(StreamEvent{RetryAfter: wait}); err != nil {
+				return err
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
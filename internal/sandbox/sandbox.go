@@ -0,0 +1,180 @@
+// Package sandbox runs code snippets written by the model in throwaway
+// containers: no network, a read-only root, limited memory and processes, and
+// a deadline.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal/config"
+)
+
+// maxOutput caps the output returned from a run; the rest is cut off.
+const maxOutput = 16 * 1024
+
+// language describes how a snippet is written to the container and run.
+type language struct {
+	file    string
+	command string
+}
+
+// languages are the languages snippets can be written in.
+var languages = map[string]language{
+	"python": {file: "main.py", command: "python3 main.py"},
+	"go":     {file: "main.go", command: "go run main.go"},
+}
+
+// Supported reports whether snippets in lang can be run.
+func Supported(lang string) bool {
+	_, ok := languages[lang]
+	return ok
+}
+
+// Result is the outcome of running a snippet.
+type Result struct {
+	Output   string // Combined stdout and stderr, truncated to 16 KiB
+	ExitCode int
+	TimedOut bool
+	Duration time.Duration
+}
+
+// Runner runs snippets with a container runtime such as docker or podman.
+type Runner struct {
+	runtime string
+	memory  string
+	timeout time.Duration
+	images  map[string]string
+}
+
+// New creates a runner for cfg.
+func New(cfg config.SandboxConfig) *Runner {
+	return &Runner{
+		runtime: cfg.Runtime,
+		memory:  cfg.Memory,
+		timeout: cfg.Timeout,
+		images:  cfg.Images,
+	}
+}
+
+// Languages returns the languages the runner has an image for, sorted.
+func (r *Runner) Languages() []string {
+	var names []string
+	for name := range r.images {
+		if Supported(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run executes code written in lang and returns its output. A snippet that
+// fails or times out is a result, not an error; errors mean the snippet could
+// not be run at all.
+func (r *Runner) Run(ctx context.Context, lang, code string) (*Result, error) {
+	spec, ok := languages[lang]
+	image := r.images[lang]
+	if !ok || image == "" {
+		return nil, fmt.Errorf("unsupported language %q (available: %s)", lang, strings.Join(r.Languages(), ", "))
+	}
+	if _, err := exec.LookPath(r.runtime); err != nil {
+		return nil, fmt.Errorf("sandbox runtime %s not found: %w", r.runtime, err)
+	}
+
+	name, err := containerName()
+	if err != nil {
+		return nil, err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// The snippet arrives on stdin and is written to the scratch directory,
+	// the only writable place in the container.
+	script := fmt.Sprintf("cat > %s && %s", spec.file, spec.command)
+	cmd := exec.CommandContext(runCtx, r.runtime, "run", "--rm", "-i",
+		"--name", name,
+		"--network", "none",
+		"--read-only",
+		"--tmpfs", "/work:rw,exec,size=64m",
+		"--workdir", "/work",
+		"--env", "HOME=/work",
+		"--env", "GOCACHE=/work/.cache",
+		"--memory", r.memory,
+		"--cpus", "1",
+		"--pids-limit", "64",
+		"--user", "65534:65534",
+		"--security-opt", "no-new-privileges",
+		image, "sh", "-c", script)
+	cmd.Stdin = strings.NewReader(code)
+	output := &limitedBuffer{limit: maxOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	start := time.Now()
+	err = cmd.Run()
+	result := &Result{Output: output.String(), Duration: time.Since(start)}
+
+	if runCtx.Err() != nil {
+		// Killing the client does not stop the container
+		exec.Command(r.runtime, "kill", name).Run()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		result.TimedOut = true
+		result.ExitCode = -1
+		return result, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("run sandbox: %w", err)
+	}
+	return result, nil
+}
+
+func containerName() (string, error) {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("name sandbox container: %w", err)
+	}
+	return "chatty-sandbox-" + hex.EncodeToString(suffix), nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and notes that the
+// rest was dropped.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
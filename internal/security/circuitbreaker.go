@@ -0,0 +1,151 @@
+package security
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects requests until the cool-down has passed.
+	CircuitOpen
+	// CircuitHalfOpen lets a single trial request through after the cool-down.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreakerConfig holds configuration for a circuit breaker
+type CircuitBreakerConfig struct {
+	FailureThreshold int           // Consecutive failures that open the circuit, 0 = disabled
+	CoolDown         time.Duration // How long the circuit stays open before a trial request
+}
+
+// DefaultCircuitBreakerConfig returns default circuit breaker configuration
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		FailureThreshold: 5,
+		CoolDown:         30 * time.Second,
+	}
+}
+
+// CircuitBreaker stops calls to an endpoint that keeps failing. After
+// FailureThreshold consecutive failures it opens and rejects calls for the
+// cool-down period, then lets one trial call through: success closes the
+// circuit again, failure reopens it for another cool-down.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	coolDown  time.Duration
+	failures  int
+	state     CircuitState
+	openedAt  time.Time
+	trialAt   time.Time // When the half-open trial request was let through
+}
+
+// NewCircuitBreaker creates a new circuit breaker
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: config.FailureThreshold,
+		coolDown:  config.CoolDown,
+	}
+}
+
+// Allow reports whether a request may be sent now
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.coolDown {
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		cb.trialAt = time.Now()
+		return true
+	case CircuitHalfOpen:
+		// A trial whose outcome was never recorded blocks for one cool-down at most
+		if time.Since(cb.trialAt) < cb.coolDown {
+			return false
+		}
+		cb.trialAt = time.Now()
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess closes the circuit and resets the failure count
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	cb.state = CircuitClosed
+}
+
+// RecordFailure counts a failed request, opening the circuit once the
+// threshold is reached or when a half-open trial fails
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	if cb.threshold <= 0 {
+		return
+	}
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.threshold {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+// State returns the current state of the circuit
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.state
+}
+
+// Failures returns the number of consecutive failures recorded
+func (cb *CircuitBreaker) Failures() int {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.failures
+}
+
+// RemainingCoolDown returns the time until an open circuit allows a trial request
+func (cb *CircuitBreaker) RemainingCoolDown() time.Duration {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != CircuitOpen {
+		return 0
+	}
+	remaining := cb.coolDown - time.Since(cb.openedAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Reset closes the circuit and clears the failure count
+func (cb *CircuitBreaker) Reset() {
+	cb.RecordSuccess()
+}
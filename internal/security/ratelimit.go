@@ -12,6 +12,7 @@ type RateLimiter struct {
 	maxRequests int
 	windowSize time.Duration
 	cleanupInterval time.Duration
+	cleanupOnce sync.Once
 }
 
 // RateLimitConfig holds configuration for rate limiting
@@ -39,14 +40,15 @@ func NewRateLimiter(config RateLimitConfig) *RateLimiter {
 		cleanupInterval: config.CleanupInterval,
 	}
 	
-	// Start cleanup goroutine
-	go rl.cleanupRoutine()
-	
+	// The cleanup goroutine starts with the first request, so a limiter
+	// that is never used costs nothing
 	return rl
 }
 
 // Allow checks if a request is allowed for the given key
 func (rl *RateLimiter) Allow(key string) bool {
+	rl.cleanupOnce.Do(func() { go rl.cleanupRoutine() })
+
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 	
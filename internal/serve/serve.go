@@ -0,0 +1,298 @@
+// Package serve exposes the chat API over HTTP so web frontends and editor
+// plugins can stream answers through chatty's configuration, fallbacks and
+// audit log, using Server-Sent Events or a WebSocket.
+package serve
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ZaguanLabs/chatty/internal"
+	"github.com/ZaguanLabs/chatty/internal/config"
+	"golang.org/x/net/websocket"
+)
+
+// maxRequestBytes bounds a chat request body or WebSocket message.
+const maxRequestBytes = 4 << 20
+
+// Options controls who may use the server.
+type Options struct {
+	Token        string   // Required as a bearer token (or ?token= for WebSockets) when set
+	AllowOrigins []string // Browser origins allowed to call the server, "*" for any
+}
+
+// Request is a chat request sent by a client.
+type Request struct {
+	// Type is "cancel" to stop the answer being streamed on a WebSocket;
+	// otherwise it is empty.
+	Type        string             `json:"type,omitempty"`
+	Messages    []internal.Message `json:"messages"`
+	Model       string             `json:"model,omitempty"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	MaxTokens   int                `json:"max_tokens,omitempty"`
+}
+
+// Event is one piece of a streamed answer. Over SSE, Type is the event name
+// and the whole event is the data.
+type Event struct {
+	Type         string          `json:"type"` // delta, done or error
+	Content      string          `json:"content,omitempty"`
+	FinishReason string          `json:"finish_reason,omitempty"`
+	Usage        *internal.Usage `json:"usage,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// Server streams chat completions at /v1/chat/stream (SSE) and /v1/chat/ws
+// (WebSocket).
+type Server struct {
+	provider internal.ChatProvider
+	cfg      *config.Config
+	opts     Options
+	mux      *http.ServeMux
+}
+
+// New creates a server that answers with provider, using the model and
+// request options from cfg unless a request names another model.
+func New(provider internal.ChatProvider, cfg *config.Config, opts Options) (*Server, error) {
+	if provider == nil {
+		return nil, errors.New("provider cannot be nil")
+	}
+	if cfg == nil {
+		return nil, errors.New("config cannot be nil")
+	}
+
+	s := &Server{provider: provider, cfg: cfg, opts: opts, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/v1/chat/stream", s.handleSSE)
+	s.mux.Handle("/v1/chat/ws", websocket.Server{Handler: s.handleWebSocket, Handshake: s.checkOrigin})
+	return s, nil
+}
+
+// ServeHTTP authenticates the request and routes it.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if origin := r.Header.Get("Origin"); origin != "" && s.originAllowed(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Add("Vary", "Origin")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chatty"`)
+		writeError(w, http.StatusUnauthorized, "missing or wrong token")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.opts.Token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		// Browsers cannot set headers on a WebSocket handshake
+		token = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) == 1
+}
+
+func (s *Server) originAllowed(origin string) bool {
+	return slices.Contains(s.opts.AllowOrigins, "*") || slices.Contains(s.opts.AllowOrigins, origin)
+}
+
+// checkOrigin accepts WebSocket handshakes from clients that send no origin,
+// such as editor plugins, from the server's own origin and from the allowed
+// origins, so other web pages cannot use the server through a visitor's
+// browser.
+func (s *Server) checkOrigin(_ *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" || s.originAllowed(origin) {
+		return nil
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return nil
+	}
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
+
+// handleSSE streams the answer to a POSTed request as Server-Sent Events.
+func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	if err := validate(req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// The request context ends when the client disconnects, which stops the
+	// upstream request as well
+	s.Stream(r.Context(), req, func(event Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
+
+// handleWebSocket answers requests sent over a WebSocket in turn. A request
+// of type "cancel" stops the answer being streamed.
+func (s *Server) handleWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = maxRequestBytes
+
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	var mu sync.Mutex
+	stopCurrent := func() {}
+	requests := make(chan Request)
+	go func() {
+		// A closed connection ends the stream being sent as well
+		defer cancel()
+		defer close(requests)
+		for {
+			var req Request
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				return
+			}
+			if req.Type == "cancel" {
+				mu.Lock()
+				stopCurrent()
+				mu.Unlock()
+				continue
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	send := func(event Event) error {
+		return websocket.JSON.Send(ws, event)
+	}
+	for req := range requests {
+		streamCtx, stop := context.WithCancel(ctx)
+		mu.Lock()
+		stopCurrent = stop
+		mu.Unlock()
+		s.Stream(streamCtx, req, send)
+		mu.Lock()
+		stopCurrent = func() {}
+		mu.Unlock()
+		stop()
+	}
+}
+
+// Stream sends req to the provider and passes every content delta to emit,
+// followed by a done or an error event. It returns the error reported in the
+// error event.
+func (s *Server) Stream(ctx context.Context, req Request, emit func(Event) error) error {
+	if err := validate(req); err != nil {
+		emit(Event{Type: "error", Error: err.Error()})
+		return err
+	}
+
+	model := req.Model
+	if model == "" {
+		model = s.cfg.Model.Name
+	}
+	temperature := s.cfg.Model.Temperature
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+	opts := internal.RequestOptionsForModel(s.cfg, model)
+	opts.IncludeUsage = true
+	if req.MaxTokens > 0 {
+		opts.MaxTokens = req.MaxTokens
+	}
+
+	done := Event{Type: "done"}
+	err := s.provider.ChatStreamEvents(ctx, req.Messages, model, temperature, opts, func(event internal.StreamEvent) error {
+		if event.FinishReason != "" {
+			done.FinishReason = event.FinishReason
+		}
+		if event.Usage != nil {
+			done.Usage = event.Usage
+		}
+		if event.Content == "" {
+			return nil
+		}
+		return emit(Event{Type: "delta", Content: event.Content})
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			emit(Event{Type: "error", Error: err.Error()})
+		}
+		return err
+	}
+	return emit(done)
+}
+
+func validate(req Request) error {
+	if req.Type != "" {
+		return fmt.Errorf("unknown request type %q", req.Type)
+	}
+	if len(req.Messages) == 0 {
+		return errors.New("messages cannot be empty")
+	}
+	for i, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "user", "assistant":
+		default:
+			return fmt.Errorf("message %d: unsupported role %q", i+1, msg.Role)
+		}
+	}
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > 2) {
+		return errors.New("temperature must be between 0 and 2")
+	}
+	if req.MaxTokens < 0 {
+		return errors.New("max_tokens cannot be negative")
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Event{Type: "error", Error: message})
+}
@@ -0,0 +1,210 @@
+// Package share publishes a read-only transcript of a saved conversation over
+// HTTP, at an unguessable URL that can expire and require a password.
+package share
+
+import (
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal/security"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+	"github.com/ZaguanLabs/chatty/internal/ui"
+)
+
+// tokenLength is the number of hex characters in a share URL token (128 bits).
+const tokenLength = 32
+
+// Options controls who can see a shared transcript and for how long.
+type Options struct {
+	Expires  time.Duration // How long the link works, 0 = until the server stops
+	Password string        // Required through HTTP basic auth when set
+}
+
+// Share serves one transcript at /s/<token>.
+type Share struct {
+	transcript *storage.Transcript
+	token      string
+	password   string
+	expiresAt  time.Time
+
+	expiredOnce sync.Once
+	expired     chan struct{}
+}
+
+// New prepares a share for transcript with a fresh random token.
+func New(transcript *storage.Transcript, opts Options) (*Share, error) {
+	if transcript == nil {
+		return nil, errors.New("transcript cannot be nil")
+	}
+	if opts.Expires < 0 {
+		return nil, errors.New("expiry cannot be negative")
+	}
+
+	token, err := security.NewRandomGenerator().GenerateSecureToken(tokenLength)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Share{
+		transcript: transcript,
+		token:      token,
+		password:   opts.Password,
+		expired:    make(chan struct{}),
+	}
+	if opts.Expires > 0 {
+		s.expiresAt = time.Now().Add(opts.Expires)
+		time.AfterFunc(opts.Expires, s.expire)
+	}
+	return s, nil
+}
+
+// Path returns the URL path of the transcript.
+func (s *Share) Path() string {
+	return "/s/" + s.token
+}
+
+// ExpiresAt returns when the link stops working, or the zero time if never.
+func (s *Share) ExpiresAt() time.Time {
+	return s.expiresAt
+}
+
+// Expired is closed once the link has expired, so the server can shut down.
+func (s *Share) Expired() <-chan struct{} {
+	return s.expired
+}
+
+func (s *Share) expire() {
+	s.expiredOnce.Do(func() { close(s.expired) })
+}
+
+// ServeHTTP renders the transcript. Every other path is a 404 so the token
+// cannot be probed.
+func (s *Share) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.URL.Path), []byte(s.Path())) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.expiresAt.IsZero() && time.Now().After(s.expiresAt) {
+		s.expire()
+		http.Error(w, "this link has expired", http.StatusGone)
+		return
+	}
+	if s.password != "" {
+		_, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chatty transcript", charset="UTF-8"`)
+			http.Error(w, "password required", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := transcriptTemplate.Execute(w, s.view()); err != nil {
+		http.Error(w, "render transcript", http.StatusInternalServerError)
+	}
+}
+
+type transcriptView struct {
+	Title     string
+	Created   string
+	ExpiresAt string
+	Messages  []messageView
+}
+
+type messageView struct {
+	Role    string
+	Label   string
+	Time    string
+	Content string
+}
+
+func (s *Share) view() transcriptView {
+	title := strings.TrimSpace(s.transcript.Summary.Name)
+	if title == "" {
+		title = "Untitled session"
+	}
+
+	view := transcriptView{
+		Title:    title,
+		Created:  ui.FormatDateTime(s.transcript.Summary.CreatedAt),
+		Messages: make([]messageView, 0, len(s.transcript.Messages)),
+	}
+	if !s.expiresAt.IsZero() {
+		view.ExpiresAt = ui.FormatDateTime(s.expiresAt)
+	}
+	for _, msg := range s.transcript.Messages {
+		label := "Assistant"
+		if msg.Role == "user" {
+			label = "User"
+		}
+		view.Messages = append(view.Messages, messageView{
+			Role:    msg.Role,
+			Label:   label,
+			Time:    ui.FormatTimestamp(msg.CreatedAt),
+			Content: msg.Content,
+		})
+	}
+	return view
+}
+
+// LANAddress returns the first non-loopback IPv4 address of this machine, or
+// "localhost" when there is none.
+func LANAddress() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "localhost"
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP.String()
+		}
+	}
+	return "localhost"
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 50rem; margin: 2rem auto; padding: 0 1rem; color: #222; background: #fafafa; }
+header { border-bottom: 1px solid #ddd; margin-bottom: 1.5rem; }
+header p { color: #777; font-size: 0.9rem; }
+.message { margin-bottom: 1.25rem; padding: 0.75rem 1rem; border-radius: 6px; background: #fff; border-left: 4px solid #87afff; }
+.message.user { border-left-color: #87d7af; }
+.label { font-weight: bold; }
+.time { color: #999; font-size: 0.8rem; margin-left: 0.5rem; }
+.content { white-space: pre-wrap; word-wrap: break-word; margin-top: 0.5rem; font-family: ui-monospace, monospace; font-size: 0.9rem; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p>Started {{.Created}} · {{len .Messages}} messages · read-only{{if .ExpiresAt}} · link expires {{.ExpiresAt}}{{end}}</p>
+</header>
+{{range .Messages}}<div class="message {{.Role}}">
+<span class="label">{{.Label}}</span><span class="time">{{.Time}}</span>
+<div class="content">{{.Content}}</div>
+</div>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"errors"
+	"io"
+)
+
+// Sink receives the text of a streamed response chunk by chunk. Sinks
+// compose: Tee fans a stream out to several of them, and Events adapts one to
+// the callback taken by ChatStreamEvents.
+type Sink func(chunk string) error
+
+// WriterSink writes every chunk to w.
+func WriterSink(w io.Writer) Sink {
+	return func(chunk string) error {
+		_, err := io.WriteString(w, chunk)
+		return err
+	}
+}
+
+// Tee sends every chunk to each sink in order. All sinks see the chunk even
+// if one fails; the errors are joined.
+func Tee(sinks ...Sink) Sink {
+	return func(chunk string) error {
+		var errs []error
+		for _, sink := range sinks {
+			if err := sink(chunk); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// Events adapts the sink to a stream event callback. Events without text,
+// such as usage or finish reasons, are skipped.
+func (s Sink) Events() func(StreamEvent) error {
+	return func(event StreamEvent) error {
+		if event.Content == "" {
+			return nil
+		}
+		return s(event.Content)
+	}
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+// statsBarWidth is the length of the longest bar of FormatStats.
+const statsBarWidth = 30
+
+// FormatStats renders usage statistics as plain text: the totals, then a
+// table of the models and one of the months, each with a bar chart.
+func FormatStats(stats *storage.Stats) string {
+	if stats == nil || stats.Messages == 0 {
+		return "No saved messages yet."
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Sessions  %d", stats.Sessions)
+	if stats.ArchivedSessions > 0 {
+		fmt.Fprintf(&b, " (%d archived)", stats.ArchivedSessions)
+	}
+	fmt.Fprintf(&b, "\nMessages  %d (%d questions, %d answers)\n", stats.Messages, stats.Questions, stats.Answers)
+	fmt.Fprintf(&b, "Tokens    %s (%s prompt, %s completion)\n",
+		FormatCount(stats.PromptTokens+stats.CompletionTokens), FormatCount(stats.PromptTokens), FormatCount(stats.CompletionTokens))
+
+	if len(stats.Models) > 0 {
+		var most int64
+		for _, usage := range stats.Models {
+			most = max(most, usage.Answers)
+		}
+		fmt.Fprintf(&b, "\n%-28s %8s %8s %11s\n", "model", "answers", "prompt", "completion")
+		for _, usage := range stats.Models {
+			fmt.Fprintf(&b, "%-28s %8d %8s %11s  %s\n", usage.Model, usage.Answers,
+				FormatCount(usage.PromptTokens), FormatCount(usage.CompletionTokens), statsBar(usage.Answers, most))
+		}
+	}
+
+	if len(stats.Months) > 0 {
+		var most int64
+		for _, usage := range stats.Months {
+			most = max(most, usage.Messages)
+		}
+		fmt.Fprintf(&b, "\n%-8s %8s %8s\n", "month", "messages", "tokens")
+		for _, usage := range stats.Months {
+			fmt.Fprintf(&b, "%-8s %8d %8s  %s\n", usage.Period, usage.Messages, FormatCount(usage.Tokens), statsBar(usage.Messages, most))
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// statsBar draws value as a bar relative to most, which gets the full width.
+// Any non-zero value gets at least one block.
+func statsBar(value, most int64) string {
+	if value <= 0 || most <= 0 {
+		return ""
+	}
+	return strings.Repeat("█", max(int(value*statsBarWidth/most), 1))
+}
+
+// FormatCount shortens large counts: 950, 12.3k, 4.5M.
+func FormatCount(n int64) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 10_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
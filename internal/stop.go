@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxStopSequences is the most stop sequences the API accepts per request.
+const MaxStopSequences = 4
+
+// stopEscapes lets stop sequences typed on one line contain control characters.
+var stopEscapes = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\,`, ",", `\\`, `\`)
+
+// ParseStopSequences parses a comma-separated list of stop sequences where
+// \n, \t, \, and \\ stand for a newline, tab, comma and backslash.
+func ParseStopSequences(list string) ([]string, error) {
+	var sequences []string
+	var current strings.Builder
+	escaped := false
+	for _, r := range list {
+		switch {
+		case escaped:
+			current.WriteRune('\\')
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',':
+			sequences = append(sequences, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	sequences = append(sequences, current.String())
+
+	result := make([]string, 0, len(sequences))
+	for _, seq := range sequences {
+		seq = stopEscapes.Replace(strings.TrimSpace(seq))
+		if seq == "" {
+			continue
+		}
+		result = append(result, seq)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no stop sequences given")
+	}
+	if len(result) > MaxStopSequences {
+		return nil, fmt.Errorf("at most %d stop sequences are supported, got %d", MaxStopSequences, len(result))
+	}
+	return result, nil
+}
+
+// FormatStopSequences renders stop sequences with control characters escaped.
+func FormatStopSequences(sequences []string) string {
+	if len(sequences) == 0 {
+		return "none"
+	}
+	quoted := make([]string, len(sequences))
+	for i, seq := range sequences {
+		quoted[i] = fmt.Sprintf("%q", seq)
+	}
+	return strings.Join(quoted, ", ")
+}
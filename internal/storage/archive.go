@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// ArchiveVersion is the format version written by ExportSession.
+	ArchiveVersion = 1
+
+	// ArchiveExtension is the conventional file extension for session archives.
+	ArchiveExtension = ".chatty"
+
+	archiveTimestampLayout = "2006-01-02T15:04:05Z"
+	maxArchiveSize         = 256 << 20 // Decompressed bytes read from an archive
+)
+
+// Archive is the self-contained, gzip-compressed JSON document used to move a
+// single conversation between databases.
+type Archive struct {
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Session    ArchiveSession `json:"session"`
+}
+
+// ArchiveSession holds a conversation and its pinned positions.
+type ArchiveSession struct {
+	Name      string           `json:"name"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Messages  []ArchiveMessage `json:"messages"`
+	Pinned    []int            `json:"pinned,omitempty"`
+	// SystemPrompt is omitted when the session has none
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	Summary      string `json:"summary,omitempty"`
+}
+
+// ArchiveMessage is a message as stored in an archive.
+type ArchiveMessage struct {
+	Role        string    `json:"role"`
+	Content     string    `json:"content"`
+	CreatedAt   time.Time `json:"created_at"`
+	Interrupted bool      `json:"interrupted,omitempty"`
+	// Meta is omitted when nothing is known about the request
+	Meta *MessageMeta `json:"meta,omitempty"`
+	// ToolCalls is omitted when no tools were called
+	ToolCalls []ToolCallRecord `json:"tool_calls,omitempty"`
+	// Repeats is omitted when the message was not repeated
+	Repeats int `json:"repeats,omitempty"`
+}
+
+// ExportSession writes the complete session, including pinned messages, to w
+// as a gzip-compressed archive.
+func (s *Store) ExportSession(ctx context.Context, id int64, w io.Writer) error {
+	archive, err := s.loadArchive(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	gz.Name = fmt.Sprintf("session-%d.json", id)
+	encoder := json.NewEncoder(gz)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(archive); err != nil {
+		gz.Close()
+		return fmt.Errorf("encode archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("compress archive: %w", err)
+	}
+
+	return nil
+}
+
+// loadArchive collects the complete session, including pinned messages.
+func (s *Store) loadArchive(ctx context.Context, id int64) (*Archive, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+
+	transcript, err := s.LoadSessionWithPagination(ctx, id, &PaginationOptions{Page: 1, PageSize: 1})
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.loadAllMessages(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := s.ListPinnedMessages(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &Archive{
+		Version:    ArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		Session: ArchiveSession{
+			Name:      transcript.Summary.Name,
+			CreatedAt: transcript.Summary.CreatedAt,
+			UpdatedAt: transcript.Summary.UpdatedAt,
+			Messages:  make([]ArchiveMessage, len(messages)),
+			Pinned:    pinned,
+
+			SystemPrompt: transcript.Summary.SystemPrompt,
+			Summary:      transcript.Summary.Summary,
+		},
+	}
+	for i, msg := range messages {
+		archive.Session.Messages[i] = ArchiveMessage{Role: msg.Role, Content: msg.Content, CreatedAt: msg.CreatedAt, Interrupted: msg.Interrupted, ToolCalls: msg.ToolCalls, Repeats: msg.Repeats}
+		if !msg.Meta.IsZero() {
+			meta := msg.Meta
+			archive.Session.Messages[i].Meta = &meta
+		}
+	}
+	return archive, nil
+}
+
+// ImportSession reads an archive written by ExportSession and stores it as a
+// new session, keeping the original timestamps. It returns the new session id.
+func (s *Store) ImportSession(ctx context.Context, r io.Reader) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("storage not initialised")
+	}
+
+	archive, err := ReadArchive(r)
+	if err != nil {
+		return 0, err
+	}
+	session := archive.Session
+
+	name := strings.TrimSpace(session.Name)
+	if name == "" {
+		name = fmt.Sprintf("Imported %s", time.Now().Format("2006-01-02 15:04"))
+	}
+	if err := validateSessionName(name); err != nil {
+		return 0, fmt.Errorf("invalid session name in archive: %w", err)
+	}
+	name = sanitizeString(name, maxSessionNameLength)
+
+	for i, msg := range session.Messages {
+		if err := validateMessageRole(msg.Role); err != nil {
+			return 0, fmt.Errorf("invalid role in archived message %d: %w", i+1, err)
+		}
+		if err := validateMessageContent(msg.Content); err != nil {
+			return 0, fmt.Errorf("invalid content in archived message %d: %w", i+1, err)
+		}
+	}
+	if session.SystemPrompt != "" {
+		if err := validateMessageContent(session.SystemPrompt); err != nil {
+			return 0, fmt.Errorf("invalid system prompt in archive: %w", err)
+		}
+	}
+	if session.Summary != "" {
+		if err := validateMessageContent(session.Summary); err != nil {
+			return 0, fmt.Errorf("invalid summary in archive: %w", err)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	id, err := insertArchiveSession(ctx, tx, name, session)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit import: %w", err)
+	}
+
+	return id, nil
+}
+
+// insertArchiveSession stores a validated conversation as a new session in tx,
+// keeping its timestamps and pins, and returns the new session id.
+func insertArchiveSession(ctx context.Context, tx *sql.Tx, name string, session ArchiveSession) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `INSERT INTO sessions(name, created_at, updated_at, system_prompt, summary) VALUES (?, ?, ?, ?, ?) RETURNING id`,
+		name, archiveTimestamp(session.CreatedAt), archiveTimestamp(session.UpdatedAt), session.SystemPrompt, session.Summary).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("insert session: %w", err)
+	}
+
+	for _, msg := range session.Messages {
+		var meta MessageMeta
+		if msg.Meta != nil {
+			meta = *msg.Meta
+		}
+		var messageID int64
+		if err := tx.QueryRowContext(ctx, `INSERT INTO messages(session_id, role, content, created_at, interrupted, model, temperature, prompt_tokens, completion_tokens, repeats) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+			id, msg.Role, msg.Content, archiveTimestamp(msg.CreatedAt), msg.Interrupted,
+			meta.Model, meta.Temperature, meta.PromptTokens, meta.CompletionTokens, max(msg.Repeats, 0)).Scan(&messageID); err != nil {
+			return 0, fmt.Errorf("insert message: %w", err)
+		}
+		if err := insertToolCalls(ctx, tx, nil, id, messageID, msg.ToolCalls); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, position := range session.Pinned {
+		if position < 0 || position >= len(session.Messages) {
+			continue // Ignore pins that point outside the archived conversation
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO pinned_messages(session_id, position) VALUES (?, ?) ON CONFLICT DO NOTHING`, id, position); err != nil {
+			return 0, fmt.Errorf("insert pinned message: %w", err)
+		}
+	}
+
+	return id, nil
+}
+
+// ReadArchive decodes a gzip-compressed session archive.
+func ReadArchive(r io.Reader) (*Archive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a chatty archive: %w", err)
+	}
+	defer gz.Close()
+
+	var archive Archive
+	decoder := json.NewDecoder(io.LimitReader(gz, maxArchiveSize))
+	if err := decoder.Decode(&archive); err != nil {
+		return nil, fmt.Errorf("decode archive: %w", err)
+	}
+	if archive.Version < 1 || archive.Version > ArchiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", archive.Version)
+	}
+
+	return &archive, nil
+}
+
+// loadAllMessages returns every message of a session in chronological order.
+func (s *Store) loadAllMessages(ctx context.Context, id int64) ([]Message, error) {
+	stmt, err := s.getPreparedStmt("getMessages")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("load messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate messages: %w", err)
+	}
+	if err := s.openMessages(ctx, id, messages); err != nil {
+		return nil, err
+	}
+	if err := s.loadAttachments(ctx, id, messages); err != nil {
+		return nil, err
+	}
+	if err := s.loadToolCalls(ctx, id, messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// archiveTimestamp formats t in the layout used by the schema defaults,
+// falling back to the current time for archives without timestamps.
+func archiveTimestamp(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.UTC().Format(archiveTimestampLayout)
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// MaxAttachmentSize is the largest file that can be attached to a message.
+const MaxAttachmentSize = 20 << 20
+
+// Attachment is a file sent with a message, such as an image for a vision
+// model. Data holds its content. An attachment kept by reference has no Data;
+// its content is read from Path, so it is lost when the file is.
+type Attachment struct {
+	Name     string // Base name of the file
+	MIMEType string
+	Size     int64
+	Data     []byte
+	Path     string // Where the file was attached from
+}
+
+// insertAttachments stores the attachments of message messageID. Their
+// content is encrypted like the message's when key is set.
+func insertAttachments(ctx context.Context, tx *sql.Tx, key []byte, sessionID, messageID int64, attachments []Attachment) error {
+	for _, attachment := range attachments {
+		if attachment.Size > MaxAttachmentSize {
+			return fmt.Errorf("attachment %s is larger than %d MiB", attachment.Name, MaxAttachmentSize>>20)
+		}
+		data := attachment.Data
+		if data != nil && key != nil {
+			sealed, err := sealContent(key, sessionID, string(data))
+			if err != nil {
+				return err
+			}
+			data = []byte(sealed)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO attachments(message_id, name, mime_type, size, data, path) VALUES (?, ?, ?, ?, ?, ?)`,
+			messageID, attachment.Name, attachment.MIMEType, attachment.Size, data, attachment.Path); err != nil {
+			return fmt.Errorf("insert attachment: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadAttachments adds their attachments to messages loaded from session id,
+// decrypting them in place.
+func (s *Store) loadAttachments(ctx context.Context, id int64, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	key, err := s.sessionKey(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[int64]int, len(messages))
+	for i, msg := range messages {
+		index[msg.ID] = i
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT a.message_id, a.name, a.mime_type, a.size, a.data, a.path
+        FROM attachments a JOIN messages m ON m.id = a.message_id
+        WHERE m.session_id = ? ORDER BY a.id`, id)
+	if err != nil {
+		return fmt.Errorf("load attachments: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var messageID int64
+		var attachment Attachment
+		if err := rows.Scan(&messageID, &attachment.Name, &attachment.MIMEType, &attachment.Size, &attachment.Data, &attachment.Path); err != nil {
+			return fmt.Errorf("load attachments: %w", err)
+		}
+		i, ok := index[messageID]
+		if !ok {
+			continue // A message outside the loaded page
+		}
+		if attachment.Data != nil && key != nil {
+			data, err := openContent(key, id, string(attachment.Data))
+			if err != nil {
+				return err
+			}
+			attachment.Data = []byte(data)
+		}
+		messages[i].Attachments = append(messages[i].Attachments, attachment)
+	}
+	return rows.Err()
+}
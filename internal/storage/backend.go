@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal/config"
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+)
+
+// Database drivers selectable with storage.driver.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// postgresDriverName is the database/sql driver registered by postgres.go,
+// which is only built with the postgres build tag.
+const postgresDriverName = "chatty-postgres"
+
+// Backend is the conversation history used by the TUI, the REPL and the
+// commands. *Store implements it on SQLite and on Postgres.
+type Backend interface {
+	CreateSession(ctx context.Context, name string) (int64, error)
+	UpdateSessionName(ctx context.Context, id int64, name string) error
+	SetSessionPinned(ctx context.Context, id int64, pinned bool) error
+	SetSessionArchived(ctx context.Context, id int64, archived bool) error
+	SetSessionSystemPrompt(ctx context.Context, id int64, prompt string) error
+	SetSessionSummary(ctx context.Context, id int64, summary string) error
+	DeleteSession(ctx context.Context, id int64) error
+	UndeleteSession(ctx context.Context, id int64) error
+	ListDeletedSessions(ctx context.Context) ([]SessionSummary, error)
+	PurgeDeletedSessions(ctx context.Context, olderThan time.Duration) (int64, error)
+	ListSessions(ctx context.Context, limit int) ([]SessionSummary, error)
+	ListAllSessions(ctx context.Context, limit int) ([]SessionSummary, error)
+	FilterSessions(ctx context.Context, filter SessionFilter) ([]SessionSummary, error)
+	LoadSession(ctx context.Context, id int64) (*Transcript, error)
+	LoadSessionWithPagination(ctx context.Context, id int64, pagination *PaginationOptions) (*Transcript, error)
+	LoadMessagesBefore(ctx context.Context, sessionID, beforeID int64, n int) ([]Message, error)
+	FindMessages(ctx context.Context, sessionID int64, text string) ([]int, error)
+	ForkSession(ctx context.Context, id int64, upTo int) (int64, error)
+	CloneSession(ctx context.Context, id int64) (int64, error)
+	SetLastSession(ctx context.Context, id int64) error
+	LastSession(ctx context.Context) (int64, error)
+
+	AppendMessage(ctx context.Context, sessionID int64, message Message) error
+	AppendMessagesBatch(ctx context.Context, sessionID int64, messages []Message) error
+	SaveMessagesWithRetry(ctx context.Context, sessionID int64, messages []Message, maxRetries int) error
+	ForgetLastExchange(ctx context.Context, sessionID int64) (int, error)
+
+	PinMessage(ctx context.Context, sessionID int64, position int) error
+	UnpinMessage(ctx context.Context, sessionID int64, position int) error
+	ListPinnedMessages(ctx context.Context, sessionID int64) ([]int, error)
+
+	ListUnembeddedMessages(ctx context.Context, model string, limit int) ([]StoredMessage, error)
+	SaveEmbedding(ctx context.Context, messageID int64, model string, vector []float32) error
+	ListEmbeddings(ctx context.Context, model string) ([]MessageEmbedding, error)
+
+	SaveSnippet(ctx context.Context, name, content string) error
+	GetSnippet(ctx context.Context, name string) (*Snippet, error)
+	ListSnippets(ctx context.Context) ([]Snippet, error)
+	DeleteSnippet(ctx context.Context, name string) error
+
+	SaveSessionTemplate(ctx context.Context, template *SessionTemplate) error
+	GetSessionTemplate(ctx context.Context, name string) (*SessionTemplate, error)
+	ListSessionTemplates(ctx context.Context) ([]SessionTemplate, error)
+	DeleteSessionTemplate(ctx context.Context, name string) error
+
+	EncryptSession(ctx context.Context, id int64, passphrase string) error
+	DecryptSession(ctx context.Context, id int64) error
+	UnlockSession(ctx context.Context, id int64, passphrase string) error
+	LockSession(id int64)
+	IsSessionSensitive(ctx context.Context, id int64) (bool, error)
+
+	ExportSession(ctx context.Context, id int64, w io.Writer) error
+	ExportTranscript(ctx context.Context, id int64, format string, w io.Writer) error
+	ImportSession(ctx context.Context, r io.Reader) (int64, error)
+	ImportSessions(ctx context.Context, sessions []ImportedSession) (*ImportResult, error)
+	Backup(ctx context.Context, dest string) error
+	Snapshot(ctx context.Context, dest string) error
+	Maintain(ctx context.Context) (*MaintenanceReport, error)
+	Stats(ctx context.Context) (*Stats, error)
+
+	Close() error
+}
+
+var _ Backend = (*Store)(nil)
+
+// OpenConfig opens the history selected by storage.driver: the SQLite
+// database under cfg.Path, or the Postgres database at cfg.DSN. Sessions
+// that have been in the trash longer than cfg.TrashRetention are purged.
+func OpenConfig(cfg config.StorageConfig) (*Store, error) {
+	var (
+		store *Store
+		err   error
+	)
+	switch cfg.Driver {
+	case "", DriverSQLite:
+		store, err = Open(cfg.Path)
+	case DriverPostgres:
+		store, err = OpenPostgres(cfg.DSN)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	store.dedupe = cfg.DedupeMessages
+
+	if cfg.TrashRetention > 0 {
+		// A failed purge is retried the next time; it must not keep the
+		// history from opening
+		_, _ = store.PurgeDeletedSessions(context.Background(), cfg.TrashRetention)
+	}
+	return store, nil
+}
+
+// OpenPostgres connects to the Postgres database at dsn, a postgres:// URL or
+// key=value connection string, and creates the tables if necessary.
+func OpenPostgres(dsn string) (*Store, error) {
+	if !slices.Contains(sql.Drivers(), postgresDriverName) {
+		return nil, chattyErrors.NewStorageError("open", "this build of chatty has no Postgres support; build it with -tags postgres", nil)
+	}
+
+	db, err := sql.Open(postgresDriverName, dsn)
+	if err != nil {
+		return nil, chattyErrors.NewStorageError("open", fmt.Sprintf("failed to open postgres database: %v", err), err)
+	}
+
+	// One connection, as with SQLite: the store never queries while it holds
+	// a transaction, so it does not need more
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, chattyErrors.NewStorageError("open", fmt.Sprintf("failed to connect to postgres: %v", err), err)
+	}
+
+	return newStore(db, DriverPostgres)
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+)
+
+// Backup writes a consistent copy of the database to dest with VACUUM INTO,
+// which also folds in the write-ahead log. dest must not exist yet. The copy
+// is written next to dest and renamed into place, so a failed backup leaves
+// nothing behind. Postgres databases are backed up with pg_dump instead.
+func (s *Store) Backup(ctx context.Context, dest string) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	if s.driver == DriverPostgres {
+		return errors.New("the database is on a Postgres server; back it up with pg_dump")
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return fmt.Errorf("resolve backup path: %w", err)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+
+	tmp := dest + ".tmp"
+	if err := s.vacuumInto(ctx, tmp, "backup"); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("move backup into place: %w", err)
+	}
+	return nil
+}
+
+// Snapshot writes a consistent copy of the database to dest like Backup, but
+// replaces dest when it exists, so it can be run again and again on a file
+// kept in a synced folder. The copy is written under a hidden name next to
+// dest and renamed over it in one step: a sync client only ever sees a
+// complete database.
+func (s *Store) Snapshot(ctx context.Context, dest string) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	if s.driver == DriverPostgres {
+		return errors.New("the database is on a Postgres server; back it up with pg_dump")
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return fmt.Errorf("resolve snapshot path: %w", err)
+	}
+	if info, err := os.Stat(dest); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", dest)
+		}
+		var live string
+		if err := s.db.QueryRowContext(ctx, `SELECT file FROM pragma_database_list WHERE name = 'main'`).Scan(&live); err != nil {
+			return fmt.Errorf("locate database: %w", err)
+		}
+		if liveInfo, err := os.Stat(live); err == nil && os.SameFile(info, liveInfo) {
+			return errors.New("cannot snapshot the database onto itself")
+		}
+	}
+
+	tmp := filepath.Join(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp")
+	if err := s.vacuumInto(ctx, tmp, "snapshot"); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("move snapshot into place: %w", err)
+	}
+	return nil
+}
+
+// vacuumInto copies the database to the new file tmp, readable by the owner
+// only. op names the operation in errors.
+func (s *Store) vacuumInto(ctx context.Context, tmp, op string) error {
+	os.Remove(tmp)
+
+	// The store has a single connection, so VACUUM INTO waits for the
+	// statement in flight. Holding the lock keeps other goroutines from
+	// fetching prepared statements, or closing them, until the copy is done.
+	s.preparedMutex.Lock()
+	_, err := s.db.ExecContext(ctx, `VACUUM INTO ?`, tmp)
+	s.preparedMutex.Unlock()
+	if err != nil {
+		os.Remove(tmp)
+		return chattyErrors.NewStorageError(op, fmt.Sprintf("failed to copy database: %v", err), err)
+	}
+
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("protect %s: %w", op, err)
+	}
+	return nil
+}
+
+// Restore replaces the database at path with the backup at src. The backup is
+// checked and copied first; the current database is then saved next to it
+// with a .before-restore suffix and the copy moved into place. No store may
+// have path open. It returns the path of the saved database, or "" when there
+// was none.
+func Restore(ctx context.Context, src, path string) (string, error) {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	src, err = filepath.Abs(src)
+	if err != nil {
+		return "", fmt.Errorf("resolve backup path: %w", err)
+	}
+	if src == resolved {
+		return "", errors.New("cannot restore a database onto itself")
+	}
+	if _, err := os.Stat(src); err != nil {
+		return "", err
+	}
+
+	// Copy the backup through SQLite rather than the file system, so a
+	// backup that is itself a live database with a write-ahead log is
+	// restored completely
+	tmp := resolved + ".restore"
+	os.Remove(tmp)
+	if err := copyBackup(ctx, src, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	var saved string
+	if _, err := os.Stat(resolved); err == nil {
+		saved = fmt.Sprintf("%s.before-restore-%s", resolved, time.Now().Format("20060102-150405"))
+		current, err := Open(resolved)
+		if err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+		err = current.Backup(ctx, saved)
+		current.Close()
+		if err != nil {
+			os.Remove(tmp)
+			return "", fmt.Errorf("save current database: %w", err)
+		}
+	}
+
+	// The old write-ahead log must not be replayed into the restored database
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(resolved + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(tmp)
+			return saved, fmt.Errorf("remove %s: %w", resolved+suffix, err)
+		}
+	}
+	if err := os.Rename(tmp, resolved); err != nil {
+		os.Remove(tmp)
+		return saved, fmt.Errorf("move restored database into place: %w", err)
+	}
+
+	// Bring the restored database up to the current schema
+	restored, err := Open(resolved)
+	if err != nil {
+		return saved, err
+	}
+	return saved, restored.Close()
+}
+
+// copyBackup checks that src is an intact chatty database and copies it to
+// dest.
+func copyBackup(ctx context.Context, src, dest string) error {
+	db, err := sql.Open("sqlite", src)
+	if err != nil {
+		return chattyErrors.NewStorageError("restore", fmt.Sprintf("failed to open backup: %v", err), err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var result string
+	if err := db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("%s is not a SQLite database: %w", src, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("backup is damaged: %s", result)
+	}
+
+	var tables int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('sessions', 'messages')`).Scan(&tables); err != nil {
+		return fmt.Errorf("inspect backup: %w", err)
+	}
+	if tables != 2 {
+		return fmt.Errorf("%s is not a chatty database", src)
+	}
+
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, dest); err != nil {
+		return chattyErrors.NewStorageError("restore", fmt.Sprintf("failed to copy backup: %v", err), err)
+	}
+	return os.Chmod(dest, 0o600)
+}
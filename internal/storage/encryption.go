@@ -0,0 +1,369 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+// Sensitive sessions keep the content of their messages and attachments
+// encrypted with a key derived from a passphrase of their own, so a shared
+// database only needs a passphrase for the conversations that warrant one.
+// Session names, timestamps, message metadata and attachment names stay
+// readable. The key is held in memory
+// while the session is unlocked and never written to disk.
+
+const (
+	MinPassphraseLength = 8
+
+	keySaltSize  = 16
+	keyCheckText = "chatty session key"
+)
+
+var (
+	// ErrSessionLocked is returned when reading or writing the messages of a
+	// sensitive session that has not been unlocked.
+	ErrSessionLocked = errors.New("session is encrypted, unlock it with its passphrase first")
+	// ErrWrongPassphrase is returned by UnlockSession for a passphrase that
+	// does not match the session's.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+)
+
+// EncryptSession marks a session as sensitive and encrypts its messages with
+// a key derived from passphrase. The session stays unlocked afterwards.
+// SQLite's secure_delete is enabled while the messages are rewritten, so the
+// plaintext is overwritten rather than left in free pages.
+func (s *Store) EncryptSession(ctx context.Context, id int64, passphrase string) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	if len(passphrase) < MinPassphraseLength {
+		return chattyErrors.NewValidationError("passphrase", fmt.Sprintf("must be at least %d characters", MinPassphraseLength), "", nil)
+	}
+	sensitive, err := s.IsSessionSensitive(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sensitive {
+		return fmt.Errorf("session %d is already encrypted", id)
+	}
+
+	salt := make([]byte, keySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("generate salt: %w", err)
+	}
+	key := deriveKey(passphrase, salt)
+	check, err := sealContent(key, id, keyCheckText)
+	if err != nil {
+		return err
+	}
+
+	err = s.rewriteMessages(ctx, id, func(content string) (string, error) {
+		return sealContent(key, id, content)
+	}, func(tx *sql.Tx) error {
+		// Embeddings would reveal what the messages are about
+		if _, err := tx.ExecContext(ctx, `DELETE FROM message_embeddings WHERE message_id IN (SELECT id FROM messages WHERE session_id = ?)`, id); err != nil {
+			return fmt.Errorf("delete embeddings: %w", err)
+		}
+		// and so would a summary
+		_, err := tx.ExecContext(ctx, `UPDATE sessions SET key_salt = ?, key_check = ?, summary = '' WHERE id = ?`, salt, []byte(check), id)
+		return err
+	})
+	if err != nil {
+		return chattyErrors.NewStorageError("encrypt", fmt.Sprintf("failed to encrypt session %d: %v", id, err), err)
+	}
+
+	s.keysMutex.Lock()
+	s.keys[id] = key
+	s.keysMutex.Unlock()
+	return nil
+}
+
+// DecryptSession stores the messages of an unlocked sensitive session as
+// plain text again and drops its passphrase.
+func (s *Store) DecryptSession(ctx context.Context, id int64) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	key, err := s.sessionKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return fmt.Errorf("session %d is not encrypted", id)
+	}
+
+	err = s.rewriteMessages(ctx, id, func(content string) (string, error) {
+		return openContent(key, id, content)
+	}, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE sessions SET key_salt = NULL, key_check = NULL WHERE id = ?`, id)
+		return err
+	})
+	if err != nil {
+		return chattyErrors.NewStorageError("decrypt", fmt.Sprintf("failed to decrypt session %d: %v", id, err), err)
+	}
+
+	s.LockSession(id)
+	return nil
+}
+
+// UnlockSession checks passphrase against a sensitive session and keeps its
+// key in memory until LockSession or Close. Unlocking a session that is not
+// sensitive does nothing.
+func (s *Store) UnlockSession(ctx context.Context, id int64, passphrase string) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	var salt, check []byte
+	err := s.db.QueryRowContext(ctx, `SELECT key_salt, key_check FROM sessions WHERE id = ?`, id).Scan(&salt, &check)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("session %d not found", id)
+	}
+	if err != nil {
+		return fmt.Errorf("select session key: %w", err)
+	}
+	if salt == nil {
+		return nil
+	}
+
+	key := deriveKey(passphrase, salt)
+	if text, err := openContent(key, id, string(check)); err != nil || text != keyCheckText {
+		return ErrWrongPassphrase
+	}
+
+	s.keysMutex.Lock()
+	s.keys[id] = key
+	s.keysMutex.Unlock()
+	return nil
+}
+
+// LockSession forgets the key of a sensitive session.
+func (s *Store) LockSession(id int64) {
+	if s == nil {
+		return
+	}
+	s.keysMutex.Lock()
+	delete(s.keys, id)
+	s.keysMutex.Unlock()
+}
+
+// sessionKey returns the key of an unlocked sensitive session, nil for a
+// session that is not sensitive, or ErrSessionLocked.
+func (s *Store) sessionKey(ctx context.Context, id int64) ([]byte, error) {
+	s.keysMutex.Lock()
+	key := s.keys[id]
+	s.keysMutex.Unlock()
+	if key != nil {
+		return key, nil
+	}
+
+	sensitive, err := s.IsSessionSensitive(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sensitive {
+		return nil, ErrSessionLocked
+	}
+	return nil, nil
+}
+
+// IsSessionSensitive reports whether a session keeps its messages encrypted.
+func (s *Store) IsSessionSensitive(ctx context.Context, id int64) (bool, error) {
+	var sensitive bool
+	err := s.db.QueryRowContext(ctx, `SELECT key_salt IS NOT NULL FROM sessions WHERE id = ?`, id).Scan(&sensitive)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("session %d not found", id)
+	}
+	if err != nil {
+		return false, fmt.Errorf("select session: %w", err)
+	}
+	return sensitive, nil
+}
+
+// messageContent returns content as it is stored: encrypted when key is set.
+func (s *Store) messageContent(key []byte, sessionID int64, content string) (string, error) {
+	if key == nil {
+		return content, nil
+	}
+	return sealContent(key, sessionID, content)
+}
+
+// openMessages decrypts messages loaded from session id in place.
+func (s *Store) openMessages(ctx context.Context, id int64, messages []Message) error {
+	key, err := s.sessionKey(ctx, id)
+	if err != nil || key == nil {
+		return err
+	}
+	for i := range messages {
+		content, err := openContent(key, id, messages[i].Content)
+		if err != nil {
+			return err
+		}
+		messages[i].Content = content
+	}
+	return nil
+}
+
+// rewriteMessages replaces the content of every message of a session with
+// convert(content) and runs finish, in one transaction.
+func (s *Store) rewriteMessages(ctx context.Context, id int64, convert func(string) (string, error), finish func(*sql.Tx) error) error {
+	return s.scrub(ctx, func(tx *sql.Tx) error {
+		return rewriteContents(ctx, tx, id, convert, finish)
+	})
+}
+
+func rewriteContents(ctx context.Context, tx *sql.Tx, id int64, convert func(string) (string, error), finish func(*sql.Tx) error) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, content FROM messages WHERE session_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	contents := make(map[int64]string)
+	for rows.Next() {
+		var messageID int64
+		var content string
+		if err := rows.Scan(&messageID, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		contents[messageID] = content
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for messageID, content := range contents {
+		converted, err := convert(content)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE messages SET content = ? WHERE id = ?`, converted, messageID); err != nil {
+			return err
+		}
+	}
+
+	// Attachments kept by reference have no content in the database
+	rows, err = tx.QueryContext(ctx, `SELECT a.id, a.data FROM attachments a JOIN messages m ON m.id = a.message_id
+        WHERE m.session_id = ? AND a.data IS NOT NULL`, id)
+	if err != nil {
+		return err
+	}
+	data := make(map[int64][]byte)
+	for rows.Next() {
+		var attachmentID int64
+		var content []byte
+		if err := rows.Scan(&attachmentID, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		data[attachmentID] = content
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for attachmentID, content := range data {
+		converted, err := convert(string(content))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE attachments SET data = ? WHERE id = ?`, []byte(converted), attachmentID); err != nil {
+			return err
+		}
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT t.id, t.arguments, t.result FROM tool_calls t JOIN messages m ON m.id = t.message_id
+        WHERE m.session_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	calls := make(map[int64][2]string)
+	for rows.Next() {
+		var callID int64
+		var arguments, result string
+		if err := rows.Scan(&callID, &arguments, &result); err != nil {
+			rows.Close()
+			return err
+		}
+		calls[callID] = [2]string{arguments, result}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for callID, call := range calls {
+		arguments, err := convert(call[0])
+		if err != nil {
+			return err
+		}
+		result, err := convert(call[1])
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE tool_calls SET arguments = ?, result = ? WHERE id = ?`, arguments, result, callID); err != nil {
+			return err
+		}
+	}
+	return finish(tx)
+}
+
+// deriveKey turns a passphrase into a 256-bit key with Argon2id.
+func deriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, 32)
+}
+
+// sealContent encrypts text with AES-GCM, bound to the session it belongs to,
+// and returns the nonce and ciphertext base64-encoded.
+func sealContent(key []byte, sessionID int64, text string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(text), sessionAAD(sessionID))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openContent reverses sealContent.
+func openContent(key []byte, sessionID int64, content string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(content)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted message is damaged")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	text, err := aead.Open(nil, nonce, ciphertext, sessionAAD(sessionID))
+	if err != nil {
+		return "", errors.New("encrypted message is damaged")
+	}
+	return string(text), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sessionAAD(sessionID int64) []byte {
+	return []byte("session:" + strconv.FormatInt(sessionID, 10))
+}
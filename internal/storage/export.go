@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal/ui"
+)
+
+// Transcript export formats.
+const (
+	FormatMarkdown = "md"
+	FormatJSON     = "json"
+	FormatHTML     = "html"
+)
+
+// ExportFormatFor returns the export format matching the extension of path,
+// or "" when there is none.
+func ExportFormatFor(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return FormatMarkdown
+	case ".json":
+		return FormatJSON
+	case ".html", ".htm":
+		return FormatHTML
+	}
+	return ""
+}
+
+// ExportTranscript writes the complete session to w as a readable transcript
+// with roles and timestamps. JSON exports are uncompressed archives, so they
+// can be imported again.
+func (s *Store) ExportTranscript(ctx context.Context, id int64, format string, w io.Writer) error {
+	switch format {
+	case FormatMarkdown, FormatJSON, FormatHTML:
+	default:
+		return fmt.Errorf("unknown export format %q (use md, json or html)", format)
+	}
+
+	archive, err := s.loadArchive(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(archive); err != nil {
+			return fmt.Errorf("encode transcript: %w", err)
+		}
+		return nil
+	case FormatHTML:
+		if err := exportTemplate.Execute(w, exportView(archive)); err != nil {
+			return fmt.Errorf("render transcript: %w", err)
+		}
+		return nil
+	default:
+		return writeMarkdown(w, archive)
+	}
+}
+
+func writeMarkdown(w io.Writer, archive *Archive) error {
+	session := archive.Session
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", exportTitle(session.Name))
+	fmt.Fprintf(&b, "*Started %s · %d messages · exported %s*\n",
+		ui.FormatDateTime(session.CreatedAt), len(session.Messages), ui.FormatDateTime(archive.ExportedAt))
+	if session.SystemPrompt != "" {
+		fmt.Fprintf(&b, "\n## System prompt\n\n%s\n", strings.TrimRight(session.SystemPrompt, "\n"))
+	}
+	for _, msg := range session.Messages {
+		heading := roleLabel(msg.Role) + " · " + ui.FormatDateTime(msg.CreatedAt)
+		if msg.Interrupted {
+			heading += " · interrupted"
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", heading, strings.TrimRight(msg.Content, "\n"))
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	return nil
+}
+
+func exportTitle(name string) string {
+	if name = strings.TrimSpace(name); name == "" {
+		return "Untitled session"
+	}
+	return name
+}
+
+func roleLabel(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "system":
+		return "System"
+	default:
+		return "Assistant"
+	}
+}
+
+type exportPage struct {
+	Title    string
+	Created  string
+	Exported string
+	Messages []exportMessage
+}
+
+type exportMessage struct {
+	Role        string
+	Label       string
+	Time        string
+	Content     string
+	Interrupted bool
+}
+
+func exportView(archive *Archive) exportPage {
+	page := exportPage{
+		Title:    exportTitle(archive.Session.Name),
+		Created:  ui.FormatDateTime(archive.Session.CreatedAt),
+		Exported: ui.FormatDateTime(archive.ExportedAt),
+		Messages: make([]exportMessage, len(archive.Session.Messages)),
+	}
+	for i, msg := range archive.Session.Messages {
+		page.Messages[i] = exportMessage{
+			Role:        msg.Role,
+			Label:       roleLabel(msg.Role),
+			Time:        ui.FormatDateTime(msg.CreatedAt),
+			Content:     msg.Content,
+			Interrupted: msg.Interrupted,
+		}
+	}
+	return page
+}
+
+var exportTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 50rem; margin: 2rem auto; padding: 0 1rem; color: #222; background: #fafafa; }
+header { border-bottom: 1px solid #ddd; margin-bottom: 1.5rem; }
+header p { color: #777; font-size: 0.9rem; }
+.message { margin-bottom: 1.25rem; padding: 0.75rem 1rem; border-radius: 6px; background: #fff; border-left: 4px solid #87afff; }
+.message.user { border-left-color: #87d7af; }
+.message.system { border-left-color: #bbb; }
+.label { font-weight: bold; }
+.time { color: #999; font-size: 0.8rem; margin-left: 0.5rem; }
+.content { white-space: pre-wrap; word-wrap: break-word; margin-top: 0.5rem; font-family: ui-monospace, monospace; font-size: 0.9rem; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p>Started {{.Created}} · {{len .Messages}} messages · exported {{.Exported}}</p>
+</header>
+{{range .Messages}}<div class="message {{.Role}}">
+<span class="label">{{.Label}}</span><span class="time">{{.Time}}{{if .Interrupted}} · interrupted{{end}}</span>
+<div class="content">{{.Content}}</div>
+</div>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+)
+
+// ForkSession copies the first upTo messages of a session, with their pins,
+// into a new session that records the session and message it was forked
+// from, and returns the new session's id. The original is left untouched. A
+// fork of an encrypted session is encrypted with the same passphrase and
+// starts out unlocked.
+func (s *Store) ForkSession(ctx context.Context, id int64, upTo int) (int64, error) {
+	return s.copySession(ctx, id, upTo, true)
+}
+
+// CloneSession copies a whole session, with its pins, into a new
+// independent session and returns the new session's id, so a carefully built
+// context can be the starting point of another task. Unlike a fork, the copy
+// does not record where it came from. A clone of an encrypted session is
+// encrypted with the same passphrase and starts out unlocked.
+func (s *Store) CloneSession(ctx context.Context, id int64) (int64, error) {
+	return s.copySession(ctx, id, -1, false)
+}
+
+// copySession copies the first upTo messages of a session, or all of them
+// when upTo is negative, into a new session. A fork records its parent and
+// fork point.
+func (s *Store) copySession(ctx context.Context, id int64, upTo int, fork bool) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("storage not initialised")
+	}
+
+	var name, systemPrompt string
+	var salt []byte
+	err := s.db.QueryRowContext(ctx, `SELECT name, key_salt, system_prompt FROM sessions WHERE id = ?`, id).Scan(&name, &salt, &systemPrompt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("session %d not found", id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("select session: %w", err)
+	}
+
+	// Read everything first: the transaction holds the only connection
+	key, err := s.sessionKey(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	messages, err := s.loadAllMessages(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if upTo < 0 {
+		upTo = len(messages)
+	} else if upTo < 1 || upTo > len(messages) {
+		return 0, chattyErrors.NewValidationError("upTo", fmt.Sprintf("must be between 1 and %d", len(messages)), upTo, nil)
+	}
+	pinned, err := s.ListPinnedMessages(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, chattyErrors.NewStorageError("copy", fmt.Sprintf("failed to begin transaction: %v", err), err)
+	}
+	defer tx.Rollback()
+
+	var forkID int64
+	if fork {
+		err = tx.QueryRowContext(ctx, `INSERT INTO sessions(name, parent_session_id, fork_point, system_prompt) VALUES (?, ?, ?, ?) RETURNING id`,
+			importName(name+" (fork)"), id, upTo, systemPrompt).Scan(&forkID)
+	} else {
+		err = tx.QueryRowContext(ctx, `INSERT INTO sessions(name, system_prompt) VALUES (?, ?) RETURNING id`,
+			importName(name+" (copy)"), systemPrompt).Scan(&forkID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("insert session: %w", err)
+	}
+
+	if key != nil {
+		check, err := sealContent(key, forkID, keyCheckText)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE sessions SET key_salt = ?, key_check = ? WHERE id = ?`, salt, []byte(check), forkID); err != nil {
+			return 0, fmt.Errorf("store session key: %w", err)
+		}
+	}
+
+	for _, msg := range messages[:upTo] {
+		content, err := s.messageContent(key, forkID, msg.Content)
+		if err != nil {
+			return 0, err
+		}
+		var messageID int64
+		if err := tx.QueryRowContext(ctx, `INSERT INTO messages(session_id, role, content, created_at, interrupted, model, temperature, prompt_tokens, completion_tokens, repeats) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+			forkID, msg.Role, content, archiveTimestamp(msg.CreatedAt), msg.Interrupted,
+			msg.Meta.Model, msg.Meta.Temperature, msg.Meta.PromptTokens, msg.Meta.CompletionTokens, msg.Repeats).Scan(&messageID); err != nil {
+			return 0, fmt.Errorf("insert message: %w", err)
+		}
+		if err := insertAttachments(ctx, tx, key, forkID, messageID, msg.Attachments); err != nil {
+			return 0, err
+		}
+		if err := insertToolCalls(ctx, tx, key, forkID, messageID, msg.ToolCalls); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, position := range pinned {
+		if position >= upTo {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO pinned_messages(session_id, position) VALUES (?, ?)`, forkID, position); err != nil {
+			return 0, fmt.Errorf("insert pinned message: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, chattyErrors.NewStorageError("copy", fmt.Sprintf("failed to commit transaction: %v", err), err)
+	}
+
+	if key != nil {
+		s.keysMutex.Lock()
+		s.keys[forkID] = key
+		s.keysMutex.Unlock()
+	}
+	return forkID, nil
+}
@@ -0,0 +1,377 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sources of imported conversations.
+const (
+	SourceChatty  = "chatty"
+	SourceChatGPT = "chatgpt"
+)
+
+// ImportedSession is a conversation read from an export file.
+type ImportedSession struct {
+	Source string
+	// SourceID identifies the conversation in its source, so importing the
+	// same file twice does not duplicate it.
+	SourceID string
+	Session  ArchiveSession
+}
+
+// ImportResult reports what ImportSessions did with each conversation.
+type ImportResult struct {
+	Imported   []int64 // IDs of the new sessions
+	Duplicates int     // Conversations that were already in the store
+	Failed     []error // Conversations that could not be stored, and why
+}
+
+// ReadExport decodes the conversations in an export file. It accepts OpenAI's
+// conversations.json export, a single conversation from it, and chatty's own
+// archives, compressed or as written by the JSON transcript export.
+func ReadExport(r io.Reader) ([]ImportedSession, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxArchiveSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read export: %w", err)
+	}
+	if len(data) > maxArchiveSize {
+		return nil, fmt.Errorf("export larger than %d bytes", maxArchiveSize)
+	}
+
+	// Compressed chatty archive
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		archive, err := ReadArchive(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return []ImportedSession{chattySession(archive.Session)}, nil
+	}
+
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		var conversations []chatGPTConversation
+		if err := json.Unmarshal(data, &conversations); err != nil {
+			return nil, fmt.Errorf("decode ChatGPT export: %w", err)
+		}
+		sessions := make([]ImportedSession, 0, len(conversations))
+		for _, conversation := range conversations {
+			sessions = append(sessions, conversation.session())
+		}
+		return sessions, nil
+
+	case bytes.HasPrefix(data, []byte("{")):
+		var probe struct {
+			Version int             `json:"version"`
+			Session json.RawMessage `json:"session"`
+			Mapping json.RawMessage `json:"mapping"`
+		}
+		if err := json.Unmarshal(data, &probe); err != nil {
+			return nil, fmt.Errorf("decode export: %w", err)
+		}
+		if probe.Mapping != nil {
+			var conversation chatGPTConversation
+			if err := json.Unmarshal(data, &conversation); err != nil {
+				return nil, fmt.Errorf("decode ChatGPT conversation: %w", err)
+			}
+			return []ImportedSession{conversation.session()}, nil
+		}
+		if probe.Session != nil {
+			var archive Archive
+			if err := json.Unmarshal(data, &archive); err != nil {
+				return nil, fmt.Errorf("decode archive: %w", err)
+			}
+			if archive.Version < 1 || archive.Version > ArchiveVersion {
+				return nil, fmt.Errorf("unsupported archive version %d", archive.Version)
+			}
+			return []ImportedSession{chattySession(archive.Session)}, nil
+		}
+	}
+
+	return nil, errors.New("unrecognised export: expected ChatGPT conversations.json or a chatty archive")
+}
+
+// ImportSessions stores each conversation as a new session, keeping its
+// timestamps. Conversations imported before, or matching an existing session
+// by name, start time and length, are skipped. One conversation failing does
+// not stop the others.
+func (s *Store) ImportSessions(ctx context.Context, sessions []ImportedSession) (*ImportResult, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+
+	result := &ImportResult{}
+	for i, imported := range sessions {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		id, err := s.importSession(ctx, imported)
+		switch {
+		case err != nil:
+			result.Failed = append(result.Failed, fmt.Errorf("conversation %d (%s): %w", i+1, exportTitle(imported.Session.Name), err))
+		case id == 0:
+			result.Duplicates++
+		default:
+			result.Imported = append(result.Imported, id)
+		}
+	}
+	return result, nil
+}
+
+// importSession stores one conversation and returns its new session id, or 0
+// when it is a duplicate.
+func (s *Store) importSession(ctx context.Context, imported ImportedSession) (int64, error) {
+	session := imported.Session
+	if len(session.Messages) == 0 {
+		return 0, errors.New("no messages")
+	}
+	for i, msg := range session.Messages {
+		if err := validateMessageRole(msg.Role); err != nil {
+			return 0, fmt.Errorf("message %d: %w", i+1, err)
+		}
+		if err := validateMessageContent(msg.Content); err != nil {
+			return 0, fmt.Errorf("message %d: %w", i+1, err)
+		}
+	}
+	name := importName(session.Name)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	duplicate, err := isDuplicateImport(ctx, tx, name, imported)
+	if err != nil || duplicate {
+		return 0, err
+	}
+
+	id, err := insertArchiveSession(ctx, tx, name, session)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO imported_sessions(source, source_id, session_id) VALUES (?, ?, ?)`,
+		imported.Source, imported.SourceID, id); err != nil {
+		return 0, fmt.Errorf("record import: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit import: %w", err)
+	}
+	return id, nil
+}
+
+// isDuplicateImport reports whether the conversation was imported before, or
+// is already stored, for example when a chatty export is imported into the
+// database it came from.
+func isDuplicateImport(ctx context.Context, tx *sql.Tx, name string, imported ImportedSession) (bool, error) {
+	var exists int
+	err := tx.QueryRowContext(ctx, `SELECT 1 FROM imported_sessions WHERE source = ? AND source_id = ?`,
+		imported.Source, imported.SourceID).Scan(&exists)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("check import: %w", err)
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM sessions s
+        WHERE s.name = ? AND s.created_at = ?
+        AND (SELECT COUNT(*) FROM messages m WHERE m.session_id = s.id) = ?
+        LIMIT 1`,
+		name, archiveTimestamp(imported.Session.CreatedAt), len(imported.Session.Messages)).Scan(&exists)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("check import: %w", err)
+	}
+	return false, nil
+}
+
+// importName turns a conversation title into a valid session name, dropping
+// characters session names do not allow.
+func importName(title string) string {
+	var b strings.Builder
+	for _, r := range title {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '_', r == '.', r == '(', r == ')':
+			b.WriteRune(r)
+		case r == ' ', r == '\t', r == '\n', r == '/', r == ':':
+			b.WriteRune(' ')
+		}
+	}
+	name := strings.Join(strings.Fields(b.String()), " ")
+	if len(name) > maxSessionNameLength {
+		name = strings.TrimSpace(name[:maxSessionNameLength])
+	}
+	if name == "" {
+		name = fmt.Sprintf("Imported %s", time.Now().Format("2006-01-02 15-04"))
+	}
+	return name
+}
+
+// chattySession wraps a conversation from a chatty archive. Archives carry no
+// ID, so the conversation is identified by its content.
+func chattySession(session ArchiveSession) ImportedSession {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00", session.Name, session.CreatedAt.Unix())
+	for _, msg := range session.Messages {
+		fmt.Fprintf(h, "%s\x00%s\x00%d\x00", msg.Role, msg.Content, msg.CreatedAt.Unix())
+	}
+	return ImportedSession{Source: SourceChatty, SourceID: hex.EncodeToString(h.Sum(nil)), Session: session}
+}
+
+// chatGPTConversation is one conversation of OpenAI's conversations.json.
+// Messages form a tree, because edited prompts and regenerated answers branch
+// off; current_node is the last message of the branch shown in ChatGPT.
+type chatGPTConversation struct {
+	ID             string                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Title          string                 `json:"title"`
+	CreateTime     float64                `json:"create_time"`
+	UpdateTime     float64                `json:"update_time"`
+	CurrentNode    string                 `json:"current_node"`
+	Mapping        map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	Message  *chatGPTMessage `json:"message"`
+	Parent   string          `json:"parent"`
+	Children []string        `json:"children"`
+}
+
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	Content struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+	} `json:"content"`
+	CreateTime float64 `json:"create_time"`
+	Metadata   struct {
+		Hidden bool `json:"is_visually_hidden_from_conversation"`
+	} `json:"metadata"`
+}
+
+// session converts the branch shown in ChatGPT to a conversation. Tool
+// output, hidden messages and non-text parts such as images are left out.
+func (c chatGPTConversation) session() ImportedSession {
+	session := ArchiveSession{
+		Name:      c.Title,
+		CreatedAt: unixTime(c.CreateTime),
+		UpdatedAt: unixTime(c.UpdateTime),
+	}
+	if session.UpdatedAt.IsZero() {
+		session.UpdatedAt = session.CreatedAt
+	}
+
+	for _, node := range c.branch() {
+		msg := node.Message
+		if msg == nil || msg.Metadata.Hidden {
+			continue
+		}
+		role := msg.Author.Role
+		if role != "user" && role != "assistant" && role != "system" {
+			continue
+		}
+		if msg.Content.ContentType != "text" && msg.Content.ContentType != "multimodal_text" {
+			continue
+		}
+		var parts []string
+		for _, raw := range msg.Content.Parts {
+			var part string
+			if json.Unmarshal(raw, &part) == nil && strings.TrimSpace(part) != "" {
+				parts = append(parts, part)
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		createdAt := unixTime(msg.CreateTime)
+		if createdAt.IsZero() {
+			createdAt = session.CreatedAt
+		}
+		session.Messages = append(session.Messages, ArchiveMessage{
+			Role:      role,
+			Content:   strings.Join(parts, "\n\n"),
+			CreatedAt: createdAt,
+		})
+	}
+
+	id := c.ConversationID
+	if id == "" {
+		id = c.ID
+	}
+	if id == "" {
+		return chattySession(session)
+	}
+	return ImportedSession{Source: SourceChatGPT, SourceID: id, Session: session}
+}
+
+// branch returns the nodes from the root to the current node. Exports
+// without a current node follow the latest child at each step.
+func (c chatGPTConversation) branch() []chatGPTNode {
+	var nodes []chatGPTNode
+	if _, ok := c.Mapping[c.CurrentNode]; ok {
+		for id := c.CurrentNode; id != "" && len(nodes) <= len(c.Mapping); {
+			node, ok := c.Mapping[id]
+			if !ok {
+				break
+			}
+			nodes = append(nodes, node)
+			id = node.Parent
+		}
+		for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		}
+		return nodes
+	}
+
+	// Map order is random; pick the root deterministically
+	ids := make([]string, 0, len(c.Mapping))
+	for id, node := range c.Mapping {
+		if _, ok := c.Mapping[node.Parent]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	for id := ids[0]; len(nodes) <= len(c.Mapping); {
+		node, ok := c.Mapping[id]
+		if !ok {
+			break
+		}
+		nodes = append(nodes, node)
+		if len(node.Children) == 0 {
+			break
+		}
+		id = node.Children[len(node.Children)-1]
+	}
+	return nodes
+}
+
+// unixTime converts the fractional Unix seconds used by ChatGPT exports.
+func unixTime(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)).UTC()
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+)
+
+// MaintenanceReport describes the database after Maintain.
+type MaintenanceReport struct {
+	// Problems reported by PRAGMA integrity_check; empty when the database
+	// is intact. A damaged database is not vacuumed or analysed.
+	Problems []string
+
+	SizeBefore, SizeAfter int64 // Bytes in use, excluding the write-ahead log
+
+	Sessions    int64
+	Messages    int64
+	Embeddings  int64
+	Snippets    int64
+	Attachments int64
+
+	Indexes []IndexStat
+}
+
+// IndexStat is what ANALYZE found out about an index.
+type IndexStat struct {
+	Name, Table string
+	Entries     int64
+	RowsPerKey  int64 // Average rows sharing a key; 1 for a unique index
+}
+
+// Maintain checks the database for damage and, if it is intact, rebuilds it
+// with VACUUM to reclaim the space of deleted messages and refreshes the
+// query planner's statistics with ANALYZE. Postgres databases are maintained
+// by the server.
+func (s *Store) Maintain(ctx context.Context) (*MaintenanceReport, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+	if s.driver == DriverPostgres {
+		return nil, errors.New("the database is on a Postgres server; use its autovacuum or VACUUM ANALYZE")
+	}
+
+	report := &MaintenanceReport{}
+
+	rows, err := s.db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return nil, fmt.Errorf("check integrity: %w", err)
+	}
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("check integrity: %w", err)
+		}
+		if result != "ok" {
+			report.Problems = append(report.Problems, result)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check integrity: %w", err)
+	}
+
+	if report.SizeBefore, err = s.databaseSize(ctx); err != nil {
+		return nil, err
+	}
+	report.SizeAfter = report.SizeBefore
+
+	counts := []struct {
+		table string
+		count *int64
+	}{
+		{"sessions", &report.Sessions},
+		{"messages", &report.Messages},
+		{"message_embeddings", &report.Embeddings},
+		{"snippets", &report.Snippets},
+		{"attachments", &report.Attachments},
+	}
+	for _, c := range counts {
+		if err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, c.table)).Scan(c.count); err != nil {
+			return nil, fmt.Errorf("count %s: %w", c.table, err)
+		}
+	}
+
+	if len(report.Problems) > 0 {
+		return report, nil
+	}
+
+	// As with Backup, holding the lock keeps other goroutines from using
+	// prepared statements while the database is rebuilt
+	s.preparedMutex.Lock()
+	_, err = s.db.ExecContext(ctx, `VACUUM`)
+	if err == nil {
+		_, err = s.db.ExecContext(ctx, `ANALYZE`)
+	}
+	s.preparedMutex.Unlock()
+	if err != nil {
+		return nil, chattyErrors.NewStorageError("maintain", fmt.Sprintf("failed to rebuild database: %v", err), err)
+	}
+
+	if report.SizeAfter, err = s.databaseSize(ctx); err != nil {
+		return nil, err
+	}
+
+	// sqlite_stat1 holds "entries rows-per-key..." for every analysed index
+	rows, err = s.db.QueryContext(ctx, `SELECT idx, tbl, stat FROM sqlite_stat1 WHERE idx IS NOT NULL ORDER BY tbl, idx`)
+	if err != nil {
+		return nil, fmt.Errorf("read index statistics: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var stat IndexStat
+		var values string
+		if err := rows.Scan(&stat.Name, &stat.Table, &values); err != nil {
+			return nil, fmt.Errorf("read index statistics: %w", err)
+		}
+		fmt.Sscan(values, &stat.Entries, &stat.RowsPerKey)
+		report.Indexes = append(report.Indexes, stat)
+	}
+	return report, rows.Err()
+}
+
+// databaseSize returns the bytes used by the pages of the database.
+func (s *Store) databaseSize(ctx context.Context) (int64, error) {
+	var pages, pageSize int64
+	if err := s.db.QueryRowContext(ctx, `PRAGMA page_count`).Scan(&pages); err != nil {
+		return 0, fmt.Errorf("read database size: %w", err)
+	}
+	if err := s.db.QueryRowContext(ctx, `PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("read database size: %w", err)
+	}
+	return pages * pageSize, nil
+}
@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// A migration is one step of the schema. Migrations are applied in order,
+// each in its own transaction, and recorded in schema_migrations so every
+// step runs once per database. They are also idempotent, because databases
+// created before schema_migrations existed already have some of them.
+//
+// Never change a migration that has been released: append a new one.
+type migration struct {
+	version     int
+	description string
+	statements  []string
+	columns     []column // Added after the statements ran
+}
+
+// column is a column added to an existing table.
+type column struct {
+	table, name, definition string
+}
+
+var migrations = []migration{
+	{
+		version:     1,
+		description: "sessions and messages",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS sessions (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+            updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+        );`,
+			`CREATE TABLE IF NOT EXISTS messages (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            session_id INTEGER NOT NULL,
+            role TEXT NOT NULL,
+            content TEXT NOT NULL,
+            created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+            FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE
+        );`,
+			`CREATE INDEX IF NOT EXISTS idx_messages_session_id ON messages(session_id);`,
+		},
+	},
+	{
+		version:     2,
+		description: "message metadata",
+		columns: []column{
+			{"messages", "interrupted", "INTEGER NOT NULL DEFAULT 0"},
+			{"messages", "model", "TEXT NOT NULL DEFAULT ''"},
+			{"messages", "temperature", "REAL"},
+			{"messages", "prompt_tokens", "INTEGER NOT NULL DEFAULT 0"},
+			{"messages", "completion_tokens", "INTEGER NOT NULL DEFAULT 0"},
+		},
+	},
+	{
+		version:     3,
+		description: "pinned messages",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS pinned_messages (
+            session_id INTEGER NOT NULL,
+            position INTEGER NOT NULL,
+            PRIMARY KEY(session_id, position),
+            FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE
+        );`,
+		},
+	},
+	{
+		version:     4,
+		description: "message embeddings",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS message_embeddings (
+            message_id INTEGER PRIMARY KEY,
+            model TEXT NOT NULL,
+            vector BLOB NOT NULL,
+            FOREIGN KEY(message_id) REFERENCES messages(id) ON DELETE CASCADE
+        );`,
+		},
+	},
+	{
+		version:     5,
+		description: "encrypted sessions",
+		columns: []column{
+			{"sessions", "key_salt", "BLOB"},
+			{"sessions", "key_check", "BLOB"},
+		},
+	},
+	{
+		version:     6,
+		description: "imported sessions",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS imported_sessions (
+            source TEXT NOT NULL,
+            source_id TEXT NOT NULL,
+            session_id INTEGER NOT NULL,
+            PRIMARY KEY(source, source_id),
+            FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE
+        );`,
+		},
+	},
+	{
+		version:     7,
+		description: "session forks",
+		columns: []column{
+			{"sessions", "parent_session_id", "INTEGER REFERENCES sessions(id) ON DELETE SET NULL"},
+			{"sessions", "fork_point", "INTEGER NOT NULL DEFAULT 0"},
+		},
+	},
+	{
+		version:     8,
+		description: "pinned and archived sessions",
+		columns: []column{
+			{"sessions", "pinned", "INTEGER NOT NULL DEFAULT 0"},
+			{"sessions", "archived", "INTEGER NOT NULL DEFAULT 0"},
+		},
+	},
+	{
+		version:     9,
+		description: "context snippets",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS snippets (
+            name TEXT PRIMARY KEY,
+            content TEXT NOT NULL,
+            updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+        );`,
+		},
+	},
+	{
+		version:     10,
+		description: "attachments",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS attachments (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            message_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            mime_type TEXT NOT NULL,
+            size INTEGER NOT NULL,
+            data BLOB,
+            path TEXT NOT NULL DEFAULT '',
+            FOREIGN KEY(message_id) REFERENCES messages(id) ON DELETE CASCADE
+        );`,
+			`CREATE INDEX IF NOT EXISTS idx_attachments_message_id ON attachments(message_id);`,
+		},
+	},
+	{
+		version:     11,
+		description: "session trash",
+		columns: []column{
+			{"sessions", "deleted_at", "TEXT"},
+		},
+	},
+	{
+		version:     12,
+		description: "session system prompts",
+		columns: []column{
+			{"sessions", "system_prompt", "TEXT NOT NULL DEFAULT ''"},
+		},
+	},
+	{
+		version:     13,
+		description: "session templates",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS session_templates (
+            name TEXT PRIMARY KEY,
+            data TEXT NOT NULL,
+            updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+        );`,
+		},
+	},
+	{
+		version:     14,
+		description: "tool calls",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS tool_calls (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            message_id INTEGER NOT NULL,
+            position INTEGER NOT NULL,
+            round INTEGER NOT NULL DEFAULT 0,
+            call_id TEXT NOT NULL DEFAULT '',
+            name TEXT NOT NULL,
+            arguments TEXT NOT NULL,
+            result TEXT NOT NULL,
+            FOREIGN KEY(message_id) REFERENCES messages(id) ON DELETE CASCADE
+        );`,
+			`CREATE INDEX IF NOT EXISTS idx_tool_calls_message_id ON tool_calls(message_id);`,
+		},
+	},
+	{
+		version:     15,
+		description: "last active session",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS state (
+            key TEXT PRIMARY KEY,
+            value TEXT NOT NULL
+        );`,
+		},
+	},
+	{
+		version:     16,
+		description: "session summaries",
+		columns: []column{
+			{"sessions", "summary", "TEXT NOT NULL DEFAULT ''"},
+		},
+	},
+	{
+		version:     17,
+		description: "session token totals",
+		columns: []column{
+			{"sessions", "prompt_tokens", "INTEGER NOT NULL DEFAULT 0"},
+			{"sessions", "completion_tokens", "INTEGER NOT NULL DEFAULT 0"},
+		},
+	},
+	{
+		version:     18,
+		description: "session token totals of earlier messages",
+		statements: []string{
+			`UPDATE sessions SET
+            prompt_tokens = (SELECT COALESCE(SUM(prompt_tokens), 0) FROM messages WHERE session_id = sessions.id),
+            completion_tokens = (SELECT COALESCE(SUM(completion_tokens), 0) FROM messages WHERE session_id = sessions.id);`,
+		},
+	},
+	{
+		version:     19,
+		description: "repeated user messages",
+		columns: []column{
+			{"messages", "repeats", "INTEGER NOT NULL DEFAULT 0"},
+		},
+	},
+}
+
+// migrate brings the schema up to the latest migration.
+func (s *Store) migrate() error {
+	ctx := context.Background()
+
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            description TEXT NOT NULL,
+            applied_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+        );`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	current, err := s.schemaVersion(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("the database has schema version %d, but this chatty only knows up to %d; upgrade chatty", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := s.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("apply migration %d (%s): %w", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs m and records it in one transaction, so a failed
+// migration leaves no trace and is tried again on the next start.
+func (s *Store) applyMigration(ctx context.Context, m migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Another process may have migrated the database since migrate looked
+	current, err := s.schemaVersion(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if m.version <= current {
+		return nil
+	}
+
+	for _, stmt := range m.statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	for _, c := range m.columns {
+		if err := s.addColumn(ctx, tx, c.table, c.name, c.definition); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations(version, description) VALUES (?, ?)`, m.version, m.description); err != nil {
+		return fmt.Errorf("record migration: %w", err)
+	}
+	return tx.Commit()
+}
+
+// querier is a database or a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// schemaVersion returns the version of the latest applied migration, 0 for
+// a new database or one created before schema_migrations.
+func (s *Store) schemaVersion(ctx context.Context, q querier) (int, error) {
+	var version int
+	if err := q.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// addColumn adds a column to an existing table unless it is already there.
+func (s *Store) addColumn(ctx context.Context, q querier, table, column, definition string) error {
+	if s.driver == DriverPostgres {
+		if _, err := q.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, column, definition)); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", table, column, err)
+		}
+		return nil
+	}
+
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("inspect %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return fmt.Errorf("inspect %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("inspect %s: %w", table, err)
+	}
+	rows.Close()
+
+	if _, err := q.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
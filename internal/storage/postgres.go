@@ -0,0 +1,147 @@
+//go:build postgres
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// The store's SQL is written for SQLite. This driver wraps pgx and rewrites
+// each statement for Postgres on the way through, so both databases share
+// one implementation.
+
+func init() {
+	sql.Register(postgresDriverName, postgresDriver{stdlib.GetDefaultDriver()})
+}
+
+type postgresDriver struct {
+	driver.Driver
+}
+
+func (d postgresDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresConn{conn}, nil
+}
+
+type postgresConn struct {
+	driver.Conn
+}
+
+func (c *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(postgresQuery(query))
+}
+
+func (c *postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, postgresQuery(query))
+	}
+	return c.Prepare(query)
+}
+
+func (c *postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := c.Conn.(driver.ExecerContext); ok {
+		return execer.ExecContext(ctx, postgresQuery(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if queryer, ok := c.Conn.(driver.QueryerContext); ok {
+		return queryer.QueryContext(ctx, postgresQuery(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *postgresConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *postgresConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *postgresConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *postgresConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue stores booleans as 0 and 1, as SQLite does, so flag
+// columns are integers on both databases.
+func (c *postgresConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if b, ok := nv.Value.(bool); ok {
+		nv.Value = int64(0)
+		if b {
+			nv.Value = int64(1)
+		}
+		return nil
+	}
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+var (
+	// postgresSyntax translates SQLite expressions used in any statement
+	postgresSyntax = strings.NewReplacer(
+		`(strftime('%Y-%m-%dT%H:%M:%SZ','now'))`, `(to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'))`,
+	)
+	// postgresTypes translates the column types of CREATE and ALTER TABLE
+	postgresTypes = strings.NewReplacer(
+		"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+		"INTEGER", "BIGINT",
+		"BLOB", "BYTEA",
+		"REAL", "DOUBLE PRECISION",
+	)
+)
+
+// postgresQuery rewrites a statement written for SQLite for Postgres: ?
+// placeholders become $1, $2 and so on, and SQLite's clock and column types
+// become their Postgres equivalents.
+func postgresQuery(query string) string {
+	query = postgresSyntax.Replace(query)
+	if trimmed := strings.TrimSpace(query); strings.HasPrefix(trimmed, "CREATE TABLE") || strings.HasPrefix(trimmed, "ALTER TABLE") {
+		query = postgresTypes.Replace(query)
+	}
+
+	var b strings.Builder
+	inString := false
+	n := 0
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+			b.WriteRune(r)
+		case r == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxReportedProblems bounds the integrity problems quoted in a DamagedError.
+const maxReportedProblems = 3
+
+// DamagedError is returned by Open when the quick integrity check finds the
+// database damaged. Salvage copies what can still be read.
+type DamagedError struct {
+	Path     string
+	Problems []string
+}
+
+func (e *DamagedError) Error() string {
+	problems := e.Problems
+	if len(problems) > maxReportedProblems {
+		problems = append(problems[:maxReportedProblems:maxReportedProblems], fmt.Sprintf("and %d more", len(e.Problems)-maxReportedProblems))
+	}
+	return fmt.Sprintf("the conversation database %s is damaged (%s); ./chatty db recover salvages the sessions that can still be read",
+		e.Path, strings.Join(problems, "; "))
+}
+
+// quickCheck runs PRAGMA quick_check on a database just opened, so damage is
+// reported when chatty starts rather than as odd failures later.
+func quickCheck(db *sql.DB, dsn string) error {
+	path, _, _ := strings.Cut(dsn, "?")
+
+	rows, err := db.Query(`PRAGMA quick_check`)
+	if err != nil {
+		if damaged(err) {
+			return &DamagedError{Path: path, Problems: []string{err.Error()}}
+		}
+		return fmt.Errorf("check integrity: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("check integrity: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		if damaged(err) {
+			return &DamagedError{Path: path, Problems: append(problems, err.Error())}
+		}
+		return fmt.Errorf("check integrity: %w", err)
+	}
+	if len(problems) > 0 {
+		return &DamagedError{Path: path, Problems: problems}
+	}
+	return nil
+}
+
+// damaged reports whether err is SQLite finding the file unreadable, as
+// opposed to busy or missing.
+func damaged(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "malformed") || strings.Contains(message, "not a database")
+}
+
+// SalvageReport describes what Salvage copied.
+type SalvageReport struct {
+	Sessions int     // Sessions copied with everything that belongs to them
+	Messages int     // Messages of those sessions
+	Lost     []int64 // Sessions that could not be read completely
+}
+
+// sessionTables are copied for each salvaged session, parents first, with
+// the condition that selects the rows of session ?.
+var sessionTables = []struct{ table, where string }{
+	{"sessions", "id = ?"},
+	{"messages", "session_id = ?"},
+	{"attachments", "message_id IN (SELECT id FROM messages WHERE session_id = ?)"},
+	{"tool_calls", "message_id IN (SELECT id FROM messages WHERE session_id = ?)"},
+	{"pinned_messages", "session_id = ?"},
+	{"imported_sessions", "session_id = ?"},
+}
+
+// Salvage copies what can still be read from the damaged SQLite database at
+// path into a new database at dest: each session whose rows all read back,
+// with its messages, attachments, tool calls and pins, and then the snippets,
+// session templates and state. Ids are kept, so encrypted sessions open with
+// their passphrases and /last still points at the same session. Embeddings
+// are left behind; /recall computes them again.
+func Salvage(ctx context.Context, path, dest string) (*SalvageReport, error) {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	dest, err = filepath.Abs(dest)
+	if err != nil {
+		return nil, fmt.Errorf("resolve destination: %w", err)
+	}
+	if dest == resolved {
+		return nil, errors.New("cannot salvage a database onto itself")
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return nil, fmt.Errorf("%s already exists", dest)
+	}
+	if _, err := os.Stat(resolved); err != nil {
+		return nil, err
+	}
+
+	src, err := sql.Open("sqlite", resolved)
+	if err != nil {
+		return nil, fmt.Errorf("open damaged database: %w", err)
+	}
+	defer src.Close()
+	src.SetMaxOpenConns(1)
+
+	target, err := Open(dest)
+	if err != nil {
+		return nil, err
+	}
+	defer target.Close()
+	if err := os.Chmod(dest, 0o600); err != nil {
+		return nil, fmt.Errorf("protect %s: %w", dest, err)
+	}
+	// A fork is kept even when the session it was forked from is lost
+	if _, err := target.db.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return nil, fmt.Errorf("prepare %s: %w", dest, err)
+	}
+
+	// Keep the ids read before any damage stops the listing
+	var ids []int64
+	rows, err := src.QueryContext(ctx, `SELECT id FROM sessions ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	report := &SalvageReport{}
+	for _, id := range ids {
+		messages, err := salvageSession(ctx, src, target.db, id)
+		if err != nil {
+			report.Lost = append(report.Lost, id)
+			continue
+		}
+		report.Sessions++
+		report.Messages += messages
+	}
+
+	for _, table := range []string{"snippets", "session_templates", "state"} {
+		tx, err := target.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := copyRows(ctx, src, tx, table, "1 = 1"); err != nil {
+			tx.Rollback()
+			continue
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := target.db.ExecContext(ctx, `UPDATE sessions SET parent_session_id = NULL
+        WHERE parent_session_id IS NOT NULL AND parent_session_id NOT IN (SELECT id FROM sessions)`); err != nil {
+		return nil, fmt.Errorf("unlink lost parents: %w", err)
+	}
+	return report, nil
+}
+
+// salvageSession copies session id from src to dst in one transaction, so a
+// session is either copied whole or not at all, and returns its number of
+// messages.
+func salvageSession(ctx context.Context, src, dst *sql.DB, id int64) (int, error) {
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	messages := 0
+	for _, t := range sessionTables {
+		n, err := copyRows(ctx, src, tx, t.table, t.where, id)
+		if err != nil {
+			return 0, err
+		}
+		if t.table == "messages" {
+			messages = n
+		}
+	}
+	return messages, tx.Commit()
+}
+
+// copyRows copies the rows of table matching where from src into tx, in the
+// columns both databases have; a table src does not have yet is skipped.
+func copyRows(ctx context.Context, src *sql.DB, tx *sql.Tx, table, where string, args ...any) (int, error) {
+	srcColumns, err := tableColumns(ctx, src, table)
+	if err != nil {
+		return 0, err
+	}
+	dstColumns, err := tableColumns(ctx, tx, table)
+	if err != nil {
+		return 0, err
+	}
+	var columns []string
+	for _, column := range srcColumns {
+		if slices.Contains(dstColumns, column) {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return 0, nil
+	}
+
+	list := strings.Join(columns, ", ")
+	rows, err := src.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE %s`, list, table, where), args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	insert := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, table, list, strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return n, err
+		}
+		if _, err := tx.ExecContext(ctx, insert, values...); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// tableColumns lists the columns of table, none when it does not exist.
+func tableColumns(ctx context.Context, q querier, table string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// Recover replaces the damaged database at path with what Salvage can read
+// from it. The damaged file is kept next to it with a .damaged suffix, whose
+// path is returned. No store may have path open.
+func Recover(ctx context.Context, path string) (string, *SalvageReport, error) {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", nil, err
+	}
+	tmp := resolved + ".recovered"
+	os.Remove(tmp)
+	report, err := Salvage(ctx, resolved, tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return "", nil, err
+	}
+
+	// The write-ahead log belongs to the damaged database and moves with it
+	damagedPath := fmt.Sprintf("%s.damaged-%s", resolved, time.Now().Format("20060102-150405"))
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(resolved+suffix, damagedPath+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(tmp)
+			return "", nil, fmt.Errorf("move damaged database aside: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, resolved); err != nil {
+		return damagedPath, nil, fmt.Errorf("move recovered database into place: %w", err)
+	}
+	return damagedPath, report, nil
+}
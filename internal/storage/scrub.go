@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	chattyErrors "github.com/ZaguanLabs/chatty/internal/errors"
+)
+
+// ForgetLastExchange deletes the last question saved in a session and every
+// message after it, overwriting them on disk. A session left empty is deleted
+// too, since its name is usually taken from the first question. It returns
+// the number of messages that remain.
+func (s *Store) ForgetLastExchange(ctx context.Context, sessionID int64) (int, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("storage not initialised")
+	}
+
+	var remaining int
+	err := s.scrub(ctx, func(tx *sql.Tx) error {
+		var from sql.NullInt64
+		if err := tx.QueryRowContext(ctx, `SELECT MAX(id) FROM messages WHERE session_id = ? AND role = 'user'`, sessionID).Scan(&from); err != nil {
+			return err
+		}
+		if !from.Valid {
+			return errors.New("no saved question to forget")
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE session_id = ? AND id >= ?`, sessionID, from.Int64); err != nil {
+			return err
+		}
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE session_id = ?`, sessionID).Scan(&remaining); err != nil {
+			return err
+		}
+		if remaining == 0 {
+			_, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, sessionID)
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM pinned_messages WHERE session_id = ? AND position >= ?`, sessionID, remaining)
+		return err
+	})
+	if err != nil {
+		return 0, chattyErrors.NewStorageError("forget", fmt.Sprintf("failed to forget the last exchange: %v", err), err)
+	}
+	if remaining == 0 {
+		s.LockSession(sessionID)
+	}
+	return remaining, nil
+}
+
+// scrub runs fn in a transaction with SQLite's secure_delete enabled, so the
+// rows it deletes or rewrites are overwritten rather than left in free pages,
+// then checkpoints the write-ahead log so no copy stays there either. On
+// Postgres fn simply runs in a transaction; old row versions stay on disk
+// until the server vacuums the table.
+func (s *Store) scrub(ctx context.Context, fn func(*sql.Tx) error) error {
+	if s.driver == DriverPostgres {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if _, err := s.db.ExecContext(ctx, `PRAGMA secure_delete = ON`); err != nil {
+		return err
+	}
+	defer s.db.Exec(`PRAGMA secure_delete = OFF`)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Session sort orders for SessionFilter.Sort. Each lists the largest
+// value first.
+const (
+	SortUpdated  = "updated"  // Most recently updated first, pinned sessions before the rest
+	SortCreated  = "created"  // Most recently started first
+	SortMessages = "messages" // Longest first
+)
+
+// SessionFilter narrows and orders the sessions FilterSessions lists. Zero
+// fields do not filter.
+type SessionFilter struct {
+	Limit           int
+	IncludeArchived bool
+	// Name is matched case-insensitively anywhere in the session name.
+	Name string
+	// A session is listed when its time is on or after the After bound and
+	// strictly before the Before bound.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	// Sort is SortUpdated (the default), SortCreated or SortMessages.
+	Sort string
+}
+
+// ValidSessionSort reports whether sort is a known session sort order; the
+// empty string is the default.
+func ValidSessionSort(sort string) bool {
+	switch sort {
+	case "", SortUpdated, SortCreated, SortMessages:
+		return true
+	}
+	return false
+}
+
+// FilterSessions is ListSessions with filters on the name and on when
+// sessions were created and updated, and a choice of sort order.
+func (s *Store) FilterSessions(ctx context.Context, filter SessionFilter) ([]SessionSummary, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+
+	var order string
+	switch filter.Sort {
+	case "", SortUpdated:
+		order = "s.pinned DESC, s.updated_at DESC"
+	case SortCreated:
+		order = "s.created_at DESC, s.id DESC"
+	case SortMessages:
+		order = "message_count DESC, s.updated_at DESC"
+	default:
+		return nil, fmt.Errorf("unknown sort order %q (use %s, %s or %s)", filter.Sort, SortUpdated, SortCreated, SortMessages)
+	}
+
+	conditions := []string{"s.deleted_at IS NULL"}
+	var args []any
+	if !filter.IncludeArchived {
+		conditions = append(conditions, "s.archived = 0")
+	}
+	if filter.Name != "" {
+		conditions = append(conditions, `LOWER(s.name) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(strings.ToLower(filter.Name))+"%")
+	}
+	bounds := []struct {
+		condition string
+		at        time.Time
+	}{
+		{"s.created_at >= ?", filter.CreatedAfter},
+		{"s.created_at < ?", filter.CreatedBefore},
+		{"s.updated_at >= ?", filter.UpdatedAfter},
+		{"s.updated_at < ?", filter.UpdatedBefore},
+	}
+	for _, bound := range bounds {
+		if !bound.at.IsZero() {
+			conditions = append(conditions, bound.condition)
+			args = append(args, bound.at.UTC().Format(timestampLayout))
+		}
+	}
+
+	query := `SELECT s.id, s.name, s.created_at, s.updated_at, COUNT(m.id) AS message_count, s.key_salt IS NOT NULL, COALESCE(s.parent_session_id, 0), s.fork_point, s.pinned, s.archived, COALESCE(s.deleted_at, ''), s.system_prompt, s.summary, s.prompt_tokens, s.completion_tokens FROM sessions s LEFT JOIN messages m ON m.session_id = s.id WHERE ` +
+		strings.Join(conditions, " AND ") + ` GROUP BY s.id ORDER BY ` + order
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+	return s.scanSessionSummaries(rows)
+}
+
+// escapeLike escapes the LIKE wildcards in s, with \ as the escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
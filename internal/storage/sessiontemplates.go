@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxSessionTemplateBytes bounds a session template as saved.
+const maxSessionTemplateBytes = 1 << 20
+
+// SessionTemplate is the start of a conversation saved under a name: a
+// system prompt, messages to begin with and model settings. New sessions are
+// started from it with /new-from or ./chatty new --template.
+type SessionTemplate struct {
+	Name         string            `json:"-"`
+	SystemPrompt string            `json:"system_prompt,omitempty"`
+	Messages     []TemplateMessage `json:"messages,omitempty"`
+
+	// Model settings; empty values leave the configured ones in place
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Length      string   `json:"length,omitempty"` // Response length preset
+	Stop        []string `json:"stop"`             // nil for model.stop
+
+	UpdatedAt time.Time `json:"-"`
+}
+
+// TemplateMessage is a message a session template begins with.
+type TemplateMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ValidateSessionTemplateName checks that name can be used for a session
+// template; the rules are those of snippet names.
+func ValidateSessionTemplateName(name string) error {
+	if !snippetNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid template name %q: use up to 64 letters, digits, '.', '-' and '_'", name)
+	}
+	return nil
+}
+
+// SaveSessionTemplate stores template under its name, replacing any template
+// of that name.
+func (s *Store) SaveSessionTemplate(ctx context.Context, template *SessionTemplate) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	if err := ValidateSessionTemplateName(template.Name); err != nil {
+		return err
+	}
+	if template.SystemPrompt != "" {
+		if err := validateMessageContent(template.SystemPrompt); err != nil {
+			return fmt.Errorf("system prompt: %w", err)
+		}
+	}
+	for i, message := range template.Messages {
+		if message.Role != "user" && message.Role != "assistant" {
+			return fmt.Errorf("message %d: invalid role %q", i+1, message.Role)
+		}
+		if err := validateMessageContent(message.Content); err != nil {
+			return fmt.Errorf("message %d: %w", i+1, err)
+		}
+	}
+
+	data, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("encode template: %w", err)
+	}
+	if len(data) > maxSessionTemplateBytes {
+		return fmt.Errorf("template is too large (%d bytes, limit %d)", len(data), maxSessionTemplateBytes)
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO session_templates (name, data) VALUES (?, ?)
+        ON CONFLICT(name) DO UPDATE SET data = excluded.data, updated_at = (strftime('%Y-%m-%dT%H:%M:%SZ','now'))`, template.Name, string(data))
+	if err != nil {
+		return fmt.Errorf("save template: %w", err)
+	}
+	return nil
+}
+
+// GetSessionTemplate returns the session template saved under name.
+func (s *Store) GetSessionTemplate(ctx context.Context, name string) (*SessionTemplate, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+
+	var data, updated string
+	err := s.db.QueryRowContext(ctx, `SELECT data, updated_at FROM session_templates WHERE name = ?`, name).Scan(&data, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("template %q not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select template: %w", err)
+	}
+	return decodeSessionTemplate(name, data, updated)
+}
+
+// ListSessionTemplates returns all session templates ordered by name.
+func (s *Store) ListSessionTemplates(ctx context.Context) ([]SessionTemplate, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT name, data, updated_at FROM session_templates ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []SessionTemplate
+	for rows.Next() {
+		var name, data, updated string
+		if err := rows.Scan(&name, &data, &updated); err != nil {
+			return nil, fmt.Errorf("scan template: %w", err)
+		}
+		template, err := decodeSessionTemplate(name, data, updated)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *template)
+	}
+	return templates, rows.Err()
+}
+
+// DeleteSessionTemplate removes the session template saved under name.
+func (s *Store) DeleteSessionTemplate(ctx context.Context, name string) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM session_templates WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("delete template: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("template %q not found", name)
+	}
+	return nil
+}
+
+func decodeSessionTemplate(name, data, updated string) (*SessionTemplate, error) {
+	var template SessionTemplate
+	if err := json.Unmarshal([]byte(data), &template); err != nil {
+		return nil, fmt.Errorf("decode template %q: %w", name, err)
+	}
+	template.Name = name
+	var err error
+	if template.UpdatedAt, err = parseTimestamp(updated); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// maxSnippetBytes bounds the content of a context snippet.
+const maxSnippetBytes = 1 << 20
+
+var snippetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Snippet is a named block of context, such as an API spec or a style
+// guide, saved once and added to any conversation with /use.
+type Snippet struct {
+	Name      string
+	Content   string
+	UpdatedAt time.Time
+}
+
+// ValidateSnippetName checks that name can be used for a snippet: up to 64
+// letters, digits, dots, dashes and underscores.
+func ValidateSnippetName(name string) error {
+	if !snippetNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid snippet name %q: use up to 64 letters, digits, '.', '-' and '_'", name)
+	}
+	return nil
+}
+
+// SaveSnippet stores content under name, replacing any snippet of that name.
+func (s *Store) SaveSnippet(ctx context.Context, name, content string) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	if err := ValidateSnippetName(name); err != nil {
+		return err
+	}
+	if len(content) > maxSnippetBytes {
+		return fmt.Errorf("snippet is too large (%d bytes, limit %d)", len(content), maxSnippetBytes)
+	}
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO snippets (name, content) VALUES (?, ?)
+        ON CONFLICT(name) DO UPDATE SET content = excluded.content, updated_at = (strftime('%Y-%m-%dT%H:%M:%SZ','now'))`, name, content)
+	if err != nil {
+		return fmt.Errorf("save snippet: %w", err)
+	}
+	return nil
+}
+
+// GetSnippet returns the snippet saved under name.
+func (s *Store) GetSnippet(ctx context.Context, name string) (*Snippet, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+
+	var snippet Snippet
+	var updated string
+	err := s.db.QueryRowContext(ctx, `SELECT name, content, updated_at FROM snippets WHERE name = ?`, name).Scan(&snippet.Name, &snippet.Content, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("snippet %q not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select snippet: %w", err)
+	}
+	if snippet.UpdatedAt, err = parseTimestamp(updated); err != nil {
+		return nil, err
+	}
+	return &snippet, nil
+}
+
+// ListSnippets returns all snippets ordered by name.
+func (s *Store) ListSnippets(ctx context.Context) ([]Snippet, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT name, content, updated_at FROM snippets ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list snippets: %w", err)
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+	for rows.Next() {
+		var snippet Snippet
+		var updated string
+		if err := rows.Scan(&snippet.Name, &snippet.Content, &updated); err != nil {
+			return nil, fmt.Errorf("scan snippet: %w", err)
+		}
+		if snippet.UpdatedAt, err = parseTimestamp(updated); err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, snippet)
+	}
+	return snippets, rows.Err()
+}
+
+// DeleteSnippet removes the snippet saved under name.
+func (s *Store) DeleteSnippet(ctx context.Context, name string) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM snippets WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("delete snippet: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("snippet %q not found", name)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// lastSessionKey is the state entry holding the last active session.
+const lastSessionKey = "last_session"
+
+// SetLastSession records id as the session most recently worked in, for
+// LastSession.
+func (s *Store) SetLastSession(ctx context.Context, id int64) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO state (key, value) VALUES (?, ?)
+        ON CONFLICT(key) DO UPDATE SET value = excluded.value`, lastSessionKey, strconv.FormatInt(id, 10))
+	if err != nil {
+		return fmt.Errorf("save last session: %w", err)
+	}
+	return nil
+}
+
+// LastSession returns the session recorded by SetLastSession, or 0 when
+// none was, or when it has since been deleted or moved to the trash.
+func (s *Store) LastSession(ctx context.Context) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("storage not initialised")
+	}
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, `SELECT s.id FROM state t JOIN sessions s ON CAST(t.value AS INTEGER) = s.id
+        WHERE t.key = ? AND s.deleted_at IS NULL`, lastSessionKey).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("select last session: %w", err)
+	}
+	return id, nil
+}
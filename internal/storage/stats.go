@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Stats summarises the saved history. Sessions in the trash no longer count;
+// archived ones do.
+type Stats struct {
+	Sessions         int64
+	ArchivedSessions int64
+
+	Messages  int64
+	Questions int64 // Messages of the user
+	Answers   int64 // Messages of the assistant
+
+	// Tokens as reported by the provider with each answer
+	PromptTokens     int64
+	CompletionTokens int64
+
+	Models []ModelUsage  // Most answers first
+	Months []PeriodUsage // Oldest first
+}
+
+// ModelUsage is how much one model was used.
+type ModelUsage struct {
+	Model            string
+	Answers          int64
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+// PeriodUsage is the activity of one period, such as a month.
+type PeriodUsage struct {
+	Period   string // "2006-01" for a month
+	Messages int64
+	Tokens   int64
+}
+
+// Stats aggregates sessions, messages, tokens and the usage of each model,
+// in total and by month.
+func (s *Store) Stats(ctx context.Context) (*Stats, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+
+	stats := &Stats{}
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(CASE WHEN archived <> 0 THEN 1 ELSE 0 END), 0) FROM sessions WHERE deleted_at IS NULL`).
+		Scan(&stats.Sessions, &stats.ArchivedSessions)
+	if err != nil {
+		return nil, fmt.Errorf("count sessions: %w", err)
+	}
+
+	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*),
+            COALESCE(SUM(CASE WHEN role = 'user' THEN 1 ELSE 0 END), 0),
+            COALESCE(SUM(CASE WHEN role = 'assistant' THEN 1 ELSE 0 END), 0),
+            COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0)
+        FROM messages WHERE session_id IN (SELECT id FROM sessions WHERE deleted_at IS NULL)`).
+		Scan(&stats.Messages, &stats.Questions, &stats.Answers, &stats.PromptTokens, &stats.CompletionTokens)
+	if err != nil {
+		return nil, fmt.Errorf("count messages: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT model, COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0)
+        FROM messages WHERE role = 'assistant' AND model <> ''
+            AND session_id IN (SELECT id FROM sessions WHERE deleted_at IS NULL)
+        GROUP BY model ORDER BY COUNT(*) DESC, model`)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate models: %w", err)
+	}
+	for rows.Next() {
+		var usage ModelUsage
+		if err := rows.Scan(&usage.Model, &usage.Answers, &usage.PromptTokens, &usage.CompletionTokens); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("aggregate models: %w", err)
+		}
+		stats.Models = append(stats.Models, usage)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("aggregate models: %w", err)
+	}
+
+	// Timestamps are stored as 2006-01-02T15:04:05Z, so the month is a prefix
+	rows, err = s.db.QueryContext(ctx, `SELECT substr(created_at, 1, 7), COUNT(*), COALESCE(SUM(prompt_tokens + completion_tokens), 0)
+        FROM messages WHERE session_id IN (SELECT id FROM sessions WHERE deleted_at IS NULL)
+        GROUP BY substr(created_at, 1, 7) ORDER BY substr(created_at, 1, 7)`)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate months: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var usage PeriodUsage
+		if err := rows.Scan(&usage.Period, &usage.Messages, &usage.Tokens); err != nil {
+			return nil, fmt.Errorf("aggregate months: %w", err)
+		}
+		stats.Months = append(stats.Months, usage)
+	}
+	return stats, rows.Err()
+}
@@ -3,11 +3,15 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -31,15 +35,70 @@ const (
 // Store wraps access to the persistent conversation database.
 type Store struct {
 	db            *sql.DB
+	driver        string // DriverSQLite or DriverPostgres
 	preparedStmts map[string]*sql.Stmt
 	preparedMutex sync.RWMutex
+
+	// Keys of the sensitive sessions unlocked so far, by session id
+	keys      map[int64][]byte
+	keysMutex sync.Mutex
+
+	// dedupe counts a user message identical to the previous one in its
+	// session instead of storing it again (storage.dedupe_messages)
+	dedupe bool
 }
 
 // Message represents a persisted chat message.
 type Message struct {
+	// ID identifies a loaded message; it is ignored when appending.
+	ID        int64
 	Role      string
 	Content   string
 	CreatedAt time.Time
+	// Interrupted marks the partial text of an answer whose stream was
+	// cancelled or timed out.
+	Interrupted bool
+	// Meta describes the request that produced an assistant message.
+	Meta MessageMeta
+	// Attachments are the files sent with the message.
+	Attachments []Attachment
+	// ToolCalls are the tools called while an assistant message was
+	// produced, in the order they ran.
+	ToolCalls []ToolCallRecord
+	// Repeats counts the times a user message was sent again right after
+	// itself and not stored again (storage.dedupe_messages).
+	Repeats int
+}
+
+// MessageMeta records the model that produced an assistant message, the
+// temperature it was asked for and the tokens used. Unknown values are left
+// zero, or nil for Temperature.
+type MessageMeta struct {
+	Model            string   `json:"model,omitempty"`
+	Temperature      *float64 `json:"temperature,omitempty"`
+	PromptTokens     int      `json:"prompt_tokens,omitempty"`
+	CompletionTokens int      `json:"completion_tokens,omitempty"`
+}
+
+// IsZero reports whether nothing is known about the request.
+func (m MessageMeta) IsZero() bool {
+	return m.Model == "" && m.Temperature == nil && m.PromptTokens == 0 && m.CompletionTokens == 0
+}
+
+// String describes the request briefly, e.g.
+// "gpt-4o · temperature 0.7 · 120 prompt + 80 completion tokens".
+func (m MessageMeta) String() string {
+	var parts []string
+	if m.Model != "" {
+		parts = append(parts, m.Model)
+	}
+	if m.Temperature != nil {
+		parts = append(parts, fmt.Sprintf("temperature %s", strconv.FormatFloat(*m.Temperature, 'f', -1, 64)))
+	}
+	if m.PromptTokens > 0 || m.CompletionTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d prompt + %d completion tokens", m.PromptTokens, m.CompletionTokens))
+	}
+	return strings.Join(parts, " · ")
 }
 
 // SessionSummary describes a saved conversation.
@@ -49,6 +108,29 @@ type SessionSummary struct {
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 	MessageCount int
+	// Sensitive sessions keep their messages encrypted; see EncryptSession.
+	Sensitive bool
+	// A fork records the session it was copied from and how many of its
+	// messages were copied; both are 0 otherwise. See ForkSession.
+	ParentID  int64
+	ForkPoint int
+	// Pinned sessions are listed first.
+	Pinned bool
+	// Archived sessions are left out of ListSessions; see ListAllSessions.
+	Archived bool
+	// DeletedAt is when the session was moved to the trash, zero otherwise;
+	// see DeleteSession.
+	DeletedAt time.Time
+	// SystemPrompt is sent first with every request of the session, empty
+	// when there is none; see SetSessionSystemPrompt.
+	SystemPrompt string
+	// Summary is a one-line gist of the conversation, empty until one is
+	// saved; see SetSessionSummary.
+	Summary string
+	// Tokens used by the requests whose answers were saved in the session,
+	// kept when messages are forgotten; see AppendMessage.
+	PromptTokens     int
+	CompletionTokens int
 }
 
 // Transcript bundles a session summary with its messages.
@@ -57,26 +139,58 @@ type Transcript struct {
 	Messages []Message
 }
 
+// StoredMessage identifies a persisted message across sessions.
+type StoredMessage struct {
+	ID        int64
+	SessionID int64
+	Role      string
+	Content   string
+}
+
+// MessageEmbedding pairs a stored message with its embedding vector.
+type MessageEmbedding struct {
+	StoredMessage
+	Vector []float32
+}
+
 // PaginationOptions holds pagination parameters for loading messages.
 type PaginationOptions struct {
 	Page     int // 1-based page number
 	PageSize int // Number of messages per page
 }
 
+// defaultPageSize is how many of the most recent messages are loaded for a
+// long session; LoadMessagesBefore fetches the earlier ones on demand.
+const defaultPageSize = 50
+
 // Open initialises the storage layer, creating the database if necessary.
 func Open(path string) (*Store, error) {
 	return OpenWithPool(path, 1) // Pool size ignored
 }
 
+// MemoryPath as the storage path keeps the history in memory for the life of
+// the store, so nothing is written to disk.
+const MemoryPath = ":memory:"
+
+// IsMemoryPath reports whether path selects an in-memory history.
+func IsMemoryPath(path string) bool {
+	return strings.TrimSpace(path) == MemoryPath
+}
+
 // OpenWithPool creates a store. maxConnections parameter is ignored in favor of safe single-connection usage.
 func OpenWithPool(path string, maxConnections int) (*Store, error) {
-	resolved, err := resolvePath(path)
-	if err != nil {
-		return nil, err
-	}
+	// An in-memory database lives as long as its connection, which the
+	// single-connection pool below keeps open until Close
+	dsn := MemoryPath
+	if !IsMemoryPath(path) {
+		resolved, err := resolvePath(path)
+		if err != nil {
+			return nil, err
+		}
 
-	// Use connection string parameters for timeout and WAL
-	dsn := fmt.Sprintf("%s?_busy_timeout=5000&_journal_mode=WAL", resolved)
+		// Use connection string parameters for timeout and WAL
+		dsn = fmt.Sprintf("%s?_busy_timeout=5000&_journal_mode=WAL", resolved)
+	}
 	
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
@@ -93,9 +207,23 @@ func OpenWithPool(path string, maxConnections int) (*Store, error) {
 		db.Close()
 		return nil, chattyErrors.NewStorageError("setup", fmt.Sprintf("failed to enable foreign keys: %v", err), err)
 	}
+	if !IsMemoryPath(path) {
+		if err := quickCheck(db, dsn); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return newStore(db, DriverSQLite)
+}
 
+// newStore brings the schema of db up to date and prepares the statements.
+// It closes db on failure.
+func newStore(db *sql.DB, driver string) (*Store, error) {
 	store := &Store{
-		db: db,
+		db:     db,
+		driver: driver,
+		keys:   make(map[int64][]byte),
 	}
 
 	if err := store.migrate(); err != nil {
@@ -116,16 +244,24 @@ func (s *Store) initializePreparedStatements() error {
 	s.preparedStmts = make(map[string]*sql.Stmt)
 
 	stmts := map[string]string{
-		"createSession":        `INSERT INTO sessions(name) VALUES (?)`,
+		"createSession":        `INSERT INTO sessions(name) VALUES (?) RETURNING id`,
 		"updateSessionName":    `UPDATE sessions SET name = ?, updated_at = (strftime('%Y-%m-%dT%H:%M:%SZ','now')) WHERE id = ?`,
-		"appendMessage":        `INSERT INTO messages(session_id, role, content) VALUES (?, ?, ?)`,
-		"touchSession":         `UPDATE sessions SET updated_at = (strftime('%Y-%m-%dT%H:%M:%SZ','now')) WHERE id = ?`,
-		"listSessions":         `SELECT s.id, s.name, s.created_at, s.updated_at, COUNT(m.id) AS message_count FROM sessions s LEFT JOIN messages m ON m.session_id = s.id GROUP BY s.id ORDER BY s.updated_at DESC LIMIT ?`,
-		"listSessionsNoLimit":  `SELECT s.id, s.name, s.created_at, s.updated_at, COUNT(m.id) AS message_count FROM sessions s LEFT JOIN messages m ON m.session_id = s.id GROUP BY s.id ORDER BY s.updated_at DESC`,
-		"getSession":           `SELECT s.id, s.name, s.created_at, s.updated_at, COUNT(m.id) AS message_count FROM sessions s LEFT JOIN messages m ON m.session_id = s.id WHERE s.id = ? GROUP BY s.id`,
-		"getMessages":          `SELECT role, content, created_at FROM messages WHERE session_id = ? ORDER BY id ASC`,
-		"getMessagesPaginated": `SELECT role, content, created_at FROM messages WHERE session_id = ? ORDER BY id DESC LIMIT ? OFFSET ?`,
+		"appendMessage":        `INSERT INTO messages(session_id, role, content, interrupted, model, temperature, prompt_tokens, completion_tokens) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		"touchSession":         `UPDATE sessions SET updated_at = (strftime('%Y-%m-%dT%H:%M:%SZ','now')), prompt_tokens = prompt_tokens + ?, completion_tokens = completion_tokens + ? WHERE id = ?`,
+		"listSessions":         `SELECT s.id, s.name, s.created_at, s.updated_at, COUNT(m.id) AS message_count, s.key_salt IS NOT NULL, COALESCE(s.parent_session_id, 0), s.fork_point, s.pinned, s.archived, COALESCE(s.deleted_at, ''), s.system_prompt, s.summary, s.prompt_tokens, s.completion_tokens FROM sessions s LEFT JOIN messages m ON m.session_id = s.id WHERE s.archived <= ? AND s.deleted_at IS NULL GROUP BY s.id ORDER BY s.pinned DESC, s.updated_at DESC LIMIT ?`,
+		"listSessionsNoLimit":  `SELECT s.id, s.name, s.created_at, s.updated_at, COUNT(m.id) AS message_count, s.key_salt IS NOT NULL, COALESCE(s.parent_session_id, 0), s.fork_point, s.pinned, s.archived, COALESCE(s.deleted_at, ''), s.system_prompt, s.summary, s.prompt_tokens, s.completion_tokens FROM sessions s LEFT JOIN messages m ON m.session_id = s.id WHERE s.archived <= ? AND s.deleted_at IS NULL GROUP BY s.id ORDER BY s.pinned DESC, s.updated_at DESC`,
+		"getSession":           `SELECT s.id, s.name, s.created_at, s.updated_at, COUNT(m.id) AS message_count, s.key_salt IS NOT NULL, COALESCE(s.parent_session_id, 0), s.fork_point, s.pinned, s.archived, COALESCE(s.deleted_at, ''), s.system_prompt, s.summary, s.prompt_tokens, s.completion_tokens FROM sessions s LEFT JOIN messages m ON m.session_id = s.id WHERE s.id = ? GROUP BY s.id`,
+		"listDeletedSessions":  `SELECT s.id, s.name, s.created_at, s.updated_at, COUNT(m.id) AS message_count, s.key_salt IS NOT NULL, COALESCE(s.parent_session_id, 0), s.fork_point, s.pinned, s.archived, COALESCE(s.deleted_at, ''), s.system_prompt, s.summary, s.prompt_tokens, s.completion_tokens FROM sessions s LEFT JOIN messages m ON m.session_id = s.id WHERE s.deleted_at IS NOT NULL GROUP BY s.id ORDER BY s.deleted_at DESC`,
+		"getMessages":          `SELECT id, role, content, created_at, interrupted, model, temperature, prompt_tokens, completion_tokens, repeats FROM messages WHERE session_id = ? ORDER BY id ASC`,
+		"getMessagesPaginated": `SELECT id, role, content, created_at, interrupted, model, temperature, prompt_tokens, completion_tokens, repeats FROM messages WHERE session_id = ? ORDER BY id DESC LIMIT ? OFFSET ?`,
+		"getMessagesBefore":    `SELECT id, role, content, created_at, interrupted, model, temperature, prompt_tokens, completion_tokens, repeats FROM messages WHERE session_id = ? AND id < ? ORDER BY id DESC LIMIT ?`,
 		"getMessageCount":      `SELECT COUNT(*) FROM messages WHERE session_id = ?`,
+		"pinMessage":           `INSERT INTO pinned_messages(session_id, position) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+		"unpinMessage":         `DELETE FROM pinned_messages WHERE session_id = ? AND position = ?`,
+		"listPinnedMessages":   `SELECT position FROM pinned_messages WHERE session_id = ? ORDER BY position ASC`,
+		"listUnembedded":       `SELECT m.id, m.session_id, m.role, m.content FROM messages m JOIN sessions s ON s.id = m.session_id LEFT JOIN message_embeddings e ON e.message_id = m.id AND e.model = ? WHERE e.message_id IS NULL AND s.key_salt IS NULL AND s.deleted_at IS NULL AND m.role IN ('user', 'assistant') ORDER BY m.id DESC LIMIT ?`,
+		"saveEmbedding":        `INSERT INTO message_embeddings(message_id, model, vector) VALUES (?, ?, ?) ON CONFLICT(message_id) DO UPDATE SET model = excluded.model, vector = excluded.vector`,
+		"listEmbeddings":       `SELECT m.id, m.session_id, m.role, m.content, e.vector FROM message_embeddings e JOIN messages m ON m.id = e.message_id JOIN sessions s ON s.id = m.session_id WHERE e.model = ? AND s.key_salt IS NULL AND s.deleted_at IS NULL`,
 	}
 
 	for name, query := range stmts {
@@ -157,6 +293,11 @@ func (s *Store) Close() error {
 	s.preparedStmts = nil
 	s.preparedMutex.Unlock()
 
+	// Forget the keys of unlocked sessions
+	s.keysMutex.Lock()
+	clear(s.keys)
+	s.keysMutex.Unlock()
+
 	// Close main database connection
 	if s.db != nil {
 		if err := s.db.Close(); err != nil && firstError == nil {
@@ -179,6 +320,12 @@ func (s *Store) AppendMessagesBatch(ctx context.Context, sessionID int64, messag
 		return nil // Nothing to do
 	}
 
+	// Look up the key first: the transaction holds the only connection
+	key, err := s.sessionKey(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
 	// Use main connection directly
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -187,32 +334,57 @@ func (s *Store) AppendMessagesBatch(ctx context.Context, sessionID int64, messag
 	defer tx.Rollback()
 
 	// Prepare statements within transaction
-	appendStmt, err := tx.PrepareContext(ctx, "INSERT INTO messages(session_id, role, content) VALUES (?, ?, ?)")
+	appendStmt, err := tx.PrepareContext(ctx, "INSERT INTO messages(session_id, role, content, interrupted, model, temperature, prompt_tokens, completion_tokens) VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id")
 	if err != nil {
 		return chattyErrors.NewStorageError("batch", fmt.Sprintf("failed to prepare append statement: %v", err), err)
 	}
 	defer appendStmt.Close()
 
-	touchStmt, err := tx.PrepareContext(ctx, "UPDATE sessions SET updated_at = (strftime('%Y-%m-%dT%H:%M:%SZ','now')) WHERE id = ?")
+	touchStmt, err := tx.PrepareContext(ctx, "UPDATE sessions SET updated_at = (strftime('%Y-%m-%dT%H:%M:%SZ','now')), prompt_tokens = prompt_tokens + ?, completion_tokens = completion_tokens + ? WHERE id = ?")
 	if err != nil {
 		return chattyErrors.NewStorageError("batch", fmt.Sprintf("failed to prepare touch statement: %v", err), err)
 	}
 	defer touchStmt.Close()
 
 	// Insert all messages
+	var promptTokens, completionTokens int
 	for _, message := range messages {
 		if strings.TrimSpace(message.Role) == "" {
 			return chattyErrors.NewValidationError("message.role", "cannot be empty", message.Role, nil)
 		}
 
-		_, err := appendStmt.ExecContext(ctx, sessionID, message.Role, message.Content)
+		if s.dedupe && message.Role == "user" && len(message.Attachments) == 0 {
+			repeated, err := s.countRepeat(ctx, tx, key, sessionID, message.Content)
+			if err != nil {
+				return chattyErrors.NewStorageError("batch", fmt.Sprintf("failed to look for a repeated message: %v", err), err)
+			}
+			if repeated {
+				continue
+			}
+		}
+
+		content, err := s.messageContent(key, sessionID, message.Content)
+		if err != nil {
+			return err
+		}
+		var messageID int64
+		err = appendStmt.QueryRowContext(ctx, sessionID, message.Role, content, message.Interrupted,
+			message.Meta.Model, message.Meta.Temperature, message.Meta.PromptTokens, message.Meta.CompletionTokens).Scan(&messageID)
 		if err != nil {
 			return chattyErrors.NewStorageError("batch", fmt.Sprintf("failed to insert message: %v", err), err)
 		}
+		if err := insertAttachments(ctx, tx, key, sessionID, messageID, message.Attachments); err != nil {
+			return chattyErrors.NewStorageError("batch", fmt.Sprintf("failed to insert attachments: %v", err), err)
+		}
+		if err := insertToolCalls(ctx, tx, key, sessionID, messageID, message.ToolCalls); err != nil {
+			return chattyErrors.NewStorageError("batch", fmt.Sprintf("failed to insert tool calls: %v", err), err)
+		}
+		promptTokens += message.Meta.PromptTokens
+		completionTokens += message.Meta.CompletionTokens
 	}
 
-	// Touch session to update timestamp
-	if _, err := touchStmt.ExecContext(ctx, sessionID); err != nil {
+	// Touch session to update timestamp and token totals
+	if _, err := touchStmt.ExecContext(ctx, promptTokens, completionTokens, sessionID); err != nil {
 		return chattyErrors.NewStorageError("batch", fmt.Sprintf("failed to touch session: %v", err), err)
 	}
 
@@ -224,6 +396,35 @@ func (s *Store) AppendMessagesBatch(ctx context.Context, sessionID int64, messag
 	return nil
 }
 
+// countRepeat reports whether content repeats the last user message of the
+// session, and if so counts the repeat on that message.
+func (s *Store) countRepeat(ctx context.Context, tx *sql.Tx, key []byte, sessionID int64, content string) (bool, error) {
+	var id int64
+	var previous string
+	err := tx.QueryRowContext(ctx, `SELECT id, content FROM messages WHERE session_id = ? AND role = 'user' ORDER BY id DESC LIMIT 1`, sessionID).Scan(&id, &previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if key != nil {
+		if previous, err = openContent(key, sessionID, previous); err != nil {
+			return false, err
+		}
+	}
+	// Attachments make a message different even with the same text
+	var attachments int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM attachments WHERE message_id = ?`, id).Scan(&attachments); err != nil {
+		return false, err
+	}
+	if previous != content || attachments > 0 {
+		return false, nil
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE messages SET repeats = repeats + 1 WHERE id = ?`, id)
+	return err == nil, err
+}
+
 // SaveMessagesWithRetry saves messages with automatic retry on failure
 func (s *Store) SaveMessagesWithRetry(ctx context.Context, sessionID int64, messages []Message, maxRetries int) error {
 	var lastErr error
@@ -247,34 +448,6 @@ func (s *Store) SaveMessagesWithRetry(ctx context.Context, sessionID int64, mess
 	return chattyErrors.NewStorageError("batch", fmt.Sprintf("failed after %d retries: %v", maxRetries, lastErr), lastErr)
 }
 
-func (s *Store) migrate() error {
-	stmts := []string{
-		`CREATE TABLE IF NOT EXISTS sessions (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            name TEXT NOT NULL,
-            created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
-            updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
-        );`,
-		`CREATE TABLE IF NOT EXISTS messages (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            session_id INTEGER NOT NULL,
-            role TEXT NOT NULL,
-            content TEXT NOT NULL,
-            created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
-            FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE
-        );`,
-		`CREATE INDEX IF NOT EXISTS idx_messages_session_id ON messages(session_id);`,
-	}
-
-	for _, stmt := range stmts {
-		if _, err := s.db.Exec(stmt); err != nil {
-			return fmt.Errorf("apply migration: %w", err)
-		}
-	}
-
-	return nil
-}
-
 // getPreparedStmt safely retrieves a prepared statement.
 func (s *Store) getPreparedStmt(name string) (*sql.Stmt, error) {
 	s.preparedMutex.RLock()
@@ -314,16 +487,11 @@ func (s *Store) CreateSession(ctx context.Context, name string) (int64, error) {
 		return 0, err
 	}
 
-	res, err := stmt.ExecContext(ctx, title)
-	if err != nil {
+	var id int64
+	if err := stmt.QueryRowContext(ctx, title).Scan(&id); err != nil {
 		return 0, fmt.Errorf("insert session: %w", err)
 	}
 
-	id, err := res.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("resolve session id: %w", err)
-	}
-
 	return id, nil
 }
 
@@ -386,41 +554,155 @@ func (s *Store) AppendMessage(ctx context.Context, sessionID int64, message Mess
 	// sanitizedRole := sanitizeString(message.Role, maxRoleLength)
 	// sanitizedContent := sanitizeString(message.Content, maxMessageLength)
 
+	// The message, its attachments and its tool calls are written together,
+	// and a repeated user message is looked for in the same transaction
+	if len(message.Attachments) > 0 || len(message.ToolCalls) > 0 || (s.dedupe && message.Role == "user") {
+		return s.AppendMessagesBatch(ctx, sessionID, []Message{message})
+	}
+
+	key, err := s.sessionKey(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	content, err := s.messageContent(key, sessionID, message.Content)
+	if err != nil {
+		return err
+	}
+
 	// Use prepared statement for appending message
 	stmt, err := s.getPreparedStmt("appendMessage")
 	if err != nil {
 		return err
 	}
 
-	if _, err := stmt.ExecContext(ctx, sessionID, message.Role, message.Content); err != nil {
+	if _, err := stmt.ExecContext(ctx, sessionID, message.Role, content, message.Interrupted,
+		message.Meta.Model, message.Meta.Temperature, message.Meta.PromptTokens, message.Meta.CompletionTokens); err != nil {
 		return fmt.Errorf("insert message: %w", err)
 	}
 
-	// Touch session to update updated_at timestamp
+	// Touch session to update updated_at timestamp and token totals
 	touchStmt, err := s.getPreparedStmt("touchSession")
 	if err != nil {
 		return err
 	}
 
-	if _, err := touchStmt.ExecContext(ctx, sessionID); err != nil {
+	if _, err := touchStmt.ExecContext(ctx, message.Meta.PromptTokens, message.Meta.CompletionTokens, sessionID); err != nil {
 		return fmt.Errorf("touch session: %w", err)
 	}
 
 	return nil
 }
 
-// ListSessions returns stored conversations ordered by most recent activity.
+// SetSessionPinned pins a session to the top of ListSessions, or unpins it.
+func (s *Store) SetSessionPinned(ctx context.Context, id int64, pinned bool) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE sessions SET pinned = ? WHERE id = ?`, pinned, id)
+	if err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("session %d not found", id)
+	}
+	return nil
+}
+
+// SetSessionSystemPrompt sets the system prompt of a session; an empty
+// prompt removes it. Unlike the messages, it is not encrypted in sensitive
+// sessions.
+func (s *Store) SetSessionSystemPrompt(ctx context.Context, id int64, prompt string) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	if prompt != "" {
+		if err := validateMessageContent(prompt); err != nil {
+			return err
+		}
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE sessions SET system_prompt = ? WHERE id = ?`, prompt, id)
+	if err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("session %d not found", id)
+	}
+	return nil
+}
+
+// SetSessionSummary saves a one-line summary of a session, shown by /list;
+// an empty summary removes it. It would be stored in the clear, so
+// sensitive sessions are refused.
+func (s *Store) SetSessionSummary(ctx context.Context, id int64, summary string) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	if summary != "" {
+		if err := validateMessageContent(summary); err != nil {
+			return err
+		}
+		sensitive, err := s.IsSessionSensitive(ctx, id)
+		if err != nil {
+			return err
+		}
+		if sensitive {
+			return fmt.Errorf("session %d is encrypted; its summary would be stored in the clear", id)
+		}
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE sessions SET summary = ? WHERE id = ?`, summary, id)
+	if err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("session %d not found", id)
+	}
+	return nil
+}
+
+// SetSessionArchived archives a session, hiding it from ListSessions, or
+// restores it.
+func (s *Store) SetSessionArchived(ctx context.Context, id int64, archived bool) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE sessions SET archived = ? WHERE id = ?`, archived, id)
+	if err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("session %d not found", id)
+	}
+	return nil
+}
+
+// ListSessions returns stored conversations that are not archived, pinned
+// ones first, ordered by most recent activity.
 func (s *Store) ListSessions(ctx context.Context, limit int) ([]SessionSummary, error) {
+	return s.listSessions(ctx, limit, false)
+}
+
+// ListAllSessions is ListSessions including archived sessions.
+func (s *Store) ListAllSessions(ctx context.Context, limit int) ([]SessionSummary, error) {
+	return s.listSessions(ctx, limit, true)
+}
+
+func (s *Store) listSessions(ctx context.Context, limit int, includeArchived bool) ([]SessionSummary, error) {
 	if s == nil || s.db == nil {
 		return nil, errors.New("storage not initialised")
 	}
 
+	// Sessions with archived <= maxArchived are listed
+	maxArchived := 0
+	if includeArchived {
+		maxArchived = 1
+	}
+
 	if limit > 0 {
 		stmt, err := s.getPreparedStmt("listSessions")
 		if err != nil {
 			return nil, err
 		}
-		rows, err := stmt.QueryContext(ctx, limit)
+		rows, err := stmt.QueryContext(ctx, maxArchived, limit)
 		if err != nil {
 			return nil, fmt.Errorf("list sessions: %w", err)
 		}
@@ -431,7 +713,7 @@ func (s *Store) ListSessions(ctx context.Context, limit int) ([]SessionSummary,
 		if err != nil {
 			return nil, err
 		}
-		rows, err := stmt.QueryContext(ctx)
+		rows, err := stmt.QueryContext(ctx, maxArchived)
 		if err != nil {
 			return nil, fmt.Errorf("list sessions: %w", err)
 		}
@@ -445,8 +727,8 @@ func (s *Store) scanSessionSummaries(rows *sql.Rows) ([]SessionSummary, error) {
 	summaries := make([]SessionSummary, 0, 8)
 	for rows.Next() {
 		var summary SessionSummary
-		var created, updated string
-		if scanErr := rows.Scan(&summary.ID, &summary.Name, &created, &updated, &summary.MessageCount); scanErr != nil {
+		var created, updated, deleted string
+		if scanErr := rows.Scan(&summary.ID, &summary.Name, &created, &updated, &summary.MessageCount, &summary.Sensitive, &summary.ParentID, &summary.ForkPoint, &summary.Pinned, &summary.Archived, &deleted, &summary.SystemPrompt, &summary.Summary, &summary.PromptTokens, &summary.CompletionTokens); scanErr != nil {
 			return nil, fmt.Errorf("scan session summary: %w", scanErr)
 		}
 
@@ -459,6 +741,10 @@ func (s *Store) scanSessionSummaries(rows *sql.Rows) ([]SessionSummary, error) {
 		if parseErr != nil {
 			return nil, parseErr
 		}
+		summary.DeletedAt, parseErr = parseTimestamp(deleted)
+		if parseErr != nil {
+			return nil, parseErr
+		}
 		summaries = append(summaries, summary)
 	}
 
@@ -484,18 +770,21 @@ func (s *Store) LoadSessionWithPagination(ctx context.Context, id int64, paginat
 	}
 
 	var summary SessionSummary
-	var created, updated string
+	var created, updated, deleted string
 	stmt, err := s.getPreparedStmt("getSession")
 	if err != nil {
 		return nil, err
 	}
 	row := stmt.QueryRowContext(ctx, id)
-	if err := row.Scan(&summary.ID, &summary.Name, &created, &updated, &summary.MessageCount); err != nil {
+	if err := row.Scan(&summary.ID, &summary.Name, &created, &updated, &summary.MessageCount, &summary.Sensitive, &summary.ParentID, &summary.ForkPoint, &summary.Pinned, &summary.Archived, &deleted, &summary.SystemPrompt, &summary.Summary, &summary.PromptTokens, &summary.CompletionTokens); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("session %d not found", id)
 		}
 		return nil, fmt.Errorf("select session: %w", err)
 	}
+	if deleted != "" {
+		return nil, fmt.Errorf("session %d is in the trash; undelete it first", id)
+	}
 
 	var parseErr error
 	summary.CreatedAt, parseErr = parseTimestamp(created)
@@ -508,16 +797,22 @@ func (s *Store) LoadSessionWithPagination(ctx context.Context, id int64, paginat
 	}
 
 	// Determine pagination settings
-	pageSize := 50 // Default page size
+	pageSize := defaultPageSize
+	if pagination != nil && pagination.PageSize > 0 {
+		pageSize = pagination.PageSize
+	}
 
-	if pagination != nil {
-		if pagination.PageSize > 0 {
-			pageSize = pagination.PageSize
+	// Long sessions, and pagination without a page, start with the most
+	// recent messages
+	if (pagination == nil && summary.MessageCount > 100) || (pagination != nil && pagination.Page <= 0) {
+		messages, err := s.LoadMessagesBefore(ctx, id, 0, pageSize)
+		if err != nil {
+			return nil, err
 		}
+		return &Transcript{Summary: summary, Messages: messages}, nil
 	}
 
-	// If pagination is requested and there are many messages, use pagination
-	if pagination != nil || summary.MessageCount > 100 {
+	if pagination != nil {
 		// Get message count using prepared statement
 		countStmt, err := s.getPreparedStmt("getMessageCount")
 		if err != nil {
@@ -532,17 +827,8 @@ func (s *Store) LoadSessionWithPagination(ctx context.Context, id int64, paginat
 		}
 		summary.MessageCount = totalCount
 
-		// Calculate offset (for backward pagination, we get messages from the end)
-		var actualOffset int
-		if pagination != nil && pagination.Page > 0 {
-			actualOffset = (pagination.Page - 1) * pageSize
-		} else {
-			// Get most recent messages (paginated from the end)
-			actualOffset = totalCount - pageSize
-			if actualOffset < 0 {
-				actualOffset = 0
-			}
-		}
+		// Pages count back from the most recent messages
+		actualOffset := (pagination.Page - 1) * pageSize
 
 		// Use paginated query
 		paginatedStmt, err := s.getPreparedStmt("getMessagesPaginated")
@@ -557,12 +843,7 @@ func (s *Store) LoadSessionWithPagination(ctx context.Context, id int64, paginat
 
 		messages := make([]Message, 0, pageSize)
 		for rows.Next() {
-			var msg Message
-			var createdAt string
-			if err := rows.Scan(&msg.Role, &msg.Content, &createdAt); err != nil {
-				return nil, fmt.Errorf("scan message: %w", err)
-			}
-			msg.CreatedAt, err = parseTimestamp(createdAt)
+			msg, err := scanMessage(rows)
 			if err != nil {
 				return nil, err
 			}
@@ -576,6 +857,15 @@ func (s *Store) LoadSessionWithPagination(ctx context.Context, id int64, paginat
 		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
 			messages[i], messages[j] = messages[j], messages[i]
 		}
+		if err := s.openMessages(ctx, id, messages); err != nil {
+			return nil, err
+		}
+		if err := s.loadAttachments(ctx, id, messages); err != nil {
+			return nil, err
+		}
+		if err := s.loadToolCalls(ctx, id, messages); err != nil {
+			return nil, err
+		}
 
 		return &Transcript{Summary: summary, Messages: messages}, nil
 	}
@@ -593,12 +883,7 @@ func (s *Store) LoadSessionWithPagination(ctx context.Context, id int64, paginat
 
 	messages := make([]Message, 0, summary.MessageCount)
 	for rows.Next() {
-		var msg Message
-		var createdAt string
-		if err := rows.Scan(&msg.Role, &msg.Content, &createdAt); err != nil {
-			return nil, fmt.Errorf("scan message: %w", err)
-		}
-		msg.CreatedAt, err = parseTimestamp(createdAt)
+		msg, err := scanMessage(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -607,10 +892,313 @@ func (s *Store) LoadSessionWithPagination(ctx context.Context, id int64, paginat
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("iterate messages: %w", err)
 	}
+	if err := s.openMessages(ctx, id, messages); err != nil {
+		return nil, err
+	}
+	if err := s.loadAttachments(ctx, id, messages); err != nil {
+		return nil, err
+	}
+	if err := s.loadToolCalls(ctx, id, messages); err != nil {
+		return nil, err
+	}
 
 	return &Transcript{Summary: summary, Messages: messages}, nil
 }
 
+// LoadMessagesBefore returns up to n messages of a session that precede the
+// message with id beforeID, or the n most recent ones when beforeID is 0, in
+// chronological order. Passing the ID of the oldest message loaded so far
+// pages back through a session without the offsets shifting as messages are
+// added.
+func (s *Store) LoadMessagesBefore(ctx context.Context, sessionID, beforeID int64, n int) ([]Message, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+	if sessionID <= 0 {
+		return nil, errors.New("invalid session id")
+	}
+	if n <= 0 {
+		n = defaultPageSize
+	}
+	if beforeID <= 0 {
+		beforeID = math.MaxInt64
+	}
+
+	stmt, err := s.getPreparedStmt("getMessagesBefore")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, sessionID, beforeID, n)
+	if err != nil {
+		return nil, fmt.Errorf("load messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]Message, 0, n)
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate messages: %w", err)
+	}
+
+	// Newest first from the query; callers want chronological order
+	slices.Reverse(messages)
+	if err := s.openMessages(ctx, sessionID, messages); err != nil {
+		return nil, err
+	}
+	if err := s.loadAttachments(ctx, sessionID, messages); err != nil {
+		return nil, err
+	}
+	if err := s.loadToolCalls(ctx, sessionID, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// FindMessages returns the zero-based positions of the messages of a session
+// that contain text, ignoring case, in chronological order. Encrypted
+// sessions are searched once unlocked, so the text is matched in Go rather
+// than in SQL.
+func (s *Store) FindMessages(ctx context.Context, sessionID int64, text string) ([]int, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+	if sessionID <= 0 {
+		return nil, errors.New("invalid session id")
+	}
+
+	stmt, err := s.getPreparedStmt("getMessages")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("load messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate messages: %w", err)
+	}
+	if err := s.openMessages(ctx, sessionID, messages); err != nil {
+		return nil, err
+	}
+
+	text = strings.ToLower(text)
+	var positions []int
+	for i, msg := range messages {
+		if strings.Contains(strings.ToLower(msg.Content), text) {
+			positions = append(positions, i)
+		}
+	}
+	return positions, nil
+}
+
+// PinMessage marks the message at the given zero-based position within a session
+// as pinned, so it is always included in the request context.
+func (s *Store) PinMessage(ctx context.Context, sessionID int64, position int) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	if sessionID <= 0 {
+		return errors.New("invalid session id")
+	}
+	if position < 0 {
+		return errors.New("invalid message position")
+	}
+
+	stmt, err := s.getPreparedStmt("pinMessage")
+	if err != nil {
+		return err
+	}
+
+	if _, err := stmt.ExecContext(ctx, sessionID, position); err != nil {
+		return fmt.Errorf("pin message: %w", err)
+	}
+
+	return nil
+}
+
+// UnpinMessage removes the pinned flag from the message at the given position.
+func (s *Store) UnpinMessage(ctx context.Context, sessionID int64, position int) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	if sessionID <= 0 {
+		return errors.New("invalid session id")
+	}
+
+	stmt, err := s.getPreparedStmt("unpinMessage")
+	if err != nil {
+		return err
+	}
+
+	if _, err := stmt.ExecContext(ctx, sessionID, position); err != nil {
+		return fmt.Errorf("unpin message: %w", err)
+	}
+
+	return nil
+}
+
+// ListPinnedMessages returns the zero-based positions of all pinned messages in a session.
+func (s *Store) ListPinnedMessages(ctx context.Context, sessionID int64) ([]int, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+	if sessionID <= 0 {
+		return nil, errors.New("invalid session id")
+	}
+
+	stmt, err := s.getPreparedStmt("listPinnedMessages")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list pinned messages: %w", err)
+	}
+	defer rows.Close()
+
+	positions := make([]int, 0, 4)
+	for rows.Next() {
+		var position int
+		if err := rows.Scan(&position); err != nil {
+			return nil, fmt.Errorf("scan pinned message: %w", err)
+		}
+		positions = append(positions, position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate pinned messages: %w", err)
+	}
+
+	return positions, nil
+}
+
+// ListUnembeddedMessages returns up to limit user and assistant messages, newest
+// first, that have no embedding for the given model.
+func (s *Store) ListUnembeddedMessages(ctx context.Context, model string, limit int) ([]StoredMessage, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	stmt, err := s.getPreparedStmt("listUnembedded")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, model, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list unembedded messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]StoredMessage, 0, limit)
+	for rows.Next() {
+		var msg StoredMessage
+		if err := rows.Scan(&msg.ID, &msg.SessionID, &msg.Role, &msg.Content); err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// SaveEmbedding stores the embedding vector for a message, replacing any
+// vector previously computed with another model.
+func (s *Store) SaveEmbedding(ctx context.Context, messageID int64, model string, vector []float32) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	if messageID <= 0 {
+		return errors.New("invalid message id")
+	}
+
+	stmt, err := s.getPreparedStmt("saveEmbedding")
+	if err != nil {
+		return err
+	}
+
+	if _, err := stmt.ExecContext(ctx, messageID, model, encodeVector(vector)); err != nil {
+		return fmt.Errorf("save embedding: %w", err)
+	}
+
+	return nil
+}
+
+// ListEmbeddings returns every stored message embedded with the given model.
+func (s *Store) ListEmbeddings(ctx context.Context, model string) ([]MessageEmbedding, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+
+	stmt, err := s.getPreparedStmt("listEmbeddings")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, model)
+	if err != nil {
+		return nil, fmt.Errorf("list embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var embeddings []MessageEmbedding
+	for rows.Next() {
+		var (
+			item MessageEmbedding
+			blob []byte
+		)
+		if err := rows.Scan(&item.ID, &item.SessionID, &item.Role, &item.Content, &blob); err != nil {
+			return nil, fmt.Errorf("scan embedding: %w", err)
+		}
+		item.Vector = decodeVector(blob)
+		embeddings = append(embeddings, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate embeddings: %w", err)
+	}
+
+	return embeddings, nil
+}
+
+// encodeVector packs a vector as little-endian float32 values.
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vector
+}
+
 func resolvePath(path string) (string, error) {
 	trimmed := strings.TrimSpace(path)
 	if trimmed == "" {
@@ -634,6 +1222,29 @@ func resolvePath(path string) (string, error) {
 	return absPath, nil
 }
 
+// Dir returns the directory holding the database at path, creating it if
+// necessary.
+func Dir(path string) (string, error) {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(resolved), nil
+}
+
+// UserPath returns the database path for one remote user, kept in its own
+// directory next to the database at base so users never share sessions.
+func UserPath(base, user string) (string, error) {
+	if user == "" || strings.ContainsAny(user, `/\.`) {
+		return "", fmt.Errorf("invalid storage user %q", user)
+	}
+	resolved, err := resolvePath(base)
+	if err != nil {
+		return "", err
+	}
+	return resolvePath(filepath.Join(filepath.Dir(resolved), "users", user, filepath.Base(resolved)))
+}
+
 func parseTimestamp(value string) (time.Time, error) {
 	if strings.TrimSpace(value) == "" {
 		return time.Time{}, nil
@@ -745,3 +1356,20 @@ func validateMessageContent(content string) error {
 
 	return nil
 }
+
+// scanMessage reads a row selected by the getMessages statements.
+func scanMessage(rows *sql.Rows) (Message, error) {
+	var msg Message
+	var createdAt string
+	var temperature sql.NullFloat64
+	if err := rows.Scan(&msg.ID, &msg.Role, &msg.Content, &createdAt, &msg.Interrupted,
+		&msg.Meta.Model, &temperature, &msg.Meta.PromptTokens, &msg.Meta.CompletionTokens, &msg.Repeats); err != nil {
+		return Message{}, fmt.Errorf("scan message: %w", err)
+	}
+	if temperature.Valid {
+		msg.Meta.Temperature = &temperature.Float64
+	}
+	var err error
+	msg.CreatedAt, err = parseTimestamp(createdAt)
+	return msg, err
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ToolCallRecord is a tool the model called while it produced an assistant
+// message, with the result it was sent back. Together with the answer they
+// are the agent trace of the message.
+type ToolCallRecord struct {
+	Round     int    `json:"round"`             // Requests before the one that made the call
+	CallID    string `json:"call_id,omitempty"` // ID the provider gave the call
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON encoded, as the model sent them
+	Result    string `json:"result"`
+}
+
+// insertToolCalls stores the tool calls of message messageID. Their
+// arguments and results are encrypted like the message's when key is set.
+func insertToolCalls(ctx context.Context, tx *sql.Tx, key []byte, sessionID, messageID int64, calls []ToolCallRecord) error {
+	for position, call := range calls {
+		arguments, result := call.Arguments, call.Result
+		if key != nil {
+			var err error
+			if arguments, err = sealContent(key, sessionID, arguments); err != nil {
+				return err
+			}
+			if result, err = sealContent(key, sessionID, result); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO tool_calls(message_id, position, round, call_id, name, arguments, result) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			messageID, position, call.Round, call.CallID, call.Name, arguments, result); err != nil {
+			return fmt.Errorf("insert tool call: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadToolCalls adds their tool calls to messages loaded from session id,
+// decrypting them in place.
+func (s *Store) loadToolCalls(ctx context.Context, id int64, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	key, err := s.sessionKey(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[int64]int, len(messages))
+	for i, msg := range messages {
+		index[msg.ID] = i
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT t.message_id, t.round, t.call_id, t.name, t.arguments, t.result
+        FROM tool_calls t JOIN messages m ON m.id = t.message_id
+        WHERE m.session_id = ? ORDER BY t.message_id, t.position`, id)
+	if err != nil {
+		return fmt.Errorf("load tool calls: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var messageID int64
+		var call ToolCallRecord
+		if err := rows.Scan(&messageID, &call.Round, &call.CallID, &call.Name, &call.Arguments, &call.Result); err != nil {
+			return fmt.Errorf("load tool calls: %w", err)
+		}
+		i, ok := index[messageID]
+		if !ok {
+			continue // A message outside the loaded page
+		}
+		if key != nil {
+			if call.Arguments, err = openContent(key, id, call.Arguments); err != nil {
+				return err
+			}
+			if call.Result, err = openContent(key, id, call.Result); err != nil {
+				return err
+			}
+		}
+		messages[i].ToolCalls = append(messages[i].ToolCalls, call)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeleteSession moves a session to the trash: it is left out of every list
+// and search, and cannot be loaded, until UndeleteSession restores it or
+// PurgeDeletedSessions removes it for good.
+func (s *Store) DeleteSession(ctx context.Context, id int64) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE sessions SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`,
+		time.Now().UTC().Format(timestampLayout), id)
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("session %d not found", id)
+	}
+	return nil
+}
+
+// UndeleteSession takes a session out of the trash.
+func (s *Store) UndeleteSession(ctx context.Context, id int64) error {
+	if s == nil || s.db == nil {
+		return errors.New("storage not initialised")
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE sessions SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("undelete session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("session %d is not in the trash", id)
+	}
+	return nil
+}
+
+// ListDeletedSessions returns the sessions in the trash, most recently
+// deleted first.
+func (s *Store) ListDeletedSessions(ctx context.Context) ([]SessionSummary, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("storage not initialised")
+	}
+	stmt, err := s.getPreparedStmt("listDeletedSessions")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list deleted sessions: %w", err)
+	}
+	defer rows.Close()
+	return s.scanSessionSummaries(rows)
+}
+
+// PurgeDeletedSessions permanently removes the sessions that have been in
+// the trash for longer than olderThan, or all of them when olderThan is 0,
+// with their messages, pins, embeddings and attachments. It returns how many
+// sessions were removed.
+func (s *Store) PurgeDeletedSessions(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("storage not initialised")
+	}
+	cutoff := time.Now().UTC().Add(-olderThan).Format(timestampLayout)
+
+	// Checked first, as this runs whenever the history is opened and a
+	// scrub checkpoints the whole write-ahead log
+	var purged int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sessions WHERE deleted_at IS NOT NULL AND deleted_at <= ?`, cutoff).Scan(&purged); err != nil {
+		return 0, fmt.Errorf("count deleted sessions: %w", err)
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+
+	err := s.scrub(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE deleted_at IS NOT NULL AND deleted_at <= ?`, cutoff)
+		if err != nil {
+			return err
+		}
+		purged, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("purge deleted sessions: %w", err)
+	}
+	return purged, nil
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// writerQueueSize bounds the saves waiting for the writer; Save blocks
+	// once it is full.
+	writerQueueSize = 64
+	// writerRetries is how often a failed save is attempted in all.
+	writerRetries = 3
+)
+
+// ErrWriterClosed is returned by Save after Close.
+var ErrWriterClosed = errors.New("writer closed")
+
+// Writer saves messages in the background, so the TUI and the REPL do not
+// wait on the database after each exchange. One goroutine writes the queued
+// saves in order; saves to the same session that are waiting together go
+// into one transaction. A failed save is retried, then reported on Errors.
+//
+// Other reads and writes of the sessions involved should call Flush first,
+// so they see every message saved before them.
+type Writer struct {
+	store   Backend
+	timeout time.Duration // Per batch, including retries
+
+	queue  chan writeRequest
+	errors chan error
+
+	mu     sync.RWMutex // Guards closed against Save sending on a closed queue
+	closed bool
+	done   chan struct{}
+}
+
+// writeRequest is a save, or a flush when flushed is set.
+type writeRequest struct {
+	sessionID int64
+	messages  []Message
+	flushed   chan struct{}
+}
+
+// NewWriter starts a writer for store. Each batch may take up to timeout,
+// retries included.
+func NewWriter(store Backend, timeout time.Duration) *Writer {
+	w := &Writer{
+		store:   store,
+		timeout: timeout,
+		queue:   make(chan writeRequest, writerQueueSize),
+		errors:  make(chan error, writerQueueSize),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Save queues messages to be appended to a session. It only blocks while
+// the queue is full.
+func (w *Writer) Save(sessionID int64, messages ...Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.queue <- writeRequest{sessionID: sessionID, messages: messages}
+	return nil
+}
+
+// Flush waits until every save queued before it has been written, or has
+// failed, or until ctx is done.
+func (w *Writer) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return nil // Close has already written everything
+	}
+	select {
+	case w.queue <- writeRequest{flushed: flushed}:
+	case <-ctx.Done():
+		w.mu.RUnlock()
+		return ctx.Err()
+	}
+	w.mu.RUnlock()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Errors reports saves that failed after their retries. Errors are dropped
+// while earlier ones are not read. It is closed by Close.
+func (w *Writer) Errors() <-chan error {
+	return w.errors
+}
+
+// Close writes the queued saves and stops the writer. It does not close the
+// store.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		<-w.done
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+
+	<-w.done
+	close(w.errors)
+	return nil
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	for request := range w.queue {
+		batch := []writeRequest{request}
+		// Take whatever else is already waiting, so a burst of saves is
+		// written together
+	drain:
+		for len(batch) < writerQueueSize {
+			select {
+			case next, ok := <-w.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+		w.write(batch)
+	}
+}
+
+// write saves the requests in order, merging consecutive saves to the same
+// session, and releases the flushes among them once everything before them
+// is written.
+func (w *Writer) write(batch []writeRequest) {
+	var (
+		sessionID int64
+		pending   []Message
+	)
+	commit := func() {
+		if len(pending) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+		err := w.store.SaveMessagesWithRetry(ctx, sessionID, pending, writerRetries)
+		cancel()
+		if err != nil {
+			select {
+			case w.errors <- err:
+			default:
+			}
+		}
+		pending = nil
+	}
+
+	for _, request := range batch {
+		if request.flushed != nil {
+			commit()
+			close(request.flushed)
+			continue
+		}
+		if request.sessionID != sessionID {
+			commit()
+			sessionID = request.sessionID
+		}
+		pending = append(pending, request.messages...)
+	}
+	commit()
+}
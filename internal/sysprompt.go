@@ -0,0 +1,12 @@
+package internal
+
+// WithSystemPrompt prepends the system prompt of a session to the history
+// sent with a request. The history slice is not modified.
+func WithSystemPrompt(history []Message, prompt string) []Message {
+	if prompt == "" {
+		return history
+	}
+	withPrompt := make([]Message, 0, len(history)+1)
+	withPrompt = append(withPrompt, Message{Role: "system", Content: prompt})
+	return append(withPrompt, history...)
+}
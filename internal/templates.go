@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal/config"
+)
+
+// templateVarPattern matches a {{name}} placeholder, allowing inner spaces.
+var templateVarPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// Template is a reusable prompt with {{name}} variables.
+type Template struct {
+	Name        string
+	Description string
+	System      string
+	Prompt      string
+	Defaults    map[string]string
+}
+
+// MissingVariablesError reports required template variables without a value.
+type MissingVariablesError struct {
+	Template string
+	Names    []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return fmt.Sprintf("template %s needs %s", e.Template, strings.Join(e.Names, ", "))
+}
+
+// LookupTemplate returns the configured template called name.
+func LookupTemplate(cfg *config.Config, name string) (*Template, error) {
+	tmpl, ok := cfg.Templates[name]
+	if !ok {
+		names := TemplateNames(cfg)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown template %q (none configured)", name)
+		}
+		return nil, fmt.Errorf("unknown template %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return &Template{
+		Name:        name,
+		Description: tmpl.Description,
+		System:      tmpl.System,
+		Prompt:      tmpl.Prompt,
+		Defaults:    tmpl.Defaults,
+	}, nil
+}
+
+// TemplateNames returns the configured template names, sorted.
+func TemplateNames(cfg *config.Config) []string {
+	names := make([]string, 0, len(cfg.Templates))
+	for name := range cfg.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Variables returns the template's variables in order of first appearance.
+func (t *Template) Variables() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, text := range []string{t.System, t.Prompt} {
+		for _, match := range templateVarPattern.FindAllStringSubmatch(text, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+	}
+	return names
+}
+
+// Missing returns the required variables that vars does not provide.
+func (t *Template) Missing(vars map[string]string) []string {
+	var missing []string
+	for _, name := range t.Variables() {
+		if _, ok := vars[name]; ok {
+			continue
+		}
+		if _, ok := t.Defaults[name]; ok {
+			continue
+		}
+		missing = append(missing, name)
+	}
+	return missing
+}
+
+// Render fills in the variables and returns the messages to send. It fails
+// with a *MissingVariablesError when a required variable has no value.
+func (t *Template) Render(vars map[string]string) ([]Message, error) {
+	if missing := t.Missing(vars); len(missing) > 0 {
+		return nil, &MissingVariablesError{Template: t.Name, Names: missing}
+	}
+
+	fill := func(text string) string {
+		return templateVarPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+			name := templateVarPattern.FindStringSubmatch(placeholder)[1]
+			if value, ok := vars[name]; ok {
+				return value
+			}
+			return t.Defaults[name]
+		})
+	}
+
+	var messages []Message
+	if strings.TrimSpace(t.System) != "" {
+		messages = append(messages, Message{Role: "system", Content: fill(t.System)})
+	}
+	return append(messages, Message{Role: "user", Content: fill(t.Prompt)}), nil
+}
+
+// ParseTemplateVars parses key=value arguments into template variables.
+func ParseTemplateVars(args []string) (map[string]string, error) {
+	vars := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected name=value, got %q", arg)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
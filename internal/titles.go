@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxTitleContext = 2000 // Characters of the question and answer sent with the request
+	maxTitleLength  = 60   // Longest title kept, in runes
+
+	maxSummaryContext = 8000 // Characters of the latest messages sent for a summary
+	maxSummaryLength  = 160  // Longest summary kept, in runes
+
+	summarySystemPrompt = "You summarise chat transcripts. Reply with one sentence of at most 20 words " +
+		"saying what the conversation is about and where it got to, and nothing else."
+
+	titlePrompt = "Write a short title, at most six words, for the conversation above. " +
+		"Reply with the title only, without quotes or a final period."
+)
+
+// GenerateTitle asks model for a short title for a new conversation, from
+// the last question and answer in history: its first exchange, after any
+// messages seeded from a session template.
+func GenerateTitle(ctx context.Context, client ChatProvider, model string, history []Message) (string, error) {
+	var exchange []Message
+	for i := len(history) - 1; i >= 0 && len(exchange) < 2; i-- {
+		msg := history[i]
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		if len(msg.Content) > maxTitleContext {
+			msg.Content = strings.ToValidUTF8(msg.Content[:maxTitleContext], "")
+		}
+		exchange = append([]Message{{Role: msg.Role, Content: msg.Content}}, exchange...)
+	}
+	if len(exchange) == 0 {
+		return "", nil
+	}
+
+	messages := append(exchange, Message{Role: "user", Content: titlePrompt})
+	reply, err := client.ChatWithOptions(ctx, messages, model, 0.3, RequestOptions{MaxTokens: 30})
+	if err != nil {
+		return "", err
+	}
+	return parseTitle(reply), nil
+}
+
+// SummarizeConversation asks model for a one-line gist of the conversation
+// in history. Excerpts of the latest messages are sent, up to
+// maxSummaryContext characters.
+func SummarizeConversation(ctx context.Context, client ChatProvider, model string, history []Message) (string, error) {
+	var excerpts []string
+	size := 0
+	for i := len(history) - 1; i >= 0 && size < maxSummaryContext; i-- {
+		msg := history[i]
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		label := "User"
+		if msg.Role == "assistant" {
+			label = "Assistant"
+		}
+		excerpt := label + ": " + outlineExcerpt(msg.Content)
+		excerpts = append([]string{excerpt}, excerpts...)
+		size += len(excerpt)
+	}
+	if len(excerpts) == 0 {
+		return "", nil
+	}
+
+	messages := []Message{
+		{Role: "system", Content: summarySystemPrompt},
+		{Role: "user", Content: strings.Join(excerpts, "\n\n")},
+	}
+	reply, err := client.ChatWithOptions(ctx, messages, model, 0.2, RequestOptions{MaxTokens: 80})
+	if err != nil {
+		return "", fmt.Errorf("summarise conversation: %w", err)
+	}
+	return parseGist(reply, "summary", maxSummaryLength), nil
+}
+
+// parseTitle keeps the first line of a reply, without a "Title:" label,
+// quotes, Markdown emphasis or a final period.
+func parseTitle(reply string) string {
+	return parseGist(reply, "title", maxTitleLength)
+}
+
+// parseGist keeps the first line of a reply, at most max runes, without a
+// "label:" prefix, quotes, Markdown emphasis or a final period.
+func parseGist(reply, label string, max int) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(reply), "\n")
+	line = strings.TrimSpace(line)
+	if prefix, rest, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(prefix), label) {
+		line = strings.TrimSpace(rest)
+	}
+	line = strings.Trim(line, "\"'“”*#_` ")
+	line = strings.TrimRight(line, ".")
+	if utf8.RuneCountInString(line) > max {
+		line = strings.TrimSpace(string([]rune(line)[:max]))
+	}
+	return line
+}
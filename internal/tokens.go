@@ -0,0 +1,24 @@
+package internal
+
+import "unicode/utf8"
+
+const (
+	charsPerToken    = 4 // Rough average for English text with BPE tokenizers
+	tokensPerMessage = 4 // Role and separator overhead added by chat formats
+)
+
+// EstimateTokens approximates the number of tokens in text. It is a heuristic
+// for previews and budgets, not an exact tokenizer count.
+func EstimateTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	return (n + charsPerToken - 1) / charsPerToken
+}
+
+// EstimateMessageTokens approximates the prompt tokens used by messages.
+func EstimateMessageTokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += EstimateTokens(msg.Content) + tokensPerMessage
+	}
+	return total
+}
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ZaguanLabs/chatty/internal/config"
+	"github.com/ZaguanLabs/chatty/internal/sandbox"
+	"github.com/ZaguanLabs/chatty/internal/storage"
+)
+
+// runCodeTool is the name of the tool that runs code in the sandbox.
+const runCodeTool = "run_code"
+
+// Tool describes a function the model may call.
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction is the name, purpose and JSON schema parameters of a tool.
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a complete tool call made by the model.
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall names the function called and its JSON encoded arguments.
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// Toolbox runs the tools the model calls while it answers. Only the code
+// sandbox is available, and only when sandbox.enabled is set.
+type Toolbox struct {
+	runner    *sandbox.Runner
+	maxRounds int
+}
+
+// NewToolbox returns the tools configured in cfg, or nil when there are none.
+func NewToolbox(cfg *config.Config) *Toolbox {
+	if !cfg.Sandbox.Enabled {
+		return nil
+	}
+	return &Toolbox{runner: sandbox.New(cfg.Sandbox), maxRounds: cfg.Sandbox.MaxRounds}
+}
+
+// Tools returns the definitions sent with each request.
+func (b *Toolbox) Tools() []Tool {
+	languages, _ := json.Marshal(b.runner.Languages())
+	return []Tool{{
+		Type: "function",
+		Function: ToolFunction{
+			Name: runCodeTool,
+			Description: "Run a complete program in an isolated container without network access " +
+				"and return its combined stdout and stderr. Use it to check code before answering, " +
+				"and fix and run it again when it fails.",
+			Parameters: json.RawMessage(`{"type":"object","properties":{` +
+				`"language":{"type":"string","enum":` + string(languages) + `},` +
+				`"code":{"type":"string","description":"Full source of the program"}},` +
+				`"required":["language","code"]}`),
+		},
+	}}
+}
+
+// Stream streams a response like ChatStreamEvents, running the tools the
+// model calls and sending it their results until it answers in text. Each
+// call and its output are streamed as content so they are part of the
+// transcript, and each finished call is sent as a ToolRun event so it can be
+// saved with the answer. After sandbox.max_rounds rounds of calls the model
+// has to answer.
+func (b *Toolbox) Stream(ctx context.Context, provider ChatProvider, messages []Message, model string, temperature float64, opts RequestOptions, onEvent func(StreamEvent) error) error {
+	messages = append([]Message{}, messages...)
+	opts.Tools = b.Tools()
+
+	for round := 0; ; round++ {
+		if round == b.maxRounds {
+			opts.ToolChoice = "none"
+		}
+
+		var content strings.Builder
+		var calls []ToolCall
+		err := provider.ChatStreamEvents(ctx, messages, model, temperature, opts, func(event StreamEvent) error {
+			// Arguments arrive in fragments, accumulated per call index
+			for _, delta := range event.ToolCalls {
+				for len(calls) <= delta.Index {
+					calls = append(calls, ToolCall{Type: "function"})
+				}
+				call := &calls[delta.Index]
+				if delta.ID != "" {
+					call.ID = delta.ID
+				}
+				call.Function.Name += delta.Function.Name
+				call.Function.Arguments += delta.Function.Arguments
+			}
+			content.WriteString(event.Content)
+			return onEvent(event)
+		})
+		if err != nil || len(calls) == 0 || round == b.maxRounds {
+			return err
+		}
+
+		messages = append(messages, Message{Role: "assistant", Content: content.String(), ToolCalls: calls})
+		for _, call := range calls {
+			result, err := b.call(ctx, call, onEvent)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, Message{Role: "tool", ToolCallID: call.ID, Content: result})
+			run := &storage.ToolCallRecord{Round: round, CallID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments, Result: result}
+			if err := onEvent(StreamEvent{ToolRun: run}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ExpandToolTrace replaces each assistant message that called tools with
+// the exchange the model had: for each round, an assistant message with the
+// calls and a tool message with each result, and then the answer. A
+// reloaded session so gives the model the trace it had when it answered.
+func ExpandToolTrace(history []Message) []Message {
+	expanded := make([]Message, 0, len(history))
+	for _, msg := range history {
+		if len(msg.ToolTrace) == 0 {
+			expanded = append(expanded, msg)
+			continue
+		}
+		for start := 0; start < len(msg.ToolTrace); {
+			round := msg.ToolTrace[start].Round
+			end := start
+			for end < len(msg.ToolTrace) && msg.ToolTrace[end].Round == round {
+				end++
+			}
+			calls := make([]ToolCall, 0, end-start)
+			results := make([]Message, 0, end-start)
+			for i, record := range msg.ToolTrace[start:end] {
+				// Tool messages must name the call they answer
+				id := record.CallID
+				if id == "" {
+					id = fmt.Sprintf("call_%d_%d", round, i)
+				}
+				calls = append(calls, ToolCall{ID: id, Type: "function", Function: FunctionCall{Name: record.Name, Arguments: record.Arguments}})
+				results = append(results, Message{Role: "tool", ToolCallID: id, Content: record.Result})
+			}
+			expanded = append(expanded, Message{Role: "assistant", ToolCalls: calls})
+			expanded = append(expanded, results...)
+			start = end
+		}
+		answer := msg
+		answer.ToolTrace = nil
+		expanded = append(expanded, answer)
+	}
+	return expanded
+}
+
+// call runs one tool call, streams what happened and returns the result for
+// the model. Failures the model can act on are results, not errors.
+func (b *Toolbox) call(ctx context.Context, call ToolCall, onEvent func(StreamEvent) error) (string, error) {
+	if call.Function.Name != runCodeTool {
+		return fmt.Sprintf("error: unknown tool %q", call.Function.Name), nil
+	}
+
+	var args struct {
+		Language string `json:"language"`
+		Code     string `json:"code"`
+	}
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+		return fmt.Sprintf("error: invalid arguments: %v", err), nil
+	}
+	if err := onEvent(StreamEvent{Content: "\n\n" + fence(args.Code, args.Language)}); err != nil {
+		return "", err
+	}
+
+	result, err := b.runner.Run(ctx, args.Language, args.Code)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	var status string
+	switch {
+	case err != nil:
+		status = "error: " + err.Error()
+	case result.TimedOut:
+		status = fmt.Sprintf("timed out after %s", result.Duration.Round(100*time.Millisecond))
+	default:
+		status = fmt.Sprintf("exit code %d", result.ExitCode)
+	}
+
+	display := "*" + status + "*\n\n"
+	output := status
+	if result != nil && result.Output != "" {
+		display = fence(result.Output, "text") + display
+		output += "\n" + result.Output
+	}
+	if err := onEvent(StreamEvent{Content: display}); err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+// fence wraps text in a markdown code block, with a fence longer than any
+// run of backticks in the text.
+func fence(text, language string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	marker := strings.Repeat("`", max(3, longest+1))
+	return marker + language + "\n" + strings.TrimRight(text, "\n") + "\n" + marker + "\n"
+}
@@ -2,14 +2,24 @@ package tui
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ZaguanLabs/chatty/internal"
 	"github.com/ZaguanLabs/chatty/internal/config"
 	"github.com/ZaguanLabs/chatty/internal/storage"
+	"github.com/ZaguanLabs/chatty/internal/ui"
 	"github.com/ZaguanLabs/chatty/internal/validation"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
@@ -17,22 +27,34 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
+// offlineRetryInterval is how often queued prompts are retried while offline.
+const offlineRetryInterval = 15 * time.Second
+
 // Message represents a chat message with its rendered view.
 type Message struct {
 	internal.Message
 	Rendered string
+	// Interrupted marks the partial text of an answer whose stream was
+	// stopped or timed out.
+	Interrupted bool
+	// Repeats counts the times a saved question was sent again right after
+	// itself (storage.dedupe_messages).
+	Repeats int
 }
 
 // Model is the Bubble Tea model for the chat application.
 type Model struct {
-	client    *internal.Client
+	client    internal.ChatProvider
 	cfg       *config.Config
-	store     *storage.Store
-	storagePath string
+	baseCfg   *config.Config // As loaded; cfg is a copy while a session template changes the model settings
+	store     storage.Backend
+	writer    *storage.Writer // Saves exchanges in the background once the store is open
+	storageCfg  config.StorageConfig
 	sessionID int64
 
 	viewport    viewport.Model
-	textinput   textinput.Model
+	textarea    textarea.Model  // Where messages are written
+	textinput   textinput.Model // Masked input for passphrases
 	renderer    *glamour.TermRenderer
 	err         error
 
@@ -41,57 +63,242 @@ type Model struct {
 	streaming     bool
 	streamContent strings.Builder
 
+	// Context pinning: positions are absolute within the stored session, and
+	// messageOffset is the position of messages[0] when a session was loaded
+	// with only its most recent page of history.
+	pinned        map[int]bool
+	messageOffset int
+
+	// ID of messages[0] in the store while earlier messages are not loaded;
+	// scrolling to the top loads the page before it
+	oldestMessageID int64
+	loadingOlder    bool
+
+	// Response length preset for the current session
+	length internal.LengthPreset
+
+	// Stop sequences for the current session, adjusted with /stopwords
+	stop []string
+
+	// System prompt of the session, set with /system and saved with it
+	systemPrompt string
+
+	// Leading messages a session template began the conversation with,
+	// saved once the session is; and the template to start from once the
+	// store is open (./chatty new --template)
+	unsavedSeeds  int
+	startTemplate string
+
+	// Reopen the last active session once the store is open (--continue)
+	continueLast bool
+
+	// Excerpts from earlier conversations injected with /recall --inject,
+	// and the system part of templates sent with /template
+	recalled []internal.Message
+
+	// Files staged with /attach, sent with the next message
+	attachments []storage.Attachment
+
+	// Template whose missing variables are being asked for, see /template
+	fill *templateFill
+
+	// Tools the model may call while answering, nil when none are enabled
+	tools *internal.Toolbox
+
+	// Features the endpoint supports for the model (api.probe_features),
+	// nil until probed
+	features *internal.ProviderFeatures
+
+	// Multi-line pastes, kept aside because the input is a single line and
+	// shown there as placeholders until the message is sent
+	pastes []pastedText
+
+	// Input whose estimated cost was shown; pressing Enter again sends it
+	costConfirmed string
+
+	// Question that repeats an earlier one, and the index of the earlier
+	// answer; pressing Enter again sends it, /reuse shows that answer
+	duplicateOf     string
+	duplicateAnswer int
+
+	// Answer replaced by /retry, and the index of the message that replaces
+	// it, for /diff-retry
+	retried   string
+	retriedAt int
+
+	// Prompts kept off disk (privacy.exclude_patterns)
+	privacy *internal.PrivacyFilter
+
+	// Passphrase being typed, with the input masked: for /sensitive or to
+	// unlock an encrypted session on /load
+	passphrase *passphrasePrompt
+
+	// Finish reason reported for the response being streamed
+	finishReason string
+
+	// Status line shown under the stream, e.g. while waiting out a rate limit
+	streamStatus string
+
+	// Stops the answer being streamed; it also ends when the provider sends
+	// nothing for timeouts.stream
+	streamCancel  context.CancelFunc
+	streamStopped bool // Stopped with Esc rather than failed
+	// Tools called by the answer being streamed, saved with it
+	streamToolTrace []storage.ToolCallRecord
+
+	// Prompts composed while the API was unreachable, sent in order once it
+	// responds again (ui.offline_queue)
+	queue []string
+
+	// Suggested follow-up questions for the last answer (ui.follow_ups)
+	suggestions []string
+
+	// Session picker, toggled with Ctrl+B and opened by /list
+	sidebar sidebar
+
+	// A new session is named by the model once its first exchange is
+	// answered (storage.auto_title); titleCancel stops a title in progress
+	needsTitle  bool
+	titleCancel context.CancelFunc
+
+	// One-line exchange summaries for /outline, keyed by internal.Exchange.Key
+	outline map[string]string
+
+	// Prompt and completion tokens the session has used, shown in the
+	// header against model.session_token_budget
+	sessionTokens int
+
+	// Response metadata footer, toggled with /meta
+	showMeta      bool
+	// Messages are rendered as markdown unless turned off with /markdown
+	renderMarkdown bool
+	requestStart  time.Time
+	requestPrompt []internal.Message
+
 	// Dimensions
 	width  int
 	height int
 }
 
 // NewModel initializes the TUI model.
-func NewModel(client *internal.Client, cfg *config.Config, _ *storage.Store) Model {
-	// Use textinput instead of textarea to avoid multi-line issues
+func NewModel(client internal.ChatProvider, cfg *config.Config, _ storage.Backend) Model {
+	// Enter sends; Alt+Enter, Shift+Enter (where the terminal reports it)
+	// and Ctrl+J start a new line
+	ta := textarea.New()
+	ta.Placeholder = "Type your message here..."
+	ta.ShowLineNumbers = false
+	ta.CharLimit = 10000
+	ta.KeyMap.InsertNewline.SetKeys("alt+enter", "shift+enter", "ctrl+j")
+	ta.SetHeight(1)
+	ta.Focus()
+
+	// Only shown while a passphrase is asked for
 	ti := textinput.New()
-	ti.Placeholder = "Type your message here..."
+	ti.EchoMode = textinput.EchoPassword
 	ti.Focus()
-	ti.CharLimit = 10000
 
 	vp := viewport.New(80, 20)
-	vp.SetContent("Welcome to Chatty! Type a message to begin.\n")
+	if cfg.UI.ShowWelcome {
+		vp.SetContent("Welcome to Chatty! Type a message to begin.\n")
+	}
 
 	return Model{
 		client:      client,
 		cfg:         cfg,
-		storagePath: cfg.Storage.Path,
+		baseCfg:     cfg,
+		storageCfg:  cfg.Storage,
 		store:       nil, // Initialized asynchronously
+		textarea:    ta,
 		textinput:   ti,
 		viewport:    vp,
 		renderer:    nil, // Initialized asynchronously
 		messages:    make([]Message, 0),
+		pinned:      make(map[int]bool),
+		length:      defaultLengthPreset(),
+		stop:        cfg.Model.Stop,
+		showMeta:    cfg.UI.ShowResponseMeta,
+		renderMarkdown: true,
+		tools:       internal.NewToolbox(cfg),
+		privacy:     internal.NewPrivacyFilter(cfg),
 	}
 }
 
+// WithSessionTemplate starts the conversation from the named session
+// template as soon as the history is open.
+func (m Model) WithSessionTemplate(name string) Model {
+	m.startTemplate = name
+	return m
+}
+
+// ContinueLastSession reopens the session last worked in, see /last, as soon
+// as the history is open.
+func (m Model) ContinueLastSession() Model {
+	m.continueLast = true
+	return m
+}
+
+// defaultLengthPreset returns the preset used for new sessions.
+func defaultLengthPreset() internal.LengthPreset {
+	preset, _ := internal.LookupLengthPreset(internal.DefaultLengthPreset)
+	return preset
+}
+
 // Init initializes the program.
 func (m Model) Init() tea.Cmd {
 	var cmds []tea.Cmd
-	// Remove textarea.Blink to avoid input issues
-	cmds = append(cmds, initRenderer(m.width))
+	cmds = append(cmds, textarea.Blink, initRenderer(m.columnWidth()))
 
-	if m.storagePath != "disable" {
-		cmds = append(cmds, loadStorage(m.storagePath))
+	if m.storageCfg.Path != "disable" {
+		cmds = append(cmds, loadStorage(m.storageCfg))
+	}
+	if pinger, ok := m.client.(internal.Pinger); ok && m.cfg.API.PingOnStartup {
+		cmds = append(cmds, pingAPI(pinger, m.cfg.Model.Name))
+	}
+	if prober, ok := m.client.(internal.FeatureProber); ok && m.cfg.API.ProbeFeatures {
+		cmds = append(cmds, probeFeatures(prober, m.cfg.API.URL, m.cfg.Model.Name, false))
 	}
 
 	return tea.Batch(cmds...)
 }
 
+// streamUpdate carries either a stream event or the error that ended the stream.
+type streamUpdate struct {
+	event internal.StreamEvent
+	err   error
+}
+
 // Msg types
 type (
 	streamChunkMsg struct {
-		chunk string
-		ch    chan string
+		event internal.StreamEvent
+		ch    chan streamUpdate
 	}
 	streamErrorMsg error
 	streamDoneMsg  struct{}
 	errMsg         error
 	sessionCreatedMsg int64
+	saveErrorMsg      struct{ err error }
+	olderMessagesMsg struct {
+		sessionID int64
+		messages  []storage.Message
+	}
+	featuresProbedMsg struct {
+		features *internal.ProviderFeatures
+		announce bool // Show the result, as for /capabilities refresh
+	}
+	passphraseNeededMsg int64 // Session to unlock
+	exchangeForgottenMsg struct {
+		id        int64
+		remaining int // Messages left in the saved session
+	}
+	sessionForkedMsg struct {
+		parent, id int64
+		upTo       int // Messages kept, as numbered by /history
+	}
+	sessionEncryptedMsg struct {
+		id        int64
+		encrypted bool
+	}
 	storeLoadedMsg *storage.Store
 	rendererLoadedMsg *glamour.TermRenderer
 	sessionsListedMsg struct {
@@ -100,6 +307,42 @@ type (
 	}
 	sessionLoadedMsg struct {
 		transcript *storage.Transcript
+		pinned     []int
+	}
+	recallResultsMsg struct {
+		query   string
+		results []internal.RecallResult
+		inject  bool
+	}
+	compareResultsMsg struct {
+		prompt  string
+		results []internal.ModelResult
+	}
+	queueRetryMsg     struct{}
+	outlineMsg struct {
+		summaries map[string]string
+	}
+	followUpsMsg struct {
+		suggestions []string
+		after       int // Number of messages when the suggestions were requested
+	}
+	sessionSummarizedMsg struct {
+		summary string
+		saved   bool
+	}
+	imageSavedMsg struct {
+		path string
+	}
+	transcriptionMsg struct {
+		text string
+	}
+	sessionExportedMsg struct {
+		id   int64
+		path string
+	}
+	sessionImportedMsg struct {
+		id   int64
+		path string
 	}
 )
 
@@ -120,9 +363,60 @@ func initRenderer(width int) tea.Cmd {
 	}
 }
 
-func loadStorage(path string) tea.Cmd {
+// pingAPI checks the endpoint in the background and reports problems before
+// the first message is sent. Success is silent.
+func pingAPI(pinger internal.Pinger, model string) tea.Cmd {
+	return func() tea.Msg {
+		result, err := pinger.Ping(context.Background())
+		if err != nil {
+			return errMsg(fmt.Errorf("API check failed: %w (run \"chatty doctor\" for details)", err))
+		}
+		if len(result.Models) > 0 && !result.HasModel(model) {
+			return errMsg(fmt.Errorf("model %q is not listed by the API; requests may fail", model))
+		}
+		return nil
+	}
+}
+
+// probeFeatures finds out which features the endpoint supports for model,
+// probing it only when no recent result is cached. A failed probe is not
+// reported: the startup ping already covers an unreachable endpoint.
+func probeFeatures(prober internal.FeatureProber, url, model string, refresh bool) tea.Cmd {
+	return func() tea.Msg {
+		path, err := internal.DefaultFeatureCachePath()
+		if err == nil && !refresh {
+			if features, ok := internal.CachedFeatures(path, url, model); ok {
+				return featuresProbedMsg{features: features}
+			}
+		}
+		features, probeErr := prober.ProbeFeatures(context.Background(), model)
+		if probeErr != nil {
+			if refresh {
+				return errMsg(fmt.Errorf("probe features: %w", probeErr))
+			}
+			return nil
+		}
+		if err == nil {
+			_ = internal.SaveFeatures(path, features)
+		}
+		return featuresProbedMsg{features: features, announce: refresh}
+	}
+}
+
+// waitForSaveError reports the next save that failed in the background.
+func waitForSaveError(writer *storage.Writer) tea.Cmd {
+	return func() tea.Msg {
+		err, ok := <-writer.Errors()
+		if !ok {
+			return nil
+		}
+		return saveErrorMsg{err: err}
+	}
+}
+
+func loadStorage(cfg config.StorageConfig) tea.Cmd {
 	return func() tea.Msg {
-		store, err := storage.Open(path)
+		store, err := storage.OpenConfig(cfg)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -137,59 +431,158 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		vpCmd tea.Cmd
 	)
 
-	m.textinput, tiCmd = m.textinput.Update(msg)
+	// Alt+1..3 sends a suggested follow-up; handled before the text input sees the key
+	if key, ok := msg.(tea.KeyMsg); ok && len(m.suggestions) > 0 && !m.streaming {
+		switch key.String() {
+		case "alt+1", "alt+2", "alt+3":
+			if n := int(key.String()[4] - '0'); n <= len(m.suggestions) {
+				return m.sendMessage(m.suggestions[n-1])
+			}
+		}
+	}
+
+	// The session picker takes the keys while it is open
+	if key, ok := msg.(tea.KeyMsg); ok && key.Type != tea.KeyCtrlC && m.passphrase == nil {
+		if m.sidebar.open {
+			return m.handleSidebarKey(key)
+		}
+		if key.Type == tea.KeyCtrlB {
+			return m.handleListCommand(false)
+		}
+	}
+
+	// Multi-line pastes are kept aside behind a placeholder so the input
+	// stays short
+	if key, ok := msg.(tea.KeyMsg); ok && key.Paste && strings.ContainsAny(string(key.Runes), "\r\n") {
+		return m.addPaste(string(key.Runes)), nil
+	}
+
+	if m.passphrase != nil {
+		m.textinput, tiCmd = m.textinput.Update(msg)
+	} else {
+		m.textarea, tiCmd = m.textarea.Update(msg)
+		m.fitInput()
+	}
 	// Only update viewport if we aren't streaming to avoid conflicts or if necessary
 	m.viewport, vpCmd = m.viewport.Update(msg)
+	if cmd := m.loadOlderMessages(msg); cmd != nil {
+		vpCmd = tea.Batch(vpCmd, cmd)
+	}
 
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
-		
-		// Update viewport size
-		headerHeight := 2
-		footerHeight := 5 // textinput + padding
-		m.viewport.Width = msg.Width
-		m.viewport.Height = msg.Height - headerHeight - footerHeight
-		
-		// Update textarea width
-		m.textinput.Width = msg.Width-4 // Account for padding/borders
-		
-		// Update renderer width if it exists
-		if m.renderer != nil {
-			m.renderer, _ = glamour.NewTermRenderer(
-				glamour.WithStylePath("dark"), // Use fixed dark style instead of auto detection
-				glamour.WithWordWrap(msg.Width-4),
-			)
-			// Optional: Re-render history on resize for perfect wrapping
-		}
+		m.resize()
 
 	case tea.KeyMsg:
 		switch msg.Type {
 		case tea.KeyCtrlC, tea.KeyEsc:
+			if msg.Type == tea.KeyEsc && m.passphrase != nil {
+				m = m.endPassphrase()
+				m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Cancelled."))
+				m.viewport.GotoBottom()
+				return m, nil
+			}
+			// Esc stops an answer being streamed, keeping what has arrived
+			if msg.Type == tea.KeyEsc && m.streaming && m.streamCancel != nil {
+				m.streamCancel()
+				m.streamStopped = true
+				m.streamStatus = "Stopping..."
+				return m, nil
+			}
+			m.closeWriter()
 			return m, tea.Quit
 		case tea.KeyEnter:
+			if msg.Alt && m.passphrase == nil {
+				break // A new line, already added by the textarea
+			}
 			if m.streaming {
 				return m, nil // Ignore input while streaming
 			}
-			input := m.textinput.Value()
+			if m.passphrase != nil {
+				input := m.textinput.Value()
+				m.textinput.Reset()
+				return m.enterPassphrase(input)
+			}
+			input := m.textarea.Value()
 			if strings.TrimSpace(input) == "" {
 				return m, nil
 			}
 
-			// Handle commands
+			// Handle commands; a command also abandons a template being filled in
 			if strings.HasPrefix(input, "/") {
-				m.textinput.Reset()
+				m.resetInput()
+				m.pastes = nil
+				m = m.cancelTemplateFill()
 				return m.handleCommand(input)
 			}
+			input = m.expandPastes(input)
+			if m.fill != nil {
+				m.resetInput()
+				m.pastes = nil
+				return m.fillTemplateVariable(input)
+			}
 
-			m.textinput.Reset()
+			// Repeated questions are sent on the second Enter
+			if m.cfg.UI.DetectDuplicates && m.duplicateOf != input {
+				if answer := internal.FindDuplicateQuestion(m.plainMessages(), input); answer >= 0 {
+					m.duplicateOf, m.duplicateAnswer = input, answer
+					m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf(
+						"You asked this before (message #%d). Type /reuse to see that answer again, or press Enter to ask for a new one.", answer)))
+					m.viewport.GotoBottom()
+					return m, nil
+				}
+			}
+			m.duplicateOf = ""
+
+			// Expensive requests are sent on the second Enter
+			if m.costConfirmed != input {
+				history, opts := m.pendingRequest()
+				prompt := append(history, internal.Message{Role: "user", Content: input})
+				if cost, over := internal.CostNeedsConfirmation(m.cfg, prompt, opts); over {
+					m.costConfirmed = input
+					m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf(
+						"Estimated cost $%.2f is above $%.2f (model.confirm_cost_above). Press Enter again to send, or edit the message.",
+						cost, m.cfg.Model.ConfirmCostAbove)))
+					m.viewport.GotoBottom()
+					return m, nil
+				}
+			}
+			m.costConfirmed = ""
+
+			m.resetInput()
+			m.pastes = nil
+			if len(m.queue) > 0 {
+				// Keep the order of prompts composed while offline
+				m.queue = append(m.queue, input)
+				m.viewport.SetContent(m.renderHistoryCache())
+				m.viewport.GotoBottom()
+				return m, nil
+			}
 			return m.sendMessage(input)
 		}
 
 	// Streaming messages
 	case streamChunkMsg:
-		m.streamContent.WriteString(msg.chunk)
+		if msg.event.FinishReason != "" {
+			m.finishReason = msg.event.FinishReason
+		}
+		if msg.event.RetryAfter > 0 {
+			seconds := int(math.Ceil(msg.event.RetryAfter.Seconds()))
+			m.streamStatus = fmt.Sprintf("Rate limited, retrying in %ds...", seconds)
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + m.renderCurrentStream())
+			m.viewport.GotoBottom()
+			return m, waitForChunk(msg.ch)
+		}
+		if msg.event.ToolRun != nil {
+			m.streamToolTrace = append(m.streamToolTrace, *msg.event.ToolRun)
+		}
+		if msg.event.Content == "" {
+			return m, waitForChunk(msg.ch)
+		}
+		m.streamStatus = ""
+		m.streamContent.WriteString(msg.event.Content)
 		// Append chunk to viewport efficiently
 		// Ideally we'd append to the viewport content directly but Viewport doesn't support append easily.
 		// Re-rendering the WHOLE history is what killed performance.
@@ -201,60 +594,219 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case streamDoneMsg:
 		m.streaming = false
+		m.streamStatus = ""
+		m.stopStream()
 		fullResponse := m.streamContent.String()
 		
 		// Render the full response once
-		var rendered string
-		var err error
-		if m.renderer != nil {
-			rendered, err = m.renderer.Render(fullResponse)
+		rendered := m.renderContent("assistant", fullResponse)
+		if note := internal.FinishReasonNote(m.finishReason); note != "" {
+			rendered += "\n" + styleSystem.Render(note)
+		}
+		answeredBy := m.client.LastModel()
+		if answeredBy != "" && answeredBy != m.cfg.Model.Name {
+			rendered += "\n" + styleSystem.Render(fmt.Sprintf("(answered by fallback model %s)", answeredBy))
+		}
+		if m.showMeta {
+			model, pricing := m.cfg.Model.Name, m.cfg.Model.Pricing
+			if answeredBy != "" && answeredBy != model {
+				// Configured pricing describes the primary model only
+				model, pricing = answeredBy, nil
+			}
+			meta := internal.NewResponseMeta(model, m.client.LastUsage(), m.requestPrompt, fullResponse, time.Since(m.requestStart), pricing)
+			rendered += "\n" + styleFooter.Render(meta.String())
 		}
-		if err != nil || m.renderer == nil {
-			rendered = fullResponse
+
+		if m.retried != "" && m.retriedAt == len(m.messages) {
+			rendered += "\n" + styleSystem.Render("(new answer; /diff-retry shows what changed)")
 		}
 
 		// Add assistant message to history
 		assistantMsg := Message{
-			Message: internal.Message{Role: "assistant", Content: fullResponse},
+			Message: internal.Message{Role: "assistant", Content: fullResponse, Meta: m.replyMeta(true), ToolTrace: m.streamToolTrace},
 			Rendered: rendered,
 		}
 		m.messages = append(m.messages, assistantMsg)
+		if meta := assistantMsg.Meta; meta != nil {
+			m.sessionTokens += meta.PromptTokens + meta.CompletionTokens
+		}
 		
 		// Persist
 		if m.store != nil {
-			go m.persistLastExchange()
+			m.persistLastExchange()
 		}
 
 		m.viewport.SetContent(m.renderHistoryCache())
 		m.viewport.GotoBottom()
 		m.streamContent.Reset()
-		return m, nil
+
+		var speakCmd, followUpCmd, titleCmd tea.Cmd
+		if m.cfg.UI.TTS {
+			speakCmd = m.speak(fullResponse)
+		}
+		if m.needsTitle && m.sessionID != 0 {
+			titleCmd = m.nameSession()
+		} else if every := m.cfg.Storage.SummaryEvery; every > 0 && m.sessionID != 0 && (m.messageOffset+len(m.messages))/2%every == 0 {
+			titleCmd = m.refreshSummary()
+		}
+		if len(m.queue) > 0 {
+			next, sendCmd := m.sendQueued()
+			return next, tea.Batch(speakCmd, titleCmd, sendCmd)
+		}
+		if m.cfg.UI.FollowUps {
+			followUpCmd = m.suggestFollowUps()
+		}
+		return m, tea.Batch(speakCmd, followUpCmd, titleCmd)
 
 	case streamErrorMsg:
 		m.streaming = false
+		m.streamStatus = ""
+		m.stopStream()
 		m.err = error(msg)
-		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", msg)))
+		if m.cfg.UI.OfflineQueue && m.streamContent.Len() == 0 && internal.IsOfflineError(msg) {
+			return m.queueLastMessage()
+		}
+		// Keep a partial answer, marked as interrupted, rather than lose it
+		if partial := m.streamContent.String(); strings.TrimSpace(partial) != "" && len(m.messages) > 0 && m.messages[len(m.messages)-1].Role == "user" {
+			m.messages = append(m.messages, Message{
+				Message:     internal.Message{Role: "assistant", Content: partial, Meta: m.replyMeta(false), ToolTrace: m.streamToolTrace},
+				Rendered:    m.renderContent("assistant", partial) + "\n" + interruptedNote(),
+				Interrupted: true,
+			})
+			if m.store != nil {
+				m.persistLastExchange()
+			}
+			m.streamContent.Reset()
+		}
+		content := m.renderHistoryCache()
+		if m.streamContent.Len() > 0 {
+			content += "\n" + m.renderCurrentStream()
+		}
+		if m.streamStopped {
+			content += "\n" + styleSystem.Render("Stopped.")
+		} else {
+			content += "\n" + styleError.Render(fmt.Sprintf("Error: %v", msg))
+		}
+		m.viewport.SetContent(content)
 		m.viewport.GotoBottom()
+		m.streamContent.Reset()
+		if len(m.queue) > 0 {
+			// Carry on with the remaining queued prompts
+			return m, scheduleQueueRetry()
+		}
 		return m, nil
 
 	case sessionCreatedMsg:
 		m.sessionID = int64(msg)
+		m.rememberSession()
+		// The messages of a session template go before the first exchange
+		if m.unsavedSeeds > 0 && m.writer != nil {
+			seeds := make([]storage.Message, 0, m.unsavedSeeds)
+			for _, seed := range m.messages[:min(m.unsavedSeeds, len(m.messages))] {
+				seeds = append(seeds, storage.Message{Role: seed.Role, Content: seed.Content})
+			}
+			m.writer.Save(m.sessionID, seeds...)
+		}
+		m.unsavedSeeds = 0
+		if m.systemPrompt != "" {
+			if err := m.saveSystemPrompt(); err != nil {
+				m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: failed to save the system prompt: %v", err)))
+				m.viewport.GotoBottom()
+			}
+		}
+		// An answer that finished before the session existed is saved now
+		var titleCmd tea.Cmd
+		if n := len(m.messages); !m.streaming && n >= 2 && m.messages[n-1].Role == "assistant" {
+			m.persistLastExchange()
+			if m.needsTitle {
+				titleCmd = m.nameSession()
+			}
+		}
+		return m, titleCmd
+
+	case exchangeForgottenMsg:
+		if msg.remaining == 0 && m.sessionID == msg.id {
+			m.sessionID, m.messageOffset = 0, 0
+		}
 		return m, nil
 
-	case storeLoadedMsg:
-		m.store = msg
+	case sessionForkedMsg:
+		if m.sessionID != msg.parent || msg.upTo > len(m.messages) {
+			return m, nil // The conversation changed meanwhile
+		}
+		m.messages = m.messages[:msg.upTo]
+		m.sessionID = msg.id
+		m.rememberSession()
+		m.sessionTokens = 0 // A fork counts its own requests
+		for position := range m.pinned {
+			if position >= m.messageOffset+msg.upTo {
+				delete(m.pinned, position)
+			}
+		}
+		m.suggestions = nil
+		m.duplicateOf = ""
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf(
+			"Forked session #%d at message %d into session #%d; continue here, or /load %d to return.", msg.parent, msg.upTo, msg.id, msg.parent)))
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case passphraseNeededMsg:
+		m = m.askPassphrase(&passphrasePrompt{sessionID: int64(msg)},
+			fmt.Sprintf("Session #%d is encrypted. Enter its passphrase, or press Esc to cancel.", int64(msg)))
+		return m, nil
+
+	case sessionEncryptedMsg:
+		m.sessionID = msg.id
+		note := "This conversation is no longer encrypted."
+		if msg.encrypted {
+			note = fmt.Sprintf("Session #%d is now encrypted. Its name stays readable; /load asks for the passphrase.", msg.id)
+		}
+		if m.systemPrompt != "" {
+			if err := m.saveSystemPrompt(); err != nil {
+				note += fmt.Sprintf("\nFailed to save the system prompt: %v", err)
+			}
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(note))
+		m.viewport.GotoBottom()
 		return m, nil
 
+	case queueRetryMsg:
+		if m.streaming || len(m.queue) == 0 {
+			return m, nil // A finished stream sends the rest of the queue
+		}
+		return m.sendQueued()
+
+	case storeLoadedMsg:
+		m.store = (*storage.Store)(msg)
+		m.writer = storage.NewWriter(m.store, m.cfg.Timeouts.Persist)
+		if name := m.startTemplate; name != "" {
+			m.startTemplate = ""
+			started, _ := m.newFromTemplate(name)
+			return started, waitForSaveError(m.writer)
+		}
+		if m.continueLast {
+			m.continueLast = false
+			resumed, cmd := m.loadLastSession()
+			return resumed, tea.Batch(waitForSaveError(m.writer), cmd)
+		}
+		return m, waitForSaveError(m.writer)
+
+	case saveErrorMsg:
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: failed to save messages: %v", msg.err)))
+		m.viewport.GotoBottom()
+		return m, waitForSaveError(m.writer)
+
+	case featuresProbedMsg:
+		return m.handleFeaturesProbed(msg)
+
+	case olderMessagesMsg:
+		return m.handleOlderMessages(msg)
+
 	case rendererLoadedMsg:
 		m.renderer = msg
 		// Re-render all messages now that we have a renderer
 		// This fixes the issue where early messages (or welcomed text) were plain text
-		for i := range m.messages {
-			rendered, err := m.renderer.Render(m.messages[i].Content)
-			if err == nil {
-				m.messages[i].Rendered = rendered
-			}
-		}
+		m.rerender()
 		m.viewport.SetContent(m.renderHistoryCache())
 		return m, nil
 
@@ -269,6 +821,58 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case sessionLoadedMsg:
 		return m.handleSessionLoaded(msg)
+
+	case recallResultsMsg:
+		return m.handleRecallResults(msg)
+
+	case compareResultsMsg:
+		return m.handleCompareResults(msg)
+
+	case outlineMsg:
+		if m.outline == nil {
+			m.outline = make(map[string]string, len(msg.summaries))
+		}
+		for key, summary := range msg.summaries {
+			m.outline[key] = summary
+		}
+		return m.showOutline()
+
+	case sessionSummarizedMsg:
+		note := "Summary: " + msg.summary
+		if msg.saved {
+			note += "\n(saved; /list shows it)"
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(note))
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case followUpsMsg:
+		if m.streaming || msg.after != len(m.messages) {
+			return m, nil // The conversation has moved on
+		}
+		m.suggestions = msg.suggestions
+		m.viewport.SetContent(m.renderHistoryCache())
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case imageSavedMsg:
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Image saved to "+msg.path))
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case transcriptionMsg:
+		if m.streaming {
+			return m, nil
+		}
+		return m.sendMessage(msg.text)
+
+	case sessionExportedMsg:
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Exported session #%d to %s.", msg.id, msg.path)))
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case sessionImportedMsg:
+		return m.handleSessionImported(msg)
 	}
 
 	return m, tea.Batch(tiCmd, vpCmd)
@@ -277,16 +881,117 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 // View renders the UI.
 func (m Model) View() string {
 	headerText := fmt.Sprintf("Chatty AI • %s", m.cfg.Model.Name)
+	if budget := m.cfg.Model.SessionTokenBudget; budget > 0 {
+		usage := fmt.Sprintf("%s/%s tokens", internal.FormatCount(int64(m.sessionTokens)), internal.FormatCount(int64(budget)))
+		if m.sessionTokens > budget {
+			usage = styleError.Render("⚠ " + usage + ", over budget")
+		}
+		headerText += " • " + usage
+	}
 	header := styleHeader.Render(headerText)
 
-	// Use textinput instead of textarea
-	textInputView := styleInput.Render(m.textinput.View())
+	input := m.textarea.View()
+	if m.passphrase != nil {
+		input = m.textinput.View()
+	}
+	textInputView := styleInput.Render(input)
 
-	return fmt.Sprintf("%s\n%s\n%s",
+	body := m.viewport.View()
+	if m.sidebarShown() {
+		body = lipgloss.JoinHorizontal(lipgloss.Top, m.renderSidebar(m.viewport.Height), body)
+	}
+	view := fmt.Sprintf("%s\n%s\n%s",
 		header,
-		m.viewport.View(),
+		body,
 		textInputView,
 	)
+	if m.cfg.UI.Center && !m.sidebarShown() && m.width > m.viewport.Width {
+		view = lipgloss.NewStyle().MarginLeft((m.width - m.viewport.Width) / 2).Render(view)
+	}
+	return view
+}
+
+// resize fits the conversation column to the terminal, beside the session
+// picker when it is open, and wraps the messages again when its width
+// changed.
+func (m *Model) resize() {
+	headerHeight := 2
+	footerHeight := m.inputHeight() + 4 // Input, its border and padding
+	width := m.columnWidth()
+	if m.sidebar.open && !m.sidebarShown() {
+		m.sidebar = sidebar{} // No longer fits beside the conversation
+	}
+	if m.height == 0 {
+		return // The terminal size is not known yet
+	}
+	if m.sidebarShown() {
+		width = min(width, m.width-sidebarWidth)
+	}
+	changed := width != m.viewport.Width
+	m.viewport.Width = width
+	m.viewport.Height = m.height - headerHeight - footerHeight
+	m.textarea.SetWidth(width - 4) // Account for padding/borders
+	m.textinput.Width = width - 4
+
+	if m.renderer != nil && changed {
+		m.renderer, _ = glamour.NewTermRenderer(
+			glamour.WithStylePath("dark"), // Use fixed dark style instead of auto detection
+			glamour.WithWordWrap(width-4),
+		)
+		m.rerender()
+		m.viewport.SetContent(m.renderHistoryCache())
+	}
+}
+
+// rerender renders every message again from its raw content, after the
+// renderer or the markdown setting changed.
+func (m *Model) rerender() {
+	for i := range m.messages {
+		rendered := m.renderContent(m.messages[i].Role, m.messages[i].Content)
+		if m.messages[i].Interrupted {
+			rendered += "\n" + interruptedNote()
+		}
+		if m.messages[i].Repeats > 0 {
+			rendered += "\n" + repeatsNote(m.messages[i].Repeats)
+		}
+		m.messages[i].Rendered = rendered
+	}
+}
+
+// maxInputLines is the tallest the message input grows before it scrolls.
+const maxInputLines = 8
+
+// inputHeight is the number of lines the input takes: one for a
+// passphrase, otherwise one per line of the message, up to maxInputLines.
+func (m Model) inputHeight() int {
+	if m.passphrase != nil {
+		return 1
+	}
+	return max(min(m.textarea.LineCount(), maxInputLines), 1)
+}
+
+// fitInput grows or shrinks the message input to its text, giving the
+// rest of the height to the conversation.
+func (m *Model) fitInput() {
+	if height := m.inputHeight(); height != m.textarea.Height() {
+		m.textarea.SetHeight(height)
+		m.resize()
+	}
+}
+
+// resetInput clears the message input back to a single line.
+func (m *Model) resetInput() {
+	m.textarea.Reset()
+	m.fitInput()
+}
+
+// columnWidth is the width of the reading column: the terminal width, capped
+// at ui.max_width.
+func (m Model) columnWidth() int {
+	if m.cfg.UI.MaxWidth > 0 && m.width > m.cfg.UI.MaxWidth {
+		return m.cfg.UI.MaxWidth
+	}
+	return m.width
 }
 
 // Helper functions
@@ -294,67 +999,211 @@ func (m Model) View() string {
 func (m Model) renderHistoryCache() string {
 	var b strings.Builder
 	for _, msg := range m.messages {
-		roleStyle := styleUserLabel
-		name := "You"
-		if msg.Role == "assistant" {
-			roleStyle = styleAILabel
-			name = "AI"
+		b.WriteString(m.renderMessage(msg))
+	}
+	if len(m.suggestions) > 0 {
+		b.WriteString(styleSystem.Render("Follow-ups (Alt+number to send):"))
+		b.WriteString("\n")
+		for i, suggestion := range m.suggestions {
+			b.WriteString(styleSystem.Render(fmt.Sprintf("  %d. %s", i+1, suggestion)))
+			b.WriteString("\n")
 		}
-
-		b.WriteString(roleStyle.Render(name + ":"))
+	}
+	for _, pending := range m.queue {
+		b.WriteString(styleUserLabel.Render(m.userLabel() + " (pending):"))
+		b.WriteString("\n")
+		b.WriteString(styleSystem.Render(pending))
 		b.WriteString("\n")
-		b.WriteString(msg.Rendered)
+	}
+	for _, attachment := range m.attachments {
+		b.WriteString(styleSystem.Render("📎 " + internal.FormatAttachment(attachment) + " (sent with your next message)"))
 		b.WriteString("\n")
 	}
 	return b.String()
 }
 
-func (m Model) renderCurrentStream() string {
-	return styleAILabel.Render("AI:") + "\n" + m.streamContent.String()
+// renderMessage renders a message with its role label.
+func (m Model) renderMessage(msg Message) string {
+	if msg.Role == "assistant" {
+		return styleAILabel.Render(m.assistantLabel()+":") + "\n" + msg.Rendered + "\n"
+	}
+	view := styleUserLabel.Render(m.userLabel()+":") + "\n" + msg.Rendered + "\n"
+	for _, attachment := range msg.Attachments {
+		view += styleSystem.Render("📎 "+internal.FormatAttachment(attachment)) + "\n"
+	}
+	return view
 }
 
-func (m Model) sendMessage(content string) (tea.Model, tea.Cmd) {
-	// Render user message immediately
-	var rendered string
-	var err error
-	if m.renderer != nil {
-		rendered, err = m.renderer.Render(content)
+// userLabel is the configured name and avatar for the user's messages.
+func (m Model) userLabel() string {
+	return displayLabel(m.cfg.UI.UserAvatar, m.cfg.UI.UserName, "You")
+}
+
+// assistantLabel is the configured name and avatar for answers.
+func (m Model) assistantLabel() string {
+	return displayLabel(m.cfg.UI.AssistantAvatar, m.cfg.UI.AssistantName, "AI")
+}
+
+func displayLabel(avatar, name, fallback string) string {
+	if name == "" {
+		name = fallback
 	}
-	if err != nil || m.renderer == nil {
-		rendered = content
+	if avatar == "" {
+		return name
 	}
+	return avatar + " " + name
+}
 
-	// Add user message
-	m.messages = append(m.messages, Message{
-		Message: internal.Message{Role: "user", Content: content},
-		Rendered: rendered,
-	})
-	
-	m.viewport.SetContent(m.renderHistoryCache())
-	m.viewport.GotoBottom()
+// suggestFollowUps requests follow-up questions for the last answer.
+func (m Model) suggestFollowUps() tea.Cmd {
+	model := m.cfg.UI.FollowUpModel
+	if model == "" {
+		model = m.cfg.Model.Name
+	}
+	client, history, after := m.client, m.contextMessages(), len(m.messages)
 
-	var sessionCmd tea.Cmd
-	// Ensure session (non-blocking)
-	if m.store != nil && m.sessionID == 0 {
-		sessionCmd = func() tea.Msg {
-			ctx := context.Background()
-			title := content
-			if len(title) > 50 { title = title[:50] }
-			id, err := m.store.CreateSession(ctx, title)
-			if err != nil {
-				return errMsg(err)
-			}
-			return sessionCreatedMsg(id)
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeouts.Request)
+		defer cancel()
+
+		suggestions, err := internal.SuggestFollowUps(ctx, client, model, history)
+		if err != nil || len(suggestions) == 0 {
+			return nil // Suggestions are optional; never interrupt the chat
+		}
+		return followUpsMsg{suggestions: suggestions, after: after}
+	}
+}
+
+// nameSession asks storage.title_model for a title for the new session and
+// saves it in place of the start of the first prompt. It is stopped when the
+// conversation is left before the title arrives.
+func (m *Model) nameSession() tea.Cmd {
+	model := m.titleModel()
+	client, store, history, id := m.client, m.store, m.contextMessages(), m.sessionID
+	timeout, persist := m.cfg.Timeouts.Request, m.cfg.Timeouts.Persist
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	m.needsTitle, m.titleCancel = false, cancel
+
+	return func() tea.Msg {
+		defer cancel()
+		title, err := internal.GenerateTitle(ctx, client, model, history)
+		if err != nil || title == "" {
+			return nil // The prompt still names the session
+		}
+		saveCtx, saveCancel := context.WithTimeout(ctx, persist)
+		defer saveCancel()
+		_ = store.UpdateSessionName(saveCtx, id, title)
+		return nil
+	}
+}
+
+// queueLastMessage moves the prompt that could not be delivered back into the
+// offline queue and schedules another attempt.
+func (m Model) queueLastMessage() (tea.Model, tea.Cmd) {
+	if last := len(m.messages) - 1; last >= 0 && m.messages[last].Role == "user" {
+		m.queue = append([]string{m.messages[last].Content}, m.queue...)
+		// The queued prompt is sent first, so its attachments go with it
+		m.attachments = append(m.messages[last].Attachments, m.attachments...)
+		m.messages = m.messages[:last]
+	}
+
+	note := fmt.Sprintf("Offline: %d message(s) queued, retrying every %s. Use /clear to discard them.", len(m.queue), offlineRetryInterval)
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(note))
+	m.viewport.GotoBottom()
+	return m, scheduleQueueRetry()
+}
+
+func scheduleQueueRetry() tea.Cmd {
+	return tea.Tick(offlineRetryInterval, func(time.Time) tea.Msg {
+		return queueRetryMsg{}
+	})
+}
+
+// sendQueued sends the oldest queued prompt.
+func (m Model) sendQueued() (tea.Model, tea.Cmd) {
+	next := m.queue[0]
+	m.queue = m.queue[1:]
+	return m.sendMessage(next)
+}
+
+// displayContent prepares message content for rendering. Tables in answers
+// are fitted to the viewport, and LaTeX math is shown as Unicode unless
+// ui.render_math is off.
+func (m Model) displayContent(role, content string) string {
+	content = ui.TagCodeFences(content)
+	if role != "assistant" {
+		return content
+	}
+	width := m.viewport.Width
+	if width == 0 {
+		width = 80
+	}
+	content = ui.FitTables(content, width-4)
+	if m.cfg.UI.RenderMath {
+		content = ui.RenderMath(content)
+	}
+	return content
+}
+
+func (m Model) renderCurrentStream() string {
+	view := styleAILabel.Render(m.assistantLabel()+":") + "\n" + m.streamContent.String()
+	if m.streamStatus != "" {
+		view += "\n" + styleSystem.Render(m.streamStatus)
+	}
+	return view
+}
+
+func (m Model) sendMessage(content string) (tea.Model, tea.Cmd) {
+	m.suggestions = nil
+
+	// Render user message immediately
+	rendered := m.renderContent("user", content)
+
+	// Add user message with the staged attachments
+	m.messages = append(m.messages, Message{
+		Message: internal.Message{Role: "user", Content: content, Attachments: m.attachments},
+		Rendered: rendered,
+	})
+	m.attachments = nil
+	
+	m.viewport.SetContent(m.renderHistoryCache())
+	m.viewport.GotoBottom()
+
+	var sessionCmd tea.Cmd
+	// Ensure session (non-blocking); an excluded prompt must not name it
+	if m.store != nil && m.sessionID == 0 && !m.privacy.Excludes(content) {
+		sessionCmd = func() tea.Msg {
+			ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeouts.Persist)
+			defer cancel()
+			title := content
+			if len(title) > 50 { title = title[:50] }
+			id, err := m.store.CreateSession(ctx, title)
+			if err != nil {
+				return errMsg(err)
+			}
+			return sessionCreatedMsg(id)
 		}
+		m.needsTitle = m.cfg.Storage.AutoTitle
 	}
 
 	m.streaming = true
 	m.streamContent.Reset()
+	m.streamToolTrace = nil
 	
-	ch := make(chan string)
+	ch := make(chan streamUpdate)
 	
 	// Start streaming command
-	streamCmd := startStream(m.client, m.messages, m.cfg.Model.Name, m.cfg.Model.Temperature, ch)
+	history, opts := m.pendingRequest()
+	// Token usage is shown with /meta and saved with the answer
+	opts.IncludeUsage = m.showMeta || m.store != nil
+	m.requestStart = time.Now()
+	m.finishReason = ""
+	m.requestPrompt = history
+	// The client ends the stream when the provider goes quiet for
+	// timeouts.stream, so a slow reasoning model is not cut off
+	ctx, cancel := context.WithCancel(context.Background())
+	m.streamCancel, m.streamStopped = cancel, false
+	streamCmd := startStream(ctx, m.client, m.tools, history, m.cfg.Model.Name, m.cfg.Model.Temperature, opts, ch)
 	
 	if sessionCmd != nil {
 		return m, tea.Batch(sessionCmd, streamCmd)
@@ -362,62 +1211,237 @@ func (m Model) sendMessage(content string) (tea.Model, tea.Cmd) {
 	return m, streamCmd
 }
 
-func startStream(client *internal.Client, messages []Message, model string, temp float64, ch chan string) tea.Cmd {
-	// Convert back to internal.Message
-	internalMessages := make([]internal.Message, len(messages))
-	for i, msg := range messages {
-		internalMessages[i] = msg.Message
+// pendingRequest assembles the messages and options sent for the conversation
+// as it currently stands.
+func (m Model) pendingRequest() ([]internal.Message, internal.RequestOptions) {
+	opts := internal.RequestOptionsFromConfig(m.cfg)
+	opts.Stop = m.stop
+	return m.length.Apply(m.contextMessages(), opts)
+}
+
+// plainMessages returns the loaded conversation without its renderings.
+func (m Model) plainMessages() []internal.Message {
+	history := make([]internal.Message, len(m.messages))
+	for i, msg := range m.messages {
+		history[i] = msg.Message
+	}
+	return history
+}
+
+// contextMessages returns the conversation trimmed to the configured history
+// window, keeping pinned messages regardless of their age, after the system
+// prompt.
+func (m Model) contextMessages() []internal.Message {
+	history := m.plainMessages()
+
+	pinned := make(map[int]bool, len(m.pinned))
+	for position := range m.pinned {
+		if index := position - m.messageOffset; index >= 0 && index < len(history) {
+			pinned[index] = true
+		}
+	}
+
+	trimmed := internal.TrimHistory(history, m.cfg.Model.MaxHistory, pinned)
+	// Providers only take tool messages with tools in the request; without
+	// them the answers' text already shows the calls and their output
+	if m.tools != nil {
+		trimmed = internal.ExpandToolTrace(trimmed)
 	}
+	if len(m.recalled) > 0 {
+		trimmed = append(append([]internal.Message{}, m.recalled...), trimmed...)
+	}
+	return internal.WithSystemPrompt(trimmed, m.systemPrompt)
+}
 
+func startStream(ctx context.Context, client internal.ChatProvider, tools *internal.Toolbox, internalMessages []internal.Message, model string, temp float64, opts internal.RequestOptions, ch chan streamUpdate) tea.Cmd {
 	return func() tea.Msg {
 		go func() {
-			ctx := context.Background()
-			err := client.ChatStream(ctx, internalMessages, model, temp, func(chunk string) error {
-				ch <- chunk
+			defer close(ch)
+			onEvent := func(event internal.StreamEvent) error {
+				ch <- streamUpdate{event: event}
 				return nil
-			})
+			}
+			var err error
+			if tools != nil {
+				err = tools.Stream(ctx, client, internalMessages, model, temp, opts, onEvent)
+			} else {
+				err = client.ChatStreamEvents(ctx, internalMessages, model, temp, opts, onEvent)
+			}
 			if err != nil {
-				// Send error through a side channel or just handle it?
-				// Ideally we send a special message to ch or use a separate errCh.
-				// For simplicity in this structure, we can't easily send error via ch (string).
-				// But we should log it or something.
-				// Actually, we can't send tea.Msg from here.
+				ch <- streamUpdate{err: err}
 			}
-			close(ch)
 		}()
 		return waitForChunk(ch)()
 	}
 }
 
-func waitForChunk(ch chan string) tea.Cmd {
+// stopStream releases the context of the finished stream.
+func (m *Model) stopStream() {
+	if m.streamCancel != nil {
+		m.streamCancel()
+		m.streamCancel = nil
+	}
+}
+
+// replyMeta describes the request that produced the latest answer. The token
+// counts are only known when the request completed.
+func (m Model) replyMeta(complete bool) *storage.MessageMeta {
+	temperature := m.cfg.Model.Temperature
+	meta := &storage.MessageMeta{Model: m.cfg.Model.Name, Temperature: &temperature}
+	if !complete {
+		return meta
+	}
+	if model := m.client.LastModel(); model != "" {
+		meta.Model = model
+	}
+	if usage := m.client.LastUsage(); usage != nil {
+		meta.PromptTokens, meta.CompletionTokens = usage.PromptTokens, usage.CompletionTokens
+	}
+	return meta
+}
+
+// interruptedNote marks answers whose stream was stopped or timed out.
+func interruptedNote() string {
+	return styleSystem.Render("(interrupted)")
+}
+
+// repeatsNote marks a question that was sent again and saved only once.
+func repeatsNote(n int) string {
+	if n == 1 {
+		return styleSystem.Render("(sent again once)")
+	}
+	return styleSystem.Render(fmt.Sprintf("(sent again %d times)", n))
+}
+
+func waitForChunk(ch chan streamUpdate) tea.Cmd {
 	return func() tea.Msg {
-		chunk, ok := <-ch
+		update, ok := <-ch
 		if !ok {
 			return streamDoneMsg{}
 		}
-		return streamChunkMsg{chunk: chunk, ch: ch}
+		if update.err != nil {
+			return streamErrorMsg(update.err)
+		}
+		return streamChunkMsg{event: update.event, ch: ch}
 	}
 }
 
+// persistLastExchange queues the last question and answer to be saved.
 func (m Model) persistLastExchange() {
-	if m.store == nil {
+	if m.writer == nil || m.sessionID == 0 {
 		return
 	}
 	if len(m.messages) < 2 {
 		return
 	}
 	userMsg := m.messages[len(m.messages)-2].Message
-	aiMsg := m.messages[len(m.messages)-1].Message
-	
-	ctx := context.Background()
+	aiMsg := m.messages[len(m.messages)-1]
+	if m.privacy.Excludes(userMsg.Content) {
+		return
+	}
+
 	batch := []storage.Message{
-		{Role: userMsg.Role, Content: userMsg.Content},
-		{Role: aiMsg.Role, Content: aiMsg.Content},
+		{Role: userMsg.Role, Content: userMsg.Content, Attachments: userMsg.Attachments},
+		{Role: aiMsg.Role, Content: aiMsg.Content, Interrupted: aiMsg.Interrupted, ToolCalls: aiMsg.ToolTrace},
+	}
+	if aiMsg.Meta != nil {
+		batch[1].Meta = *aiMsg.Meta
+	}
+	m.writer.Save(m.sessionID, batch...)
+}
+
+// flushWriter waits, up to timeouts.persist, for the exchanges being saved.
+// Saves that fail are reported through waitForSaveError.
+func (m Model) flushWriter() {
+	if m.writer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeouts.Persist)
+	defer cancel()
+	m.writer.Flush(ctx)
+}
+
+// closeWriter saves the queued exchanges before the program exits.
+func (m Model) closeWriter() {
+	if m.writer != nil {
+		m.writer.Close()
+	}
+}
+
+// reuseAnswer answers the repeated question with the earlier answer, without
+// a request, and saves the exchange like any other.
+func (m Model) reuseAnswer() (tea.Model, tea.Cmd) {
+	// The conversation may have been cleared or replaced since
+	if m.duplicateOf == "" || m.duplicateAnswer >= len(m.messages) || m.messages[m.duplicateAnswer].Role != "assistant" {
+		m.duplicateOf = ""
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("No repeated question to answer."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	prompt, answer := m.duplicateOf, m.messages[m.duplicateAnswer].Content
+	note := styleSystem.Render(fmt.Sprintf("(earlier answer, message #%d)", m.duplicateAnswer+1))
+	m.duplicateOf = ""
+	m.suggestions = nil
+
+	m.messages = append(m.messages,
+		Message{Message: internal.Message{Role: "user", Content: prompt}, Rendered: m.renderContent("user", prompt)},
+		Message{Message: internal.Message{Role: "assistant", Content: answer}, Rendered: m.renderContent("assistant", answer) + "\n" + note},
+	)
+	m.viewport.SetContent(m.renderHistoryCache())
+	m.viewport.GotoBottom()
+
+	if m.store == nil || m.privacy.Excludes(prompt) {
+		return m, nil
+	}
+	if m.sessionID != 0 {
+		m.persistLastExchange()
+		return m, nil
+	}
+	store, timeout := m.store, m.cfg.Timeouts.Persist
+	title := prompt
+	if len(title) > 50 {
+		title = title[:50]
+	}
+	// The exchange is saved once the session exists, see sessionCreatedMsg
+	return m, func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		id, err := store.CreateSession(ctx, title)
+		if err != nil {
+			return errMsg(err)
+		}
+		return sessionCreatedMsg(id)
+	}
+}
+
+// renderContent renders message content as markdown, or shows it as it is
+// while the renderer is not ready or markdown is turned off.
+func (m Model) renderContent(role, content string) string {
+	display := m.displayContent(role, content)
+	if !m.renderMarkdown {
+		return wrapPlain(display, m.viewport.Width-4)
 	}
-	m.store.AppendMessagesBatch(ctx, m.sessionID, batch)
+	if m.renderer == nil {
+		return display
+	}
+	rendered, err := m.renderer.Render(display)
+	if err != nil {
+		return display
+	}
+	return rendered
 }
 
 func (m Model) handleCommand(input string) (tea.Model, tea.Cmd) {
+	// A /grep pattern needs characters commands may not contain; it is only
+	// ever compiled as a regular expression, taken as typed. /find text,
+	// such as a line of code, is only ever compared.
+	if fields := strings.Fields(input); fields[0] == "/grep" && len(input) <= validation.MaxCommandLength {
+		return m.handleGrepCommand(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(input), "/grep")))
+	}
+	if fields := strings.Fields(input); fields[0] == "/find" && len(input) <= validation.MaxCommandLength {
+		return m.handleFindCommand(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(input), "/find")))
+	}
+
 	// Validate command input
 	if err := validation.ValidateCommand(input); err != nil {
 		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Invalid command: "+err.Error()))
@@ -425,6 +1449,10 @@ func (m Model) handleCommand(input string) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	// Commands read and change saved sessions, so they must see every
+	// exchange saved before them
+	m.flushWriter()
+
 	// Sanitize command
 	sanitizedCmd := validation.SanitizeInput(input, validation.MaxCommandLength)
 
@@ -433,14 +1461,58 @@ func (m Model) handleCommand(input string) (tea.Model, tea.Cmd) {
 
 	switch cmd {
 	case "/exit", "/quit":
+		m.closeWriter()
 		return m, tea.Quit
 
 	case "/clear", "/reset":
-		m.messages = []Message{}
+		m.clearConversation()
 		m.viewport.SetContent("History cleared.")
-		m.sessionID = 0
 		return m, nil
 
+	case "/reuse":
+		return m.reuseAnswer()
+
+	case "/summarize":
+		return m.handleSummarizeCommand(parts[1:])
+	case "/system":
+		return m.handleSystemCommand(strings.TrimSpace(strings.TrimPrefix(sanitizedCmd, "/system")))
+
+	case "/last":
+		return m.loadLastSession()
+
+	case "/new-from":
+		if len(parts) < 2 {
+			return m.listSessionTemplates()
+		}
+		return m.newFromTemplate(parts[1])
+
+	case "/save-template", "/delete-template":
+		return m.handleSessionTemplateCommand(parts)
+
+	case "/sensitive":
+		return m.handleSensitiveCommand(parts[1:])
+
+	case "/fork":
+		return m.handleForkCommand(parts[1:])
+
+	case "/clone":
+		return m.handleCloneCommand(parts[1:])
+
+	case "/forget-last":
+		return m.forgetLast()
+
+	case "/retry":
+		return m.retryLast()
+
+	case "/diff-retry":
+		return m.handleDiffRetryCommand()
+
+	case "/pin", "/unpin", "/pin-session", "/unpin-session", "/archive", "/unarchive", "/delete", "/undelete":
+		return m.handleSessionFlagCommand(parts)
+
+	case "/trash":
+		return m.handleTrashCommand(parts[1:])
+
 	case "/help":
 		help := `Available commands:
 /exit, /quit           - Exit application
@@ -448,8 +1520,51 @@ func (m Model) handleCommand(input string) (tea.Model, tea.Cmd) {
 /help                  - Show this help
 /history               - Show conversation history
 /markdown              - Toggle markdown rendering on/off
-/list, /sessions       - List saved conversations
+/list, /sessions [--all] - Pick a saved conversation in the sidebar (--all includes archived ones; Ctrl+B toggles it)
 /load <id>             - Load a saved conversation by ID
+/last                  - Reopen the conversation you last worked in (also ./chatty --continue)
+/reuse                 - Answer a repeated question with the earlier answer
+/sensitive [off]       - Encrypt this conversation with a passphrase (off decrypts it)
+/fork [n]              - Continue a copy of this conversation from message n (default: the last)
+/clone [id]            - Continue in a copy of a saved conversation (default: this one)
+/forget-last           - Remove the last question and answer from the conversation and from disk
+/retry                 - Ask the last question again for a new answer
+/diff-retry            - Show what changed between the answer replaced by /retry and the new one
+/pin-session [id], /unpin-session [id] - Pin a saved conversation (default: this one) to the top of /list, or unpin it (also /pin, /unpin)
+/archive [id], /unarchive [id] - Hide a saved conversation (default: this one) from /list, or bring it back
+/delete [id]           - Move a saved conversation (default: this one) to the trash
+/trash [empty]         - List deleted conversations, or purge them now
+/undelete <id>         - Restore a conversation from the trash
+/pin-context [n]       - Always include message n in the context (no args lists pins)
+/unpin-context <n>     - Remove the pin from message n
+/length [preset]       - Set response length: short, normal, detailed
+/stopwords [list|off|reset] - Show or set this session's stop sequences (comma-separated, \n = newline)
+/system [text|off]     - Show, set or remove this session's system prompt, saved with it
+/summarize [--save]    - Sum up this conversation in one line (--save shows it in /list)
+/save-template <name>  - Save this conversation's system prompt, messages and model settings as a session template
+/new-from [template]   - Start a new conversation from a session template (no args lists them)
+/delete-template <name> - Delete a session template
+/template [name] [k=v]  - List templates or send one, asking for missing variables
+/logprobs              - Show token log probabilities of the last response
+/stats                 - Show sessions, messages and tokens by model and month
+/capabilities [refresh] - Show which features the endpoint supports for the model, or probe it again
+/recall [--inject] <q> - Search past conversations by meaning (--inject adds results to the context)
+/use [name]            - Add a saved context snippet to the context (no args lists snippets)
+/compare <m1,m2> [q]   - Ask several models the same question side by side (default: last question)
+/preview [message]     - Show the exact request the next message would send, without sending it
+/meta                  - Toggle the footer with model, tokens, latency and cost after each answer
+/outline [n]           - Show a table of contents of the conversation, or jump to exchange n
+/image <prompt>        - Generate an image and save it to images.output_dir
+/speak                 - Read the last answer aloud
+/transcribe <file>     - Transcribe an audio file and send the text as your message
+/attach [file]         - Attach an image or file to your next message (no args lists attachments)
+/detach                - Remove the attachments from your next message
+/grep <regex>          - Show the lines of this conversation that match, with message numbers
+/find <text>           - List the messages of this conversation containing text, searching all of a long saved one
+/goto <n>              - Scroll to message n, as numbered by /history and /find
+/export chatty <id> <file> - Save a conversation to a single-file archive
+/export md|json|html [id] <file> - Save a readable transcript (default: this conversation)
+/import chatty <file>  - Restore a conversation from an archive as a new session
 
 You can also ask questions directly like:
 "What is an LLM?" or "Explain Go programming"`
@@ -468,6 +1583,9 @@ You can also ask questions directly like:
 					role = "Assistant"
 				}
 				history += fmt.Sprintf("[%d] %s:\n", i+1, role)
+				if msg.Meta != nil && !msg.Meta.IsZero() {
+					history += "(" + msg.Meta.String() + ")\n"
+				}
 				history += strings.Repeat("-", 30) + "\n"
 				history += msg.Content + "\n\n"
 			}
@@ -477,14 +1595,18 @@ You can also ask questions directly like:
 		return m, nil
 
 	case "/markdown":
-		// Toggle markdown rendering
-		// This would need to be implemented as a state in the model
-		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Markdown toggle functionality not yet implemented in TUI mode."))
+		m.renderMarkdown = !m.renderMarkdown
+		m.rerender()
+		status := "on"
+		if !m.renderMarkdown {
+			status = "off; messages are shown as plain text"
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Markdown rendering "+status+"."))
 		m.viewport.GotoBottom()
 		return m, nil
 
 	case "/list", "/sessions":
-		return m.handleListCommand()
+		return m.handleListCommand(len(parts) > 1 && parts[1] == "--all")
 
 	case "/load":
 		if len(parts) < 2 {
@@ -494,6 +1616,170 @@ You can also ask questions directly like:
 		}
 		return m.handleLoadCommand(parts[1])
 
+	case "/pin-context":
+		if len(parts) < 2 {
+			return m.handleListPins()
+		}
+		return m.handlePinCommand(parts[1], true)
+
+	case "/unpin-context":
+		if len(parts) < 2 {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /unpin-context <message-number>"))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		return m.handlePinCommand(parts[1], false)
+
+	case "/logprobs":
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(internal.FormatLogprobs(m.client.LastLogprobs(), 200)))
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case "/capabilities":
+		if len(parts) > 1 && parts[1] == "refresh" {
+			prober, ok := m.client.(internal.FeatureProber)
+			if !ok {
+				m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("This provider cannot be probed."))
+				m.viewport.GotoBottom()
+				return m, nil
+			}
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Probing "+m.cfg.API.URL+"..."))
+			m.viewport.GotoBottom()
+			return m, probeFeatures(prober, m.cfg.API.URL, m.cfg.Model.Name, true)
+		}
+		status := "Features not probed yet. Use /capabilities refresh to probe the endpoint."
+		if m.features != nil {
+			status = fmt.Sprintf("%s at %s (probed %s): %s",
+				m.features.Model, m.features.URL, m.features.ProbedAt.Local().Format("2006-01-02"), m.features)
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(status))
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case "/stats":
+		if m.store == nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		stats, err := m.store.Stats(context.Background())
+		if err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+		} else {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(internal.FormatStats(stats)))
+		}
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case "/recall":
+		return m.handleRecallCommand(parts[1:])
+
+	case "/use":
+		return m.handleUseCommand(parts[1:])
+
+	case "/transcribe":
+		return m.handleTranscribeCommand(parts[1:])
+
+	case "/attach":
+		return m.handleAttachCommand(parts[1:])
+
+	case "/detach":
+		m.attachments = nil
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Attachments removed."))
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case "/goto":
+		if len(parts) != 2 {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /goto <n>"))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 1 || n > len(m.messages) {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("No message %s. Use /history or /find to see message numbers.", parts[1])))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		return m.scrollToMessage(n - 1)
+
+	case "/outline":
+		if len(parts) > 1 {
+			return m.jumpToExchange(parts[1])
+		}
+		return m.handleOutlineCommand()
+
+	case "/image":
+		return m.handleImageCommand(strings.Join(parts[1:], " "))
+
+	case "/speak":
+		for i := len(m.messages) - 1; i >= 0; i-- {
+			if m.messages[i].Role == "assistant" {
+				return m, m.speak(m.messages[i].Content)
+			}
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("No answer to read yet."))
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case "/export":
+		return m.handleExportCommand(parts[1:])
+
+	case "/import":
+		return m.handleImportCommand(parts[1:])
+
+	case "/compare":
+		return m.handleCompareCommand(parts[1:])
+
+	case "/meta":
+		m.showMeta = !m.showMeta
+		status := "Response metadata footer disabled."
+		if m.showMeta {
+			status = "Response metadata footer enabled."
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(status))
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case "/preview":
+		pending := strings.Join(parts[1:], " ")
+		if strings.TrimSpace(pending) != "" {
+			m.messages = append(m.messages[:len(m.messages):len(m.messages)], Message{
+				Message: internal.Message{Role: "user", Content: pending},
+			})
+		}
+		history, opts := m.pendingRequest()
+		preview := internal.FormatRequestPreview(history, m.cfg.Model.Name, m.cfg.Model.Temperature, true, opts)
+		if strings.TrimSpace(pending) != "" {
+			m.messages = m.messages[:len(m.messages)-1]
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(preview))
+		m.viewport.GotoBottom()
+		return m, nil
+
+	case "/stopwords":
+		return m.handleStopwordsCommand(strings.Join(parts[1:], " "))
+
+	case "/template":
+		return m.handleTemplateCommand(parts[1:])
+
+	case "/length":
+		if len(parts) < 2 {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Response length: %s (options: short, normal, detailed)", m.length.Name)))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		preset, err := internal.LookupLengthPreset(parts[1])
+		if err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(err.Error()))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		m.length = preset
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Response length set to %s.", preset.Name)))
+		m.viewport.GotoBottom()
+		return m, nil
+
 	default:
 		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Unknown command: "+cmd+"\nUse /help to see available commands."))
 		m.viewport.GotoBottom()
@@ -501,7 +1787,7 @@ You can also ask questions directly like:
 	}
 }
 
-func (m Model) handleListCommand() (tea.Model, tea.Cmd) {
+func (m Model) handleListCommand(all bool) (tea.Model, tea.Cmd) {
 	if m.store == nil {
 		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
 		m.viewport.GotoBottom()
@@ -510,7 +1796,11 @@ func (m Model) handleListCommand() (tea.Model, tea.Cmd) {
 
 	return m, func() tea.Msg {
 		ctx := context.Background()
-		sessions, err := m.store.ListSessions(ctx, 0)
+		list := m.store.ListSessions
+		if all {
+			list = m.store.ListAllSessions
+		}
+		sessions, err := list(ctx, 0)
 		if err != nil {
 			return errMsg(fmt.Errorf("failed to list sessions: %w", err))
 		}
@@ -538,76 +1828,585 @@ func (m Model) handleLoadCommand(sessionIDStr string) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	return m, func() tea.Msg {
-		ctx := context.Background()
-		transcript, err := m.store.LoadSession(ctx, sessionID)
-		if err != nil {
-			return errMsg(fmt.Errorf("failed to load session %d: %w", sessionID, err))
-		}
+	return m, m.loadSession(sessionID)
+}
 
-		return sessionLoadedMsg{transcript: transcript}
-	}
+// passphrasePrompt is a passphrase being asked for: to unlock sessionID, or
+// to encrypt the current session, where first holds the entry to confirm.
+type passphrasePrompt struct {
+	sessionID int64
+	encrypt   bool
+	first     string
 }
 
-var styleSystem = lipgloss.NewStyle().Foreground(ColorSystem)
+// askPassphrase swaps in the masked input and asks for a passphrase.
+func (m Model) askPassphrase(prompt *passphrasePrompt, note string) Model {
+	m.passphrase = prompt
+	m.textinput.Reset()
+	m.resize()
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(note))
+	m.viewport.GotoBottom()
+	return m
+}
 
-func (m Model) handleSessionsListed(msg sessionsListedMsg) (tea.Model, tea.Cmd) {
-	if msg.message != "" {
-		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(msg.message))
-		m.viewport.GotoBottom()
+// endPassphrase brings back the message input.
+func (m Model) endPassphrase() Model {
+	m.passphrase = nil
+	m.textinput.Reset()
+	m.resize()
+	return m
+}
+
+// enterPassphrase handles a passphrase typed for the pending prompt.
+func (m Model) enterPassphrase(passphrase string) (tea.Model, tea.Cmd) {
+	prompt := *m.passphrase
+	m = m.endPassphrase()
+	if m.store == nil {
 		return m, nil
 	}
 
-	sessionsList := "Saved Sessions:\n" + strings.Repeat("=", 50) + "\n"
-	for _, session := range msg.sessions {
-		title := session.Name
-		if strings.TrimSpace(title) == "" {
-			title = "Untitled session"
+	if !prompt.encrypt {
+		store, id := m.store, prompt.sessionID
+		return m, func() tea.Msg {
+			if err := store.UnlockSession(context.Background(), id, passphrase); err != nil {
+				return errMsg(fmt.Errorf("failed to unlock session %d: %w", id, err))
+			}
+			return m.loadSession(id)()
 		}
-		sessionsList += fmt.Sprintf("#%d: %s\n", session.ID, title)
-		sessionsList += fmt.Sprintf("     %d messages • Last updated %s\n\n",
-			session.MessageCount, formatRelative(session.UpdatedAt))
 	}
 
-	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(sessionsList))
-	m.viewport.GotoBottom()
-	return m, nil
-}
-
-func (m Model) handleSessionLoaded(msg sessionLoadedMsg) (tea.Model, tea.Cmd) {
-	transcript := msg.transcript
-	title := transcript.Summary.Name
-	if strings.TrimSpace(title) == "" {
-		title = "Untitled session"
+	if prompt.first == "" {
+		if len(passphrase) < storage.MinPassphraseLength {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(
+				fmt.Sprintf("The passphrase must be at least %d characters.", storage.MinPassphraseLength)))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		prompt.first = passphrase
+		return m.askPassphrase(&prompt, "Repeat the passphrase."), nil
+	}
+	if passphrase != prompt.first {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("The passphrases do not match."))
+		m.viewport.GotoBottom()
+		return m, nil
 	}
 
-	// Clear current messages and load from transcript
-	m.messages = make([]Message, 0, len(transcript.Messages))
-	m.sessionID = transcript.Summary.ID
+	store, id, timeout := m.store, m.sessionID, m.cfg.Timeouts.Persist
+	return m, func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if id == 0 {
+			// Nothing is saved yet. A neutral name, since the first question
+			// would otherwise become it
+			created, err := store.CreateSession(ctx, "Sensitive conversation")
+			if err != nil {
+				return errMsg(fmt.Errorf("failed to create session: %w", err))
+			}
+			id = created
+		}
+		if err := store.EncryptSession(ctx, id, passphrase); err != nil {
+			return errMsg(fmt.Errorf("failed to encrypt session: %w", err))
+		}
+		return sessionEncryptedMsg{id: id, encrypted: true}
+	}
+}
 
-	// Convert storage messages to TUI messages
-	for _, storageMsg := range transcript.Messages {
-		tuiMsg := Message{
-			Message: internal.Message{
-				Role:    storageMsg.Role,
-				Content: storageMsg.Content,
-			},
-			Rendered: "", // Will be rendered when renderer is available
-		}
-
-		// Render if renderer is available
-		if m.renderer != nil {
-			rendered, err := m.renderer.Render(storageMsg.Content)
-			if err == nil {
-				tuiMsg.Rendered = rendered
-			} else {
-				tuiMsg.Rendered = storageMsg.Content
+// handleSensitiveCommand encrypts the current session with a passphrase, or
+// with "off" stores it as plain text again.
+func (m Model) handleSensitiveCommand(args []string) (tea.Model, tea.Cmd) {
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if len(args) == 0 {
+		return m.askPassphrase(&passphrasePrompt{encrypt: true},
+			"Enter a passphrase for this conversation, or press Esc to cancel. It cannot be recovered if forgotten."), nil
+	}
+	if args[0] != "off" || m.sessionID == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /sensitive [off] (off needs a saved conversation)"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	store, id := m.store, m.sessionID
+	return m, func() tea.Msg {
+		if err := store.DecryptSession(context.Background(), id); err != nil {
+			return errMsg(fmt.Errorf("failed to decrypt session: %w", err))
+		}
+		return sessionEncryptedMsg{id: id}
+	}
+}
+
+// handleSessionFlagCommand pins a saved session to the top of /list,
+// archives it out of the list or moves it to the trash, or undoes any of
+// these.
+func (m Model) handleSessionFlagCommand(parts []string) (tea.Model, tea.Cmd) {
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	// Without an id, the command applies to the current conversation
+	id := m.sessionID
+	if len(parts) > 1 {
+		if _, err := fmt.Sscanf(parts[1], "%d", &id); err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Invalid session ID: "+parts[1]))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+	}
+	if id == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: "+parts[0]+" <session-id>"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	var err error
+	var status string
+	ctx := context.Background()
+	switch parts[0] {
+	case "/pin", "/pin-session":
+		err = m.store.SetSessionPinned(ctx, id, true)
+		status = fmt.Sprintf("Session #%d is pinned to the top of /list.", id)
+	case "/unpin", "/unpin-session":
+		err = m.store.SetSessionPinned(ctx, id, false)
+		status = fmt.Sprintf("Session #%d is no longer pinned.", id)
+	case "/archive":
+		err = m.store.SetSessionArchived(ctx, id, true)
+		status = fmt.Sprintf("Session #%d is archived; /list --all still shows it.", id)
+	case "/unarchive":
+		err = m.store.SetSessionArchived(ctx, id, false)
+		status = fmt.Sprintf("Session #%d is back in /list.", id)
+	case "/delete":
+		err = m.store.DeleteSession(ctx, id)
+		status = fmt.Sprintf("Session #%d moved to the trash; /undelete %d restores it.", id, id)
+	case "/undelete":
+		err = m.store.UndeleteSession(ctx, id)
+		status = fmt.Sprintf("Session #%d restored.", id)
+	}
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if parts[0] == "/delete" && id == m.sessionID {
+		// Otherwise the next answer would be saved to the deleted session
+		m.clearConversation()
+	}
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(status))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// forgetLast removes the last question and everything after it from the
+// conversation, and from disk unless it was never saved.
+func (m Model) forgetLast() (tea.Model, tea.Cmd) {
+	start := -1
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].Role == "user" {
+			start = i
+			break
+		}
+	}
+	if start < 0 || m.streaming {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("There is no finished question to forget."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	prompt := m.messages[start].Content
+	m.messages = m.messages[:start]
+	for position := range m.pinned {
+		if position >= m.messageOffset+start {
+			delete(m.pinned, position)
+		}
+	}
+	m.suggestions = nil
+	m.duplicateOf = ""
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Forgot the last question and its answer."))
+	m.viewport.GotoBottom()
+
+	// Excluded exchanges were never saved
+	if m.store == nil || m.sessionID == 0 || m.privacy.Excludes(prompt) {
+		return m, nil
+	}
+	store, id := m.store, m.sessionID
+	return m, func() tea.Msg {
+		remaining, err := store.ForgetLastExchange(context.Background(), id)
+		if err != nil {
+			return errMsg(err)
+		}
+		return exchangeForgottenMsg{id: id, remaining: remaining}
+	}
+}
+
+// retryLast asks the last question again, replacing its answer here and on
+// disk. The replaced answer is kept for /diff-retry.
+func (m Model) retryLast() (tea.Model, tea.Cmd) {
+	n := len(m.messages)
+	if m.streaming || n < 2 || m.messages[n-1].Role != "assistant" || m.messages[n-2].Role != "user" {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("There is no finished answer to retry."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	prompt, answer := m.messages[n-2].Content, m.messages[n-1].Content
+	attachments := m.messages[n-2].Attachments
+
+	// Forget the saved exchange before the new answer is saved after it;
+	// excluded exchanges were never saved
+	if m.store != nil && m.sessionID != 0 && !m.privacy.Excludes(prompt) {
+		ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeouts.Persist)
+		remaining, err := m.store.ForgetLastExchange(ctx, m.sessionID)
+		cancel()
+		if err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		if remaining == 0 {
+			m.sessionID, m.messageOffset = 0, 0
+		}
+	}
+
+	for position := range m.pinned {
+		if position >= m.messageOffset+n-2 {
+			delete(m.pinned, position)
+		}
+	}
+	m.messages = m.messages[:n-2]
+	m.duplicateOf = ""
+	m.retried, m.retriedAt = answer, n-1
+	m.attachments = attachments
+	return m.sendMessage(prompt)
+}
+
+// handleDiffRetryCommand shows a word-level diff between the answer replaced
+// by /retry and the answer that replaced it.
+func (m Model) handleDiffRetryCommand() (tea.Model, tea.Cmd) {
+	n := len(m.messages)
+	if m.retried == "" || m.streaming || m.retriedAt != n-1 || m.messages[n-1].Role != "assistant" {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("No new answer to compare; use /retry to ask the last question again first."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	segments := internal.WordDiff(m.retried, m.messages[n-1].Content)
+	if len(segments) <= 1 && (len(segments) == 0 || segments[0].Op == internal.DiffEqual) {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("The new answer is the same as the previous one."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	var b strings.Builder
+	b.WriteString(styleSystem.Render("Changes from the previous answer (removed text struck through, new text in bold):") + "\n\n")
+	for _, segment := range segments {
+		switch segment.Op {
+		case internal.DiffEqual:
+			b.WriteString(segment.Text)
+		case internal.DiffDelete:
+			// Removed line breaks would only break the lines of the new text
+			if strings.TrimSpace(segment.Text) != "" {
+				b.WriteString(renderLines(styleDiffDelete, segment.Text))
 			}
-		} else {
-			tuiMsg.Rendered = storageMsg.Content
+		case internal.DiffInsert:
+			b.WriteString(renderLines(styleDiffInsert, segment.Text))
+		}
+	}
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + b.String())
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// renderLines styles each line of text on its own, since lipgloss pads a
+// multi-line block to its widest line.
+func renderLines(style lipgloss.Style, text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = style.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleForkCommand copies the conversation up to a message into a new
+// session and continues there, leaving the original as it was.
+func (m Model) handleForkCommand(args []string) (tea.Model, tea.Cmd) {
+	if m.store == nil || m.sessionID == 0 || len(m.messages) == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Only a saved conversation can be forked."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	upTo := len(m.messages)
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > len(m.messages) {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(
+				fmt.Sprintf("Usage: /fork [n], where n is a message number from 1 to %d (see /history)", len(m.messages))))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		upTo = n
+	}
+
+	store, parent, count := m.store, m.sessionID, m.messageOffset+upTo
+	return m, func() tea.Msg {
+		id, err := store.ForkSession(context.Background(), parent, count)
+		if err != nil {
+			return errMsg(fmt.Errorf("failed to fork session: %w", err))
+		}
+		return sessionForkedMsg{parent: parent, id: id, upTo: upTo}
+	}
+}
+
+// handleCloneCommand copies a saved conversation, by default the current
+// one, into a new session and loads the copy.
+func (m Model) handleCloneCommand(args []string) (tea.Model, tea.Cmd) {
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	source := m.sessionID
+	if len(args) > 0 {
+		if _, err := fmt.Sscanf(args[0], "%d", &source); err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Invalid session ID: "+args[0]))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+	}
+	if source == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /clone <session-id>"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	store, load := m.store, m.loadSession
+	return m, func() tea.Msg {
+		id, err := store.CloneSession(context.Background(), source)
+		if errors.Is(err, storage.ErrSessionLocked) {
+			return errMsg(fmt.Errorf("session #%d is encrypted; /load it first, then /clone without an id", source))
+		}
+		if err != nil {
+			return errMsg(fmt.Errorf("failed to clone session: %w", err))
+		}
+		return load(id)()
+	}
+}
+
+// clearConversation starts over with an empty, unsaved conversation.
+func (m *Model) clearConversation() {
+	m.cfg = m.baseCfg
+	m.unsavedSeeds = 0
+	m.messages = []Message{}
+	m.queue = nil
+	m.suggestions = nil
+	m.leaveSession()
+	m.pinned = make(map[int]bool)
+	m.messageOffset = 0
+	m.oldestMessageID = 0
+	m.length = defaultLengthPreset()
+	m.stop = m.cfg.Model.Stop
+	m.recalled = nil
+	m.attachments = nil
+	m.retried = ""
+	m.systemPrompt = ""
+	m.sessionTokens = 0
+}
+
+// handleTrashCommand lists the sessions in the trash, or purges them all
+// with "empty".
+func (m Model) handleTrashCommand(args []string) (tea.Model, tea.Cmd) {
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	ctx := context.Background()
+
+	if len(args) > 0 {
+		if args[0] != "empty" {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /trash [empty]"))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		purged, err := m.store.PurgeDeletedSessions(ctx, 0)
+		if err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Permanently deleted %d session(s).", purged)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	sessions, err := m.store.ListDeletedSessions(ctx)
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if len(sessions) == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("The trash is empty."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	list := "Trash:\n" + strings.Repeat("=", 50) + "\n"
+	for _, session := range sessions {
+		title := session.Name
+		if strings.TrimSpace(title) == "" {
+			title = "Untitled session"
+		}
+		list += fmt.Sprintf("#%d: %s\n", session.ID, title)
+		list += fmt.Sprintf("     %d messages • Deleted %s", session.MessageCount, formatRelative(session.DeletedAt))
+		if retention := m.cfg.Storage.TrashRetention; retention > 0 {
+			list += " • Purged " + session.DeletedAt.Add(retention).Local().Format("2006-01-02")
+		}
+		list += "\n\n"
+	}
+	list += "/undelete <id> restores a session; /trash empty deletes them all for good."
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(list))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// leaveSession forgets the current session, locking it again if it is
+// encrypted.
+func (m *Model) leaveSession() {
+	if m.store != nil && m.sessionID != 0 {
+		m.store.LockSession(m.sessionID)
+	}
+	if m.titleCancel != nil {
+		m.titleCancel()
+		m.titleCancel = nil
+	}
+	m.needsTitle = false
+	m.sessionID = 0
+}
+
+// rememberSession records the current session for /last and --continue.
+func (m Model) rememberSession() {
+	if m.store == nil || m.sessionID == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeouts.Persist)
+	defer cancel()
+	// Failing only leaves /last on an earlier session
+	_ = m.store.SetLastSession(ctx, m.sessionID)
+}
+
+// loadLastSession loads the session last worked in, with its full history.
+func (m Model) loadLastSession() (tea.Model, tea.Cmd) {
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeouts.Persist)
+	defer cancel()
+	id, err := m.store.LastSession(ctx)
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if id == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("No earlier conversation to continue."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if id == m.sessionID {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Session #%d is already open.", id)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	return m, m.loadSession(id)
+}
+
+// loadSession reads a saved session, asking for the passphrase of an
+// encrypted one that is still locked.
+func (m Model) loadSession(sessionID int64) tea.Cmd {
+	store := m.store
+	return func() tea.Msg {
+		ctx := context.Background()
+		transcript, err := store.LoadSession(ctx, sessionID)
+		if errors.Is(err, storage.ErrSessionLocked) {
+			return passphraseNeededMsg(sessionID)
+		}
+		if err != nil {
+			return errMsg(fmt.Errorf("failed to load session %d: %w", sessionID, err))
+		}
+
+		pinned, err := store.ListPinnedMessages(ctx, sessionID)
+		if err != nil {
+			return errMsg(fmt.Errorf("failed to load pinned messages for session %d: %w", sessionID, err))
 		}
 
-		m.messages = append(m.messages, tuiMsg)
+		return sessionLoadedMsg{transcript: transcript, pinned: pinned}
+	}
+}
+
+var styleSystem = lipgloss.NewStyle().Foreground(ColorSystem)
+
+func (m Model) handleSessionsListed(msg sessionsListedMsg) (tea.Model, tea.Cmd) {
+	if msg.message != "" {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(msg.message))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	m = m.openSidebar(msg.sessions)
+	if !m.sidebar.open {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf(
+			"The session picker needs a terminal at least %d columns wide; ./chatty /list prints the sessions instead.", sidebarWidth+sidebarMinChat)))
+		m.viewport.GotoBottom()
+	}
+	return m, nil
+}
+
+func (m Model) handleSessionLoaded(msg sessionLoadedMsg) (tea.Model, tea.Cmd) {
+	transcript := msg.transcript
+	title := transcript.Summary.Name
+	if strings.TrimSpace(title) == "" {
+		title = "Untitled session"
+	}
+
+	// Clear current messages and load from transcript
+	m.messages = make([]Message, 0, len(transcript.Messages))
+	if m.sessionID != transcript.Summary.ID {
+		m.leaveSession()
+	}
+	m.sessionID = transcript.Summary.ID
+	m.rememberSession()
+	m.sessionTokens = transcript.Summary.PromptTokens + transcript.Summary.CompletionTokens
+	m.messageOffset = transcript.Summary.MessageCount - len(transcript.Messages)
+	if m.messageOffset < 0 {
+		m.messageOffset = 0
+	}
+	m.pinned = make(map[int]bool, len(msg.pinned))
+	for _, position := range msg.pinned {
+		m.pinned[position] = true
+	}
+	m.cfg = m.baseCfg
+	m.unsavedSeeds = 0
+	m.length = defaultLengthPreset()
+	m.stop = m.cfg.Model.Stop
+	m.systemPrompt = transcript.Summary.SystemPrompt
+	m.recalled = nil
+	m.attachments = nil
+	m.retried = ""
+	m.suggestions = nil
+
+	m.oldestMessageID = 0
+	if len(transcript.Messages) > 0 {
+		m.oldestMessageID = transcript.Messages[0].ID
+	}
+
+	// Convert storage messages to TUI messages
+	for _, storageMsg := range transcript.Messages {
+		m.messages = append(m.messages, m.storedMessage(storageMsg))
 	}
 
 	// Update viewport content
@@ -617,30 +2416,1329 @@ func (m Model) handleSessionLoaded(msg sessionLoadedMsg) (tea.Model, tea.Cmd) {
 	// Show success message
 	successMsg := fmt.Sprintf("Loaded session #%d: %s\n%d messages loaded",
 		transcript.Summary.ID, title, len(transcript.Messages))
+	if m.messageOffset > 0 {
+		successMsg += fmt.Sprintf(" (%d earlier ones load as you scroll up)", m.messageOffset)
+	}
 	m.viewport.SetContent(m.viewport.View() + "\n" + styleSystem.Render(successMsg))
 	m.viewport.GotoBottom()
 
 	return m, nil
 }
 
-// formatRelative formats a time relative to now (copied from main.go)
-func formatRelative(t time.Time) string {
-	if t.IsZero() {
-		return "unknown"
+// storedMessage converts a saved message for display.
+func (m Model) storedMessage(storageMsg storage.Message) Message {
+	tuiMsg := Message{
+		Message: internal.Message{
+			Role:        storageMsg.Role,
+			Content:     storageMsg.Content,
+			Attachments: storageMsg.Attachments,
+			ToolTrace:   storageMsg.ToolCalls,
+		},
+		Rendered:    m.renderContent(storageMsg.Role, storageMsg.Content),
+		Interrupted: storageMsg.Interrupted,
+		Repeats:     storageMsg.Repeats,
 	}
-
-	delta := time.Since(t)
-	if delta < time.Minute {
-		return "just now"
+	if !storageMsg.Meta.IsZero() {
+		meta := storageMsg.Meta
+		tuiMsg.Meta = &meta
 	}
-	if delta < time.Hour {
-		return fmt.Sprintf("%d min ago", int(delta.Minutes()))
+	if tuiMsg.Interrupted {
+		tuiMsg.Rendered += "\n" + interruptedNote()
 	}
-	if delta < 24*time.Hour {
-		return fmt.Sprintf("%d hr ago", int(delta.Hours()))
+	if tuiMsg.Repeats > 0 {
+		tuiMsg.Rendered += "\n" + repeatsNote(tuiMsg.Repeats)
 	}
-	if delta < 30*24*time.Hour {
-		return fmt.Sprintf("%d d ago", int(delta.Hours()/24))
+	return tuiMsg
+}
+
+// loadOlderMessages fetches the page of messages before the first one shown
+// when the user scrolls to the top of a session that was loaded in part.
+func (m *Model) loadOlderMessages(msg tea.Msg) tea.Cmd {
+	switch msg.(type) {
+	case tea.KeyMsg, tea.MouseMsg:
+	default:
+		return nil
+	}
+	if m.store == nil || m.sessionID == 0 || m.messageOffset == 0 || m.oldestMessageID == 0 || m.loadingOlder || !m.viewport.AtTop() {
+		return nil
+	}
+	m.loadingOlder = true
+
+	store, sessionID, beforeID := m.store, m.sessionID, m.oldestMessageID
+	return func() tea.Msg {
+		messages, err := store.LoadMessagesBefore(context.Background(), sessionID, beforeID, 50)
+		if err != nil {
+			return errMsg(fmt.Errorf("failed to load earlier messages: %w", err))
+		}
+		return olderMessagesMsg{sessionID: sessionID, messages: messages}
+	}
+}
+
+// handleOlderMessages puts the earlier messages above the conversation,
+// keeping the lines on screen where they were.
+func (m Model) handleOlderMessages(msg olderMessagesMsg) (tea.Model, tea.Cmd) {
+	m.loadingOlder = false
+	if msg.sessionID != m.sessionID {
+		return m, nil
+	}
+	if len(msg.messages) == 0 {
+		m.messageOffset = 0
+		return m, nil
+	}
+
+	older := make([]Message, 0, len(msg.messages)+len(m.messages))
+	for _, storageMsg := range msg.messages {
+		older = append(older, m.storedMessage(storageMsg))
+	}
+	linesBefore := strings.Count(m.renderHistoryCache(), "\n")
+
+	added := len(msg.messages)
+	m.messages = append(older, m.messages...)
+	m.messageOffset -= added
+	if m.messageOffset < 0 {
+		m.messageOffset = 0
+	}
+	m.oldestMessageID = msg.messages[0].ID
+	// Indexes into m.messages move down with the rest
+	m.duplicateAnswer += added
+	m.retriedAt += added
+
+	content := m.renderHistoryCache()
+	m.viewport.SetContent(content)
+	m.viewport.SetYOffset(m.viewport.YOffset + strings.Count(content, "\n") - linesBefore)
+	return m, nil
+}
+
+// handlePinCommand pins or unpins the message with the given 1-based number as
+// shown by /history.
+func (m Model) handlePinCommand(arg string, pin bool) (tea.Model, tea.Cmd) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(m.messages) {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Invalid message number: %s (use /history to see message numbers)", arg)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	position := m.messageOffset + n - 1
+	status := fmt.Sprintf("Message %d pinned to the context.", n)
+	if pin {
+		m.pinned[position] = true
+	} else {
+		delete(m.pinned, position)
+		status = fmt.Sprintf("Message %d unpinned.", n)
+	}
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(status))
+	m.viewport.GotoBottom()
+
+	if m.store == nil || m.sessionID == 0 {
+		return m, nil
+	}
+
+	store, sessionID := m.store, m.sessionID
+	return m, func() tea.Msg {
+		ctx := context.Background()
+		var err error
+		if pin {
+			err = store.PinMessage(ctx, sessionID, position)
+		} else {
+			err = store.UnpinMessage(ctx, sessionID, position)
+		}
+		if err != nil {
+			return errMsg(fmt.Errorf("failed to update pinned messages: %w", err))
+		}
+		return nil
+	}
+}
+
+// handleListPins shows the messages currently pinned to the context.
+func (m Model) handleListPins() (tea.Model, tea.Cmd) {
+	var numbers []int
+	for position := range m.pinned {
+		if index := position - m.messageOffset; index >= 0 && index < len(m.messages) {
+			numbers = append(numbers, index+1)
+		}
+	}
+	sort.Ints(numbers)
+
+	status := "No pinned messages. Use /pin-context <n> to pin one."
+	if len(numbers) > 0 {
+		var b strings.Builder
+		b.WriteString("Pinned messages:\n")
+		for _, n := range numbers {
+			b.WriteString(fmt.Sprintf("  [%d] %s\n", n, truncate(m.messages[n-1].Content, 60)))
+		}
+		status = b.String()
+	}
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(status))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// handleRecallCommand searches saved conversations for messages semantically
+// similar to the query.
+func (m Model) handleRecallCommand(args []string) (tea.Model, tea.Cmd) {
+	inject := false
+	if len(args) > 0 && args[0] == "--inject" {
+		inject = true
+		args = args[1:]
+	}
+	query := strings.Join(args, " ")
+	if strings.TrimSpace(query) == "" {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /recall [--inject] <query>"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	client, ok := m.client.(internal.Embedder)
+	if !ok {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("/recall is not supported by this provider."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Searching past conversations..."))
+	m.viewport.GotoBottom()
+
+	store, embeddings := m.store, m.cfg.Embeddings
+	return m, func() tea.Msg {
+		results, err := internal.Recall(context.Background(), client, store, embeddings.Model, query, embeddings.RecallLimit)
+		if err != nil {
+			return errMsg(fmt.Errorf("recall failed: %w", err))
+		}
+		return recallResultsMsg{query: query, results: results, inject: inject}
+	}
+}
+
+// handleRecallResults displays recall matches and optionally adds them to the
+// context of subsequent requests.
+func (m Model) handleRecallResults(msg recallResultsMsg) (tea.Model, tea.Cmd) {
+	if len(msg.results) == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("No past messages found for %q.", msg.query)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Recalled for %q:\n", msg.query))
+	for _, r := range msg.results {
+		b.WriteString(fmt.Sprintf("  #%d %s (%.2f): %s\n", r.SessionID, r.Role, r.Score, truncate(r.Content, 80)))
+	}
+	if msg.inject {
+		m.recalled = append(m.recalled, internal.RecallContext(msg.results))
+		b.WriteString("\nThese excerpts will be included in the context for this conversation.")
+	} else {
+		b.WriteString("\nUse /recall --inject <query> to include them in the context.")
+	}
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(b.String()))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// handleUseCommand adds a snippet saved with ./chatty context save to the
+// context of subsequent requests, or lists the snippets.
+func (m Model) handleUseCommand(args []string) (tea.Model, tea.Cmd) {
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		snippets, err := m.store.ListSnippets(ctx)
+		if err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		if len(snippets) == 0 {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("No snippets saved. Save one with ./chatty context save <name> <file>."))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		var b strings.Builder
+		b.WriteString("Context snippets:\n")
+		for _, snippet := range snippets {
+			b.WriteString(fmt.Sprintf("  %s (%d bytes)\n", snippet.Name, len(snippet.Content)))
+		}
+		b.WriteString("\nUse /use <name> to include one in the context.")
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(b.String()))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	snippet, err := m.store.GetSnippet(ctx, args[0])
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	message := snippetContext(snippet)
+	for _, recalled := range m.recalled {
+		if recalled.Role == message.Role && recalled.Content == message.Content {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Snippet %q is already in the context.", snippet.Name)))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+	}
+	m.recalled = append(m.recalled, message)
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Snippet %q will be included in the context for this conversation.", snippet.Name)))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// snippetContext wraps a snippet as a system message for the request context.
+func snippetContext(snippet *storage.Snippet) internal.Message {
+	return internal.Message{Role: "system", Content: fmt.Sprintf("Reference material %q:\n\n%s", snippet.Name, snippet.Content)}
+}
+
+// handleCompareCommand sends a prompt to several models concurrently. Without a
+// prompt the last question of the conversation is asked again. The answers are
+// shown for comparison only and are not added to the conversation.
+func (m Model) handleCompareCommand(args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /compare <model1,model2> [question]"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if m.streaming {
+		return m, nil
+	}
+
+	client, ok := m.client.(internal.ModelComparer)
+	if !ok {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("/compare is not supported by this provider."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	models, err := internal.ParseModelList(args[0])
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(err.Error()))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	history := m.contextMessages()
+	prompt := strings.Join(args[1:], " ")
+	if strings.TrimSpace(prompt) != "" {
+		history = append(history, internal.Message{Role: "user", Content: prompt})
+	} else {
+		last := -1
+		for i, msg := range history {
+			if msg.Role == "user" {
+				last = i
+			}
+		}
+		if last < 0 {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Nothing to compare yet. Use /compare <model1,model2> <question>."))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		prompt = history[last].Content
+		history = history[:last+1]
+	}
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Asking %s...", strings.Join(models, ", "))))
+	m.viewport.GotoBottom()
+
+	cfg := m.cfg
+	return m, func() tea.Msg {
+		results := client.ChatModels(context.Background(), history, models, cfg.Model.Temperature, func(model string) internal.RequestOptions {
+			return internal.RequestOptionsForModel(cfg, model)
+		})
+		return compareResultsMsg{prompt: prompt, results: results}
+	}
+}
+
+// handleCompareResults renders the answers of a comparison in side-by-side columns.
+func (m Model) handleCompareResults(msg compareResultsMsg) (tea.Model, tea.Cmd) {
+	width := m.viewport.Width - 4
+	if width <= 0 {
+		width = 80
+	}
+	columnWidth := width/len(msg.results) - 2
+
+	columns := make([]string, 0, len(msg.results))
+	for _, result := range msg.results {
+		header := styleAILabel.Render(fmt.Sprintf("%s (%.1fs)", result.Model, result.Duration.Seconds()))
+		body := strings.TrimSpace(result.Response)
+		if result.Err != nil {
+			body = styleError.Render(fmt.Sprintf("Error: %v", result.Err))
+		}
+		columns = append(columns, styleCompareColumn.Width(columnWidth).Render(header+"\n\n"+body))
+	}
+
+	comparison := styleSystem.Render(fmt.Sprintf("Comparison for %q:", truncate(msg.prompt, 60))) + "\n" +
+		lipgloss.JoinHorizontal(lipgloss.Top, columns...)
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + comparison)
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// wrapPlain wraps text at width columns for display without markdown.
+func wrapPlain(s string, width int) string {
+	if width <= 0 {
+		return s
+	}
+	return lipgloss.NewStyle().Width(width).Render(s)
+}
+
+// truncate shortens s to at most max runes on a single line.
+func truncate(s string, max int) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "\n", " ")
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-3]) + "..."
+}
+
+// formatRelative formats a time relative to now (copied from main.go)
+func formatRelative(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+
+	delta := time.Since(t)
+	if delta < time.Minute {
+		return "just now"
+	}
+	if delta < time.Hour {
+		return fmt.Sprintf("%d min ago", int(delta.Minutes()))
+	}
+	if delta < 24*time.Hour {
+		return fmt.Sprintf("%d hr ago", int(delta.Hours()))
+	}
+	if delta < 30*24*time.Hour {
+		return fmt.Sprintf("%d d ago", int(delta.Hours()/24))
+	}
+	return ui.FormatDate(t)
+}
+
+// handleTranscribeCommand transcribes an audio file and sends the transcript
+// as the next user message.
+func (m Model) handleTranscribeCommand(args []string) (tea.Model, tea.Cmd) {
+	if len(args) != 1 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /transcribe <audio-file>"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if m.streaming {
+		return m, nil
+	}
+	transcriber, ok := m.client.(internal.Transcriber)
+	if !ok {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("/transcribe is not supported by this provider."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	path, err := expandHome(args[0])
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(err.Error()))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Transcribing "+path+"..."))
+	m.viewport.GotoBottom()
+
+	audio := m.cfg.Audio
+	return m, func() tea.Msg {
+		text, err := transcriber.Transcribe(context.Background(), audio.TranscriptionModel, path, audio.Language)
+		if err != nil {
+			return errMsg(fmt.Errorf("transcription failed: %w", err))
+		}
+		return transcriptionMsg{text: text}
+	}
+}
+
+// handleAttachCommand stages a file for the next message, or lists the staged
+// files. The file is read now, so later changes to it are not sent, unless
+// storage.attachments is "reference".
+func (m Model) handleAttachCommand(args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		status := "No attachments. Use /attach <file> to send an image or file with your next message."
+		if len(m.attachments) > 0 {
+			status = fmt.Sprintf("%d attachment(s) will be sent with your next message; /detach removes them.", len(m.attachments))
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(status))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	path, err := expandHome(strings.Join(args, " "))
+	if err == nil {
+		var attachment storage.Attachment
+		if attachment, err = internal.LoadAttachment(path, m.cfg.Storage.Attachments == "reference"); err == nil {
+			m.attachments = append(m.attachments, attachment)
+		}
+	}
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	attached := m.attachments[len(m.attachments)-1]
+	if m.features != nil && !m.features.Vision && strings.HasPrefix(attached.MIMEType, "image/") {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Warning: %s does not accept images; the request may fail. /detach removes the attachment.", m.cfg.Model.Name)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	m.viewport.SetContent(m.renderHistoryCache())
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// handleFeaturesProbed keeps the probed features, turns off tools the model
+// cannot take and warns about the other features chatty relies on.
+func (m Model) handleFeaturesProbed(msg featuresProbedMsg) (tea.Model, tea.Cmd) {
+	m.features = msg.features
+
+	var notes []string
+	if msg.announce {
+		notes = append(notes, styleSystem.Render("Features: "+m.features.String()))
+	}
+	if !m.features.Tools && m.tools != nil {
+		m.tools = nil
+		notes = append(notes, styleError.Render(fmt.Sprintf("Warning: %s does not accept tools; tools are off for this session.", m.cfg.Model.Name)))
+	}
+	if !m.features.Streaming {
+		notes = append(notes, styleError.Render(fmt.Sprintf("Warning: %s does not seem to stream answers, which this interface needs; answers may fail.", m.cfg.Model.Name)))
+	}
+	if len(notes) == 0 {
+		return m, nil
+	}
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + strings.Join(notes, "\n"))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// handleSystemCommand shows, sets or removes ("off") the system prompt of
+// the session, saving it with a saved session at once and with a new one
+// when it is created.
+func (m Model) handleSystemCommand(arg string) (tea.Model, tea.Cmd) {
+	var status string
+	switch arg {
+	case "":
+		status = "No system prompt. Use /system <text> to set one for this session."
+		if m.systemPrompt != "" {
+			status = "System prompt: " + m.systemPrompt
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(status))
+		m.viewport.GotoBottom()
+		return m, nil
+	case "off":
+		m.systemPrompt = ""
+		status = "System prompt removed."
+	default:
+		m.systemPrompt = arg
+		status = "System prompt set; it is sent first with every request of this session."
+	}
+
+	if err := m.saveSystemPrompt(); err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(status))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// handleSummarizeCommand sums up the conversation in one line, and with
+// --save stores it with the session for /list.
+func (m Model) handleSummarizeCommand(args []string) (tea.Model, tea.Cmd) {
+	save := len(args) == 1 && args[0] == "--save"
+	if len(args) > 1 || (len(args) == 1 && !save) {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /summarize [--save]"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if len(m.messages) == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Nothing to summarize yet."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if save && (m.store == nil || m.sessionID == 0) {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("This conversation is not saved, so there is nowhere to keep its summary."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	client, store, model, history, id := m.client, m.store, m.titleModel(), m.contextMessages(), m.sessionID
+	timeout, persist := m.cfg.Timeouts.Request, m.cfg.Timeouts.Persist
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Summarizing..."))
+	m.viewport.GotoBottom()
+	return m, func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		summary, err := internal.SummarizeConversation(ctx, client, model, history)
+		if err != nil {
+			return errMsg(err)
+		}
+		if summary == "" {
+			return errMsg(errors.New("the model returned an empty summary"))
+		}
+		if !save {
+			return sessionSummarizedMsg{summary: summary}
+		}
+		saveCtx, saveCancel := context.WithTimeout(context.Background(), persist)
+		defer saveCancel()
+		if err := store.SetSessionSummary(saveCtx, id, summary); err != nil {
+			return errMsg(fmt.Errorf("failed to save the summary: %w", err))
+		}
+		return sessionSummarizedMsg{summary: summary, saved: true}
+	}
+}
+
+// refreshSummary saves a new summary of the session in the background
+// (storage.summary_every). Sensitive sessions are skipped: the summary would
+// be stored in the clear.
+func (m Model) refreshSummary() tea.Cmd {
+	client, store, model, history, id := m.client, m.store, m.titleModel(), m.contextMessages(), m.sessionID
+	timeout, persist := m.cfg.Timeouts.Request, m.cfg.Timeouts.Persist
+	return func() tea.Msg {
+		checkCtx, checkCancel := context.WithTimeout(context.Background(), persist)
+		sensitive, err := store.IsSessionSensitive(checkCtx, id)
+		checkCancel()
+		if err != nil || sensitive {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		summary, err := internal.SummarizeConversation(ctx, client, model, history)
+		if err != nil || summary == "" {
+			return nil // The previous summary stays
+		}
+		saveCtx, saveCancel := context.WithTimeout(context.Background(), persist)
+		defer saveCancel()
+		_ = store.SetSessionSummary(saveCtx, id, summary)
+		return nil
+	}
+}
+
+// titleModel is the model that writes session titles and summaries.
+func (m Model) titleModel() string {
+	if m.cfg.Storage.TitleModel != "" {
+		return m.cfg.Storage.TitleModel
+	}
+	return m.cfg.Model.Name
+}
+
+// saveSystemPrompt stores the system prompt with the current session, if
+// it is saved.
+func (m Model) saveSystemPrompt() error {
+	if m.store == nil || m.sessionID == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeouts.Persist)
+	defer cancel()
+	return m.store.SetSessionSystemPrompt(ctx, m.sessionID, m.systemPrompt)
+}
+
+// listSessionTemplates shows the saved session templates for /new-from.
+func (m Model) listSessionTemplates() (tea.Model, tea.Cmd) {
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	templates, err := m.store.ListSessionTemplates(context.Background())
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if len(templates) == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("No session templates saved. Save this conversation as one with /save-template <name>."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	var b strings.Builder
+	b.WriteString("Session templates:\n")
+	for _, template := range templates {
+		model := template.Model
+		if model == "" {
+			model = m.baseCfg.Model.Name
+		}
+		b.WriteString(fmt.Sprintf("  %s (%s, %d messages)\n", template.Name, model, len(template.Messages)))
+	}
+	b.WriteString("\nUse /new-from <name> to start a conversation from one.")
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(b.String()))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// newFromTemplate leaves the current conversation and starts one from the
+// named session template.
+func (m Model) newFromTemplate(name string) (tea.Model, tea.Cmd) {
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	template, err := m.store.GetSessionTemplate(context.Background(), name)
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	length := defaultLengthPreset()
+	if template.Length != "" {
+		if length, err = internal.LookupLengthPreset(template.Length); err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: template %q: %v", name, err)))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+	}
+
+	m.clearConversation()
+	if template.Model != "" || template.Temperature != nil {
+		cfg := *m.baseCfg
+		if template.Model != "" {
+			cfg.Model.Name = template.Model
+		}
+		if template.Temperature != nil {
+			cfg.Model.Temperature = *template.Temperature
+		}
+		m.cfg = &cfg
+	}
+	m.length = length
+	if template.Stop != nil {
+		m.stop = template.Stop
+	}
+	m.systemPrompt = template.SystemPrompt
+	for _, seed := range template.Messages {
+		m.messages = append(m.messages, m.storedMessage(storage.Message{Role: seed.Role, Content: seed.Content}))
+	}
+	m.unsavedSeeds = len(template.Messages)
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf(
+		"New conversation from template %q (%s, temperature %.2g, %s length, %d messages).", name, m.cfg.Model.Name, m.cfg.Model.Temperature, m.length.Name, len(template.Messages))))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// handleSessionTemplateCommand saves the current conversation as a session
+// template with /save-template, or deletes one with /delete-template.
+func (m Model) handleSessionTemplateCommand(parts []string) (tea.Model, tea.Cmd) {
+	if len(parts) != 2 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Usage: %s <name>", parts[0])))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeouts.Persist)
+	defer cancel()
+	name := parts[1]
+
+	if parts[0] == "/delete-template" {
+		if err := m.store.DeleteSessionTemplate(ctx, name); err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Deleted session template %q.", name)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	// Templates are stored in the clear
+	if m.sessionID != 0 {
+		if sensitive, err := m.store.IsSessionSensitive(ctx, m.sessionID); err != nil || sensitive {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("This conversation is encrypted; session templates are not, so it cannot be saved as one."))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+	}
+
+	temperature := m.cfg.Model.Temperature
+	template := &storage.SessionTemplate{
+		Name:         name,
+		SystemPrompt: m.systemPrompt,
+		Model:        m.cfg.Model.Name,
+		Temperature:  &temperature,
+		Length:       m.length.Name,
+		Stop:         append([]string{}, m.stop...),
+	}
+	for i := 0; i < len(m.messages); i++ {
+		msg := m.messages[i]
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		// A prompt kept off disk is left out together with its answer
+		if msg.Role == "user" && m.privacy.Excludes(msg.Content) {
+			if i+1 < len(m.messages) && m.messages[i+1].Role == "assistant" {
+				i++
+			}
+			continue
+		}
+		template.Messages = append(template.Messages, storage.TemplateMessage{Role: msg.Role, Content: msg.Content})
+	}
+
+	if err := m.store.SaveSessionTemplate(ctx, template); err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf(
+		"Saved session template %q with %d messages. Start a conversation from it with /new-from %s or ./chatty new --template %s.", name, len(template.Messages), name, name)))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// handleStopwordsCommand shows or changes the stop sequences of the session.
+func (m Model) handleStopwordsCommand(arg string) (tea.Model, tea.Cmd) {
+	var status string
+	switch strings.TrimSpace(arg) {
+	case "":
+		status = "Stop sequences: " + internal.FormatStopSequences(m.stop)
+	case "off":
+		m.stop = nil
+		status = "Stop sequences disabled for this session."
+	case "reset":
+		m.stop = m.cfg.Model.Stop
+		status = "Stop sequences reset to " + internal.FormatStopSequences(m.stop) + "."
+	default:
+		stop, err := internal.ParseStopSequences(arg)
+		if err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(err.Error()))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		m.stop = stop
+		status = "Stop sequences set to " + internal.FormatStopSequences(m.stop) + "."
+	}
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(status))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// templateFill collects the variables of a /template one prompt at a time.
+type templateFill struct {
+	tmpl    *internal.Template
+	vars    map[string]string
+	missing []string
+}
+
+// handleTemplateCommand lists the configured templates, or sends one once
+// all its required variables have values.
+// maxGrepLines is the most matching lines /grep shows.
+const maxGrepLines = 100
+
+func (m Model) handleGrepCommand(expr string) (tea.Model, tea.Cmd) {
+	if expr == "" {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /grep <regex>  (prefix with (?i) to ignore case)"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Invalid pattern: "+err.Error()))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	matches := internal.GrepMessages(m.plainMessages(), pattern)
+	if len(matches) == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("No lines match %s.", expr)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	// Numbers are those shown by /history and taken by /pin-context
+	width := m.columnWidth() - 20
+	if width < 20 {
+		width = 20
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d matching lines for %s:\n", len(matches), expr)
+	for i, match := range matches {
+		if i == maxGrepLines {
+			fmt.Fprintf(&b, "... and %d more\n", len(matches)-maxGrepLines)
+			break
+		}
+		role := "User"
+		if match.Role == "assistant" {
+			role = "AI"
+		}
+		fmt.Fprintf(&b, "[%d] %-4s %s\n", match.Message+1, role+":", truncate(match.Line, width))
+	}
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(strings.TrimRight(b.String(), "\n")))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// maxFindMatches is the most matching messages /find lists.
+const maxFindMatches = 50
+
+// handleFindCommand lists the messages of the conversation that contain
+// text. When the earlier messages of a long session are not loaded, the
+// saved session is searched and loaded back to the earliest match listed,
+// so every match has a number for /goto.
+func (m Model) handleFindCommand(text string) (tea.Model, tea.Cmd) {
+	if text == "" {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /find <text>  (case is ignored)"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	if m.store != nil && m.sessionID != 0 && m.messageOffset > 0 {
+		m.flushWriter()
+		ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeouts.Persist)
+		positions, err := m.store.FindMessages(ctx, m.sessionID, text)
+		if err == nil && len(positions) > 0 {
+			if first := positions[max(0, len(positions)-maxFindMatches)]; first < m.messageOffset {
+				var older []storage.Message
+				older, err = m.store.LoadMessagesBefore(ctx, m.sessionID, m.oldestMessageID, m.messageOffset-first)
+				if err == nil {
+					loaded, _ := m.handleOlderMessages(olderMessagesMsg{sessionID: m.sessionID, messages: older})
+					m = loaded.(Model)
+				}
+			}
+		}
+		cancel()
+		if err != nil {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("Error: %v", err)))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+	}
+
+	matches := internal.FindMessages(m.plainMessages(), text)
+	if len(matches) == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("No messages contain %q.", text)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	width := m.columnWidth() - 20
+	if width < 20 {
+		width = 20
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d messages contain %q:\n", len(matches), text)
+	if len(matches) > maxFindMatches {
+		fmt.Fprintf(&b, "(the %d most recent; %d earlier ones are not listed)\n", maxFindMatches, len(matches)-maxFindMatches)
+		matches = matches[len(matches)-maxFindMatches:]
+	}
+	for _, match := range matches {
+		role := "User"
+		if match.Role == "assistant" {
+			role = "AI"
+		}
+		fmt.Fprintf(&b, "[%d] %-4s %s\n", match.Message+1, role+":", truncate(strings.TrimSpace(match.Line), width))
+	}
+	b.WriteString("\nUse /goto <n> to scroll to a message.")
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(b.String()))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+func (m Model) handleTemplateCommand(args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		var b strings.Builder
+		b.WriteString("Templates:")
+		for _, name := range internal.TemplateNames(m.cfg) {
+			tmpl, _ := internal.LookupTemplate(m.cfg, name)
+			fmt.Fprintf(&b, "\n  %s", name)
+			if vars := tmpl.Variables(); len(vars) > 0 {
+				fmt.Fprintf(&b, " (%s)", strings.Join(vars, ", "))
+			}
+			if tmpl.Description != "" {
+				fmt.Fprintf(&b, " - %s", tmpl.Description)
+			}
+		}
+		if len(m.cfg.Templates) == 0 {
+			b.WriteString(" none configured, see templates in config.example.yaml")
+		}
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(b.String()))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	tmpl, err := internal.LookupTemplate(m.cfg, args[0])
+	if err == nil {
+		var vars map[string]string
+		if vars, err = internal.ParseTemplateVars(args[1:]); err == nil {
+			m.fill = &templateFill{tmpl: tmpl, vars: vars, missing: tmpl.Missing(vars)}
+			return m.fillTemplateVariable("")
+		}
+	}
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(err.Error()))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// fillTemplateVariable stores value for the variable being asked for, then
+// asks for the next one or sends the template when none are left.
+func (m Model) fillTemplateVariable(value string) (tea.Model, tea.Cmd) {
+	fill := m.fill
+	if value != "" && len(fill.missing) > 0 {
+		fill.vars[fill.missing[0]] = strings.TrimSpace(value)
+		fill.missing = fill.missing[1:]
+	}
+	if len(fill.missing) > 0 {
+		m.textarea.Placeholder = fmt.Sprintf("Value for {{%s}} in template %s (a /command cancels)", fill.missing[0], fill.tmpl.Name)
+		return m, nil
+	}
+
+	m = m.cancelTemplateFill()
+	messages, err := fill.tmpl.Render(fill.vars)
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(err.Error()))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	last := len(messages) - 1
+	m.recalled = append(m.recalled, messages[:last]...)
+	return m.sendMessage(messages[last].Content)
+}
+
+func (m Model) cancelTemplateFill() Model {
+	if m.fill != nil {
+		m.fill = nil
+		m.textarea.Placeholder = "Type your message here..."
+	}
+	return m
+}
+
+// exchanges pairs each user message with the answer that follows it and
+// returns the message index of each question.
+func (m Model) exchanges() ([]internal.Exchange, []int) {
+	var exchanges []internal.Exchange
+	var indices []int
+	for i, msg := range m.messages {
+		if msg.Role != "user" {
+			continue
+		}
+		exchange := internal.Exchange{Question: msg.Content}
+		if i+1 < len(m.messages) && m.messages[i+1].Role == "assistant" {
+			exchange.Answer = m.messages[i+1].Content
+		}
+		exchanges = append(exchanges, exchange)
+		indices = append(indices, i)
+	}
+	return exchanges, indices
+}
+
+// handleOutlineCommand summarises exchanges that are not in the outline cache
+// yet and then shows the outline.
+func (m Model) handleOutlineCommand() (tea.Model, tea.Cmd) {
+	exchanges, _ := m.exchanges()
+	if len(exchanges) == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Nothing to outline yet."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	var missing []internal.Exchange
+	for _, exchange := range exchanges {
+		if _, ok := m.outline[exchange.Key()]; !ok {
+			missing = append(missing, exchange)
+		}
+	}
+	if len(missing) == 0 {
+		return m.showOutline()
+	}
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Summarising %d exchange(s)...", len(missing))))
+	m.viewport.GotoBottom()
+
+	client, model := m.client, m.cfg.Model.Name
+	return m, func() tea.Msg {
+		summaries, err := internal.SummarizeExchanges(context.Background(), client, model, missing)
+		if err != nil {
+			return errMsg(fmt.Errorf("outline failed: %w", err))
+		}
+		byKey := make(map[string]string, len(missing))
+		for i, exchange := range missing {
+			byKey[exchange.Key()] = summaries[i]
+		}
+		return outlineMsg{summaries: byKey}
+	}
+}
+
+// showOutline lists the cached summary of every exchange.
+func (m Model) showOutline() (tea.Model, tea.Cmd) {
+	exchanges, _ := m.exchanges()
+
+	var b strings.Builder
+	b.WriteString("Outline:\n" + strings.Repeat("=", 50) + "\n")
+	for i, exchange := range exchanges {
+		summary, ok := m.outline[exchange.Key()]
+		if !ok {
+			summary = "(not summarised yet, run /outline again)"
+		}
+		fmt.Fprintf(&b, "%3d. %s\n", i+1, summary)
+	}
+	b.WriteString("\nUse /outline <n> to jump to an exchange.")
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(b.String()))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// jumpToExchange scrolls the conversation to the start of exchange n.
+func (m Model) jumpToExchange(arg string) (tea.Model, tea.Cmd) {
+	_, indices := m.exchanges()
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(indices) {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(fmt.Sprintf("No exchange %s. Use /outline to list them.", arg)))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	return m.scrollToMessage(indices[n-1])
+}
+
+// scrollToMessage scrolls the conversation to the start of messages[index].
+func (m Model) scrollToMessage(index int) (tea.Model, tea.Cmd) {
+	line := 0
+	for _, msg := range m.messages[:index] {
+		line += strings.Count(m.renderMessage(msg), "\n")
+	}
+	m.viewport.SetContent(m.renderHistoryCache())
+	m.viewport.SetYOffset(line)
+	return m, nil
+}
+
+// handleImageCommand generates an image from prompt and saves it to disk.
+func (m Model) handleImageCommand(prompt string) (tea.Model, tea.Cmd) {
+	if strings.TrimSpace(prompt) == "" {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /image <prompt>"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	generator, ok := m.client.(internal.ImageGenerator)
+	if !ok {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("/image is not supported by this provider."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	dir, err := expandHome(m.cfg.Images.OutputDir)
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(err.Error()))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render("Generating image..."))
+	m.viewport.GotoBottom()
+
+	images := m.cfg.Images
+	return m, func() tea.Msg {
+		data, err := generator.GenerateImage(context.Background(), images.Model, prompt, images.Size)
+		if err != nil {
+			return errMsg(fmt.Errorf("image generation failed: %w", err))
+		}
+		path, err := internal.SaveImage(data, dir)
+		if err != nil {
+			return errMsg(fmt.Errorf("image generation failed: %w", err))
+		}
+		return imageSavedMsg{path: path}
+	}
+}
+
+// speechMutex keeps answers from being read aloud over each other.
+var speechMutex sync.Mutex
+
+// speak reads text aloud using the provider's speech endpoint and a local
+// audio player.
+func (m Model) speak(text string) tea.Cmd {
+	speaker, ok := m.client.(internal.Speaker)
+	if !ok {
+		return func() tea.Msg {
+			return errMsg(fmt.Errorf("speech is not supported by this provider"))
+		}
+	}
+
+	audio := m.cfg.Audio
+	return func() tea.Msg {
+		speechMutex.Lock()
+		defer speechMutex.Unlock()
+
+		ctx := context.Background()
+		for _, chunk := range internal.SpeechChunks(text) {
+			data, err := speaker.Speech(ctx, audio.SpeechModel, audio.Voice, chunk)
+			if err != nil {
+				return errMsg(fmt.Errorf("speech failed: %w", err))
+			}
+			if err := internal.PlayAudio(ctx, data, audio.Player); err != nil {
+				return errMsg(fmt.Errorf("speech failed: %w", err))
+			}
+		}
+		return nil
+	}
+}
+
+// handleExportCommand writes a saved session to a single-file archive so it
+// can be moved to another machine.
+func (m Model) handleExportCommand(args []string) (tea.Model, tea.Cmd) {
+	usage := "Usage: /export chatty <session-id> <file" + storage.ArchiveExtension + ">, or /export md|json|html [session-id] <file>"
+	if len(args) < 2 || len(args) > 3 || (args[0] == "chatty" && len(args) != 3) {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(usage))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	format := args[0]
+	switch format {
+	case "chatty", storage.FormatMarkdown, storage.FormatJSON, storage.FormatHTML:
+	default:
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(usage))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	// Transcripts default to the current session
+	sessionID := m.sessionID
+	if len(args) == 3 {
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || id <= 0 {
+			m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Invalid session ID: "+args[1]))
+			m.viewport.GotoBottom()
+			return m, nil
+		}
+		sessionID = id
+	} else if sessionID == 0 {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("This conversation has not been saved yet. Give a session ID to export another one."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	path, err := expandHome(args[len(args)-1])
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(err.Error()))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	store := m.store
+	return m, func() tea.Msg {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return errMsg(fmt.Errorf("export failed: %w", err))
+		}
+		if format == "chatty" {
+			err = store.ExportSession(context.Background(), sessionID, file)
+		} else {
+			err = store.ExportTranscript(context.Background(), sessionID, format, file)
+		}
+		if err != nil {
+			file.Close()
+			os.Remove(path)
+			return errMsg(fmt.Errorf("export failed: %w", err))
+		}
+		if err := file.Close(); err != nil {
+			return errMsg(fmt.Errorf("export failed: %w", err))
+		}
+		return sessionExportedMsg{id: sessionID, path: path}
+	}
+}
+
+// handleImportCommand stores the conversation from an archive as a new session.
+func (m Model) handleImportCommand(args []string) (tea.Model, tea.Cmd) {
+	if len(args) != 2 || args[0] != "chatty" {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Usage: /import chatty <file"+storage.ArchiveExtension+">"))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+	if m.store == nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render("Storage not available. Check your configuration."))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	path, err := expandHome(args[1])
+	if err != nil {
+		m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleError.Render(err.Error()))
+		m.viewport.GotoBottom()
+		return m, nil
+	}
+
+	store := m.store
+	return m, func() tea.Msg {
+		file, err := os.Open(path)
+		if err != nil {
+			return errMsg(fmt.Errorf("import failed: %w", err))
+		}
+		defer file.Close()
+
+		id, err := store.ImportSession(context.Background(), file)
+		if err != nil {
+			return errMsg(fmt.Errorf("import failed: %w", err))
+		}
+		return sessionImportedMsg{id: id, path: path}
+	}
+}
+
+func (m Model) handleSessionImported(msg sessionImportedMsg) (tea.Model, tea.Cmd) {
+	m.viewport.SetContent(m.renderHistoryCache() + "\n" + styleSystem.Render(fmt.Sprintf("Imported %s as session #%d. Use /load %d to open it.", msg.path, msg.id, msg.id)))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// expandHome resolves a leading ~/ in a user-supplied path.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("determine home directory: %w", err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// pastedText is a multi-line paste and the placeholder standing in for it.
+type pastedText struct {
+	placeholder string
+	text        string
+}
+
+// addPaste keeps a multi-line paste aside and inserts a placeholder saying
+// what it is at the cursor.
+func (m Model) addPaste(text string) Model {
+	text = strings.Trim(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	kind := "text"
+	if ui.LooksLikeCode(text) {
+		kind = "code"
+		if lang := ui.DetectLanguage(text); lang != "" {
+			kind = lang + " code"
+		}
+	}
+	placeholder := fmt.Sprintf("[paste #%d: %d lines of %s]", len(m.pastes)+1, strings.Count(text, "\n")+1, kind)
+	m.pastes = append(m.pastes, pastedText{placeholder: placeholder, text: text})
+
+	m.textarea.InsertString(placeholder)
+	return m
+}
+
+// expandPastes replaces paste placeholders in input with the pasted text,
+// fenced when it is code.
+func (m Model) expandPastes(input string) string {
+	if len(m.pastes) == 0 {
+		return input
+	}
+	for _, paste := range m.pastes {
+		input = strings.Replace(input, paste.placeholder, "\n"+internal.FormatPaste(paste.text)+"\n", 1)
 	}
-	return t.Format("2006-01-02")
+	return strings.TrimSpace(input)
 }
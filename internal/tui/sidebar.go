@@ -0,0 +1,180 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ZaguanLabs/chatty/internal/storage"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	sidebarWidth    = 34 // Columns of the session picker, border included
+	sidebarMinChat  = 40 // Narrowest conversation column left beside it
+	sidebarRowLines = 4  // Name, summary, details and a blank line per session
+)
+
+// sidebar is the session picker opened with Ctrl+B or /list. While it is
+// open it takes the keys: arrows move, typing filters by name or summary,
+// Enter loads the highlighted session and Esc closes it.
+type sidebar struct {
+	open     bool
+	sessions []storage.SessionSummary
+	filter   string
+	cursor   int // Index into visible()
+	offset   int // First visible session shown
+}
+
+// visible returns the sessions matching the filter.
+func (s sidebar) visible() []storage.SessionSummary {
+	if s.filter == "" {
+		return s.sessions
+	}
+	filter := strings.ToLower(s.filter)
+	var matches []storage.SessionSummary
+	for _, session := range s.sessions {
+		if strings.Contains(strings.ToLower(session.Name), filter) || strings.Contains(strings.ToLower(session.Summary), filter) {
+			matches = append(matches, session)
+		}
+	}
+	return matches
+}
+
+// move moves the cursor by delta sessions, keeping it in range and on
+// screen, where rows sessions fit.
+func (s *sidebar) move(delta, rows int) {
+	n := len(s.visible())
+	s.cursor = max(min(s.cursor+delta, n-1), 0)
+	if s.cursor < s.offset {
+		s.offset = s.cursor
+	}
+	if rows > 0 && s.cursor >= s.offset+rows {
+		s.offset = s.cursor - rows + 1
+	}
+}
+
+// sidebarShown reports whether the picker is open and the terminal is wide
+// enough to show it beside the conversation.
+func (m Model) sidebarShown() bool {
+	return m.sidebar.open && m.width >= sidebarWidth+sidebarMinChat
+}
+
+// sidebarRows is the number of sessions that fit in the picker.
+func (m Model) sidebarRows() int {
+	// The title, a blank line and the key hint take three lines
+	return max((m.viewport.Height-3)/sidebarRowLines, 1)
+}
+
+// openSidebar shows the listed sessions in the picker, with the current
+// session highlighted.
+func (m Model) openSidebar(sessions []storage.SessionSummary) Model {
+	m.sidebar = sidebar{open: true, sessions: sessions}
+	for i, session := range sessions {
+		if session.ID == m.sessionID {
+			m.sidebar.move(i, m.sidebarRows())
+			break
+		}
+	}
+	m.resize()
+	return m
+}
+
+// closeSidebar hides the picker and gives the conversation its width back.
+func (m Model) closeSidebar() Model {
+	m.sidebar = sidebar{}
+	m.resize()
+	return m
+}
+
+// handleSidebarKey handles a key pressed while the picker is open.
+func (m Model) handleSidebarKey(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	rows := m.sidebarRows()
+	switch key.Type {
+	case tea.KeyEsc, tea.KeyCtrlB:
+		return m.closeSidebar(), nil
+	case tea.KeyUp, tea.KeyCtrlP:
+		m.sidebar.move(-1, rows)
+	case tea.KeyDown, tea.KeyCtrlN:
+		m.sidebar.move(1, rows)
+	case tea.KeyPgUp:
+		m.sidebar.move(-rows, rows)
+	case tea.KeyPgDown:
+		m.sidebar.move(rows, rows)
+	case tea.KeyHome:
+		m.sidebar.move(-len(m.sidebar.sessions), rows)
+	case tea.KeyEnd:
+		m.sidebar.move(len(m.sidebar.sessions), rows)
+	case tea.KeyBackspace:
+		if m.sidebar.filter != "" {
+			runes := []rune(m.sidebar.filter)
+			m.sidebar.filter = string(runes[:len(runes)-1])
+			m.sidebar.cursor, m.sidebar.offset = 0, 0
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.sidebar.filter += string(key.Runes)
+		m.sidebar.cursor, m.sidebar.offset = 0, 0
+	case tea.KeyEnter:
+		visible := m.sidebar.visible()
+		if len(visible) == 0 || m.streaming {
+			return m, nil
+		}
+		id := visible[m.sidebar.cursor].ID
+		m = m.closeSidebar()
+		return m, m.loadSession(id)
+	}
+	return m, nil
+}
+
+// renderSidebar draws the picker, height lines tall.
+func (m Model) renderSidebar(height int) string {
+	width := sidebarWidth - 3 // Right border and padding
+	var b strings.Builder
+	title := "Sessions"
+	if m.sidebar.filter != "" {
+		title = "Filter: " + m.sidebar.filter
+	}
+	b.WriteString(styleSidebarTitle.Render(truncate(title, width)))
+	b.WriteString("\n\n")
+
+	visible := m.sidebar.visible()
+	if len(visible) == 0 {
+		b.WriteString(styleSystem.Render("No matching sessions."))
+	}
+	end := min(m.sidebar.offset+m.sidebarRows(), len(visible))
+	for i := m.sidebar.offset; i < end; i++ {
+		session := visible[i]
+		name := strings.TrimSpace(session.Name)
+		if name == "" {
+			name = "Untitled session"
+		}
+		if session.Pinned {
+			name = "📌 " + name
+		}
+		if session.Sensitive {
+			name += " 🔒"
+		}
+		marker := "  "
+		if session.ID == m.sessionID {
+			marker = "• "
+		}
+		details := fmt.Sprintf("  %s · %d msgs", formatRelative(session.UpdatedAt), session.MessageCount)
+		if session.Archived {
+			details += " · archived"
+		}
+
+		line := marker + truncate(name, width-len(marker))
+		if i == m.sidebar.cursor {
+			b.WriteString(styleSidebarSelected.Width(width).Render(line))
+		} else {
+			b.WriteString(line)
+		}
+		b.WriteString("\n")
+		b.WriteString(styleSidebarSummary.Render(truncate("  "+session.Summary, width)))
+		b.WriteString("\n")
+		b.WriteString(styleSystem.Render(truncate(details, width)))
+		b.WriteString("\n\n")
+	}
+	b.WriteString(styleSystem.Render(truncate("↑↓ move · Enter load · Esc close", width)))
+
+	return styleSidebar.Height(height).Render(b.String())
+}
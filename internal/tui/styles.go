@@ -44,4 +44,37 @@ var (
 
 	styleError = lipgloss.NewStyle().
 			Foreground(ColorError)
+
+	styleDiffDelete = lipgloss.NewStyle().
+			Foreground(ColorError).
+			Strikethrough(true)
+
+	styleDiffInsert = lipgloss.NewStyle().
+			Foreground(ColorUser).
+			Bold(true)
+
+	styleCompareColumn = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(ColorBorder).
+			Padding(0, 1)
+
+	styleSidebar = lipgloss.NewStyle().
+			Width(sidebarWidth - 1).
+			PaddingRight(1).
+			BorderStyle(lipgloss.NormalBorder()).
+			BorderForeground(ColorBorder).
+			BorderRight(true)
+
+	styleSidebarTitle = lipgloss.NewStyle().
+			Foreground(ColorHeader).
+			Bold(true)
+
+	styleSidebarSelected = lipgloss.NewStyle().
+			Foreground(ColorAI).
+			Bold(true).
+			Reverse(true)
+
+	styleSidebarSummary = lipgloss.NewStyle().
+			Foreground(ColorSystem).
+			Italic(true)
 )
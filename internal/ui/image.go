@@ -0,0 +1,55 @@
+package ui
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// kittyChunkSize is the largest base64 payload per kitty graphics escape.
+const kittyChunkSize = 4096
+
+// InlineImage returns the escape sequence that draws image data in terminals
+// with an inline image protocol (iTerm2, WezTerm, kitty, Ghostty), or an empty
+// string when the terminal has none.
+func InlineImage(data []byte) string {
+	switch {
+	case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("TERM_PROGRAM") == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return fmt.Sprintf("\x1b]1337;File=inline=1;size=%d;preserveAspectRatio=1:%s\a\n",
+			len(data), base64.StdEncoding.EncodeToString(data))
+	case os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("TERM") == "xterm-kitty" || os.Getenv("TERM_PROGRAM") == "ghostty":
+		// The kitty protocol only decodes PNG directly
+		if http.DetectContentType(data) != "image/png" {
+			return ""
+		}
+		return kittyImage(data)
+	default:
+		return ""
+	}
+}
+
+func kittyImage(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for first := true; len(encoded) > 0; first = false {
+		chunk := encoded
+		if len(chunk) > kittyChunkSize {
+			chunk = chunk[:kittyChunkSize]
+		}
+		encoded = encoded[len(chunk):]
+
+		more := 0
+		if len(encoded) > 0 {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(&b, "\x1b_Ga=T,f=100,m=%d;%s\x1b\\", more, chunk)
+		} else {
+			fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,208 @@
+package ui
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// languageHint is a pattern that suggests a language, and how strongly.
+type languageHint struct {
+	pattern *regexp.Regexp
+	weight  int
+}
+
+// languageHints are checked against the whole snippet. Names match the
+// lexers of the markdown highlighter.
+var languageHints = map[string][]languageHint{
+	"go": {
+		{regexp.MustCompile(`(?m)^package \w+\s*$`), 3},
+		{regexp.MustCompile(`\bfunc (\(\w+ \*?\w+\) )?\w*\(`), 2},
+		{regexp.MustCompile(`\w+ := `), 1},
+		{regexp.MustCompile(`\b(fmt|errors|strings)\.\w+\(`), 1},
+		{regexp.MustCompile(`if err != nil`), 2},
+	},
+	"python": {
+		{regexp.MustCompile(`(?m)^\s*def \w+\(.*\)( -> [\w\[\], .]+)?:\s*$`), 3},
+		{regexp.MustCompile(`(?m)^\s*(from [\w.]+ )?import [\w., ]+$`), 1},
+		{regexp.MustCompile(`(?m)^\s*(elif .*|else|try|except.*|finally):\s*$`), 2},
+		{regexp.MustCompile(`\bself\.\w+`), 1},
+		{regexp.MustCompile(`(?m)^\s*class \w+(\(.*\))?:\s*$`), 2},
+		{regexp.MustCompile(`\bprint\(`), 1},
+	},
+	"javascript": {
+		{regexp.MustCompile(`\b(const|let|var) \w+ = `), 1},
+		{regexp.MustCompile(`=> \{?`), 1},
+		{regexp.MustCompile(`\bconsole\.log\(`), 2},
+		{regexp.MustCompile(`\bfunction \w*\(`), 2},
+		{regexp.MustCompile(`\brequire\(['"]|\bmodule\.exports\b`), 2},
+	},
+	"typescript": {
+		{regexp.MustCompile(`\b\w+\??: (string|number|boolean|any|void)\b`), 2},
+		{regexp.MustCompile(`(?m)^\s*(export )?(interface|type) \w+`), 2},
+	},
+	"rust": {
+		{regexp.MustCompile(`\bfn \w+(<.*>)?\(`), 3},
+		{regexp.MustCompile(`\blet mut \w+`), 2},
+		{regexp.MustCompile(`\b(println|vec|format)!\(`), 2},
+		{regexp.MustCompile(`(?m)^\s*(pub )?(impl|struct|enum|use) `), 1},
+	},
+	"java": {
+		{regexp.MustCompile(`\bpublic (static )?(class|void|final)\b`), 3},
+		{regexp.MustCompile(`\bSystem\.out\.print`), 3},
+		{regexp.MustCompile(`(?m)^\s*import java\.`), 3},
+	},
+	"c": {
+		{regexp.MustCompile(`(?m)^#include [<"]\w+\.h[>"]`), 3},
+		{regexp.MustCompile(`\bprintf\(`), 1},
+		{regexp.MustCompile(`\bint main\(`), 1},
+	},
+	"cpp": {
+		{regexp.MustCompile(`(?m)^#include <\w+>`), 2},
+		{regexp.MustCompile(`\bstd::\w+`), 3},
+		{regexp.MustCompile(`\b(cout|cin) (<<|>>)`), 2},
+	},
+	"bash": {
+		{regexp.MustCompile(`(?m)\A#!/(usr/)?bin/(env )?(ba)?sh`), 4},
+		{regexp.MustCompile(`(?m)^\s*(echo|export|sudo|cd|apt|brew|chmod|mkdir) `), 1},
+		{regexp.MustCompile(`(?m)^\s*(fi|done|esac)\s*$`), 2},
+		{regexp.MustCompile(`\$\{?\w+\}?`), 1},
+	},
+	"sql": {
+		{regexp.MustCompile(`(?ims)^\s*(select\b.+?\bfrom|insert into|update \w+ set|delete from|create (table|index))\b`), 3},
+		{regexp.MustCompile(`(?i)\b(where|join|group by|order by)\b`), 1},
+	},
+	"html": {
+		{regexp.MustCompile(`(?i)<(!doctype html|html|head|body|div|span|p|a|ul|li)\b[^>]*>`), 2},
+		{regexp.MustCompile(`</\w+>`), 1},
+	},
+	"css": {
+		{regexp.MustCompile(`(?m)^[.#]?[\w-]+( [.#]?[\w-]+)* \{\s*$`), 2},
+		{regexp.MustCompile(`(?m)^\s*[\w-]+: [^;]+;\s*$`), 2},
+	},
+	"ruby": {
+		{regexp.MustCompile(`(?m)^\s*def \w+[?!]?(\(.*\))?\s*$`), 2},
+		{regexp.MustCompile(`(?m)^\s*end\s*$`), 1},
+		{regexp.MustCompile(`\bputs `), 2},
+	},
+	"php": {
+		{regexp.MustCompile(`<\?php`), 5},
+		{regexp.MustCompile(`\$\w+->\w+`), 2},
+	},
+	"yaml": {
+		{regexp.MustCompile(`(?m)^[\w-]+:\s*$`), 1},
+		{regexp.MustCompile(`(?m)^\s+- [\w"']`), 1},
+		{regexp.MustCompile(`(?m)^\s{2,}[\w-]+: \S`), 1},
+	},
+}
+
+// codeLine matches lines that look like code rather than prose: ending in
+// punctuation typical of code, starting with a keyword or comment, or holding
+// assignments and operators.
+var codeLine = regexp.MustCompile(`[;{}()\[\]]\s*$|^\s*[})\]]` +
+	`|^\s*(#include|import|from|package|func|def|class|return|if|for|while|let|const|var|fn|pub|public|private|elif|else|end|echo|export)\b` +
+	`|^\s*(#!|//|/\*|<\?php|</?[a-zA-Z!])` +
+	`|^\s*(SELECT|FROM|WHERE|JOIN|INSERT|UPDATE|DELETE|CREATE|GROUP BY|ORDER BY)\b` +
+	`|^\s*[\w.\[\]]+ [-+*/]?= |:=|==|=>|->|&&|\|\|`)
+
+// DetectLanguage guesses the language of a code snippet for syntax
+// highlighting. It returns "" when no language is a clear match.
+func DetectLanguage(code string) string {
+	trimmed := strings.TrimSpace(code)
+	if trimmed == "" {
+		return ""
+	}
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return "json"
+	}
+
+	scores := make(map[string]int, len(languageHints))
+	for lang, hints := range languageHints {
+		for _, hint := range hints {
+			if hint.pattern.MatchString(code) {
+				scores[lang] += hint.weight
+			}
+		}
+	}
+	// TypeScript is JavaScript with type annotations
+	if scores["typescript"] >= 2 {
+		scores["typescript"] += scores["javascript"]
+	}
+
+	best, bestScore, tied := "", 0, false
+	for lang, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = lang, score, false
+		case score == bestScore && score > 0:
+			tied = true
+		}
+	}
+
+	// A single weak hint, or two languages scoring the same, is a guess too far
+	if bestScore < 2 || tied {
+		return ""
+	}
+	return best
+}
+
+// LooksLikeCode reports whether text of several lines is probably source
+// code rather than prose, judging by how many of its lines look like code.
+func LooksLikeCode(text string) bool {
+	var lines, code int
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines++
+		if codeLine.MatchString(line) || strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+			code++
+		}
+	}
+	if lines < 2 {
+		return false
+	}
+	return code*2 >= lines
+}
+
+// fenceLine matches the opening or closing line of a fenced code block and
+// captures its indentation, fence and info string.
+var fenceLine = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})(.*)$")
+
+// TagCodeFences adds the detected language to fenced code blocks in markdown
+// that have none, so the highlighter picks a lexer instead of plain text.
+// Blocks whose language cannot be detected, and unclosed blocks, are left
+// unchanged.
+func TagCodeFences(markdown string) string {
+	if !strings.Contains(markdown, "```") && !strings.Contains(markdown, "~~~") {
+		return markdown
+	}
+
+	lines := strings.Split(markdown, "\n")
+	for i := 0; i < len(lines); i++ {
+		open := fenceLine.FindStringSubmatch(lines[i])
+		if open == nil {
+			continue
+		}
+		// A block closes with the same fence character, at least as long, and
+		// no info string
+		end := -1
+		for j := i + 1; j < len(lines); j++ {
+			if close := fenceLine.FindStringSubmatch(lines[j]); close != nil &&
+				close[2][0] == open[2][0] && len(close[2]) >= len(open[2]) && strings.TrimSpace(close[3]) == "" {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			break
+		}
+		if strings.TrimSpace(open[3]) == "" {
+			if lang := DetectLanguage(strings.Join(lines[i+1:end], "\n")); lang != "" {
+				lines[i] = open[1] + open[2] + lang
+			}
+		}
+		i = end
+	}
+	return strings.Join(lines, "\n")
+}
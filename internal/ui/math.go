@@ -0,0 +1,380 @@
+package ui
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// mathPattern matches display ($$...$$, \[...\]) and inline (\(...\)) math.
+	// Single dollars are left alone, they are far more often prices than math.
+	mathPattern = regexp.MustCompile(`(?s)\$\$(.+?)\$\$|\\\[(.+?)\\\]|\\\((.+?)\\\)`)
+
+	// codePattern matches fenced and inline code, which is never rewritten.
+	codePattern = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+
+	mathSpaces = regexp.MustCompile(`[ \t]{2,}`)
+)
+
+// RenderMath replaces LaTeX math in text with a Unicode approximation so that
+// formulas stay readable in a terminal. Code blocks and code spans are kept
+// verbatim, and display math is placed on its own lines.
+func RenderMath(text string) string {
+	if !strings.Contains(text, "$$") && !strings.Contains(text, `\[`) && !strings.Contains(text, `\(`) {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range codePattern.FindAllStringIndex(text, -1) {
+		b.WriteString(renderMathSpans(text[last:loc[0]]))
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(renderMathSpans(text[last:]))
+	return b.String()
+}
+
+func renderMathSpans(text string) string {
+	return mathPattern.ReplaceAllStringFunc(text, func(match string) string {
+		groups := mathPattern.FindStringSubmatch(match)
+		if groups[3] != "" {
+			return LaTeXToUnicode(groups[3])
+		}
+		display := groups[1]
+		if display == "" {
+			display = groups[2]
+		}
+		lines := strings.Split(LaTeXToUnicode(display), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimSpace(line)
+		}
+		// Trailing double spaces keep the lines apart when rendered as markdown
+		return "\n\n" + strings.Join(lines, "  \n") + "\n\n"
+	})
+}
+
+// LaTeXToUnicode converts a LaTeX math expression to plain Unicode text.
+// Constructs without a Unicode equivalent are kept in a readable ASCII form,
+// e.g. \frac{a+b}{2} becomes (a+b)/2.
+func LaTeXToUnicode(expr string) string {
+	p := &latexParser{src: expr}
+	out := mathSpaces.ReplaceAllString(p.parse(), " ")
+	return strings.TrimSpace(out)
+}
+
+type latexParser struct {
+	src string
+	pos int
+}
+
+func (p *latexParser) parse() string {
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		switch r {
+		case '\\':
+			b.WriteString(p.command())
+		case '{':
+			b.WriteString(convertGroup(p.group()))
+		case '}':
+			p.pos += size // Unbalanced, drop it
+		case '^':
+			p.pos += size
+			b.WriteString(script(convertGroup(p.argument()), superscripts, "^"))
+		case '_':
+			p.pos += size
+			b.WriteString(script(convertGroup(p.argument()), subscripts, "_"))
+		case '&':
+			p.pos += size
+			b.WriteByte(' ')
+		case '~':
+			p.pos += size
+			b.WriteByte(' ')
+		default:
+			p.pos += size
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// command consumes a backslash command and returns its rendering.
+func (p *latexParser) command() string {
+	name := p.commandName()
+	switch name {
+	case `\`:
+		return "\n"
+	case ",", ":", ";", " ":
+		return " "
+	case "!":
+		return ""
+	case "quad", "qquad":
+		return "  "
+	case "{", "}", "%", "$", "#", "&", "_":
+		return name
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num := convertGroup(p.argument())
+		den := convertGroup(p.argument())
+		return wrapOperand(num) + "/" + wrapOperand(den)
+	case "binom":
+		n := convertGroup(p.argument())
+		k := convertGroup(p.argument())
+		return "C(" + n + ", " + k + ")"
+	case "sqrt":
+		index := ""
+		if p.peek() == '[' {
+			index = p.until(']')
+		}
+		radicand := wrapOperand(convertGroup(p.argument()))
+		switch index {
+		case "":
+			return "√" + radicand
+		case "3":
+			return "∛" + radicand
+		case "4":
+			return "∜" + radicand
+		default:
+			return script(index, superscripts, "^") + "√" + radicand
+		}
+	case "text", "textrm", "textit", "textbf", "mbox":
+		return p.argument()
+	case "mathrm", "mathbf", "mathit", "mathsf", "mathtt", "mathcal", "boldsymbol", "operatorname":
+		return convertGroup(p.argument())
+	case "mathbb":
+		arg := p.argument()
+		if s, ok := doubleStruck[arg]; ok {
+			return s
+		}
+		return arg
+	case "hat", "widehat", "bar", "overline", "vec", "dot", "ddot", "tilde", "widetilde":
+		return accent(convertGroup(p.argument()), accents[strings.TrimPrefix(name, "wide")])
+	case "left", "right", "bigl", "bigr", "Bigl", "Bigr", "big", "Big", "bigg", "Bigg":
+		if p.peek() == '.' {
+			p.pos++ // Invisible delimiter
+		}
+		return ""
+	case "begin", "end":
+		p.argument()
+		if name == "begin" && p.peek() == '{' {
+			p.argument() // Column spec of array/tabular
+		}
+		return ""
+	case "displaystyle", "textstyle", "limits", "nolimits", "nonumber", "notag":
+		return ""
+	}
+	if s, ok := latexSymbols[name]; ok {
+		return s
+	}
+	return `\` + name
+}
+
+// commandName consumes a backslash and the command name that follows it.
+func (p *latexParser) commandName() string {
+	p.pos++ // Backslash
+	start := p.pos
+	for p.pos < len(p.src) && isLetter(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start && p.pos < len(p.src) {
+		_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+	}
+	return p.src[start:p.pos]
+}
+
+// argument consumes a command argument: a braced group, a command or a single
+// character. The raw source of the argument is returned.
+func (p *latexParser) argument() string {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return ""
+	}
+	switch p.src[p.pos] {
+	case '{':
+		return p.group()
+	case '\\':
+		start := p.pos
+		p.commandName()
+		return p.src[start:p.pos]
+	}
+	_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	return p.src[p.pos-size : p.pos]
+}
+
+// group consumes a braced group and returns its contents without the braces.
+func (p *latexParser) group() string {
+	p.pos++ // Opening brace
+	start, depth := p.pos, 1
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos++ // Escaped character, e.g. \{
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return p.src[start : p.pos-1]
+			}
+		}
+		p.pos++
+	}
+	return p.src[start:]
+}
+
+// until consumes an opening delimiter and everything up to close.
+func (p *latexParser) until(close byte) string {
+	p.pos++
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] != close {
+		p.pos++
+	}
+	end := p.pos
+	if p.pos < len(p.src) {
+		p.pos++
+	}
+	return p.src[start:end]
+}
+
+func (p *latexParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *latexParser) skipSpaces() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func convertGroup(src string) string {
+	return (&latexParser{src: src}).parse()
+}
+
+// wrapOperand parenthesises operands of more than one character.
+func wrapOperand(s string) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) <= 1 || isNumber(s) {
+		return s
+	}
+	return "(" + s + ")"
+}
+
+func isNumber(s string) bool {
+	for _, r := range s {
+		if (r < '0' || r > '9') && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// script renders s with Unicode super- or subscript characters, falling back
+// to marker notation when one of its characters has no scripted form.
+func script(s string, table map[rune]rune, marker string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	var b strings.Builder
+	for _, r := range s {
+		mapped, ok := table[r]
+		if !ok {
+			if utf8.RuneCountInString(s) == 1 {
+				return marker + s
+			}
+			return marker + "(" + s + ")"
+		}
+		b.WriteRune(mapped)
+	}
+	return b.String()
+}
+
+// accent adds a combining mark to single-character arguments.
+func accent(s, mark string) string {
+	if utf8.RuneCountInString(s) != 1 || mark == "" {
+		return s
+	}
+	return s + mark
+}
+
+var superscripts = map[rune]rune{
+	'0': '⁰', '1': '¹', '2': '²', '3': '³', '4': '⁴', '5': '⁵', '6': '⁶', '7': '⁷', '8': '⁸', '9': '⁹',
+	'+': '⁺', '-': '⁻', '−': '⁻', '=': '⁼', '(': '⁽', ')': '⁾',
+	'a': 'ᵃ', 'b': 'ᵇ', 'c': 'ᶜ', 'd': 'ᵈ', 'e': 'ᵉ', 'f': 'ᶠ', 'g': 'ᵍ', 'h': 'ʰ', 'i': 'ⁱ', 'j': 'ʲ',
+	'k': 'ᵏ', 'l': 'ˡ', 'm': 'ᵐ', 'n': 'ⁿ', 'o': 'ᵒ', 'p': 'ᵖ', 'r': 'ʳ', 's': 'ˢ', 't': 'ᵗ', 'u': 'ᵘ',
+	'v': 'ᵛ', 'w': 'ʷ', 'x': 'ˣ', 'y': 'ʸ', 'z': 'ᶻ', 'T': 'ᵀ', '*': '*', '′': '′',
+}
+
+var subscripts = map[rune]rune{
+	'0': '₀', '1': '₁', '2': '₂', '3': '₃', '4': '₄', '5': '₅', '6': '₆', '7': '₇', '8': '₈', '9': '₉',
+	'+': '₊', '-': '₋', '−': '₋', '=': '₌', '(': '₍', ')': '₎',
+	'a': 'ₐ', 'e': 'ₑ', 'h': 'ₕ', 'i': 'ᵢ', 'j': 'ⱼ', 'k': 'ₖ', 'l': 'ₗ', 'm': 'ₘ', 'n': 'ₙ', 'o': 'ₒ',
+	'p': 'ₚ', 'r': 'ᵣ', 's': 'ₛ', 't': 'ₜ', 'u': 'ᵤ', 'v': 'ᵥ', 'x': 'ₓ',
+}
+
+var accents = map[string]string{
+	"hat": "̂", "bar": "̄", "overline": "̅", "vec": "⃗",
+	"dot": "̇", "ddot": "̈", "tilde": "̃",
+}
+
+var doubleStruck = map[string]string{
+	"R": "ℝ", "N": "ℕ", "Z": "ℤ", "Q": "ℚ", "C": "ℂ", "P": "ℙ", "H": "ℍ",
+}
+
+var latexSymbols = map[string]string{
+	// Greek letters
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ε", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "φ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+
+	// Operators and relations
+	"times": "×", "cdot": "·", "div": "÷", "pm": "±", "mp": "∓", "ast": "∗", "star": "⋆",
+	"circ": "∘", "bullet": "•", "oplus": "⊕", "otimes": "⊗",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "approx": "≈",
+	"equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅", "propto": "∝", "ll": "≪", "gg": "≫",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆", "supset": "⊃",
+	"supseteq": "⊇", "cup": "∪", "cap": "∩", "setminus": "∖", "emptyset": "∅", "varnothing": "∅",
+	"forall": "∀", "exists": "∃", "nexists": "∄", "neg": "¬", "lnot": "¬", "land": "∧",
+	"wedge": "∧", "lor": "∨", "vee": "∨", "mid": "∣", "parallel": "∥", "perp": "⊥",
+
+	// Arrows
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←", "leftrightarrow": "↔",
+	"Rightarrow": "⇒", "implies": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔", "iff": "⇔",
+	"mapsto": "↦", "uparrow": "↑", "downarrow": "↓", "longrightarrow": "⟶", "longleftarrow": "⟵",
+
+	// Big operators and calculus
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+	"partial": "∂", "nabla": "∇", "infty": "∞", "prime": "′", "bigcup": "⋃", "bigcap": "⋂",
+
+	// Functions
+	"sin": "sin", "cos": "cos", "tan": "tan", "cot": "cot", "sec": "sec", "csc": "csc",
+	"arcsin": "arcsin", "arccos": "arccos", "arctan": "arctan", "sinh": "sinh", "cosh": "cosh",
+	"tanh": "tanh", "log": "log", "ln": "ln", "exp": "exp", "lim": "lim", "max": "max",
+	"min": "min", "sup": "sup", "inf": "inf", "det": "det", "gcd": "gcd", "deg": "deg",
+	"arg": "arg", "dim": "dim", "ker": "ker", "Pr": "Pr", "mod": " mod ", "bmod": " mod ",
+
+	// Delimiters and dots
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+	"lvert": "|", "rvert": "|", "vert": "|", "lVert": "‖", "rVert": "‖", "Vert": "‖",
+	"ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱",
+
+	// Miscellaneous
+	"hbar": "ħ", "ell": "ℓ", "Re": "ℜ", "Im": "ℑ", "aleph": "ℵ", "degree": "°",
+	"angle": "∠", "triangle": "△", "square": "□", "therefore": "∴", "because": "∵",
+}
@@ -0,0 +1,214 @@
+package ui
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MinTableColumnWidth is the narrowest a column is truncated to. Tables
+	// that would need narrower columns are shown one record per row instead.
+	MinTableColumnWidth = 8
+
+	// Width markdown renderers add around cells: the separator between two
+	// columns and the margin of the whole table.
+	tableColumnGap = 3
+	tableMargin    = 4
+)
+
+var (
+	tableSeparatorPattern = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	tableFencePattern     = regexp.MustCompile("^\\s*(```|~~~)")
+	tableEmphasisPattern  = regexp.MustCompile("\\*\\*|__|`")
+)
+
+// FitTables rewrites markdown tables in text that are wider than width. Wide
+// columns are truncated with an ellipsis; if that would leave columns narrower
+// than MinTableColumnWidth, each row is shown as a block of "Header: value"
+// lines instead. Tables that fit, and anything inside code blocks, are left
+// unchanged.
+func FitTables(text string, width int) string {
+	if width <= 0 || !strings.Contains(text, "|") {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if tableFencePattern.MatchString(line) {
+			inFence = !inFence
+		}
+		if inFence || i+1 >= len(lines) || !strings.Contains(line, "|") || !tableSeparatorPattern.MatchString(lines[i+1]) {
+			out = append(out, line)
+			continue
+		}
+
+		end := i + 2
+		for end < len(lines) && strings.Contains(lines[end], "|") && strings.TrimSpace(lines[end]) != "" {
+			end++
+		}
+		out = append(out, fitTable(lines[i:end], width)...)
+		i = end - 1
+	}
+	return strings.Join(out, "\n")
+}
+
+// fitTable lays out one table: header, separator and body rows.
+func fitTable(lines []string, width int) []string {
+	header := splitTableRow(lines[0])
+	separator := splitTableRow(lines[1])
+	if len(header) == 0 || len(separator) != len(header) {
+		return lines
+	}
+	rows := make([][]string, 0, len(lines)-2)
+	for _, line := range lines[2:] {
+		rows = append(rows, normalizeRow(splitTableRow(line), len(header)))
+	}
+
+	natural := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for col, cell := range row {
+			natural[col] = max(natural[col], utf8.RuneCountInString(cell))
+		}
+	}
+
+	available := width - tableMargin - tableColumnGap*(len(header)-1)
+	total := 0
+	for _, w := range natural {
+		total += w
+	}
+	if total <= available {
+		return lines
+	}
+
+	widths, ok := columnWidths(natural, available)
+	if !ok {
+		return tableRecords(header, rows)
+	}
+
+	fitted := []string{joinTableRow(truncateRow(header, widths)), joinTableRow(separator)}
+	for _, row := range rows {
+		fitted = append(fitted, joinTableRow(truncateRow(row, widths)))
+	}
+	return fitted
+}
+
+// columnWidths shares available space between columns: narrow columns keep
+// their natural width and the rest is split evenly among the wide ones. It
+// reports false when a column would end up below MinTableColumnWidth.
+func columnWidths(natural []int, available int) ([]int, bool) {
+	widths := make([]int, len(natural))
+	fixed := make([]bool, len(natural))
+	remaining, open := available, len(natural)
+
+	for changed := true; changed && open > 0; {
+		changed = false
+		share := remaining / open
+		for col, w := range natural {
+			if !fixed[col] && w <= share {
+				widths[col], fixed[col] = w, true
+				remaining -= w
+				open--
+				changed = true
+			}
+		}
+	}
+	if open == 0 {
+		return widths, true
+	}
+
+	share := remaining / open
+	if share < MinTableColumnWidth {
+		return nil, false
+	}
+	for col := range natural {
+		if !fixed[col] {
+			widths[col] = share
+		}
+	}
+	return widths, true
+}
+
+// tableRecords renders each row as "Header: value" lines.
+func tableRecords(header []string, rows [][]string) []string {
+	var out []string
+	for i, row := range rows {
+		if i > 0 {
+			out = append(out, "")
+		}
+		for col, cell := range row {
+			line := "**" + header[col] + ":** " + cell
+			if col < len(row)-1 {
+				line += "  " // Hard line break in markdown
+			}
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// splitTableRow splits a markdown table row into trimmed cells, honouring
+// escaped pipes.
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteString(`\|`)
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func normalizeRow(row []string, columns int) []string {
+	if len(row) > columns {
+		return row[:columns]
+	}
+	for len(row) < columns {
+		row = append(row, "")
+	}
+	return row
+}
+
+func truncateRow(row []string, widths []int) []string {
+	truncated := make([]string, len(row))
+	for col, cell := range row {
+		truncated[col] = truncateCell(cell, widths[col])
+	}
+	return truncated
+}
+
+// truncateCell shortens a cell to width runes, ending it with an ellipsis.
+// Emphasis and code markers are dropped first so none is left unbalanced.
+func truncateCell(cell string, width int) string {
+	if utf8.RuneCountInString(cell) <= width {
+		return cell
+	}
+	cell = tableEmphasisPattern.ReplaceAllString(cell, "")
+	runes := []rune(cell)
+	if len(runes) <= width {
+		return cell
+	}
+	cut := strings.TrimRight(string(runes[:width-1]), " \\")
+	return cut + "…"
+}
+
+func joinTableRow(cells []string) string {
+	return "| " + strings.Join(cells, " | ") + " |"
+}
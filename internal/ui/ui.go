@@ -39,34 +39,102 @@ const (
 	BorderGray   = "\033[38;5;245m" // Medium gray for borders
 )
 
+// Display names and avatars, overridden by SetDisplayNames
+var (
+	userName        = "You"
+	userAvatar      = "👤"
+	assistantName   = "Assistant"
+	assistantAvatar = "🤖"
+)
+
+// SetDisplayNames replaces the names and avatars shown in message headers.
+// Empty values keep the current ones.
+func SetDisplayNames(user, userAv, assistant, assistantAv string) {
+	if user != "" {
+		userName = user
+	}
+	if userAv != "" {
+		userAvatar = userAv
+	}
+	if assistant != "" {
+		assistantName = assistant
+	}
+	if assistantAv != "" {
+		assistantAvatar = assistantAv
+	}
+}
+
 // GetUserAvatar returns the avatar emoji for user messages
 func GetUserAvatar() string {
-	return "👤"
+	return userAvatar
 }
 
 // GetAssistantAvatar returns the avatar emoji for assistant messages
 func GetAssistantAvatar() string {
-	return "🤖"
+	return assistantAvatar
 }
 
 // GetUserName returns the display name for user messages
 func GetUserName() string {
-	return "You"
+	return userName
 }
 
 // GetAssistantName returns the display name for assistant messages
 func GetAssistantName() string {
-	return "Assistant"
+	return assistantName
+}
+
+// Layout and time zone of displayed times, set by SetTimeFormat
+var (
+	timeLayout   = "15:04"
+	timeLocation = time.Local
+)
+
+// SetTimeFormat sets how times are displayed. format is "24h", "12h" or a Go
+// time layout; timezone is an IANA name, or empty for the local time zone.
+func SetTimeFormat(format, timezone string) error {
+	loc := time.Local
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return fmt.Errorf("load time zone: %w", err)
+		}
+	}
+
+	switch format {
+	case "", "24h":
+		timeLayout = "15:04"
+	case "12h":
+		timeLayout = "3:04 PM"
+	default:
+		timeLayout = format
+	}
+	timeLocation = loc
+	return nil
 }
 
-// FormatTimestamp formats a time with modern styling
+// FormatTimestamp formats the time of day in the configured layout and zone
 func FormatTimestamp(t time.Time) string {
-	return t.Format("3:04 PM")
+	return t.In(timeLocation).Format(timeLayout)
 }
 
 // FormatShortTimestamp formats time in a compact format
 func FormatShortTimestamp(t time.Time) string {
-	return t.Format("15:04")
+	return t.In(timeLocation).Format("15:04")
+}
+
+// FormatDate formats the calendar date in the configured zone
+func FormatDate(t time.Time) string {
+	return t.In(timeLocation).Format("2006-01-02")
+}
+
+// FormatDateTime formats the date and time of day. Layouts that already
+// include the date are used as they are.
+func FormatDateTime(t time.Time) string {
+	if strings.Contains(timeLayout, "2006") {
+		return FormatTimestamp(t)
+	}
+	return FormatDate(t) + " " + FormatTimestamp(t)
 }
 
 // CreateSeparator creates a decorative separator line
@@ -241,6 +309,14 @@ func GetLanguageEmoji(lang string) string {
 		return "⚙️"
 	case strings.Contains(lang, "bash"), strings.Contains(lang, "shell"):
 		return "💻"
+	case strings.Contains(lang, "sql"):
+		return "🗃️"
+	case strings.Contains(lang, "ruby"):
+		return "💎"
+	case strings.Contains(lang, "php"):
+		return "🐘"
+	case lang == "c":
+		return "🔧"
 	default:
 		return "📄"
 	}
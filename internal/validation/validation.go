@@ -21,7 +21,7 @@ const (
 // Validation patterns
 var (
 	// Command validation - only allow specific characters
-	CommandPattern = regexp.MustCompile(`^[a-zA-Z0-9\s\-_./:@#]+$`)
+	CommandPattern = regexp.MustCompile(`^[a-zA-Z0-9\s\-_./:@#,?!'~\\]+$`)
 	
 	// Safe identifier pattern (alphanumeric, underscore, hyphen)
 	IdentifierPattern = regexp.MustCompile(`^[a-zA-Z0-9\-_]+$`)
@@ -240,6 +240,31 @@ func SanitizeInput(input string, maxLength int) string {
 	return trimmed
 }
 
+// SanitizeOutput makes model output safe to hand to renderers: byte order marks
+// are removed, invalid UTF-8 is replaced with U+FFFD, and control characters
+// other than newline and tab (including terminal escape sequences) are dropped.
+func SanitizeOutput(output string) string {
+	output = strings.ToValidUTF8(output, "\uFFFD")
+	if !strings.ContainsFunc(output, isUnsafeOutputRune) {
+		return output
+	}
+
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		if isUnsafeOutputRune(r) {
+			return -1
+		}
+		return r
+	}, output)
+}
+
+func isUnsafeOutputRune(r rune) bool {
+	if r == '\n' || r == '\t' {
+		return false
+	}
+	return r == '\uFEFF' || unicode.IsControl(r)
+}
+
 // hasExcessiveRepetition checks if input contains excessive repetition
 func hasExcessiveRepetition(input string) bool {
 	if len(input) < 10 {